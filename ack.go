@@ -0,0 +1,169 @@
+package delayqueue
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ackScript 批量确认消息：从 unack 中移除，并删除消息内容、投递历史、header 和重试次数
+// KEYS: unackKey, retryCountKey, attemptKey
+// ARGV: 消息 key 前缀, 消息ID...
+// 返回从 unack 中移除的消息ID
+const ackScript = msgFieldScript + `
+local acked = {}
+for i = 2, #ARGV do
+	local id = ARGV[i]
+	if redis.call('ZRem', KEYS[1], id) == 1 then
+		table.insert(acked, id)
+	end
+	redis.call('Del', ARGV[1] .. id, ARGV[1] .. id .. ':history', ARGV[1] .. id .. ':headers', ARGV[1] .. id .. ':owner')
+	delField(KEYS[2], id, 'retry')
+	delField(KEYS[3], id, 'attempt')
+end
+return acked
+`
+
+// nackScript 批量将 unack 中消息的处理超时时间设置为当前时间，使其在下一次 unack2Retry 中立即重试
+// KEYS: unackKey
+// ARGV: currentTime, 消息ID...
+// 返回更新的消息ID
+const nackScript = `
+local nacked = {}
+for i = 2, #ARGV do
+	if redis.call('ZScore', KEYS[1], ARGV[i]) then
+		redis.call('ZAdd', KEYS[1], ARGV[1], ARGV[i])
+		table.insert(nacked, ARGV[i])
+	end
+end
+return nacked
+`
+
+// AckMany 在一次 redis 调用中确认多条正在处理的消息，返回确认的消息数量
+func (q *DelayQueue) AckMany(ctx context.Context, ids ...string) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	refs := q.payloadRefs(ctx, ids)
+	archives := q.manualAckArchives(ctx, ids)
+	acked, err := q.broker.AckMany(ctx, ids)
+	if err != nil {
+		return 0, err
+	}
+	q.afterAck(ctx, acked, refs, archives)
+	return len(acked), nil
+}
+
+// NackMany 在一次 redis 调用中将多条正在处理的消息标记为消费失败，返回标记的消息数量
+// 消息会在下一个消费周期按重试策略重新投递，投递历史中记录的原因为 "negative ack"
+func (q *DelayQueue) NackMany(ctx context.Context, ids ...string) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	nacked, err := q.broker.NackMany(ctx, ids, q.clock.Now())
+	if err != nil {
+		return 0, err
+	}
+	q.afterNack(ctx, nacked, errNegativeAck)
+	return len(nacked), nil
+}
+
+// Ack 确认正在处理的消息，通常用于 Handler 返回 ErrAckLater 后在其它协程或进程中确认消息
+// 消息不在处理中（已确认或已超时）时返回 ErrMessageNotFound
+func (q *DelayQueue) Ack(ctx context.Context, idStr string) error {
+	refs := q.payloadRefs(ctx, []string{idStr})
+	archives := q.manualAckArchives(ctx, []string{idStr})
+	acked, err := q.broker.AckMany(ctx, []string{idStr})
+	if err != nil {
+		return err
+	}
+	if len(acked) == 0 {
+		return ErrMessageNotFound
+	}
+	q.afterAck(ctx, acked, refs, archives)
+	return nil
+}
+
+// Nack 将正在处理的消息标记为消费失败，消息会在下一个消费周期按重试策略重新投递
+// reason 为失败的原因，启用死信队列时会记录在投递历史中，为 nil 时记录为 "negative ack"
+// 消息不在处理中（已确认或已超时）时返回 ErrMessageNotFound
+func (q *DelayQueue) Nack(ctx context.Context, idStr string, reason error) error {
+	nacked, err := q.broker.NackMany(ctx, []string{idStr}, q.clock.Now())
+	if err != nil {
+		return err
+	}
+	if len(nacked) == 0 {
+		return ErrMessageNotFound
+	}
+	if reason == nil {
+		reason = errNegativeAck
+	}
+	q.afterNack(ctx, nacked, reason)
+	return nil
+}
+
+// afterAck 手动确认后对每条已确认的消息删除外部存储中的内容、写入归档，并记录状态、指标和审计日志
+func (q *DelayQueue) afterAck(ctx context.Context, acked []string, refs map[string]string, archives map[string]*ArchivedMessage) {
+	for _, idStr := range acked {
+		if ref, ok := refs[idStr]; ok {
+			q.deletePayloads(ctx, ref)
+		}
+		if archived, ok := archives[idStr]; ok {
+			q.archiveManualAck(ctx, archived)
+		}
+		q.recordStatus(ctx, idStr, StatusSucceeded, time.Time{})
+		q.debugTransition(idStr, StageUnack, StageAcked)
+	}
+	q.incCounter(MetricAcked, int64(len(acked)))
+	q.audit(ctx, AuditAck, acked...)
+}
+
+// afterNack 手动标记消费失败后对每条消息记录投递历史、状态、指标和审计日志
+func (q *DelayQueue) afterNack(ctx context.Context, nacked []string, reason error) {
+	now := q.clock.Now()
+	for _, idStr := range nacked {
+		q.recordHistory(ctx, idStr, &HistoryRecord{Time: now.Unix(), Event: HistoryNack, Error: reason.Error()})
+		q.recordStatus(ctx, idStr, StatusFailed, time.Time{})
+		q.debugLog("message nacked", "id", idStr, "error", reason)
+	}
+	q.incCounter(MetricNacked, int64(len(nacked)))
+	q.audit(ctx, AuditNack, nacked...)
+}
+
+func (b *redisBroker) Ack(ctx context.Context, idStr string) error {
+	_, err := b.AckMany(ctx, []string{idStr})
+	return err
+}
+
+func (b *redisBroker) AckMany(ctx context.Context, ids []string) ([]string, error) {
+	q := b.q
+	args := make([]interface{}, 0, len(ids)+1)
+	args = append(args, q.genMsgKey(""))
+	for _, idStr := range ids {
+		args = append(args, idStr)
+	}
+	ret, err := q.eval(ctx, ackScript, []string{q.unAckKey, q.retryCountKey, q.attemptKey}, args...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("ack script failed: %v", err)
+	}
+	return scriptIDs(ret), nil
+}
+
+func (b *redisBroker) Nack(ctx context.Context, idStr string, now time.Time) error {
+	_, err := b.NackMany(ctx, []string{idStr}, now)
+	return err
+}
+
+func (b *redisBroker) NackMany(ctx context.Context, ids []string, now time.Time) ([]string, error) {
+	q := b.q
+	args := make([]interface{}, 0, len(ids)+1)
+	args = append(args, now.Unix())
+	for _, idStr := range ids {
+		args = append(args, idStr)
+	}
+	ret, err := q.eval(ctx, nackScript, []string{q.unAckKey}, args...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("negative ack failed: %v", err)
+	}
+	return scriptIDs(ret), nil
+}
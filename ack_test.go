@@ -0,0 +1,157 @@
+package delayqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_AckMany(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	})
+	size := 5
+	for i := 0; i < size; i++ {
+		if err := queue.SendDelayMsg("hello", 0); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if _, err := queue.pending2Ready(); err != nil {
+		t.Error(err)
+		return
+	}
+	ids, err := queue.fetch(queue.ready2Unack, 0)
+	if err != nil || len(ids) != size {
+		t.Errorf("fetch failed: %v, %d", err, len(ids))
+		return
+	}
+	n, err := queue.AckMany(ctx, ids[0], ids[1], ids[2], "not-exist")
+	if err != nil || n != 3 {
+		t.Errorf("unexpected ack result: %d, %v", n, err)
+	}
+	n, err = queue.NackMany(ctx, ids[3:]...)
+	if err != nil || n != 2 {
+		t.Errorf("unexpected nack result: %d, %v", n, err)
+	}
+	for _, idStr := range ids[:3] {
+		if _, err := queue.GetMessage(ctx, idStr); err != ErrMessageNotFound {
+			t.Errorf("expect acked message %s removed, actual: %v", idStr, err)
+		}
+	}
+	retried, _, err := queue.broker.Unack2Retry(ctx, queue.clock.Now())
+	if err != nil || retried != 2 {
+		t.Errorf("expect nacked messages retried: %d, %v", retried, err)
+	}
+}
+
+func TestDelayQueue_AckManyStatusHistory(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	}).WithStatusTracking(time.Hour).WithDeadLetter(time.Hour)
+	for i := 0; i < 4; i++ {
+		if err := queue.SendDelayMsg("hello", 0); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if _, err := queue.pending2Ready(); err != nil {
+		t.Error(err)
+		return
+	}
+	ids, err := queue.fetch(queue.ready2Unack, 0)
+	if err != nil || len(ids) != 4 {
+		t.Errorf("fetch failed: %v, %d", err, len(ids))
+		return
+	}
+	// 批量确认与逐条确认记录相同的状态及投递历史
+	if _, err := queue.AckMany(ctx, ids[0], "not-exist"); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := queue.Ack(ctx, ids[1]); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := queue.NackMany(ctx, ids[2]); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := queue.Nack(ctx, ids[3], nil); err != nil {
+		t.Error(err)
+		return
+	}
+	for i, expect := range []JobStatus{StatusSucceeded, StatusSucceeded, StatusFailed, StatusFailed} {
+		status, err := queue.GetStatus(ctx, ids[i])
+		if err != nil || status.Status != expect {
+			t.Errorf("expect status %s of message %d, actual %+v, err: %v", expect, i, status, err)
+		}
+	}
+	if _, err := queue.GetStatus(ctx, "not-exist"); err != ErrMessageNotFound {
+		t.Errorf("expect no status for message not in unack, actual: %v", err)
+	}
+	for _, idStr := range ids[2:] {
+		history, err := queue.GetHistory(ctx, idStr)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(history) == 0 {
+			t.Errorf("expect nack recorded in history of %s", idStr)
+			continue
+		}
+		last := history[len(history)-1]
+		if last.Event != HistoryNack || last.Error != errNegativeAck.Error() {
+			t.Errorf("expect nack recorded in history of %s, actual: %+v", idStr, last)
+		}
+	}
+}
+
+func TestDelayQueue_AckLater(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	pipeline := make(chan string, 10)
+	queue := NewDelayQueueWithHandler("test", redisCli, func(ctx context.Context, msg *Message) error {
+		pipeline <- msg.ID
+		return ErrAckLater
+	})
+	for i := 0; i < 2; i++ {
+		if err := queue.SendDelayMsg("hello", 0); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	flow, err := queue.ProcessOnce()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if flow.Ready2Unack != 2 || flow.Unack2Ack != 0 {
+		t.Errorf("unexpected flow: %+v", flow)
+	}
+	acked, nacked := <-pipeline, <-pipeline
+	if err := queue.Ack(ctx, acked); err != nil {
+		t.Error(err)
+	}
+	if err := queue.Ack(ctx, acked); err != ErrMessageNotFound {
+		t.Errorf("expect ErrMessageNotFound, actual: %v", err)
+	}
+	if err := queue.Nack(ctx, nacked, nil); err != nil {
+		t.Error(err)
+	}
+	flow, err = queue.ProcessOnce()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if flow.Unack2Retry != 1 || flow.Retry2Unack != 1 {
+		t.Errorf("expect nacked message retried, flow: %+v", flow)
+	}
+	if <-pipeline != nacked {
+		t.Error("expect nacked message delivered again")
+	}
+}
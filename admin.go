@@ -0,0 +1,192 @@
+package delayqueue
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// adminHandler 队列管理的 HTTP 接口
+type adminHandler struct {
+	q *DelayQueue
+}
+
+// NewAdminHandler 创建队列管理的 HTTP 接口，所有接口均返回 JSON
+//
+//	GET    /stats          查询各阶段的消息数量
+//	GET    /health         查询队列的健康状态，不健康时返回 503
+//	GET    /messages       分页查询消息，参数 state、cursor、count，参见 DelayQueue.List
+//	GET    /messages/{id}  查询消息
+//	DELETE /messages/{id}  取消消息
+//	GET    /dead           分页查询死信消息及其投递历史，参数 cursor、count
+//	POST   /dead/requeue   重新投递死信消息，请求体 {"ids": [...]}，ids 为空时重新投递所有死信消息
+//	POST   /pause          暂停所有实例的消息投递
+//	POST   /resume         恢复所有实例的消息投递
+//	POST   /purge          清空队列
+//
+// 挂载到子路径时请配合 http.StripPrefix 使用，例如：
+//
+//	mux.Handle("/admin/queue/", http.StripPrefix("/admin/queue", delayqueue.NewAdminHandler(queue)))
+func NewAdminHandler(q *DelayQueue) http.Handler {
+	return &adminHandler{q: q}
+}
+
+func (h *adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	switch {
+	case path == "stats":
+		h.handle(w, r, http.MethodGet, h.stats)
+	case path == "health":
+		if r.Method != http.MethodGet {
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		status := h.q.Health(r.Context())
+		code := http.StatusOK
+		if !status.Healthy {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, status)
+	case path == "messages":
+		h.handle(w, r, http.MethodGet, h.list)
+	case strings.HasPrefix(path, "messages/"):
+		id := strings.TrimPrefix(path, "messages/")
+		if r.Method == http.MethodDelete {
+			h.handle(w, r, http.MethodDelete, func(r *http.Request) (interface{}, error) {
+				return nil, h.q.Cancel(r.Context(), id)
+			})
+			return
+		}
+		h.handle(w, r, http.MethodGet, func(r *http.Request) (interface{}, error) {
+			return h.q.GetMessage(r.Context(), id)
+		})
+	case path == "dead":
+		h.handle(w, r, http.MethodGet, h.listDead)
+	case path == "dead/requeue":
+		h.handle(w, r, http.MethodPost, h.requeueDead)
+	case path == "pause":
+		h.handle(w, r, http.MethodPost, func(r *http.Request) (interface{}, error) {
+			return nil, h.q.PauseAll(r.Context())
+		})
+	case path == "resume":
+		h.handle(w, r, http.MethodPost, func(r *http.Request) (interface{}, error) {
+			return nil, h.q.ResumeAll(r.Context())
+		})
+	case path == "purge":
+		h.handle(w, r, http.MethodPost, func(r *http.Request) (interface{}, error) {
+			return nil, h.q.Purge(r.Context())
+		})
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not found"})
+	}
+}
+
+// handle 检查请求方法，执行 fn 并将结果写为 JSON
+func (h *adminHandler) handle(w http.ResponseWriter, r *http.Request, method string, fn func(*http.Request) (interface{}, error)) {
+	if r.Method != method {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	ret, err := fn(r)
+	if err != nil {
+		writeJSON(w, errorStatus(err), map[string]string{"error": err.Error()})
+		return
+	}
+	if ret == nil {
+		ret = map[string]bool{"ok": true}
+	}
+	writeJSON(w, http.StatusOK, ret)
+}
+
+func (h *adminHandler) stats(r *http.Request) (interface{}, error) {
+	return h.q.Stats(r.Context())
+}
+
+type listResponse struct {
+	Messages []*MessageInfo `json:"messages"`
+	Next     string         `json:"next"`
+}
+
+func (h *adminHandler) list(r *http.Request) (interface{}, error) {
+	query := r.URL.Query()
+	count, _ := strconv.ParseInt(query.Get("count"), 10, 64)
+	msgs, next, err := h.q.List(r.Context(), query.Get("state"), query.Get("cursor"), count)
+	if err != nil {
+		return nil, listError(err)
+	}
+	if msgs == nil {
+		msgs = []*MessageInfo{}
+	}
+	return &listResponse{Messages: msgs, Next: next}, nil
+}
+
+// listError 参数不合法的错误返回 400，其余错误（如 redis 故障）返回 500
+func listError(err error) error {
+	if errors.Is(err, ErrInvalidCursor) || errors.Is(err, ErrUnknownState) {
+		return &badRequestError{err}
+	}
+	return err
+}
+
+type listDeadResponse struct {
+	Messages []*DeadMessage `json:"messages"`
+	Next     string         `json:"next"`
+}
+
+func (h *adminHandler) listDead(r *http.Request) (interface{}, error) {
+	query := r.URL.Query()
+	count, _ := strconv.ParseInt(query.Get("count"), 10, 64)
+	msgs, next, err := h.q.ListDead(r.Context(), query.Get("cursor"), count)
+	if err != nil {
+		return nil, listError(err)
+	}
+	return &listDeadResponse{Messages: msgs, Next: next}, nil
+}
+
+type requeueRequest struct {
+	IDs []string `json:"ids"`
+}
+
+func (h *adminHandler) requeueDead(r *http.Request) (interface{}, error) {
+	req := requeueRequest{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, &badRequestError{err}
+		}
+	}
+	n, err := h.q.RequeueDead(r.Context(), req.IDs...)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]int{"requeued": n}, nil
+}
+
+// badRequestError 请求参数错误
+type badRequestError struct {
+	err error
+}
+
+func (e *badRequestError) Error() string {
+	return "bad request: " + e.err.Error()
+}
+
+func errorStatus(err error) int {
+	var badRequest *badRequestError
+	switch {
+	case errors.Is(err, ErrMessageNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrQueueDeleted):
+		return http.StatusGone
+	case errors.As(err, &badRequest):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,113 @@
+package delayqueue
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestAdminHandler(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return false
+	}).WithDeadLetter(time.Hour).WithMaxConsumeDuration(0)
+	handler := NewAdminHandler(queue)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	msg, err := queue.SendDelayMsgV2("hello", time.Hour)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	rec := do(http.MethodGet, "/messages/"+msg.ID, "")
+	info := &MessageInfo{}
+	if err := json.NewDecoder(rec.Body).Decode(info); err != nil {
+		t.Error(err)
+		return
+	}
+	if rec.Code != http.StatusOK || info.Payload != "hello" || info.State != StagePending {
+		t.Errorf("unexpected message: %d %+v", rec.Code, info)
+	}
+	if rec := do(http.MethodDelete, "/messages/"+msg.ID, ""); rec.Code != http.StatusOK {
+		t.Errorf("cancel failed: %s", rec.Body.String())
+	}
+	if rec := do(http.MethodGet, "/messages/"+msg.ID, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expect 404 after cancel, actual %d", rec.Code)
+	}
+
+	// 重试次数耗尽后进入死信队列
+	msg, err = queue.SendDelayMsgV2("dead", 0, WithRetryCount(0))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err := queue.consume(); err != nil {
+		t.Errorf("consume error: %v", err)
+		return
+	}
+	stats := &QueueStats{}
+	rec = do(http.MethodGet, "/stats", "")
+	if err := json.NewDecoder(rec.Body).Decode(stats); err != nil {
+		t.Error(err)
+		return
+	}
+	if stats.Dead != 1 {
+		t.Errorf("expect 1 dead message, actual %+v", stats)
+	}
+	rec = do(http.MethodPost, "/dead/requeue", `{"ids":["`+msg.ID+`"]}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"requeued":1`) {
+		t.Errorf("requeue failed: %s", rec.Body.String())
+	}
+	info, err = queue.GetMessage(ctx, msg.ID)
+	if err != nil || info.State != StageReady {
+		t.Errorf("expect message ready after requeue, actual %+v %v", info, err)
+	}
+
+	if rec := do(http.MethodGet, "/messages?state=unknown", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("expect 400 for unknown state, actual %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/messages?state=pending&cursor=bad", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("expect 400 for invalid cursor, actual %d", rec.Code)
+	}
+
+	if rec := do(http.MethodPost, "/pause", ""); rec.Code != http.StatusOK {
+		t.Errorf("pause failed: %s", rec.Body.String())
+	}
+	if paused, _ := queue.IsPaused(ctx); !paused {
+		t.Error("expect queue paused")
+	}
+	if rec := do(http.MethodPost, "/purge", ""); rec.Code != http.StatusOK {
+		t.Errorf("purge failed: %s", rec.Body.String())
+	}
+	if rec := do(http.MethodGet, "/purge", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expect 405, actual %d", rec.Code)
+	}
+}
+
+func TestAdminHandler_ListRedisError(t *testing.T) {
+	redisCli := redis.NewClient(&redis.Options{
+		Addr: "127.0.0.1:6379",
+	})
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	})
+	handler := NewAdminHandler(queue)
+	redisCli.Close()
+	// redis 故障不是请求参数的问题，应返回 500
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/messages?state=pending", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expect 500, actual %d: %s", rec.Code, rec.Body.String())
+	}
+}
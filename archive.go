@@ -0,0 +1,236 @@
+package delayqueue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 归档消息的处理结果
+const (
+	OutcomeAcked     = "acked"     // 消息被确认
+	OutcomeFailed    = "failed"    // 最后一次投递处理失败
+	OutcomeExpired   = "expired"   // 超过最晚投递时间
+	OutcomePoisoned  = "poisoned"  // 被识别为毒消息并隔离
+	OutcomePermanent = "permanent" // 消费者返回永久错误
+)
+
+// 归档的种类，失败归档包含 OutcomeFailed、OutcomeExpired、OutcomePoisoned 和 OutcomePermanent 的消息
+const (
+	archiveAcked  = "acked"
+	archiveFailed = "failed"
+)
+
+// ArchivedMessage 归档的消息
+type ArchivedMessage struct {
+	ID      string            `json:"id"`
+	Payload string            `json:"payload"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Outcome 处理结果，如 OutcomeAcked
+	Outcome string `json:"outcome"`
+	// Attempt 第几次投递时得到该结果
+	Attempt int `json:"attempt"`
+	// DeliveredAt 最后一次投递给 Handler 的时间
+	DeliveredAt time.Time `json:"deliveredAt"`
+	// FinishedAt 得到处理结果的时间
+	FinishedAt time.Time `json:"finishedAt"`
+	// Cost 最后一次处理的耗时
+	Cost time.Duration `json:"cost"`
+	// LastError 最后一次处理失败的原因，仅失败归档有效
+	LastError string `json:"lastError,omitempty"`
+	// History 投递历史，启用 WithHistory 或死信队列时有效，仅失败归档有效
+	History []*HistoryRecord `json:"history,omitempty"`
+}
+
+// archiveConfig 归档的保留时间和数量上限
+type archiveConfig struct {
+	kind      string
+	retention time.Duration
+	maxLen    int64
+}
+
+// WithAckArchive 将确认的消息（内容、header、投递次数及耗时）保存到归档中，用于事后查询消息是否已被处理
+// 归档保留 retention，maxLen 大于 0 时最多保留最近的 maxLen 条，写入新的归档时清理过期及超出数量的归档；
+// 通过 Ack、AckMany 确认（ErrAckLater）的消息同样归档，投递时间取自投递历史中最后一次投递的记录，
+// 未启用投递历史时投递时间和耗时为零值；仅支持 redis，写入失败时只输出日志
+func (q *DelayQueue) WithAckArchive(retention time.Duration, maxLen int64) *DelayQueue {
+	if q.frozen("WithAckArchive") {
+		return q
+	}
+	if q.redisCli == nil {
+		q.invalidOption("WithAckArchive", "ack archive requires redis")
+		return q
+	}
+	q.ackArchive = &archiveConfig{kind: archiveAcked, retention: retention, maxLen: maxLen}
+	return q
+}
+
+// genArchiveKey hash 存储归档的消息，消息ID -> ArchivedMessage 的 JSON
+func (q *DelayQueue) genArchiveKey(kind string) string {
+	return q.keyBase(q.baseName) + ":archive:" + kind
+}
+
+// genArchiveIndexKey sorted set 按得到处理结果的时间（unix 毫秒）索引归档的消息
+func (q *DelayQueue) genArchiveIndexKey(kind string) string {
+	return q.genArchiveKey(kind) + ":index"
+}
+
+// archiveScript 写入一条归档，并删除早于 minScore 及超出数量上限的归档
+// KEYS: archiveKey, indexKey
+// ARGV: 消息ID, 归档内容, 当前时间(毫秒), minScore, maxLen, 保留时间(毫秒)
+const archiveScript = `
+redis.call('HSet', KEYS[1], ARGV[1], ARGV[2])
+redis.call('ZAdd', KEYS[2], ARGV[3], ARGV[1])
+local removed = redis.call('ZRangeByScore', KEYS[2], '-inf', '(' .. ARGV[4])
+local maxLen = tonumber(ARGV[5])
+if maxLen > 0 then
+	local over = redis.call('ZCard', KEYS[2]) - maxLen
+	if over > #removed then removed = redis.call('ZRange', KEYS[2], 0, over - 1) end
+end
+if #removed > 0 then
+	redis.call('HDel', KEYS[1], unpack(removed))
+	redis.call('ZRem', KEYS[2], unpack(removed))
+end
+redis.call('PExpire', KEYS[1], ARGV[6])
+redis.call('PExpire', KEYS[2], ARGV[6])
+`
+
+// archive 写入归档，cfg 为 nil 时不归档
+func (q *DelayQueue) archive(ctx context.Context, cfg *archiveConfig, msg *ArchivedMessage) {
+	if cfg == nil {
+		return
+	}
+	record, err := json.Marshal(msg)
+	if err != nil {
+		q.logger.Error("marshal archive failed", "queue", q.name, "id", msg.ID, "error", err)
+		return
+	}
+	now := q.clock.Now().UnixNano() / int64(time.Millisecond)
+	retention := cfg.retention.Milliseconds()
+	keys := []string{q.genArchiveKey(cfg.kind), q.genArchiveIndexKey(cfg.kind)}
+	err = q.eval(ctx, archiveScript, keys, msg.ID, record, now, now-retention, cfg.maxLen, retention).Err()
+	if err != nil && err != redis.Nil {
+		q.logger.Error("archive message failed", "queue", q.name, "id", msg.ID, "outcome", msg.Outcome, "error", err)
+	}
+}
+
+// archiveAcked 归档确认的消息
+func (q *DelayQueue) archiveAcked(ctx context.Context, msg *Message, deliveredAt time.Time) {
+	if q.ackArchive == nil {
+		return
+	}
+	now := q.clock.Now()
+	q.archive(ctx, q.ackArchive, &ArchivedMessage{
+		ID:          msg.ID,
+		Payload:     msg.Payload,
+		Headers:     msg.Headers,
+		Outcome:     OutcomeAcked,
+		Attempt:     msg.Attempt,
+		DeliveredAt: deliveredAt,
+		FinishedAt:  now,
+		Cost:        now.Sub(deliveredAt),
+	})
+}
+
+// manualAckArchives 在 Ack、AckMany 删除消息之前读取需要归档的消息，未启用 WithAckArchive 时返回 nil
+func (q *DelayQueue) manualAckArchives(ctx context.Context, ids []string) map[string]*ArchivedMessage {
+	if q.ackArchive == nil {
+		return nil
+	}
+	archives := make(map[string]*ArchivedMessage, len(ids))
+	for _, idStr := range ids {
+		msg, err := q.broker.Message(ctx, idStr)
+		if err != nil {
+			continue
+		}
+		if err := q.loadPayload(ctx, msg); err != nil {
+			q.logger.Error("load archived payload failed", "queue", q.name, "id", idStr, "error", err)
+		}
+		archived := &ArchivedMessage{
+			ID:      idStr,
+			Payload: msg.Payload,
+			Headers: msg.Headers,
+			Outcome: OutcomeAcked,
+			Attempt: msg.Attempt,
+		}
+		records, _ := q.GetHistory(ctx, idStr)
+		archived.DeliveredAt = lastDelivered(records)
+		archives[idStr] = archived
+	}
+	return archives
+}
+
+// archiveManualAck 归档通过 Ack、AckMany 确认的消息
+func (q *DelayQueue) archiveManualAck(ctx context.Context, archived *ArchivedMessage) {
+	archived.FinishedAt = q.clock.Now()
+	if !archived.DeliveredAt.IsZero() {
+		archived.Cost = archived.FinishedAt.Sub(archived.DeliveredAt)
+	}
+	q.archive(ctx, q.ackArchive, archived)
+}
+
+// GetArchived 查询归档中已确认的消息，不存在或已过期时返回 ErrMessageNotFound
+func (q *DelayQueue) GetArchived(ctx context.Context, idStr string) (*ArchivedMessage, error) {
+	return q.getArchived(ctx, archiveAcked, idStr)
+}
+
+// ListArchived 按确认时间顺序返回 [from, to] 之间归档的消息，count 大于 0 时最多返回 count 条
+func (q *DelayQueue) ListArchived(ctx context.Context, from, to time.Time, count int64) ([]*ArchivedMessage, error) {
+	return q.listArchived(ctx, archiveAcked, from, to, count)
+}
+
+func (q *DelayQueue) getArchived(ctx context.Context, kind, idStr string) (*ArchivedMessage, error) {
+	if err := q.requireRedis("archive"); err != nil {
+		return nil, err
+	}
+	record, err := q.redisCli.HGet(ctx, q.genArchiveKey(kind), idStr).Result()
+	if err == redis.Nil {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get archive failed: %v", err)
+	}
+	msg := &ArchivedMessage{}
+	if err := json.Unmarshal([]byte(record), msg); err != nil {
+		return nil, fmt.Errorf("unmarshal archive failed: %v", err)
+	}
+	return msg, nil
+}
+
+func (q *DelayQueue) listArchived(ctx context.Context, kind string, from, to time.Time, count int64) ([]*ArchivedMessage, error) {
+	if err := q.requireRedis("archive"); err != nil {
+		return nil, err
+	}
+	ids, err := q.redisCli.ZRangeByScore(ctx, q.genArchiveIndexKey(kind), &redis.ZRangeBy{
+		Min:   strconv.FormatInt(from.UnixNano()/int64(time.Millisecond), 10),
+		Max:   strconv.FormatInt(to.UnixNano()/int64(time.Millisecond), 10),
+		Count: count,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("list archive failed: %v", err)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	records, err := q.redisCli.HMGet(ctx, q.genArchiveKey(kind), ids...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("get archive failed: %v", err)
+	}
+	msgs := make([]*ArchivedMessage, 0, len(records))
+	for _, record := range records {
+		str, ok := record.(string)
+		if !ok {
+			continue
+		}
+		msg := &ArchivedMessage{}
+		if err := json.Unmarshal([]byte(str), msg); err != nil {
+			return nil, fmt.Errorf("unmarshal archive failed: %v", err)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
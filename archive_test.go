@@ -0,0 +1,127 @@
+package delayqueue
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_AckArchive(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return s != "fail"
+	}).WithAckArchive(24*time.Hour, 3).WithDefaultRetryCount(0)
+	var ids []string
+	for i := 0; i < 4; i++ {
+		msg, err := queue.SendDelayMsgV2(strconv.Itoa(i), 0, WithHeader("index", strconv.Itoa(i)))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		ids = append(ids, msg.ID)
+		if _, err := queue.ProcessOnce(); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	failed, err := queue.SendDelayMsgV2("fail", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	archived, err := queue.GetArchived(ctx, ids[3])
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if archived.Payload != "3" || archived.Outcome != OutcomeAcked || archived.Attempt != 1 ||
+		archived.Headers["index"] != "3" || archived.FinishedAt.Before(archived.DeliveredAt) {
+		t.Errorf("unexpected archive: %+v", archived)
+	}
+	// 超出数量上限的最早的归档被删除，处理失败的消息不归档
+	for _, id := range []string{ids[0], failed.ID} {
+		if _, err := queue.GetArchived(ctx, id); err != ErrMessageNotFound {
+			t.Errorf("expect ErrMessageNotFound for %s, actual %v", id, err)
+		}
+	}
+	msgs, err := queue.ListArchived(ctx, time.Now().Add(-time.Minute), time.Now().Add(time.Minute), 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	listed := make(map[string]bool)
+	for _, msg := range msgs {
+		listed[msg.ID] = true
+	}
+	if len(msgs) != 3 || !listed[ids[1]] || !listed[ids[2]] || !listed[ids[3]] {
+		t.Errorf("unexpected archive list: %d", len(msgs))
+	}
+	msgs, err = queue.ListArchived(ctx, time.Now().Add(-time.Hour), time.Now().Add(-time.Minute), 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(msgs) != 0 {
+		t.Errorf("expect no archive before from, actual %d", len(msgs))
+	}
+	ttl, err := redisCli.PTTL(ctx, queue.genArchiveKey(archiveAcked)).Result()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if ttl <= 23*time.Hour {
+		t.Errorf("unexpected archive ttl: %v", ttl)
+	}
+}
+
+func TestDelayQueue_AckArchiveManual(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	var delivered []string
+	queue := NewDelayQueueWithHandler("test", redisCli, func(ctx context.Context, msg *Message) error {
+		delivered = append(delivered, msg.ID)
+		return ErrAckLater
+	}).WithAckArchive(24*time.Hour, 0).WithHistory()
+	for i := 0; i < 3; i++ {
+		if err := queue.SendDelayMsg(strconv.Itoa(i), 0, WithHeader("index", strconv.Itoa(i))); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(delivered) != 3 {
+		t.Errorf("expect 3 deliveries, actual %d", len(delivered))
+		return
+	}
+	if _, err := queue.GetArchived(ctx, delivered[0]); err != ErrMessageNotFound {
+		t.Errorf("expect ErrMessageNotFound before ack, actual %v", err)
+	}
+	if err := queue.Ack(ctx, delivered[0]); err != nil {
+		t.Error(err)
+		return
+	}
+	if n, err := queue.AckMany(ctx, delivered[1:]...); err != nil || n != 2 {
+		t.Errorf("expect 2 acked, actual %d, %v", n, err)
+		return
+	}
+	for _, id := range delivered {
+		archived, err := queue.GetArchived(ctx, id)
+		if err != nil {
+			t.Errorf("expect %s archived, actual %v", id, err)
+			continue
+		}
+		if archived.Outcome != OutcomeAcked || archived.Attempt != 1 || archived.Headers["index"] != archived.Payload ||
+			archived.DeliveredAt.IsZero() || archived.FinishedAt.Before(archived.DeliveredAt) {
+			t.Errorf("unexpected archive: %+v", archived)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package delayqueue
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 审计流中的事件
+const (
+	AuditSend    = "send"    // 消息被发送
+	AuditDeliver = "deliver" // 消息被投递给 Handler
+	AuditAck     = "ack"     // 消息被确认
+	AuditNack    = "nack"    // 消息处理失败
+	AuditDead    = "dead"    // 最后一次投递处理失败或超过最晚投递时间，不再重试
+	AuditCancel  = "cancel"  // 消息被取消
+)
+
+// genAuditKey stream 存储审计事件
+func (q *DelayQueue) genAuditKey() string {
+	return q.keyBase(q.baseName) + ":audit"
+}
+
+// WithAuditStream 将消息的发送、投递、确认、失败、死亡及取消事件追加到 redis stream {prefix}{name}:audit 中，
+// 每条事件包含 event、id、actor（消费者ID，参见 WithConsumerID）及 time（unix 毫秒），用于合规审计和离线分析
+// maxLen 大于 0 时按近似长度裁剪 stream；处理超时后达到重试上限的消息不会记录 dead 事件
+// 仅支持 redis，写入失败时只输出日志
+func (q *DelayQueue) WithAuditStream(maxLen int64) *DelayQueue {
+	if q.frozen("WithAuditStream") {
+		return q
+	}
+	q.auditEnabled = true
+	q.auditMaxLen = maxLen
+	return q
+}
+
+// audit 将事件追加到审计流
+func (q *DelayQueue) audit(ctx context.Context, event string, ids ...string) {
+	if !q.auditEnabled || q.redisCli == nil || len(ids) == 0 {
+		return
+	}
+	now := strconv.FormatInt(q.clock.Now().UnixNano()/1e6, 10)
+	pipe := q.redisCli.Pipeline()
+	for _, idStr := range ids {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: q.genAuditKey(),
+			MaxLen: q.auditMaxLen,
+			Approx: q.auditMaxLen > 0,
+			Values: []interface{}{"event", event, "id", idStr, "actor", q.consumerID, "time", now},
+		})
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		q.logger.Error("append audit event failed", "queue", q.name, "event", event, "error", err)
+	}
+}
@@ -0,0 +1,60 @@
+package delayqueue
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_AuditStream(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return s == "ok"
+	}).WithDefaultRetryCount(0).WithConsumerID("pod-1").WithAuditStream(100)
+	ok, err := queue.SendDelayMsgV2("ok", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	fail, err := queue.SendDelayMsgV2("fail", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	cancelled, err := queue.SendDelayMsgV2("cancelled", time.Hour)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err := queue.Cancel(ctx, cancelled.ID); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	entries, err := redisCli.XRange(ctx, queue.genAuditKey(), "-", "+").Result()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	events := make(map[string][]string)
+	for _, entry := range entries {
+		if entry.Values["actor"] != "pod-1" || entry.Values["time"] == "" {
+			t.Errorf("unexpected entry: %+v", entry.Values)
+		}
+		id := entry.Values["id"].(string)
+		events[id] = append(events[id], entry.Values["event"].(string))
+	}
+	expect := map[string][]string{
+		ok.ID:        {AuditSend, AuditDeliver, AuditAck},
+		fail.ID:      {AuditSend, AuditDeliver, AuditNack, AuditDead},
+		cancelled.ID: {AuditSend, AuditCancel},
+	}
+	if !reflect.DeepEqual(events, expect) {
+		t.Errorf("unexpected events: %v", events)
+	}
+}
@@ -0,0 +1,47 @@
+package delayqueue
+
+import (
+	"context"
+	"fmt"
+)
+
+// WithMaxUnack 配置 unack 中消息数量的上限，为 0 表示不限制
+// unack 中的消息达到上限后暂停拉取新消息，待消费者确认后再恢复，
+// 避免消费缓慢时 unack 无限增长并在之后集中重试
+func (q *DelayQueue) WithMaxUnack(n uint) *DelayQueue {
+	if q.frozen("WithMaxUnack") {
+		return q
+	}
+	q.maxUnack = n
+	return q
+}
+
+// backpressureLimit 根据 unack 中的消息数量调整单次拉取的数量
+// 返回 false 表示 unack 已满，本次不拉取消息
+func (q *DelayQueue) backpressureLimit(limit uint) (uint, bool, error) {
+	if q.maxUnack == 0 {
+		return limit, true, nil
+	}
+	stats, err := q.broker.Stats(context.Background())
+	if err != nil {
+		return 0, false, fmt.Errorf("get unack size failed: %v", err)
+	}
+	n := stats.Unack
+	throttled := n >= int64(q.maxUnack)
+	if throttled != q.throttled {
+		q.throttled = throttled
+		if throttled {
+			q.logger.Warn("pause fetching", "queue", q.name, "unack", n)
+		} else {
+			q.logger.Info("resume fetching", "queue", q.name, "unack", n)
+		}
+	}
+	if throttled {
+		return 0, false, nil
+	}
+	room := uint(int64(q.maxUnack) - n)
+	if limit == 0 || limit > room {
+		limit = room
+	}
+	return limit, true, nil
+}
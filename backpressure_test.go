@@ -0,0 +1,44 @@
+package delayqueue
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_MaxUnack(t *testing.T) {
+	redisCli := newTestRedis(t)
+	size := 10
+	received := 0
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		received++
+		return false
+	}).WithMaxUnack(4).WithMaxConsumeDuration(time.Hour)
+	for i := 0; i < size; i++ {
+		err := queue.SendDelayMsg(strconv.Itoa(i), 0)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	// nack 的消息会立即进入 retry，为了让消息停留在 unack 中，直接取出而不回调
+	limit, ok, err := queue.backpressureLimit(0)
+	if err != nil || !ok || limit != 4 {
+		t.Errorf("expect limit 4, actual %d %v %v", limit, ok, err)
+		return
+	}
+	if _, err := queue.pending2Ready(); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := queue.fetch(queue.ready2Unack, limit); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := queue.consume(); err != nil {
+		t.Errorf("consume error: %v", err)
+		return
+	}
+	if received != 0 {
+		t.Errorf("expect no delivery when unack is full, actual %d", received)
+	}
+}
@@ -0,0 +1,115 @@
+package delayqueue
+
+import (
+	"sync"
+	"time"
+)
+
+// BreakerState 熔断器的状态
+type BreakerState int
+
+const (
+	// BreakerClosed 正常投递
+	BreakerClosed BreakerState = iota
+	// BreakerOpen 连续失败次数达到阈值，冷却期间暂停投递
+	BreakerOpen
+	// BreakerHalfOpen 冷却结束，每个消费周期只投递一条消息用于探测，成功后恢复正常投递，失败后重新熔断
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker 统计 Handler 连续失败的次数，回调可能并发执行，所有字段都需要加锁访问
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold uint
+	coolDown  time.Duration
+	failures  uint
+	state     BreakerState
+	openUntil time.Time
+}
+
+// WithCircuitBreaker 启用熔断器，Handler 连续失败 threshold 次后暂停投递 coolDown 时间，
+// 避免下游服务不可用时所有消息很快耗尽重试次数。冷却结束后每个消费周期只投递一条消息，成功后恢复正常投递
+// 熔断器状态变化时会触发 BreakerOpenEvent、BreakerHalfOpenEvent 和 BreakerClosedEvent 事件
+func (q *DelayQueue) WithCircuitBreaker(threshold uint, coolDown time.Duration) *DelayQueue {
+	if q.frozen("WithCircuitBreaker") {
+		return q
+	}
+	if threshold == 0 {
+		q.circuit = nil
+		return q
+	}
+	q.circuit = &circuitBreaker{threshold: threshold, coolDown: coolDown}
+	return q
+}
+
+// BreakerState 返回熔断器当前的状态，未启用熔断器时返回 BreakerClosed
+func (q *DelayQueue) BreakerState() BreakerState {
+	if q.circuit == nil {
+		return BreakerClosed
+	}
+	q.circuit.mu.Lock()
+	defer q.circuit.mu.Unlock()
+	return q.circuit.state
+}
+
+// breakerAllow 返回本次消费周期是否可以投递消息，冷却结束时进入半开状态
+func (q *DelayQueue) breakerAllow(now time.Time) bool {
+	b := q.circuit
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	if b.state == BreakerOpen && !now.Before(b.openUntil) {
+		b.state = BreakerHalfOpen
+		b.mu.Unlock()
+		q.logger.Info("circuit breaker half-open", "queue", q.name)
+		q.emit(BreakerHalfOpenEvent, 0)
+		return true
+	}
+	allow := b.state != BreakerOpen
+	b.mu.Unlock()
+	return allow
+}
+
+// breakerRecord 记录一次 Handler 的处理结果
+func (q *DelayQueue) breakerRecord(success bool) {
+	b := q.circuit
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	if success {
+		b.failures = 0
+		closed := b.state != BreakerClosed
+		b.state = BreakerClosed
+		b.mu.Unlock()
+		if closed {
+			q.logger.Info("circuit breaker closed", "queue", q.name)
+			q.emit(BreakerClosedEvent, 0)
+		}
+		return
+	}
+	b.failures++
+	failures := b.failures
+	opened := b.state == BreakerHalfOpen || (b.state == BreakerClosed && failures >= b.threshold)
+	if opened {
+		b.state = BreakerOpen
+		b.openUntil = q.clock.Now().Add(b.coolDown)
+	}
+	b.mu.Unlock()
+	if opened {
+		q.logger.Warn("circuit breaker open", "queue", q.name, "failures", failures)
+		q.emit(BreakerOpenEvent, int(failures))
+	}
+}
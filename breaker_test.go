@@ -0,0 +1,56 @@
+package delayqueue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_CircuitBreaker(t *testing.T) {
+	fail := true
+	delivered := 0
+	recorder := &eventRecorder{}
+	queue := NewMemoryQueue("test", func(s string) bool {
+		delivered++
+		return !fail
+	}).WithFetchLimit(1).WithCircuitBreaker(2, 100*time.Millisecond).WithEventListener(recorder)
+	for i := 0; i < 5; i++ {
+		if err := queue.SendDelayMsg("hello", 0); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	if queue.BreakerState() != BreakerOpen || delivered != 2 {
+		t.Errorf("expect breaker open after 2 failures, state: %s, delivered: %d", queue.BreakerState(), delivered)
+	}
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	if delivered != 2 {
+		t.Errorf("expect no delivery while breaker open, delivered: %d", delivered)
+	}
+	time.Sleep(150 * time.Millisecond)
+	fail = false
+	flow, err := queue.ProcessOnce()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if flow.Ready2Unack != 1 || queue.BreakerState() != BreakerClosed {
+		t.Errorf("expect one probe delivery and breaker closed, flow: %+v, state: %s", flow, queue.BreakerState())
+	}
+	expect := []EventCode{BreakerOpenEvent, BreakerHalfOpenEvent, BreakerClosedEvent}
+	if len(recorder.events) != len(expect) {
+		t.Errorf("unexpected events: %d", len(recorder.events))
+		return
+	}
+	for i := range expect {
+		if recorder.events[i].Code != expect[i] {
+			t.Errorf("expect event %d, actual %d", expect[i], recorder.events[i].Code)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package delayqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNoMessage Broker 中没有可以取出的消息
+var ErrNoMessage = errors.New("no message")
+
+// ErrUnsupported 使用自定义 Broker 的队列不支持直接操作 redis 的功能
+var ErrUnsupported = errors.New("unsupported by custom broker")
+
+// Broker 存储消息及各阶段数据的后端，DelayQueue 的消费流程只通过 Broker 完成消息的流转
+// 默认使用 redis 实现，实现 Broker 即可将队列存储在内存、数据库等其它后端中
+type Broker interface {
+	// Push 保存消息并放入 pending，msg.Time 为投递时间，ttl 为消息内容的过期时间
+	Push(ctx context.Context, msg *MessageInfo, ttl time.Duration) error
+	// Pending2Ready 将投递时间不晚于 now 的消息移入 ready，返回移动的消息数量
+	Pending2Ready(ctx context.Context, now time.Time) (int64, error)
+	// Ready2Unack 从 ready 中取出一条消息移入 unack，deadline 为处理超时时间，没有消息时返回 ErrNoMessage
+	Ready2Unack(ctx context.Context, deadline time.Time) (string, error)
+	// Retry2Unack 从 retry 中取出一条消息移入 unack，没有消息时返回 ErrNoMessage
+	Retry2Unack(ctx context.Context, deadline time.Time) (string, error)
+	// Message 返回投递给 Handler 的消息，包括内容、投递次数和剩余重试次数，消息不存在或已过期时返回 ErrMessageNotFound
+	Message(ctx context.Context, idStr string) (*Message, error)
+	// Ack 确认消息，从 unack 中移除并删除消息内容
+	Ack(ctx context.Context, idStr string) error
+	// Nack 将 unack 中消息的处理超时时间设置为 now，使其在 Unack2Retry 中立即重试
+	Nack(ctx context.Context, idStr string, now time.Time) error
+	// Reserve 占用去重 key，key 已被占用时返回占用 key 的消息ID，ttl 为占用的时间
+	Reserve(ctx context.Context, key string, idStr string, ttl time.Duration) (string, error)
+	// Release 释放去重 key
+	Release(ctx context.Context, key string) error
+	// Drop 将 unack 中的消息移入 garbage 不再重试，由 CollectGarbage 删除或移入死信队列，event 为记录在投递历史中的事件
+	Drop(ctx context.Context, idStr string, now time.Time, event string) error
+	// Requeue 将 unack 中的消息以投递时间 now 放回 pending，不消耗重试次数和投递次数
+	Requeue(ctx context.Context, idStr string, now time.Time) error
+	// RecordFailure 记录消息本次处理失败的错误特征，返回以该特征连续失败的次数
+	RecordFailure(ctx context.Context, idStr string, signature string) (int64, error)
+	// AddPoisonSignature 记录导致消息被隔离的错误特征，特征第一次出现时返回 true
+	AddPoisonSignature(ctx context.Context, signature string) (bool, error)
+	// Evict 取消最早投递的 n 条消息，先从 ready 中取消，再取消 pending 中投递时间最早的消息，返回取消的消息ID
+	Evict(ctx context.Context, n int64) ([]string, error)
+	// Oldest 返回 pending 中最早的投递时间（没有消息时为零值）以及每个 ready 分片中下一个被取出的消息ID
+	Oldest(ctx context.Context) (time.Time, []string, error)
+	// Overdue 返回 unack 中处理超时时间不晚于 before 的消息ID及其处理超时时间
+	Overdue(ctx context.Context, before time.Time) (map[string]time.Time, error)
+	// SetOwner 记录正在处理消息的消费者，ttl 为记录的保留时间
+	SetOwner(ctx context.Context, idStr string, owner *Owner, ttl time.Duration) error
+	// Owners 查询正在处理消息的消费者，没有记录的消息不在返回值中
+	Owners(ctx context.Context, ids []string) (map[string]*Owner, error)
+	// PushMany 在同一个事务中保存多条消息
+	PushMany(ctx context.Context, msgs []*PendingMessage) error
+	// CancelByTag 取消带有 tag 的所有消息，并清空该标签的索引，返回取消的消息ID
+	CancelByTag(ctx context.Context, tag string) ([]string, error)
+	// AckAndPush 确认消息，并在同一个事务中保存 msgs
+	AckAndPush(ctx context.Context, idStr string, msgs []*PendingMessage) error
+	// Reply 保存消息的处理结果并通知 WaitReply，ttl 为处理结果的保留时间
+	Reply(ctx context.Context, idStr string, result string, ttl time.Duration) error
+	// Result 查询消息的处理结果，不存在时返回 ErrResultNotFound
+	Result(ctx context.Context, idStr string) (string, error)
+	// WaitReply 等待消息的处理结果，直到 ctx 取消
+	WaitReply(ctx context.Context, idStr string) (string, error)
+	// SetStatus 更新消息的状态，at 为消息的投递时间，为零值时不更新，ttl 为状态的保留时间
+	SetStatus(ctx context.Context, idStr string, status JobStatus, now time.Time, at time.Time, ttl time.Duration) error
+	// Status 查询消息的状态及投递时间，不存在时返回 ErrMessageNotFound
+	Status(ctx context.Context, idStr string) (*StatusInfo, time.Time, error)
+	// SetProgress 保存消息的处理进度，ttl 为进度的保留时间
+	SetProgress(ctx context.Context, idStr string, progress *Progress, ttl time.Duration) error
+	// Progress 查询消息的处理进度，不存在时返回 ErrMessageNotFound
+	Progress(ctx context.Context, idStr string) (*Progress, error)
+	// AckMany 批量确认消息，返回从 unack 中移除的消息ID
+	AckMany(ctx context.Context, ids []string) ([]string, error)
+	// NackMany 批量将 unack 中消息的处理超时时间设置为 now，返回更新的消息ID
+	NackMany(ctx context.Context, ids []string, now time.Time) ([]string, error)
+	// Extend 将 unack 中消息的处理超时时间设置为 deadline，消息不在 unack 中时返回 ErrMessageNotFound
+	Extend(ctx context.Context, idStr string, deadline time.Time) error
+	// Unack2Retry 将处理超时的消息移入 retry 并减少重试次数，已达重试上限的消息移入 garbage
+	Unack2Retry(ctx context.Context, now time.Time) (retried int64, dropped int64, err error)
+	// CollectGarbage 删除 garbage 中的消息，deadLetterTTL 大于 0 时改为移入死信队列并保留 deadLetterTTL，
+	// 返回移入死信队列的消息数量
+	CollectGarbage(ctx context.Context, now time.Time, deadLetterTTL time.Duration) (int64, error)
+	// RecordHistory 记录消息的投递历史，最多保留 20 条
+	RecordHistory(ctx context.Context, idStr string, record *HistoryRecord) error
+	// SetPaused 设置所有实例共享的暂停标记
+	SetPaused(ctx context.Context, paused bool) error
+	// Paused 返回共享的暂停标记
+	Paused(ctx context.Context) (bool, error)
+
+	Stats(ctx context.Context) (*QueueStats, error)
+	Get(ctx context.Context, idStr string) (*MessageInfo, error)
+	// Cancel 从所有阶段中移除消息，消息不存在时返回 ErrMessageNotFound
+	Cancel(ctx context.Context, idStr string) error
+	ListDead(ctx context.Context, cursor string, count int64) ([]*DeadMessage, string, error)
+	// RequeueDead 将死信消息放回 ready，重试次数重置为 retryCount，消息内容的过期时间重置为 msgTTL
+	RequeueDead(ctx context.Context, retryCount uint, msgTTL time.Duration, ids ...string) (int, error)
+}
+
+// redisBroker 基于 redis 的 Broker，key 的命名及分片规则由 DelayQueue 决定
+type redisBroker struct {
+	q *DelayQueue
+}
+
+// NewDelayQueueWithBroker 使用自定义的 Broker 创建队列
+// List、Export、Purge、DeleteQueue 等直接操作 redis 的管理功能仅支持 NewDelayQueue 创建的队列，其它队列调用时返回 ErrUnsupported
+func NewDelayQueueWithBroker(name string, broker Broker, callback func(string) bool) *DelayQueue {
+	if name == "" {
+		panic("name is required")
+	}
+	if broker == nil {
+		panic("broker is required")
+	}
+	if callback == nil {
+		panic("callback is required")
+	}
+	q := newDelayQueue(name, nil)
+	q.broker = broker
+	q.handler = callbackHandler(callback)
+	return q
+}
+
+// requireRedis 队列不是基于 redis 时返回 ErrUnsupported，op 为调用的功能
+func (q *DelayQueue) requireRedis(op string) error {
+	if q.redisCli == nil {
+		return fmt.Errorf("%w: %s", ErrUnsupported, op)
+	}
+	return nil
+}
+
+var (
+	_ Broker = (*redisBroker)(nil)
+	_ Broker = (*memoryBroker)(nil)
+)
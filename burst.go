@@ -0,0 +1,60 @@
+package delayqueue
+
+import (
+	"context"
+)
+
+// WithBurst 配置突发模式
+// 当 ready 与 retry 中积压的消息数达到 threshold 时，临时将单次拉取数量和并发数提升至 fetchLimit 和 concurrent，
+// 积压消化后恢复为正常配置，用于在故障恢复后尽快处理积压的消息
+func (q *DelayQueue) WithBurst(threshold uint, fetchLimit uint, concurrent uint) *DelayQueue {
+	if q.frozen("WithBurst") {
+		return q
+	}
+	q.burstThreshold = threshold
+	q.burstFetchLimit = fetchLimit
+	q.burstConcurrent = concurrent
+	return q
+}
+
+// consumeLimits 返回本次消费周期使用的单次拉取数量和并发数
+func (q *DelayQueue) consumeLimits() (fetchLimit uint, concurrent uint) {
+	fetchLimit, concurrent = q.fetchLimit, q.concurrent
+	if q.burstThreshold == 0 {
+		return
+	}
+	backlog, err := q.backlog(context.Background())
+	if err != nil {
+		q.logger.Error("get backlog failed", "queue", q.name, "error", err)
+		return
+	}
+	bursting := backlog >= int64(q.burstThreshold)
+	if bursting != q.bursting {
+		q.bursting = bursting
+		if bursting {
+			q.logger.Info("enter burst mode", "queue", q.name, "backlog", backlog)
+		} else {
+			q.logger.Info("leave burst mode", "queue", q.name, "backlog", backlog)
+		}
+	}
+	if !bursting {
+		return
+	}
+	// fetchLimit 为 0 表示不限制，无需提升
+	if fetchLimit > 0 && q.burstFetchLimit > fetchLimit {
+		fetchLimit = q.burstFetchLimit
+	}
+	if q.burstConcurrent > concurrent {
+		concurrent = q.burstConcurrent
+	}
+	return
+}
+
+// backlog 返回 ready 与 retry 中积压的消息数
+func (q *DelayQueue) backlog(ctx context.Context) (int64, error) {
+	stats, err := q.broker.Stats(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return stats.Ready + stats.Retry, nil
+}
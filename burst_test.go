@@ -0,0 +1,35 @@
+package delayqueue
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestDelayQueue_Burst(t *testing.T) {
+	redisCli := newTestRedis(t)
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	}).WithFetchLimit(1).WithBurst(3, 10, 4)
+	for i := 0; i < 5; i++ {
+		err := queue.SendDelayMsg(strconv.Itoa(i), 0)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := queue.pending2Ready(); err != nil {
+		t.Error(err)
+		return
+	}
+	fetchLimit, concurrent := queue.consumeLimits()
+	if fetchLimit != 10 || concurrent != 4 {
+		t.Errorf("expect burst limits 10/4, actual %d/%d", fetchLimit, concurrent)
+	}
+	if err := queue.consume(); err != nil {
+		t.Errorf("consume error: %v", err)
+		return
+	}
+	fetchLimit, concurrent = queue.consumeLimits()
+	if fetchLimit != 1 || concurrent != 1 {
+		t.Errorf("expect normal limits 1/1, actual %d/%d", fetchLimit, concurrent)
+	}
+}
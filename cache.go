@@ -0,0 +1,246 @@
+package delayqueue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// invalidateChannel redis 推送 client-side caching 失效通知的频道
+const invalidateChannel = "__redis__:invalidate"
+
+// cacheCheckInterval 检查跟踪连接的间隔，连接断开重连后会重新开启跟踪并清空缓存
+const cacheCheckInterval = 10 * time.Second
+
+// client-side caching 的状态
+const (
+	cacheUnknown     = iota // 尚未开启跟踪
+	cacheReady              // 已开启跟踪
+	cacheUnsupported        // redis 不支持 CLIENT TRACKING 或已关闭
+)
+
+// WithClientCache 使用 redis client-side caching（需要 redis 6 及以上版本）缓存暂停标记和消费组等很少变化的元数据，
+// 消费者不再在每个消费周期读取暂停标记，发送消息时不再读取已注册的消费组
+// go-redis v8 只支持 RESP2，因此使用 CLIENT TRACKING 的 REDIRECT 广播模式，额外占用两个 redis 连接：
+// 一个连接订阅失效通知，另一个连接开启对元数据 key 的跟踪，key 被任意客户端修改后 redis 推送通知使缓存失效
+// redis 不支持时回退为直接读取，StopConsume 后关闭缓存
+func (q *DelayQueue) WithClientCache() *DelayQueue {
+	if q.frozen("WithClientCache") {
+		return q
+	}
+	if q.redisCli == nil {
+		q.logger.Warn("client cache requires redis", "queue", q.name)
+		return q
+	}
+	q.cache = &clientCache{q: q, values: make(map[string]interface{})}
+	return q
+}
+
+// clientCache 缓存元数据 key 的值，收到失效通知时删除
+type clientCache struct {
+	q       *DelayQueue
+	once    sync.Once
+	mu      sync.Mutex
+	state   int
+	values  map[string]interface{}
+	gen     uint64 // 每次失效时递增，避免读取期间失效的旧值被写入缓存
+	retrack bool   // 订阅连接重连后需要使用新的连接ID重新开启跟踪
+	checked time.Time
+
+	redirect int64 // 订阅连接的ID
+	sub      *redis.Client
+	track    *redis.Client
+	pubsub   *redis.PubSub
+}
+
+// cachedKeys 缓存的元数据 key
+func (c *clientCache) cachedKeys() []string {
+	return []string{c.q.pausedKey, c.q.groupsKey}
+}
+
+// get 返回 key 缓存的值，未缓存时调用 load 读取并缓存，跟踪不可用时直接调用 load
+func (c *clientCache) get(ctx context.Context, key string, load func() (interface{}, error)) (interface{}, error) {
+	if c == nil || !c.available(ctx) {
+		return load()
+	}
+	c.mu.Lock()
+	value, ok := c.values[key]
+	gen := c.gen
+	c.mu.Unlock()
+	if ok {
+		return value, nil
+	}
+	value, err := load()
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if c.gen == gen && c.state == cacheReady {
+		c.values[key] = value
+	}
+	c.mu.Unlock()
+	return value, nil
+}
+
+// invalidate 删除 keys 的缓存，keys 为空时清空所有缓存
+func (c *clientCache) invalidate(keys ...string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	if len(keys) == 0 {
+		c.values = make(map[string]interface{})
+		return
+	}
+	for _, key := range keys {
+		delete(c.values, key)
+	}
+}
+
+// available 返回是否可以使用缓存，第一次调用时开启跟踪，之后定期检查跟踪连接
+func (c *clientCache) available(ctx context.Context) bool {
+	c.mu.Lock()
+	state, retrack, check := c.state, c.retrack, c.q.clock.Now().Sub(c.checked) > cacheCheckInterval
+	if check {
+		c.checked = c.q.clock.Now()
+	}
+	c.mu.Unlock()
+	switch state {
+	case cacheUnsupported:
+		return false
+	case cacheUnknown:
+		c.once.Do(func() {
+			if err := c.start(ctx); err != nil {
+				c.q.logger.Warn("client cache not available, read metadata from redis directly", "queue", c.q.name, "error", err)
+				c.close()
+			}
+		})
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.state == cacheReady
+	}
+	var err error
+	if retrack {
+		c.mu.Lock()
+		c.retrack = false
+		c.mu.Unlock()
+		err = c.track.Do(ctx, "Client", "Tracking", "Off").Err()
+		if err == nil {
+			err = c.enableTracking(ctx, c.track)
+		}
+	} else if check {
+		// 跟踪连接断开时 Ping 会建立新的连接，由 OnConnect 重新开启跟踪
+		// go-redis 无法解析 FLUSHDB 等命令产生的空通知，因此同时清空缓存
+		c.invalidate()
+		err = c.track.Ping(ctx).Err()
+	}
+	if err != nil {
+		c.invalidate()
+		c.mu.Lock()
+		c.retrack = true
+		c.mu.Unlock()
+		return false
+	}
+	return true
+}
+
+// start 订阅失效通知并开启跟踪
+func (c *clientCache) start(ctx context.Context) error {
+	opt := *c.q.redisCli.Options()
+	opt.PoolSize, opt.MinIdleConns, opt.IdleTimeout = 1, 0, -1
+	subOpt, trackOpt := opt, opt
+	onConnect := opt.OnConnect
+	subOpt.OnConnect = func(ctx context.Context, cn *redis.Conn) error {
+		if onConnect != nil {
+			if err := onConnect(ctx, cn); err != nil {
+				return err
+			}
+		}
+		id, err := cn.ClientID(ctx).Result()
+		if err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.redirect = id
+		c.retrack = c.state == cacheReady
+		c.mu.Unlock()
+		c.invalidate()
+		return nil
+	}
+	trackOpt.OnConnect = func(ctx context.Context, cn *redis.Conn) error {
+		if onConnect != nil {
+			if err := onConnect(ctx, cn); err != nil {
+				return err
+			}
+		}
+		c.invalidate()
+		return c.enableTracking(ctx, cn)
+	}
+	c.sub = redis.NewClient(&subOpt)
+	c.track = redis.NewClient(&trackOpt)
+	c.pubsub = c.sub.Subscribe(ctx, invalidateChannel)
+	if _, err := c.pubsub.Receive(ctx); err != nil {
+		return fmt.Errorf("subscribe invalidation failed: %v", err)
+	}
+	if err := c.track.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("enable tracking failed: %v", err)
+	}
+	c.mu.Lock()
+	c.state = cacheReady
+	c.checked = c.q.clock.Now()
+	c.mu.Unlock()
+	go c.listen(c.pubsub.Channel())
+	return nil
+}
+
+// enableTracking 在连接上开启对元数据 key 的广播跟踪，失效通知发送到订阅连接
+func (c *clientCache) enableTracking(ctx context.Context, cn interface {
+	Process(ctx context.Context, cmd redis.Cmder) error
+}) error {
+	c.mu.Lock()
+	redirect := c.redirect
+	c.mu.Unlock()
+	args := []interface{}{"Client", "Tracking", "On", "Redirect", redirect, "BCast"}
+	for _, key := range c.cachedKeys() {
+		args = append(args, "Prefix", key)
+	}
+	cmd := redis.NewCmd(ctx, args...)
+	_ = cn.Process(ctx, cmd)
+	return cmd.Err()
+}
+
+// listen 处理失效通知
+func (c *clientCache) listen(ch <-chan *redis.Message) {
+	for msg := range ch {
+		if msg.Payload != "" {
+			c.invalidate(msg.Payload)
+		} else if len(msg.PayloadSlice) > 0 {
+			c.invalidate(msg.PayloadSlice...)
+		}
+	}
+}
+
+// close 关闭订阅及跟踪连接，之后直接读取 redis
+func (c *clientCache) close() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.state = cacheUnsupported
+	c.values = make(map[string]interface{})
+	c.mu.Unlock()
+	if c.pubsub != nil {
+		_ = c.pubsub.Close()
+	}
+	if c.sub != nil {
+		_ = c.sub.Close()
+	}
+	if c.track != nil {
+		_ = c.track.Close()
+	}
+}
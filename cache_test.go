@@ -0,0 +1,76 @@
+package delayqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestDelayQueue_ClientCache(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	}).WithClientCache()
+	defer queue.StopConsume()
+	for _, paused := range []bool{false, true, false} {
+		if paused {
+			if err := queue.PauseAll(ctx); err != nil {
+				t.Error(err)
+				return
+			}
+		} else if err := queue.ResumeAll(ctx); err != nil {
+			t.Error(err)
+			return
+		}
+		actual, err := queue.IsPaused(ctx)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if actual != paused {
+			t.Errorf("expect paused %v, actual %v", paused, actual)
+		}
+	}
+}
+
+func TestClientCache_Invalidate(t *testing.T) {
+	queue := NewDelayQueue("test", redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379"}), func(s string) bool {
+		return true
+	}).WithClientCache()
+	cache := queue.cache
+	// 跳过开启跟踪，只测试缓存的读写
+	cache.once.Do(func() {})
+	cache.state, cache.checked = cacheReady, time.Now()
+	loads := 0
+	load := func() (interface{}, error) {
+		loads++
+		return loads, nil
+	}
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if v, _ := cache.get(ctx, "foo", load); v != 1 {
+			t.Errorf("expect cached value 1, actual %v", v)
+		}
+	}
+	cache.invalidate("bar")
+	if v, _ := cache.get(ctx, "foo", load); v != 1 {
+		t.Errorf("expect cached value 1, actual %v", v)
+	}
+	cache.invalidate("foo")
+	if v, _ := cache.get(ctx, "foo", load); v != 2 {
+		t.Errorf("expect reloaded value 2, actual %v", v)
+	}
+	// 读取期间失效的值不写入缓存
+	stale := func() (interface{}, error) {
+		cache.invalidate()
+		return "stale", nil
+	}
+	cache.invalidate()
+	cache.get(ctx, "foo", stale)
+	if v, _ := cache.get(ctx, "foo", load); v != 3 {
+		t.Errorf("expect reloaded value 3, actual %v", v)
+	}
+}
@@ -0,0 +1,129 @@
+package delayqueue
+
+import "time"
+
+// calendarSearchDays 查找下一个工作时间时最多向后查找的天数，避免所有日期都不是工作日时无限循环
+const calendarSearchDays = 3660
+
+// Calendar 工作日历，包含周末、节假日和每天的工作时间，用于按工作日计算投递时间
+// 例如 queue.SendScheduleMsg(payload, cal.AddBusinessDays(time.Now(), 2)) 在两个工作日后投递
+type Calendar struct {
+	loc      *time.Location
+	weekend  map[time.Weekday]bool
+	holidays map[string]bool // 节假日，格式为 2006-01-02
+	start    time.Duration   // 每天工作时间的开始，距离当天零点的时长
+	end      time.Duration   // 每天工作时间的结束，为 0 时表示全天
+}
+
+// NewCalendar 创建工作日历，loc 为日历所在的时区，为 nil 时使用本地时区
+// 默认周六、周日为周末，没有节假日，全天都是工作时间
+func NewCalendar(loc *time.Location) *Calendar {
+	if loc == nil {
+		loc = time.Local
+	}
+	return &Calendar{
+		loc:      loc,
+		weekend:  map[time.Weekday]bool{time.Saturday: true, time.Sunday: true},
+		holidays: make(map[string]bool),
+	}
+}
+
+// WithWeekend 设置每周的休息日，代替默认的周六、周日
+func (c *Calendar) WithWeekend(days ...time.Weekday) *Calendar {
+	c.weekend = make(map[time.Weekday]bool, len(days))
+	for _, day := range days {
+		c.weekend[day] = true
+	}
+	return c
+}
+
+// WithHolidays 添加节假日，只使用日期在日历时区中的年月日
+func (c *Calendar) WithHolidays(dates ...time.Time) *Calendar {
+	for _, date := range dates {
+		c.holidays[date.In(c.loc).Format("2006-01-02")] = true
+	}
+	return c
+}
+
+// WithBusinessHours 设置每天的工作时间 [start, end)，start 和 end 为距离当天零点的时长，不支持跨越零点
+func (c *Calendar) WithBusinessHours(start, end time.Duration) *Calendar {
+	if start < 0 || end > 24*time.Hour || start >= end {
+		panic("invalid business hours")
+	}
+	c.start, c.end = start, end
+	return c
+}
+
+// IsBusinessDay 返回 t 所在的日期是否为工作日
+func (c *Calendar) IsBusinessDay(t time.Time) bool {
+	t = t.In(c.loc)
+	return !c.weekend[t.Weekday()] && !c.holidays[t.Format("2006-01-02")]
+}
+
+// IsBusinessTime 返回 t 是否在工作日的工作时间内
+func (c *Calendar) IsBusinessTime(t time.Time) bool {
+	if !c.IsBusinessDay(t) {
+		return false
+	}
+	if c.end == 0 {
+		return true
+	}
+	offset := t.Sub(c.midnight(t))
+	return offset >= c.start && offset < c.end
+}
+
+// Next 返回不早于 t 的第一个工作时间，t 已在工作时间内时原样返回
+// 找不到工作时间（例如每天都是休息日）时返回 t
+func (c *Calendar) Next(t time.Time) time.Time {
+	day := c.midnight(t)
+	for i := 0; i < calendarSearchDays; i++ {
+		if c.IsBusinessDay(day) {
+			begin := day.Add(c.start)
+			if t.Before(begin) {
+				return begin
+			}
+			if c.end == 0 || t.Before(day.Add(c.end)) {
+				return t
+			}
+		}
+		day = c.midnight(day.AddDate(0, 0, 1).Add(time.Hour))
+	}
+	return t
+}
+
+// AddBusinessDays 返回 t 之后第 n 个工作日的同一时刻，不在工作时间内时顺延到之后的第一个工作时间
+// n 小于等于 0 时返回 Next(t)
+func (c *Calendar) AddBusinessDays(t time.Time, n int) time.Time {
+	t = t.In(c.loc)
+	for i := 0; i < n; i++ {
+		t = t.AddDate(0, 0, 1)
+		for j := 0; j < calendarSearchDays && !c.IsBusinessDay(t); j++ {
+			t = t.AddDate(0, 0, 1)
+		}
+	}
+	return c.Next(t)
+}
+
+// midnight 返回 t 所在日期在日历时区中的零点
+func (c *Calendar) midnight(t time.Time) time.Time {
+	y, m, d := t.In(c.loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, c.loc)
+}
+
+// WithCalendar 按工作日历调整消息的投递时间，不在工作时间内的消息顺延到之后的第一个工作时间，
+// 可以被发送时的 WithBusinessCalendar 覆盖，cal 为 nil 时不调整
+func (q *DelayQueue) WithCalendar(cal *Calendar) *DelayQueue {
+	if q.frozen("WithCalendar") {
+		return q
+	}
+	q.calendar = cal
+	return q
+}
+
+// WithBusinessCalendar 按工作日历调整本条消息的投递时间，不在工作时间内时顺延到之后的第一个工作时间
+// example: queue.SendDelayMsg(payload, 2*time.Hour, delayqueue.WithBusinessCalendar(cal))
+func WithBusinessCalendar(cal *Calendar) SendOption {
+	return func(c *sendConfig) {
+		c.calendar = cal
+	}
+}
@@ -0,0 +1,82 @@
+package delayqueue
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCalendar(t *testing.T) {
+	date := func(day, hour, min int) time.Time {
+		return time.Date(2026, 10, day, hour, min, 0, 0, time.UTC)
+	}
+	// 2026-10-16 为周五，10-19（周一）为节假日
+	cal := NewCalendar(time.UTC).WithHolidays(date(19, 0, 0)).WithBusinessHours(9*time.Hour, 18*time.Hour)
+	cases := []struct {
+		name   string
+		actual time.Time
+		expect time.Time
+	}{
+		{"in business hours", cal.Next(date(16, 10, 30)), date(16, 10, 30)},
+		{"before business hours", cal.Next(date(16, 7, 0)), date(16, 9, 0)},
+		{"after business hours", cal.Next(date(16, 19, 0)), date(20, 9, 0)},
+		{"weekend", cal.Next(date(17, 12, 0)), date(20, 9, 0)},
+		{"add business days", cal.AddBusinessDays(date(16, 10, 30), 2), date(21, 10, 30)},
+		{"add business days after hours", cal.AddBusinessDays(date(15, 20, 0), 1), date(20, 9, 0)},
+	}
+	for _, c := range cases {
+		if !c.actual.Equal(c.expect) {
+			t.Errorf("%s: expect %v, actual %v", c.name, c.expect, c.actual)
+		}
+	}
+	if cal.IsBusinessTime(date(19, 10, 0)) || !cal.IsBusinessTime(date(20, 10, 0)) {
+		t.Error("unexpected business time")
+	}
+	// 每天都是休息日时原样返回
+	never := NewCalendar(time.UTC).WithWeekend(time.Sunday, time.Monday, time.Tuesday, time.Wednesday,
+		time.Thursday, time.Friday, time.Saturday)
+	if !never.Next(date(16, 10, 0)).Equal(date(16, 10, 0)) {
+		t.Error("next should return t when there is no business day")
+	}
+}
+
+func TestDelayQueue_Calendar(t *testing.T) {
+	redisCli := newTestRedis(t)
+	// 今天是休息日，投递时间顺延到明天零点
+	now := time.Now().In(time.UTC)
+	weekend := NewCalendar(time.UTC).WithWeekend(now.Weekday())
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	}).WithCalendar(weekend)
+	msg, err := queue.SendDelayMsgV2("hello", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	y, m, d := now.AddDate(0, 0, 1).Date()
+	if expect := time.Date(y, m, d, 0, 0, 0, 0, time.UTC); !msg.Time.Equal(expect) {
+		t.Errorf("expect %v, actual %v", expect, msg.Time)
+	}
+	// 发送时的日历覆盖队列的日历
+	msg, err = queue.SendDelayMsgV2("hello", 0, WithBusinessCalendar(NewCalendar(time.UTC).WithWeekend()))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if msg.Time.Unix() > time.Now().Unix() {
+		t.Errorf("message should be delivered now, actual: %v", msg.Time)
+	}
+}
+
+func TestDelayQueue_CalendarMaxDelay(t *testing.T) {
+	redisCli := newTestRedis(t)
+	// 今天和明天都是休息日，投递时间被顺延到 24 小时之后
+	now := time.Now().In(time.UTC)
+	weekend := NewCalendar(time.UTC).WithWeekend(now.Weekday(), (now.Weekday()+1)%7)
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	}).WithCalendar(weekend).WithScheduleValidation(24 * time.Hour)
+	if _, err := queue.SendDelayMsgV2("hello", 0); !errors.Is(err, ErrScheduleTooFar) {
+		t.Errorf("expect ErrScheduleTooFar, actual %v", err)
+	}
+}
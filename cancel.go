@@ -0,0 +1,52 @@
+package delayqueue
+
+import (
+	"context"
+)
+
+// genCancelChannel 取消消息时发布消息ID的频道，消费者收到后取消正在处理该消息的 Handler 的 ctx
+func (q *DelayQueue) genCancelChannel() string {
+	return q.keyBase(q.name) + ":cancel"
+}
+
+// abortDelivery 取消当前实例中正在处理 idStr 的 Handler 的 ctx
+func (q *DelayQueue) abortDelivery(idStr string) {
+	if v, ok := q.deliveries.Load(idStr); ok {
+		v.(*delivery).abort()
+		q.debugLog("in-flight message cancelled", "id", idStr)
+	}
+}
+
+// publishCancel 通知其它实例中的消费者消息已被取消，通知失败只记录日志，消费完成后的确认仍会被忽略
+func (q *DelayQueue) publishCancel(ctx context.Context, idStr string) {
+	q.abortDelivery(idStr)
+	if q.redisCli == nil {
+		return
+	}
+	err := q.redisCli.Publish(ctx, q.genCancelChannel(), idStr).Err()
+	if err != nil {
+		q.logger.Error("publish cancel failed", "queue", q.name, "id", idStr, "error", err)
+	}
+}
+
+// watchCancel 订阅取消频道直到 stop 关闭，取消正在处理被取消消息的 Handler 的 ctx
+func (q *DelayQueue) watchCancel(stop <-chan struct{}) {
+	if q.redisCli == nil {
+		return
+	}
+	ctx := context.Background()
+	pubsub := q.redisCli.Subscribe(ctx, q.genCancelChannel())
+	defer pubsub.Close()
+	ch := pubsub.Channel()
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			q.abortDelivery(msg.Payload)
+		case <-stop:
+			return
+		}
+	}
+}
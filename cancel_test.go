@@ -0,0 +1,54 @@
+package delayqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_CancelInFlight(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	started := make(chan string, 1)
+	handled := make(chan error, 1)
+	queue := NewDelayQueueWithHandler("test", redisCli, func(ctx context.Context, msg *Message) error {
+		started <- msg.ID
+		<-ctx.Done()
+		handled <- ctx.Err()
+		return nil
+	}).WithFetchInterval(50 * time.Millisecond).WithMaxConsumeDuration(time.Minute)
+	done := queue.StartConsume()
+	defer func() {
+		queue.StopConsume()
+		<-done
+	}()
+	if err := queue.SendDelayMsg("long job", 0); err != nil {
+		t.Error(err)
+		return
+	}
+	var id string
+	select {
+	case id = <-started:
+	case <-time.After(5 * time.Second):
+		t.Error("handler not started")
+		return
+	}
+	// 通过另一个实例取消，模拟管理后台所在的进程
+	admin := NewDelayQueue("test", redisCli, func(string) bool { return true })
+	if err := admin.Cancel(ctx, id); err != nil {
+		t.Error(err)
+		return
+	}
+	select {
+	case err := <-handled:
+		if err != context.Canceled {
+			t.Errorf("expect context.Canceled, actual: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("handler ctx not cancelled")
+		return
+	}
+	if _, err := queue.GetMessage(ctx, id); err != ErrMessageNotFound {
+		t.Errorf("expect message cancelled, actual: %v", err)
+	}
+}
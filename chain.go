@@ -0,0 +1,74 @@
+package delayqueue
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// PendingMessage 等待保存的消息，TTL 为消息内容的过期时间
+type PendingMessage struct {
+	*MessageInfo
+	TTL      time.Duration
+	DedupKey string // WithDedupKey 设置的去重 key
+
+	ctx      context.Context // WithContext 设置的 ctx
+	dedupTTL time.Duration   // 去重 key 的占用时间，为 0 时与 TTL 相同
+}
+
+// chainedMessage Handler 通过 Message.Chain 添加的后续消息
+type chainedMessage struct {
+	payload string
+	delay   time.Duration
+	opts    []SendOption
+}
+
+// Chain 添加一条后续消息，Handler 返回 nil 时，后续消息会与当前消息的确认在同一个事务中发送到当前队列，
+// 在确认之后的 delay 投递，opts 与 SendDelayMsg 相同。Handler 返回其它值时后续消息会被丢弃
+// 用于实现多步骤的流程，如第一次提醒成功后在 3 天后发送第二次提醒，避免确认与发送之间出现竞争
+func (m *Message) Chain(payload string, delay time.Duration, opts ...SendOption) {
+	m.next = append(m.next, &chainedMessage{payload: payload, delay: delay, opts: opts})
+}
+
+// ackAndChain 确认消息并发送 Handler 添加的后续消息
+func (q *DelayQueue) ackAndChain(ctx context.Context, msg *Message) error {
+	now := q.clock.Now()
+	next := make([]*PendingMessage, 0, len(msg.next))
+	for _, c := range msg.next {
+		pending, err := q.newMessage(c.payload, now.Add(c.delay), c.opts...)
+		if err != nil {
+			return err
+		}
+		err = q.intercept(ctx, pending, 0, func(ctx context.Context, m *PendingMessage) error {
+			next = append(next, m)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("intercept chained msg failed: %v", err)
+		}
+	}
+	err := q.broker.AckAndPush(ctx, msg.ID, next)
+	if err != nil {
+		return err
+	}
+	for _, m := range next {
+		q.recordStatus(ctx, m.ID, StatusScheduled, m.Time)
+		q.debugTransition(m.ID, "", StagePending, "deliverAt", m.Time.Format(time.RFC3339), "chainedFrom", msg.ID)
+	}
+	return nil
+}
+
+func (b *redisBroker) AckAndPush(ctx context.Context, idStr string, msgs []*PendingMessage) error {
+	q := b.q
+	pipe := q.redisCli.TxPipeline()
+	keys := []string{q.unAckKey, q.retryCountKey, q.attemptKey}
+	q.pipeEval(ctx, pipe, ackScript, keys, q.genMsgKey(""), idStr)
+	for _, msg := range msgs {
+		q.pushPipe(ctx, pipe, msg.MessageInfo, msg.TTL)
+	}
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("ack and push failed: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package delayqueue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_Chain(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	var received []string
+	queue := NewDelayQueueWithHandler("test", redisCli, func(ctx context.Context, msg *Message) error {
+		received = append(received, msg.Payload)
+		switch msg.Payload {
+		case "reminder 1":
+			msg.Chain("reminder 2", 0)
+			msg.Chain("reminder 3", time.Hour)
+		case "fail":
+			msg.Chain("discarded", 0)
+			return errors.New("fail")
+		}
+		return nil
+	}).WithDefaultRetryCount(0)
+	for _, payload := range []string{"reminder 1", "fail"} {
+		if err := queue.SendDelayMsg(payload, 0); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := queue.ProcessOnce(); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	count := map[string]int{}
+	for _, payload := range received {
+		count[payload]++
+	}
+	if count["reminder 1"] != 1 || count["reminder 2"] != 1 || count["fail"] != 1 || count["discarded"] != 0 {
+		t.Errorf("unexpected received: %v", received)
+	}
+	stats, err := queue.Stats(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if stats.Pending != 1 || stats.Unack != 0 {
+		t.Errorf("expect reminder 3 pending, stats: %+v", stats)
+	}
+}
@@ -0,0 +1,52 @@
+package delayqueue
+
+import "time"
+
+// Clock 提供当前时间和定时器，默认使用系统时间
+// 测试中可以替换为可手动推进的 Clock，无需等待即可验证投递、重试及过期等与时间相关的逻辑
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker 与 time.Ticker 相同
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// clockAware 需要使用队列 Clock 的 Broker
+type clockAware interface {
+	useClock(clock Clock)
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// WithClock 自定义时钟，用于计算投递时间、处理超时时间以及驱动消费周期
+// 使用 redis 时消息内容的过期时间仍由 redis 计算
+func (q *DelayQueue) WithClock(clock Clock) *DelayQueue {
+	if q.frozen("WithClock") {
+		return q
+	}
+	q.clock = clock
+	if b, ok := q.broker.(clockAware); ok {
+		b.useClock(clock)
+	}
+	return q
+}
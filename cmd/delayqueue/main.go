@@ -0,0 +1,225 @@
+// delayqueue 是用于运维延迟队列的命令行工具
+//
+//	delayqueue [-url redis://127.0.0.1:6379/0] [-prefix dp:] [-queue name] [-shards n] <command> [args]
+//
+// 支持的命令：
+//
+//	stats                       查询队列各阶段的消息数量，未指定 -queue 时列出所有队列
+//	peek <id>                   查询消息内容及所处的阶段
+//	peek [-n 10] pending|ready  查看即将投递的消息，不改变消息状态
+//	send [-delay d] [-retry n] <payload>
+//	                            发送消息
+//	cancel <id>                 取消消息
+//	requeue-dead [id...]        重新投递死信消息，不指定ID时重新投递所有死信消息
+//	purge -yes                  清空队列
+//	repair                      修复孤立的消息内容和重试次数
+//	export                      将队列中的所有消息导出到标准输出
+//	import                      从标准输入导入 export 导出的消息
+//	migrate [-to-url url] [-to-prefix prefix] [-to-shards n] -to name
+//	                            将所有消息移动到另一个队列，未指定 -to-url 及 -to-prefix 时使用同一个 Redis 及 key 前缀
+package main
+
+import (
+	"context"
+	"delayqueue"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func main() {
+	url := flag.String("url", envOr("DELAYQUEUE_REDIS_URL", "redis://127.0.0.1:6379/0"), "redis url, env DELAYQUEUE_REDIS_URL")
+	name := flag.String("queue", "", "queue name")
+	shards := flag.Uint("shards", 1, "shard count of the queue")
+	prefix := flag.String("prefix", delayqueue.DefaultKeyPrefix, "key prefix of the queues")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	opt, err := redis.ParseURL(*url)
+	if err != nil {
+		fatal(fmt.Errorf("parse redis url failed: %v", err))
+	}
+	redisCli := redis.NewClient(opt)
+	defer redisCli.Close()
+
+	ctx := context.Background()
+	cmd, args := flag.Arg(0), flag.Args()[1:]
+	if cmd == "stats" && *name == "" {
+		queues, err := delayqueue.ListQueuesWithPrefix(ctx, redisCli, *prefix)
+		if err != nil {
+			fatal(err)
+		}
+		printJSON(queues)
+		return
+	}
+	if *name == "" {
+		fatal(errors.New("-queue is required"))
+	}
+	queue := delayqueue.NewDelayQueue(*name, redisCli, func(string) bool { return false }).WithKeyPrefix(*prefix).WithShards(*shards)
+	if err := run(ctx, redisCli, queue, *prefix, cmd, args); err != nil {
+		fatal(err)
+	}
+}
+
+func run(ctx context.Context, redisCli *redis.Client, queue *delayqueue.DelayQueue, prefix string, cmd string, args []string) error {
+	switch cmd {
+	case "stats":
+		stats, err := queue.Stats(ctx)
+		if err != nil {
+			return err
+		}
+		printJSON(stats)
+	case "peek":
+		fs := flag.NewFlagSet("peek", flag.ExitOnError)
+		n := fs.Int64("n", 10, "max number of messages")
+		_ = fs.Parse(args)
+		if fs.NArg() != 1 {
+			return errors.New("usage: peek <id> | peek [-n 10] pending|ready")
+		}
+		var msgs interface{}
+		var err error
+		switch fs.Arg(0) {
+		case "pending":
+			msgs, err = queue.PeekPending(ctx, *n)
+		case "ready":
+			msgs, err = queue.PeekReady(ctx, *n)
+		default:
+			msgs, err = queue.GetMessage(ctx, fs.Arg(0))
+		}
+		if err != nil {
+			return err
+		}
+		printJSON(msgs)
+	case "send":
+		fs := flag.NewFlagSet("send", flag.ExitOnError)
+		delay := fs.Duration("delay", 0, "delivery delay")
+		retry := fs.Int("retry", -1, "max retry count, use queue default if negative")
+		_ = fs.Parse(args)
+		if fs.NArg() != 1 {
+			return errors.New("usage: send [-delay d] [-retry n] <payload>")
+		}
+		var opts []delayqueue.SendOption
+		if *retry >= 0 {
+			opts = append(opts, delayqueue.WithRetryCount(*retry))
+		}
+		msg, err := queue.SendDelayMsgV2(fs.Arg(0), *delay, opts...)
+		if err != nil {
+			return err
+		}
+		printJSON(msg)
+	case "cancel":
+		if len(args) != 1 {
+			return errors.New("usage: cancel <id>")
+		}
+		return queue.Cancel(ctx, args[0])
+	case "requeue-dead":
+		n, err := queue.RequeueDead(ctx, args...)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("requeued %d messages\n", n)
+	case "purge":
+		fs := flag.NewFlagSet("purge", flag.ExitOnError)
+		yes := fs.Bool("yes", false, "confirm purging all messages")
+		_ = fs.Parse(args)
+		if !*yes {
+			return errors.New("purge removes all messages of the queue, add -yes to confirm")
+		}
+		return queue.Purge(ctx)
+	case "repair":
+		report, err := queue.Repair(ctx)
+		if err != nil {
+			return err
+		}
+		printJSON(report)
+	case "export":
+		n, err := queue.Export(ctx, os.Stdout)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "exported %d messages\n", n)
+	case "import":
+		n, err := queue.Import(ctx, os.Stdin)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("imported %d messages\n", n)
+	case "migrate":
+		fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+		to := fs.String("to", "", "destination queue name")
+		toURL := fs.String("to-url", "", "redis url of the destination queue, same as -url if empty")
+		toShards := fs.Uint("to-shards", 1, "shard count of the destination queue")
+		toPrefix := fs.String("to-prefix", prefix, "key prefix of the destination queue")
+		_ = fs.Parse(args)
+		if *to == "" {
+			return errors.New("usage: migrate [-to-url url] [-to-prefix prefix] [-to-shards n] -to name")
+		}
+		dstCli := redisCli
+		if *toURL != "" {
+			opt, err := redis.ParseURL(*toURL)
+			if err != nil {
+				return fmt.Errorf("parse redis url failed: %v", err)
+			}
+			dstCli = redis.NewClient(opt)
+			defer dstCli.Close()
+		}
+		dst := delayqueue.NewDelayQueue(*to, dstCli, func(string) bool { return false }).WithKeyPrefix(*toPrefix).WithShards(*toShards)
+		n, err := delayqueue.Migrate(ctx, queue, dst)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("migrated %d messages\n", n)
+	default:
+		return fmt.Errorf("unknown command: %s", cmd)
+	}
+	return nil
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `usage: delayqueue [flags] <command> [args]
+
+commands:
+  stats                     show message count of each state, list all queues if -queue is absent
+  peek <id>                 show a message
+  peek [-n 10] pending|ready
+                            show upcoming messages without consuming them
+  send [-delay d] [-retry n] <payload>
+                            send a message
+  cancel <id>               cancel a message
+  requeue-dead [id...]      requeue dead messages, all dead messages if no id is given
+  purge -yes                remove all messages of the queue
+  repair                    remove orphan payloads and retry counts
+  export                    write all messages to stdout
+  import                    read messages written by export from stdin
+  migrate [-to-url url] [-to-prefix prefix] [-to-shards n] -to name
+                            move all messages to another queue, on the same redis and key prefix if -to-url and -to-prefix are absent
+
+flags:
+`)
+	flag.PrintDefaults()
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func printJSON(v interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "delayqueue:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,37 @@
+package delayqueue
+
+// WithUpstreamCompat 兼容 hdt3213/delayqueue 的 key 和消息格式，用于与使用上游库的生产者和消费者共用同一个队列，逐步迁移
+// 默认的 key（dp:{name}:pending、dp:{name}:msg:{id} 等）及消息内容、重试次数的存储格式与上游库相同，
+// hashTag 为 true 时使用上游 UseHashTagKey 的 key 格式，即 {dp:{name}}:pending、{dp:{name}}:msg:{id}；
+// 上游的 UseCustomPrefix(prefix) 对应 WithKeyPrefix(prefix + ":")
+// 上游库无法读取分片、stream 和分区中的消息，因此不能与 WithShards、WithStreams、WithPartitions 同时使用；
+// 消费组、标签、消息头等扩展数据对上游库不可见，由上游消费者确认的消息的扩展数据在过期后删除，仅支持 redis
+func (q *DelayQueue) WithUpstreamCompat(hashTag bool) *DelayQueue {
+	if q.frozen("WithUpstreamCompat") {
+		return q
+	}
+	if q.redisCli == nil {
+		q.invalidOption("WithUpstreamCompat", "upstream compat requires redis")
+		return q
+	}
+	if q.shards > 1 || q.streams || q.partitions != nil {
+		q.invalidOption("WithUpstreamCompat", "upstream compat can not be used with shards, streams or partitions")
+		return q
+	}
+	if q.hashStorage {
+		q.invalidOption("WithUpstreamCompat", "upstream compat can not be used with hash storage")
+		return q
+	}
+	q.compat = true
+	q.hashTagKeys = hashTag
+	q.initKeys(q.name)
+	return q
+}
+
+// keyBase 返回队列 key 的公共部分，启用 hash tag 时形如 {dp:name}
+func (q *DelayQueue) keyBase(name string) string {
+	if q.hashTagKeys {
+		return "{" + q.prefix + name + "}"
+	}
+	return q.prefix + name
+}
@@ -0,0 +1,99 @@
+package delayqueue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestDelayQueue_UpstreamCompatConsume(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	// 按上游 UseHashTagKey 的格式写入一条消息
+	idStr := "upstream-msg"
+	pipe := redisCli.TxPipeline()
+	pipe.Set(ctx, "{dp:test}:msg:"+idStr, "hello", time.Hour)
+	pipe.HSet(ctx, "{dp:test}:retry:cnt", idStr, 3)
+	pipe.ZAdd(ctx, "{dp:test}:pending", &redis.Z{Score: float64(time.Now().Unix()), Member: idStr})
+	if _, err := pipe.Exec(ctx); err != nil {
+		t.Error(err)
+		return
+	}
+	var received []string
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		received = append(received, s)
+		return true
+	}).WithUpstreamCompat(true)
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(received) != 1 || received[0] != "hello" {
+		t.Errorf("unexpected received: %v", received)
+	}
+	n, err := redisCli.Exists(ctx, "{dp:test}:msg:"+idStr, "{dp:test}:unack").Result()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if n != 0 {
+		t.Errorf("message should be acked, %d keys left", n)
+	}
+}
+
+func TestDelayQueue_UpstreamCompatSend(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	}).WithUpstreamCompat(true).WithDefaultRetryCount(2)
+	msg, err := queue.SendDelayMsgV2("hello", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// 按上游库的方式读取消息
+	ids, err := redisCli.ZRangeByScore(ctx, "{dp:test}:pending", &redis.ZRangeBy{Min: "0", Max: "+inf"}).Result()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(ids) != 1 || ids[0] != msg.ID {
+		t.Errorf("unexpected pending: %v", ids)
+	}
+	payload, err := redisCli.Get(ctx, "{dp:test}:msg:"+msg.ID).Result()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if payload != "hello" {
+		t.Errorf("unexpected payload: %s", payload)
+	}
+	retryCount, err := redisCli.HGet(ctx, "{dp:test}:retry:cnt", msg.ID).Int()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if retryCount != 2 {
+		t.Errorf("unexpected retry count: %d", retryCount)
+	}
+}
+
+func TestDelayQueue_UpstreamCompatDefaultKeys(t *testing.T) {
+	redisCli := redis.NewClient(&redis.Options{
+		Addr: "127.0.0.1:6379",
+	})
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	}).WithUpstreamCompat(false)
+	if queue.pendingKey != "dp:test:pending" || queue.genMsgKey("1") != "dp:test:msg:1" {
+		t.Errorf("unexpected keys: %s, %s", queue.pendingKey, queue.genMsgKey("1"))
+	}
+	queue.WithShards(2)
+	if !errors.Is(queue.ConfigErr(), ErrInvalidOption) || queue.shards != 1 {
+		t.Errorf("expect shards rejected, err: %v, shards: %d", queue.ConfigErr(), queue.shards)
+	}
+}
@@ -0,0 +1,28 @@
+package delayqueue
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// WithContentDedup 丢弃 window 内已经发送过相同内容的消息，用于防止重复点击或至少一次投递的上游重复创建定时任务
+// 以消息内容的 SHA-256 作为去重 key，重复发送时返回 ErrDuplicateMessage 及 window 内第一次发送的消息ID；
+// window 从第一次发送时开始计算，消息使用 WithDedupKey 时以业务 key 去重，SendSpread 和 Chain 不去重
+func (q *DelayQueue) WithContentDedup(window time.Duration) *DelayQueue {
+	if q.frozen("WithContentDedup") {
+		return q
+	}
+	q.contentDedupWindow = window
+	return q
+}
+
+// contentDedup 未设置去重 key 时使用消息内容的哈希去重
+func (q *DelayQueue) contentDedup(msg *PendingMessage) {
+	if q.contentDedupWindow <= 0 || msg.DedupKey != "" {
+		return
+	}
+	sum := sha256.Sum256([]byte(msg.Payload))
+	msg.DedupKey = "sha256:" + hex.EncodeToString(sum[:])
+	msg.dedupTTL = q.contentDedupWindow
+}
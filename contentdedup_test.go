@@ -0,0 +1,53 @@
+package delayqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_WithContentDedup(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	}).WithContentDedup(time.Second)
+	first, err := queue.SendDelayMsgV2("order:42", time.Hour)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	dup, err := queue.SendDelayMsgV2("order:42", time.Hour)
+	if err != ErrDuplicateMessage || dup == nil || dup.ID != first.ID {
+		t.Errorf("expected duplicate of %s, got %v, %v", first.ID, dup, err)
+	}
+	if _, err := queue.SendDelayMsgV2("order:43", time.Hour); err != nil {
+		t.Error(err)
+	}
+	// 使用业务 key 去重的消息不按内容去重
+	if _, err := queue.SendDelayMsgV2("order:42", time.Hour, WithDedupKey("order:42:retry")); err != nil {
+		t.Error(err)
+	}
+	// 去重 key 在 window 之后过期
+	keys, err := redisCli.Keys(ctx, queue.genDedupKey("sha256:*")).Result()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(keys) != 2 {
+		t.Errorf("unexpected dedup keys: %v", keys)
+	}
+	for _, key := range keys {
+		if ttl := redisCli.PTTL(ctx, key).Val(); ttl <= 0 || ttl > time.Second {
+			t.Errorf("unexpected ttl of %s: %v", key, ttl)
+		}
+	}
+	stats, err := queue.Stats(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if stats.Pending != 3 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
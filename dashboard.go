@@ -0,0 +1,114 @@
+package delayqueue
+
+import (
+	"context"
+	"embed"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed dashboard/index.html
+var dashboardAssets embed.FS
+
+// StatsSample 某一时刻各阶段的消息数量
+type StatsSample struct {
+	Time int64 `json:"time"` // unix 秒
+	QueueStats
+}
+
+// Dashboard 可嵌入的队列监控页面，展示各阶段消息数量的变化、处理中的消息以及消息详情
+// 页面打开期间每次刷新统计数据时记录一次采样，最多保留 maxSamples 个采样点
+type Dashboard struct {
+	q              *DelayQueue
+	admin          http.Handler
+	mu             sync.Mutex
+	samples        []StatsSample
+	maxSamples     int
+	sampleInterval time.Duration
+}
+
+// NewDashboard 创建队列监控页面
+// 挂载到子路径时请配合 http.StripPrefix 使用，例如：
+//
+//	mux.Handle("/dashboard/", http.StripPrefix("/dashboard", delayqueue.NewDashboard(queue)))
+func NewDashboard(q *DelayQueue) *Dashboard {
+	return &Dashboard{
+		q:              q,
+		admin:          NewAdminHandler(q),
+		maxSamples:     360,
+		sampleInterval: 5 * time.Second,
+	}
+}
+
+func (d *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	switch {
+	case path == "" || path == "index.html":
+		page, err := dashboardAssets.ReadFile("dashboard/index.html")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(page)
+	case path == "api/history":
+		samples, err := d.history(r.Context())
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, samples)
+	case path == "api/inflight":
+		msgs, err := d.q.inflight(r.Context(), 100)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, msgs)
+	case strings.HasPrefix(path, "api/"):
+		// 其余接口与 NewAdminHandler 一致
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = "/" + strings.TrimPrefix(path, "api/")
+		d.admin.ServeHTTP(w, r2)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// history 记录一次采样并返回所有采样，距上次采样不足 sampleInterval 时不重复采样
+func (d *Dashboard) history(ctx context.Context) ([]StatsSample, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.q.clock.Now()
+	if n := len(d.samples); n == 0 || now.Sub(time.Unix(d.samples[n-1].Time, 0)) >= d.sampleInterval {
+		stats, err := d.q.Stats(ctx)
+		if err != nil {
+			return nil, err
+		}
+		d.samples = append(d.samples, StatsSample{Time: now.Unix(), QueueStats: *stats})
+		if len(d.samples) > d.maxSamples {
+			d.samples = d.samples[len(d.samples)-d.maxSamples:]
+		}
+	}
+	return append([]StatsSample(nil), d.samples...), nil
+}
+
+// inflight 返回处理超时时间最早的至多 n 条处理中的消息
+func (q *DelayQueue) inflight(ctx context.Context, n int64) ([]*MessageInfo, error) {
+	members, err := q.redisCli.ZRangeWithScores(ctx, q.unAckKey, 0, n-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]*MessageInfo, 0, len(members))
+	for _, z := range members {
+		idStr, _ := z.Member.(string)
+		msgs = append(msgs, &MessageInfo{
+			ID:    idStr,
+			State: StageUnack,
+			Time:  time.Unix(int64(z.Score), 0),
+		})
+	}
+	return msgs, q.fillPreview(ctx, msgs)
+}
@@ -0,0 +1,57 @@
+package delayqueue
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDashboard(t *testing.T) {
+	redisCli := newTestRedis(t)
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	})
+	msg, err := queue.SendDelayMsgV2("hello", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := queue.pending2Ready(); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := queue.ready2Unack(); err != nil {
+		t.Error(err)
+		return
+	}
+	dashboard := NewDashboard(queue)
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		dashboard.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+	if rec := get("/"); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "DelayQueue") {
+		t.Errorf("unexpected index page: %d", rec.Code)
+	}
+	var samples []StatsSample
+	if err := json.NewDecoder(get("/api/history").Body).Decode(&samples); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(samples) != 1 || samples[0].Unack != 1 {
+		t.Errorf("unexpected samples: %+v", samples)
+	}
+	var inflight []*MessageInfo
+	if err := json.NewDecoder(get("/api/inflight").Body).Decode(&inflight); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(inflight) != 1 || inflight[0].ID != msg.ID {
+		t.Errorf("unexpected inflight messages: %+v", inflight)
+	}
+	if rec := get("/api/messages/" + msg.ID); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "hello") {
+		t.Errorf("unexpected message: %s", rec.Body.String())
+	}
+}
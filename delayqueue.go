@@ -4,25 +4,41 @@ import (
 	"context"
 	"fmt"
 	"github.com/go-redis/redis/v8"
-	"github.com/google/uuid"
 	"log"
+	"math/rand"
+	"runtime/debug"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type DelayQueue struct {
-	name          string            //队列名称，保证当前队列在redis中是唯一的
-	redisCli      *redis.Client     //redis 客户端
-	cb            func(string) bool //回调函数
-	pendingKey    string            //sortedset 存储未到投递时间的消息 member为消息ID，score为投递时间
-	readyKey      string            //list 存储已经到投递时间的消息 element为消息ID
-	unAckKey      string            //sortedset 存储已经投递，但为确认的消息 member为消息ID，score为处理超时时间，超出时间还没ack的消息会被重试
-	retryKey      string            //list 存储超时后待重试的消息 element为消息ID
-	retryCountKey string            //hash 存储重试次数 field为消息ID，value为重试次数
-	garbageKey    string            //set 暂时存储已达重试上限的消息 member为消息ID
-	ticker        *time.Ticker
-	logger        *log.Logger
-	close         chan struct{}
+	name           string        //队列名称，保证当前队列在redis中是唯一的
+	prefix         string        //key 前缀，默认为 dp:
+	redisCli       *redis.Client //redis 客户端
+	handler        Handler       //消费消息的函数
+	pendingKey     string        //sortedset 存储未到投递时间的消息 member为消息ID，score为投递时间
+	readyKey       string        //list 存储已经到投递时间的消息 element为消息ID
+	unAckKey       string        //sortedset 存储已经投递，但为确认的消息 member为消息ID，score为处理超时时间，超出时间还没ack的消息会被重试
+	retryKey       string        //list 存储超时后待重试的消息 element为消息ID
+	retryCountKey  string        //hash 存储重试次数 field为消息ID，value为重试次数，启用 WithHashStorage 时为消息 key 的前缀
+	attemptKey     string        //hash 存储投递次数 field为消息ID，value为已投递的次数，启用 WithHashStorage 时为消息 key 的前缀
+	garbageKey     string        //set 暂时存储已达重试上限的消息 member为消息ID
+	pausedKey      string        //string 存在时所有实例暂停投递
+	deadKey        string        //sortedset 存储死信消息 member为消息ID，score为进入死信队列的时间
+	broker         Broker        //存储消息的后端，默认为 redis
+	ticker         Ticker
+	clock          Clock
+	idGenerator    IDGenerator
+	logger         Logger
+	errorHandler   func(error)    // 处理消费过程中的错误，为 nil 时输出到日志
+	expiredHandler func(*Message) // 处理超过最晚投递时间的消息
+	close          chan struct{}
+	flow           flowCounter // 当前消费周期的流转计数
+	flowMu         sync.Mutex
+	lastFlow       FlowStats // 上一个消费周期的流转计数
 
 	maxConsumeDuration time.Duration
 	msgTTL             time.Duration
@@ -30,6 +46,123 @@ type DelayQueue struct {
 	fetchInterval      time.Duration
 	fetchLimit         uint
 	concurrent         uint
+	deadLetterTTL      time.Duration // 死信消息的保留时间，为 0 表示不启用死信队列
+	historyTracking    bool          // 是否在未启用死信队列时也记录投递历史
+
+	burstThreshold  uint // ready 与 retry 中积压的消息数达到该值时进入突发模式，为 0 表示不启用
+	burstFetchLimit uint // 突发模式下单次拉取消息的数量上限
+	burstConcurrent uint // 突发模式下的并发数上限
+	bursting        bool
+
+	shards      uint // pending 和 ready 的分片数
+	streams     bool // 使用 redis stream 存储 ready 阶段的消息
+	shardCursor uint // 消费者轮询 ready 分片的游标
+
+	partitions *partitionState // 当前消费者持有的分区，为 nil 表示不启用分区模式
+	role       Role            // 实例在消费周期中的角色
+	retryOrder RetryOrder      // ready 与 retry 中消息的投递顺序
+
+	freshWeight uint // RetryInterleave 中新消息的比例
+	retryWeight uint // RetryInterleave 中重试消息的比例
+	retryTurn   uint // RetryInterleave 的投递位置，在消费周期之间保持
+
+	headerFilter func(map[string]string) bool // 只处理 header 满足条件的消息
+	reroute      *DelayQueue                  // 转发不满足 headerFilter 的消息，为 nil 时放回 pending
+
+	slots chan struct{} // QueueManager 中所有队列共享的并发数
+
+	tenant *Tenant // 队列所属的租户
+
+	payloadStore     PayloadStore // 保存较大消息内容的外部存储
+	payloadThreshold int          // 内容超过该长度的消息保存到 payloadStore
+
+	ackArchive     *archiveConfig // 确认的消息的归档配置
+	failureArchive *archiveConfig // 最终处理失败的消息的归档配置
+
+	hashStorage bool // 消息的各项数据保存在同一个 HASH 中
+
+	singleTick bool // 每个消费周期只执行一个脚本
+
+	wakeupWindow time.Duration // 发送在该时间内到期的消息后通过 Pub/Sub 唤醒消费者
+	wakeup       chan struct{} // 收到唤醒通知后立即执行消费周期，未启用 WithWakeup 时为 nil
+
+	validateSchedule bool          // 发送时校验投递时间
+	maxDelay         time.Duration // 投递时间距当前时间的上限，为 0 时不限制
+
+	pastPolicy   PastSchedulePolicy // 投递时间早于当前时间的消息的处理方式
+	pastMinDelay time.Duration      // PastClamp 时投递时间距当前时间的延时
+
+	calendar *Calendar // 调整投递时间的工作日历
+
+	hardTimeout time.Duration // Handler 的 ctx 取消后等待其返回的宽限时间，为 0 时一直等待
+	abandoned   atomic.Int64  // 已被放弃但仍在运行的 Handler 数量
+
+	compat      bool // 兼容 hdt3213/delayqueue 的 key 和消息格式
+	hashTagKeys bool // key 使用 {prefix+name} 形式的 hash tag
+
+	middlewares []func(Handler) Handler // 通过 Use 注册的中间件
+	chained     Handler                 // 使用中间件包装后的 Handler，为 nil 表示没有中间件
+
+	sendInterceptors []SendInterceptor // 通过 UseSend 注册的发送拦截器
+	validator        Validator         // 发送时校验消息内容，为 nil 表示不校验
+
+	contentDedupWindow time.Duration // 相同内容的消息的去重时间，为 0 表示不去重
+
+	poisonThreshold uint                   // 以相同错误特征连续失败多少次后隔离消息，为 0 表示不隔离
+	poisonHook      func(string, *Message) // 新的错误特征导致消息被隔离时调用
+	poisonSignature func(error) string     // 自定义的错误特征
+
+	payloadVersion  int                    // 当前的消息内容格式版本
+	payloadUpgrades map[int]PayloadUpgrade // 版本 -> 升级到下一个版本的函数
+
+	functions     bool         // 使用 redis function 执行 lua 脚本
+	functionState atomic.Int32 // redis function 的加载状态
+
+	maintenanceWindows []MaintenanceWindow // 每天的维护时间段，维护期间不投递消息
+	maintenanceLoc     *time.Location
+	maintaining        bool
+
+	circuit *circuitBreaker // 熔断器，为 nil 表示不启用
+
+	baseName        string // 不含消费组的队列名称
+	group           string // 消费组名称，为空表示不使用消费组
+	groupsKey       string //set 存储已注册的消费组
+	groupRegistered atomic.Bool
+	groupQueues     sync.Map // 发送消息时使用的各消费组的队列，消费组名称 -> *DelayQueue
+
+	maxBackoff      time.Duration // redis 暂时不可用时消费周期的最大退避时间
+	backoffFailures int           // 连续发生暂时性错误的消费周期数
+	backoffUntil    time.Time     // 退避结束前跳过消费周期
+	degraded        atomic.Bool
+
+	maxLength      uint           // pending 与 ready 中消息数量的上限，为 0 表示不限制
+	overflowPolicy OverflowPolicy // 消息数量达到上限时的处理方式
+
+	resultTTL time.Duration // 处理结果的保留时间
+	statusTTL time.Duration // 消息状态的保留时间，为 0 表示不跟踪消息状态
+	started   atomic.Bool   // StartConsume 之后配置不可修改
+	configErr error         // With* 方法记录的第一个配置错误，参见 invalidOption
+	startedAt atomic.Int64  // StartConsume 的时间，unix 纳秒
+	lastTick  atomic.Int64  // 最近一次执行消费周期的时间，unix 纳秒
+
+	maxUnack     uint // unack 中消息数量的上限，为 0 表示不限制
+	throttled    bool
+	limiter      *tokenBucket
+	sendLimiter  *tokenBucket      // 发送限流器，为 nil 表示不限制
+	latency      *latencyHistogram // 投递延迟的直方图，为 nil 表示不记录
+	metrics      Metrics           // 指标上报，为 nil 表示不上报
+	stuck        *stuckDetector    // 检测卡住的消息，为 nil 表示不检测
+	consumerID   string            // 消费者ID，记录在正在处理的消息中
+	slow         *slowConsumer     // 处理耗时统计，为 nil 表示不统计
+	cache        *clientCache      // 元数据的 client-side caching，为 nil 表示不缓存
+	auditEnabled bool              // 是否将消息事件写入审计流
+	auditMaxLen  int64             // 审计流的近似最大长度，为 0 表示不裁剪
+	listeners    []EventListener
+	closeOnce    sync.Once
+	deleted      atomic.Bool // 队列已被 DeleteQueue 删除
+	paused       atomic.Bool // 当前实例暂停投递
+	debug        atomic.Bool // 记录消息流转的调试日志
+	deliveries   sync.Map    // 当前实例正在处理的消息，消息ID -> *delivery
 }
 
 // NewDelayQueue 创建新的Queue
@@ -43,34 +176,113 @@ func NewDelayQueue(name string, redisCli *redis.Client, callback func(string) bo
 	if callback == nil {
 		panic("callback is required")
 	}
-	return &DelayQueue{
-		name:               name,
+	q := newDelayQueue(name, redisCli)
+	q.handler = callbackHandler(callback)
+	return q
+}
+
+// newDelayQueue 创建不带回调函数的 Queue，用于发送消息和管理队列
+func newDelayQueue(name string, redisCli *redis.Client) *DelayQueue {
+	q := &DelayQueue{
+		baseName:           name,
 		redisCli:           redisCli,
-		cb:                 callback,
-		pendingKey:         "dp:" + name + ":pending",
-		readyKey:           "dp:" + name + ":ready",
-		unAckKey:           "dp:" + name + ":unack",
-		retryKey:           "dp:" + name + ":retry",
-		retryCountKey:      "dp:" + name + ":retry:cnt",
-		garbageKey:         "dp:" + name + ":garbage",
-		logger:             log.Default(),
+		prefix:             DefaultKeyPrefix,
+		logger:             NewStdLogger(log.Default()),
 		close:              make(chan struct{}, 1),
 		maxConsumeDuration: 5 * time.Second,
 		msgTTL:             time.Hour,
 		defaultRetryCount:  3,
 		fetchInterval:      time.Second,
 		concurrent:         1,
+		shards:             1,
+		maxBackoff:         30 * time.Second,
+		resultTTL:          time.Hour,
+		clock:              realClock{},
+		idGenerator:        uuidGenerator{},
+		consumerID:         defaultConsumerID(),
 	}
+	q.initKeys(name)
+	q.broker = &redisBroker{q: q}
+	return q
+}
+
+// initKeys 根据队列名称生成存储各阶段数据的 key
+func (q *DelayQueue) initKeys(name string) {
+	q.name = name
+	q.pendingKey = q.keyBase(name) + ":pending"
+	q.readyKey = q.keyBase(name) + ":ready"
+	q.unAckKey = q.keyBase(name) + ":unack"
+	q.retryKey = q.keyBase(name) + ":retry"
+	q.retryCountKey = q.keyBase(name) + ":retry:cnt"
+	q.attemptKey = q.keyBase(name) + ":attempt"
+	if q.hashStorage {
+		// 重试次数和投递次数存储在消息的 HASH 中，参见 msgFieldScript
+		q.retryCountKey = q.genMsgKey("")
+		q.attemptKey = q.genMsgKey("")
+	}
+	q.garbageKey = q.keyBase(name) + ":garbage"
+	q.pausedKey = q.keyBase(name) + ":paused"
+	q.deadKey = q.keyBase(name) + ":dead"
+	q.groupsKey = q.keyBase(q.baseName) + ":groups"
+}
+
+// DefaultKeyPrefix 队列在 redis 中的 key 的默认前缀
+const DefaultKeyPrefix = "dp:"
+
+// WithKeyPrefix 自定义 key 前缀，默认为 "dp:"，用于多个环境或租户共用一个 redis 时隔离各自的 key
+// 同一队列的生产者和消费者必须使用相同的前缀
+func (q *DelayQueue) WithKeyPrefix(prefix string) *DelayQueue {
+	if q.frozen("WithKeyPrefix") {
+		return q
+	}
+	q.prefix = prefix
+	q.initKeys(q.name)
+	return q
 }
 
 // WithLogger 自定义日志
 func (q *DelayQueue) WithLogger(logger *log.Logger) *DelayQueue {
+	if q.frozen("WithLogger") {
+		return q
+	}
+	q.logger = NewStdLogger(logger)
+	return q
+}
+
+// WithStructuredLogger 自定义结构化日志，日志中会携带队列名称、消息ID等字段
+func (q *DelayQueue) WithStructuredLogger(logger Logger) *DelayQueue {
+	if q.frozen("WithStructuredLogger") {
+		return q
+	}
 	q.logger = logger
 	return q
 }
 
+// WithErrorHandler 配置消费过程中发生错误时的回调函数，可以用于统计和告警
+// 未配置时错误会输出到日志，回调函数会在消费协程中同步执行，不应阻塞
+func (q *DelayQueue) WithErrorHandler(handler func(error)) *DelayQueue {
+	if q.frozen("WithErrorHandler") {
+		return q
+	}
+	q.errorHandler = handler
+	return q
+}
+
+// handleError 将消费过程中的错误交给 errorHandler 处理
+func (q *DelayQueue) handleError(err error) {
+	q.incCounter(MetricConsumeErrors, 1)
+	if q.errorHandler != nil {
+		q.errorHandler(err)
+		return
+	}
+	q.logger.Error("consume failed", "queue", q.name, "error", err)
+}
+
 // WithFetchInterval 配置从redis中拉取消息时间间隔
 func (q *DelayQueue) WithFetchInterval(d time.Duration) *DelayQueue {
+	if q.frozen("WithFetchInterval") {
+		return q
+	}
 	q.fetchInterval = d
 	return q
 }
@@ -78,24 +290,36 @@ func (q *DelayQueue) WithFetchInterval(d time.Duration) *DelayQueue {
 // WithMaxConsumeDuration 配置消息的超时时间
 // 如果在消息传递后WithMaxConsumeDuration内未收到确认，DelayQueue将尝试再次传递此消息
 func (q *DelayQueue) WithMaxConsumeDuration(d time.Duration) *DelayQueue {
+	if q.frozen("WithMaxConsumeDuration") {
+		return q
+	}
 	q.maxConsumeDuration = d
 	return q
 }
 
 // WithFetchLimit 配置单次拉取消息的数量
 func (q *DelayQueue) WithFetchLimit(limit uint) *DelayQueue {
+	if q.frozen("WithFetchLimit") {
+		return q
+	}
 	q.fetchLimit = limit
 	return q
 }
 
 // WithDefaultRetryCount 自定义最大重试次数
 func (q *DelayQueue) WithDefaultRetryCount(count uint) *DelayQueue {
+	if q.frozen("WithDefaultRetryCount") {
+		return q
+	}
 	q.defaultRetryCount = count
 	return q
 }
 
 // WithConcurrent 自定义并发数
 func (q *DelayQueue) WithConcurrent(c uint) *DelayQueue {
+	if q.frozen("WithConcurrent") {
+		return q
+	}
 	if c > 0 {
 		q.concurrent = c
 	}
@@ -103,122 +327,257 @@ func (q *DelayQueue) WithConcurrent(c uint) *DelayQueue {
 }
 
 func (q *DelayQueue) genMsgKey(idStr string) string {
-	return "dp:" + q.name + ":msg:" + idStr
+	return q.keyBase(q.name) + ":msg:" + idStr
 }
 
-type retryCountOpt int
-
-// WithRetryCount 给消息设置最大重试次数
-// example: queue.SendDelayMsg(payload, duration, delayqueue.WithRetryCount(3))
-func WithRetryCount(count int) interface{} {
-	return retryCountOpt(count)
+// SendScheduleMsg 发送定时消息
+func (q *DelayQueue) SendScheduleMsg(payload string, t time.Time, opts ...SendOption) error {
+	_, err := q.SendScheduleMsgV2(payload, t, opts...)
+	return err
 }
 
-type msgTTLOpt time.Duration
-
-func WithMsgTTL(d time.Duration) interface{} {
-	return msgTTLOpt(d)
+// SendScheduleMsgV2 发送定时消息，并返回消息信息，可以通过消息ID查询或取消消息
+// 使用 WithDedupKey 且去重 key 已被占用时，返回 ErrDuplicateMessage 及已发送的消息ID
+func (q *DelayQueue) SendScheduleMsgV2(payload string, t time.Time, opts ...SendOption) (*MessageInfo, error) {
+	if q.deleted.Load() {
+		return nil, ErrQueueDeleted
+	}
+	if q.configErr != nil {
+		return nil, q.configErr
+	}
+	if err := q.checkSchedule(t); err != nil {
+		return nil, err
+	}
+	t, err := q.adjustPast(t)
+	if err != nil {
+		return nil, err
+	}
+	if q.sendLimiter != nil && !q.sendLimiter.allow(q.clock.Now()) {
+		return nil, ErrSendRateLimited
+	}
+	pending, err := q.newMessage(payload, t, opts...)
+	if err != nil {
+		return nil, err
+	}
+	ctx := pending.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var msg *MessageInfo
+	err = q.intercept(ctx, pending, 0, func(ctx context.Context, pending *PendingMessage) error {
+		q.contentDedup(pending)
+		if pending.DedupKey != "" {
+			existing, err := q.dedup(ctx, pending)
+			if err != nil {
+				msg = existing
+				return err
+			}
+		}
+		var err error
+		msg, err = q.push(ctx, pending.MessageInfo, pending.TTL)
+		if err != nil && pending.DedupKey != "" {
+			_ = q.broker.Release(ctx, pending.DedupKey)
+		}
+		return err
+	})
+	if err != nil {
+		if err != ErrDuplicateMessage {
+			msg = nil
+		}
+		return msg, err
+	}
+	q.recordStatus(context.Background(), msg.ID, StatusScheduled, msg.Time)
+	q.recordHistory(ctx, msg.ID, &HistoryRecord{Time: q.clock.Now().Unix(), Event: HistoryEnqueued})
+	q.incCounter(MetricSent, 1)
+	q.audit(ctx, AuditSend, msg.ID)
+	q.debugTransition(msg.ID, "", StagePending, "deliverAt", msg.Time.Format(time.RFC3339))
+	q.publishWakeup(ctx, msg.Time)
+	return msg, nil
 }
 
-// SendScheduleMsg 发送定时消息
-func (q *DelayQueue) SendScheduleMsg(payload string, t time.Time, opts ...interface{}) error {
-	// parse options
-	retryCount := q.defaultRetryCount
+// newMessage 根据发送参数创建在 t 时刻投递的消息
+func (q *DelayQueue) newMessage(payload string, t time.Time, opts ...SendOption) (*PendingMessage, error) {
+	cfg := &sendConfig{retryCount: q.defaultRetryCount, msgTTL: q.msgTTL, calendar: q.calendar}
 	for _, opt := range opts {
-		switch o := opt.(type) {
-		case retryCountOpt:
-			retryCount = uint(o)
-		case msgTTLOpt:
-			q.msgTTL = time.Duration(o)
+		opt(cfg)
+	}
+	// 投递时间精确到秒，不足一秒的抖动没有意义
+	if seconds := int64(cfg.jitter / time.Second); seconds > 0 {
+		t = t.Add(time.Duration(rand.Int63n(seconds)) * time.Second)
+	}
+	if cfg.calendar != nil {
+		t = cfg.calendar.Next(t)
+	}
+	// 抖动和工作日历可能将投递时间推迟到 maxDelay 之后
+	if err := q.checkSchedule(t); err != nil {
+		return nil, err
+	}
+	if q.latency != nil {
+		if cfg.headers == nil {
+			cfg.headers = make(map[string]string)
 		}
+		cfg.headers[HeaderScheduledAt] = strconv.FormatInt(t.Unix(), 10)
 	}
-	idStr := uuid.Must(uuid.NewRandom()).String()
-	ctx := context.Background()
-	now := time.Now()
-
-	//存储消息
-	msgTTL := t.Sub(now) + q.msgTTL
-	err := q.redisCli.Set(ctx, q.genMsgKey(idStr), payload, msgTTL).Err()
-	if err != nil {
-		return fmt.Errorf("store msg failed: %v", err)
+	if q.payloadVersion != 0 {
+		if cfg.headers == nil {
+			cfg.headers = make(map[string]string)
+		}
+		cfg.headers[HeaderPayloadVersion] = strconv.Itoa(q.payloadVersion)
 	}
-	//记录重试次数
-	err = q.redisCli.HSet(ctx, q.retryCountKey, idStr, retryCount).Err()
-	if err != nil {
-		return fmt.Errorf("store retry count failed: %v", err)
+	id := q.idGenerator.NewID(payload)
+	if err := q.checkID(id); err != nil {
+		return nil, err
+	}
+	if q.partitions != nil && cfg.partitionKey != "" {
+		id += "{" + cfg.partitionKey + "}"
+	}
+	msg := &MessageInfo{
+		ID:         id,
+		Payload:    payload,
+		State:      StagePending,
+		Time:       time.Unix(t.Unix(), 0),
+		RetryCount: int64(cfg.retryCount),
+		Tags:       cfg.tags,
+		Headers:    cfg.headers,
+	}
+	// 投递时间早于当前时间时消息会立即投递，过期时间从当前时间开始计算
+	ttl := cfg.msgTTL
+	if now := q.clock.Now(); t.After(now) {
+		ttl += t.Sub(now)
 	}
-	//加入pending队列
-	err = q.redisCli.ZAdd(ctx, q.pendingKey, &redis.Z{Score: float64(t.Unix()), Member: idStr}).Err()
+	return &PendingMessage{MessageInfo: msg, TTL: ttl, DedupKey: cfg.dedupKey, ctx: cfg.ctx}, nil
+}
+
+func (b *redisBroker) Push(ctx context.Context, msg *MessageInfo, ttl time.Duration) error {
+	q := b.q
+	// 使用事务保证消息内容、重试次数和 pending 队列同时写入，避免产生孤立的 key
+	pipe := q.redisCli.TxPipeline()
+	q.pushPipe(ctx, pipe, msg, ttl)
+	_, err := pipe.Exec(ctx)
 	if err != nil {
-		return fmt.Errorf("push to pending failed: %v", err)
+		return fmt.Errorf("store msg failed: %v", err)
 	}
 	return nil
 }
 
 // SendDelayMsg 发送延时消息
-func (q *DelayQueue) SendDelayMsg(payload string, duration time.Duration, opts ...interface{}) error {
-	t := time.Now().Add(duration)
+func (q *DelayQueue) SendDelayMsg(payload string, duration time.Duration, opts ...SendOption) error {
+	t, err := q.checkDelay(duration)
+	if err != nil {
+		return err
+	}
 	return q.SendScheduleMsg(payload, t, opts...)
 }
 
-// pending2ReadyScript 将消息从pending列表移入ready列表 保证原子性
-// 参数：currentTime、pendingKey、readyKey
-const pending2ReadyScript = `
-local msgs = redis.call('ZRangeByScore', KEYS[2], '0', ARGV[1])  -- get ready msg
-if (#msgs == 0) then return end
-local args2 = {'LPush', KEYS[3]} -- push into ready
-for _,v in ipairs(msgs) do
+// SendDelayMsgV2 发送延时消息，并返回消息信息
+func (q *DelayQueue) SendDelayMsgV2(payload string, duration time.Duration, opts ...SendOption) (*MessageInfo, error) {
+	t, err := q.checkDelay(duration)
+	if err != nil {
+		return nil, err
+	}
+	return q.SendScheduleMsgV2(payload, t, opts...)
+}
+
+// pending2ReadyFuncScript 供其它脚本拼接使用的 lua 函数，将到期的消息从 pending 移入 ready，返回移动的消息数量
+// 参数: pendingKey, readyKey, currentTime
+const pending2ReadyFuncScript = `
+local function pending2Ready(pendingKey, readyKey, now)
+	local msgs = redis.call('ZRangeByScore', pendingKey, '0', now)  -- get ready msg
+	if (#msgs == 0) then return 0 end
+	local args2 = {'LPush', readyKey} -- push into ready
+	for _,v in ipairs(msgs) do
 		table.insert(args2,v)
+	end
+	redis.call(unpack(args2))
+	redis.call('ZRemRangeByScore',pendingKey,'0',now)
+	return #msgs
 end
-redis.call(unpack(args2))
-redis.call('ZRemRangeByScore',KEYS[1],'0',ARGV[1])
 `
 
-func (q *DelayQueue) pending2Ready() error {
-	now := time.Now().Unix()
-	ctx := context.Background()
-	keys := []string{q.pendingKey, q.readyKey}
-	err := q.redisCli.Eval(ctx, pending2ReadyScript, keys, now).Err()
-	if err != nil && err != redis.Nil {
-		return fmt.Errorf("pending2ReadyScript failed: %v", err)
+// pending2ReadyScript 将消息从pending列表移入ready列表 保证原子性
+// KEYS: pendingKey, readyKey
+// ARGV: currentTime
+// 返回移动的消息数量
+const pending2ReadyScript = pending2ReadyFuncScript + `
+return pending2Ready(KEYS[1], KEYS[2], ARGV[1])
+`
+
+func (q *DelayQueue) pending2Ready() (int64, error) {
+	return q.broker.Pending2Ready(context.Background(), q.clock.Now())
+}
+
+func (b *redisBroker) Pending2Ready(ctx context.Context, now time.Time) (int64, error) {
+	q := b.q
+	if q.streams {
+		return b.pending2Stream(ctx, now)
 	}
-	return nil
+	var total int64
+	for shard := uint(0); shard < q.shards; shard++ {
+		keys := []string{q.shardKey(q.pendingKey, shard), q.shardKey(q.readyKey, shard)}
+		n, err := q.eval(ctx, pending2ReadyScript, keys, now.Unix()).Int64()
+		if err != nil && err != redis.Nil {
+			return total, fmt.Errorf("pending2ReadyScript failed: %v", err)
+		}
+		total += n
+	}
+	return total, nil
 }
 
 // ready2UnackScript 将一条等待投递的消息从 ready （或 retry） 移动到 unack 中，并把消息发送给消费者。
-// 参数: retryTime, readyKey/retryKey, unackKey
-const ready2UnackScript = `
+// 参数: retryTime, readyKey/retryKey, unackKey, attemptKey
+const ready2UnackScript = msgFieldScript + `
 local msg = redis.call('RPop',KEYS[1])
 if (not msg) then return end
 redis.call('ZAdd',KEYS[2],ARGV[1],msg)
+incrField(KEYS[3], msg, 'attempt', 1)
 return msg
 `
 
 func (q *DelayQueue) ready2Unack() (string, error) {
-	retryTime := time.Now().Add(q.maxConsumeDuration).Unix()
-	ctx := context.Background()
-	keys := []string{q.readyKey, q.unAckKey}
-	ret, err := q.redisCli.Eval(ctx, ready2UnackScript, keys, retryTime).Result()
-	if err == redis.Nil {
-		return "", err
+	idStr, err := q.broker.Ready2Unack(context.Background(), q.clock.Now().Add(q.maxConsumeDuration))
+	if err == nil {
+		q.debugTransition(idStr, StageReady, StageUnack)
 	}
-	if err != nil {
-		return "", fmt.Errorf("ready2UnackScript failed %v", err)
+	return idStr, err
+}
+
+func (q *DelayQueue) retry2Unack() (string, error) {
+	idStr, err := q.broker.Retry2Unack(context.Background(), q.clock.Now().Add(q.maxConsumeDuration))
+	if err == nil {
+		q.debugTransition(idStr, StageRetry, StageUnack)
 	}
-	str, ok := ret.(string)
-	if !ok {
-		return "", fmt.Errorf("illegal result: %#v", ret)
+	return idStr, err
+}
+
+// Ready2Unack 依次轮询各个 ready 分片，取出一条消息移入 unack
+func (b *redisBroker) Ready2Unack(ctx context.Context, deadline time.Time) (string, error) {
+	q := b.q
+	if q.partitions != nil {
+		return b.partition2Unack(ctx, deadline)
 	}
-	return str, nil
+	if q.streams {
+		return b.stream2Unack(ctx, deadline)
+	}
+	for i := uint(0); i < q.shards; i++ {
+		idStr, err := b.move2Unack(ctx, q.shardKey(q.readyKey, q.nextShard()), deadline)
+		if err == ErrNoMessage {
+			continue
+		}
+		return idStr, err
+	}
+	return "", ErrNoMessage
 }
 
-func (q *DelayQueue) retry2Unack() (string, error) {
-	retryTime := time.Now().Add(q.maxConsumeDuration).Unix()
-	ctx := context.Background()
-	keys := []string{q.retryKey, q.unAckKey}
-	ret, err := q.redisCli.Eval(ctx, ready2UnackScript, keys, retryTime, q.retryKey, q.unAckKey).Result()
+func (b *redisBroker) Retry2Unack(ctx context.Context, deadline time.Time) (string, error) {
+	return b.move2Unack(ctx, b.q.retryKey, deadline)
+}
+
+func (b *redisBroker) move2Unack(ctx context.Context, key string, deadline time.Time) (string, error) {
+	q := b.q
+	keys := []string{key, q.unAckKey, q.attemptKey}
+	ret, err := q.eval(ctx, ready2UnackScript, keys, deadline.Unix()).Result()
 	if err == redis.Nil {
-		return "", redis.Nil
+		return "", ErrNoMessage
 	}
 	if err != nil {
 		return "", fmt.Errorf("ready2UnackScript failed %v", err)
@@ -230,32 +589,163 @@ func (q *DelayQueue) retry2Unack() (string, error) {
 	return str, nil
 }
 
-func (q *DelayQueue) callback(idStr string) error {
+// callback 将消息交给 Handler 处理，并根据结果确认消息或标记为消费失败
+func (q *DelayQueue) callback(idStr string, deadline time.Time) error {
 	ctx := context.Background()
-	payload, err := q.redisCli.Get(ctx, q.genMsgKey(idStr)).Result()
-	if err == redis.Nil {
+	msg, err := q.broker.Message(ctx, idStr)
+	if err == ErrMessageNotFound {
 		return nil
 	}
 	if err != nil {
-		return fmt.Errorf("get message payload failed:%v", err)
+		return err
 	}
-	ack := q.cb(payload)
-	if ack {
-		err = q.ack(idStr)
+	if err := q.loadPayload(ctx, msg); err != nil {
+		return err
+	}
+	if expired, err := q.expireIfStale(ctx, msg); expired {
+		if err == nil {
+			q.archiveFailure(ctx, msg, q.clock.Now(), OutcomeExpired, nil)
+		}
+		if err == nil && q.deadLetterTTL == 0 {
+			q.deletePayloads(ctx, msg.payloadRef)
+		}
+		return err
+	}
+	if filtered, err := q.filterOut(ctx, msg); filtered {
+		return err
+	}
+	q.observeLatency(msg)
+	q.incCounter(MetricDelivered, 1)
+	q.audit(ctx, AuditDeliver, idStr)
+	if q.stuck != nil {
+		q.stuck.recordDelivery(idStr, q.clock.Now())
+	}
+	q.recordOwner(ctx, idStr, deadline)
+	q.recordHistory(ctx, idStr, &HistoryRecord{Time: q.clock.Now().Unix(), Event: HistoryDelivered})
+	q.recordStatus(ctx, idStr, StatusRunning, time.Time{})
+	start := q.clock.Now()
+	handleCtx := newDelivery(ctx, deadline, deadline.Sub(start))
+	q.deliveries.Store(idStr, handleCtx)
+	msg.Deadline = deadline
+	msg.queue = q
+	handleErr := q.runHandler(handleCtx, msg)
+	q.deliveries.Delete(idStr)
+	handleCtx.finish()
+	cost := q.clock.Now().Sub(start)
+	q.observeDuration(MetricConsumeDuration, cost)
+	q.observeConsume(msg, cost)
+	if handleCtx.isAborted() {
+		q.debugLog("message cancelled while handling", "id", idStr, "cost", cost)
+		return nil
+	}
+	if handleErr == ErrAckLater {
+		q.debugLog("message ack later", "id", idStr, "cost", cost)
+		return nil
+	}
+	q.breakerRecord(handleErr == nil)
+	if handleErr == nil && len(msg.next) > 0 {
+		err = q.ackAndChain(ctx, msg)
+		if err == nil {
+			q.deletePayloads(ctx, msg.payloadRef)
+			q.archiveAcked(ctx, msg, start)
+			q.sendReply(ctx, msg)
+			q.recordStatus(ctx, idStr, StatusSucceeded, time.Time{})
+			q.incCounter(MetricAcked, 1)
+			q.audit(ctx, AuditAck, idStr)
+			q.flow.add(&q.flow.unack2Ack, 1)
+			q.debugTransition(idStr, StageUnack, StageAcked, "cost", cost, "chained", len(msg.next))
+		}
+	} else if handleErr == nil {
+		err = q.broker.Ack(ctx, idStr)
+		if err == nil {
+			q.deletePayloads(ctx, msg.payloadRef)
+			q.archiveAcked(ctx, msg, start)
+			q.sendReply(ctx, msg)
+			q.recordStatus(ctx, idStr, StatusSucceeded, time.Time{})
+			q.incCounter(MetricAcked, 1)
+			q.audit(ctx, AuditAck, idStr)
+			q.flow.add(&q.flow.unack2Ack, 1)
+			q.debugTransition(idStr, StageUnack, StageAcked, "cost", cost)
+		}
 	} else {
-		err = q.nack(idStr)
+		q.recordHistory(ctx, idStr, &HistoryRecord{Time: q.clock.Now().Unix(), Event: HistoryNack, Error: handleErr.Error()})
+		if q.dropIfPermanent(ctx, msg, handleErr) {
+			q.archiveFailure(ctx, msg, start, OutcomePermanent, handleErr)
+			return nil
+		}
+		if q.quarantineIfPoison(ctx, msg, handleErr) {
+			q.archiveFailure(ctx, msg, start, OutcomePoisoned, handleErr)
+			return nil
+		}
+		err = q.nack(ctx, msg, handleErr)
+		if err == nil {
+			status := StatusFailed
+			if msg.RetriesLeft == 0 && q.deadLetterTTL > 0 {
+				status = StatusDead
+			}
+			q.recordStatus(ctx, idStr, status, time.Time{})
+			q.incCounter(MetricNacked, 1)
+			q.audit(ctx, AuditNack, idStr)
+			if msg.RetriesLeft == 0 {
+				q.audit(ctx, AuditDead, idStr)
+				q.archiveFailure(ctx, msg, start, OutcomeFailed, handleErr)
+			}
+			q.debugLog("message nacked", "id", idStr, "cost", cost, "error", handleErr)
+		}
 	}
 	return err
 }
 
-// batchCallback calls DelayQueue.callback in batch. callback is executed concurrently according to property DelayQueue.concurrent
+func (b *redisBroker) Message(ctx context.Context, idStr string) (*Message, error) {
+	q := b.q
+	pipe := q.redisCli.Pipeline()
+	cmds := q.readMsg(ctx, pipe, idStr)
+	_, _ = pipe.Exec(ctx)
+	stored, err := cmds.result()
+	if err == redis.Nil {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get message payload failed:%v", err)
+	}
+	msg := &Message{ID: idStr, Payload: stored.payload, Headers: stored.headers}
+	msg.RetriesLeft = int(stored.retryCount)
+	msg.Attempt = int(stored.attempt)
+	return msg, nil
+}
+
+// safeHandle 执行 Handler，Handler panic 时恢复并视为消费失败，避免消费协程退出
+func (q *DelayQueue) safeHandle(ctx context.Context, msg *Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+			q.logger.Error("callback panic", "queue", q.name, "id", msg.ID, "panic", r, "stack", string(debug.Stack()))
+			if q.errorHandler != nil {
+				q.errorHandler(fmt.Errorf("consume msg %s failed: %v", msg.ID, err))
+			}
+		}
+	}()
+	if err := q.upgradePayload(msg); err != nil {
+		return err
+	}
+	if q.chained != nil {
+		return q.chained(ctx, msg)
+	}
+	return q.handler(ctx, msg)
+}
+
+// batchCallback calls DelayQueue.callback in batch. callback is executed concurrently according to param concurrent
 // batchCallback must wait all callback finished, otherwise the actual number of processing messages may beyond DelayQueue.FetchLimit
-func (q *DelayQueue) batchCallback(ids []string) {
-	if len(ids) == 1 || q.concurrent == 1 {
+// deadline 为这批消息的处理超时时间
+func (q *DelayQueue) batchCallback(ids []string, concurrent uint, deadline time.Time) {
+	if q.slots != nil {
+		concurrent = uint(cap(q.slots))
+	}
+	if len(ids) == 1 || concurrent <= 1 {
 		for _, id := range ids {
-			err := q.callback(id)
+			err := q.sharedCallback(id, deadline)
 			if err != nil {
-				q.logger.Printf("consume msg %s failed:%v", id, err)
+				q.handleError(fmt.Errorf("consume msg %s failed: %v", id, err))
 			}
 		}
 		return
@@ -266,191 +756,337 @@ func (q *DelayQueue) batchCallback(ids []string) {
 	}
 	close(ch)
 	wg := sync.WaitGroup{}
-	concurrent := int(q.concurrent)
+	workers := int(concurrent)
 	// 无需太多的协程
-	if concurrent > len(ch) {
-		concurrent = len(ch)
+	if workers > len(ch) {
+		workers = len(ch)
 	}
-	wg.Add(concurrent)
-	for i := 0; i < concurrent; i++ {
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
 		go func() {
 			defer wg.Done()
 			for id := range ch {
-				err := q.callback(id)
+				err := q.sharedCallback(id, deadline)
 				if err != nil {
-					q.logger.Printf("consume msg %s failed: %v", id, err)
+					q.handleError(fmt.Errorf("consume msg %s failed: %v", id, err))
 				}
 			}
 		}()
 	}
 	wg.Wait()
 }
-func (q *DelayQueue) ack(idStr string) error {
-	ctx := context.Background()
-	err := q.redisCli.ZRem(ctx, q.unAckKey, idStr).Err()
-	if err != nil {
-		return fmt.Errorf("remove from unack failed: %v", err)
-	}
-	// msg key has ttl, ignore result of delete
-	_ = q.redisCli.Del(ctx, q.genMsgKey(idStr)).Err()
-	q.redisCli.HDel(ctx, q.retryCountKey, idStr)
-	return nil
-}
 
-func (q DelayQueue) nack(idStr string) error {
-	ctx := context.Background()
-	//更新重试时间为现在，unack2Retry 将立即将其重试
-	err := q.redisCli.ZAdd(ctx, q.unAckKey, &redis.Z{
-		Score:  float64(time.Now().Unix()),
-		Member: idStr,
-	}).Err()
-	if err != nil {
-		return fmt.Errorf("negative ack failed:%v", err)
+// sharedCallback 在 QueueManager 共享的并发数内处理消息
+func (q *DelayQueue) sharedCallback(idStr string, deadline time.Time) error {
+	if q.slots != nil {
+		q.slots <- struct{}{}
+		defer func() { <-q.slots }()
 	}
-	return nil
+	return q.callback(idStr, deadline)
 }
 
+// unack2RetryFuncScript 供其它脚本拼接使用的 lua 函数，需要拼接在 recordHistoryScript 和 msgFieldScript 之后
+// 将处理超时且 retryCount>0 的消息从 unack 移动到 retry，其余移动到 garbage，返回 进入retry的数量, 进入garbage的数量
+// 参数: unackKey, retryCountKey, retryKey, garbageKey, attemptKey, currentTime, 投递历史 key 前缀
+const unack2RetryFuncScript = `
+local function unack2Retry(unackKey, retryCountKey, retryKey, garbageKey, attemptKey, now, historyPrefix)
+	local msgs = redis.call('ZRangeByScore', unackKey, '0', now)  -- get retry msg
+	if (#msgs == 0) then return 0, 0 end
+	local retried, dropped = 0, 0
+	for _, k in ipairs(msgs) do
+		local v = getField(retryCountKey, k, 'retry') -- get retry count
+		if v ~= false and tonumber(v) > 0 then
+			incrField(retryCountKey, k, 'retry', -1) -- reduce retry count
+			redis.call("LPush", retryKey, k) -- add to retry
+			recordHistory(historyPrefix, k, now, 'retry')
+			retried = retried + 1
+		else
+			delField(retryCountKey, k, 'retry') -- del retry count
+			delField(attemptKey, k, 'attempt') -- del attempt count
+			redis.call("SAdd", garbageKey, k) -- add to garbage
+			recordHistory(historyPrefix, k, now, 'dead')
+			dropped = dropped + 1
+		end
+	end
+	redis.call('ZRemRangeByScore', unackKey, '0', now)  -- remove msgs from unack
+	return retried, dropped
+end
+`
+
 // unack2RetryScript 将retryCount>0的消息从unack列表 移动到retry列表中
 // 由于DelayQueue无法在eval unack2RetryScript之前确定垃圾消息，
 // 因此无法将keys参数传递给redisCli.eval
 // 因此unack2ReteryScript将垃圾消息移动到garbageKey，而不是直接删除
-// KEYS: currentTime, unackKey, retryCountKey, retryKey, garbageKey
-const unack2RetryScript = `
-local msgs = redis.call('ZRangeByScore', KEYS[1], '0', ARGV[1])  -- get retry msg
-if (#msgs == 0) then return end
-local retryCounts = redis.call('HMGet', KEYS[2], unpack(msgs)) -- get retry count
-for i,v in ipairs(retryCounts) do
-	local k = msgs[i]
-	if tonumber(v) > 0 then
-		redis.call("HIncrBy", KEYS[2], k, -1) -- reduce retry count
-		redis.call("LPush", KEYS[3], k) -- add to retry
-	else
-		redis.call("HDel", KEYS[2], k) -- del retry count
-		redis.call("SAdd", KEYS[4], k) -- add to garbage
-	end
-end
-redis.call('ZRemRangeByScore', KEYS[1], '0', ARGV[1])  -- remove msgs from unack
+// KEYS: unackKey, retryCountKey, retryKey, garbageKey, attemptKey
+// ARGV: currentTime, 投递历史 key 前缀
+// 返回 {进入retry的数量, 进入garbage的数量}
+const unack2RetryScript = recordHistoryScript + msgFieldScript + unack2RetryFuncScript + `
+local retried, dropped = unack2Retry(KEYS[1], KEYS[2], KEYS[3], KEYS[4], KEYS[5], ARGV[1], ARGV[2])
+return {retried, dropped}
 `
 
-func (q *DelayQueue) unack2Retry() error {
-	ctx := context.Background()
-	keys := []string{q.unAckKey, q.retryCountKey, q.retryKey, q.garbageKey}
-	now := time.Now()
-	err := q.redisCli.Eval(ctx, unack2RetryScript, keys, now.Unix()).Err()
+func (b *redisBroker) Unack2Retry(ctx context.Context, now time.Time) (retried int64, dropped int64, err error) {
+	q := b.q
+	keys := []string{q.unAckKey, q.retryCountKey, q.retryKey, q.garbageKey, q.attemptKey}
+	ret, err := q.eval(ctx, unack2RetryScript, keys, now.Unix(), q.historyPrefix()).Result()
 	if err != nil && err != redis.Nil {
-		return fmt.Errorf("unack to retry script failed:%v", err)
+		return 0, 0, fmt.Errorf("unack to retry script failed:%v", err)
 	}
-	return nil
+	if counts, ok := ret.([]interface{}); ok && len(counts) == 2 {
+		retried, _ = counts[0].(int64)
+		dropped, _ = counts[1].(int64)
+	}
+	return retried, dropped, nil
 }
 
-// garbageCollect 清理已到最大重试次数的消息
+// garbageCollect 清理已到最大重试次数的消息，启用死信队列时将其移入死信队列
 func (q *DelayQueue) garbageCollect() error {
-	ctx := context.Background()
+	n, err := q.broker.CollectGarbage(context.Background(), q.clock.Now(), q.deadLetterTTL)
+	if err != nil {
+		return err
+	}
+	q.flow.add(&q.flow.garbage2Dead, n)
+	q.debugFlow(StageGarbage, StageDead, n)
+	return nil
+}
+
+func (b *redisBroker) CollectGarbage(ctx context.Context, now time.Time, deadLetterTTL time.Duration) (int64, error) {
+	q := b.q
 	msgIds, err := q.redisCli.SMembers(ctx, q.garbageKey).Result()
 	if err != nil {
-		return fmt.Errorf("smembers failed:%v", err)
+		return 0, fmt.Errorf("smembers failed:%v", err)
+	}
+	q.archiveGarbage(ctx, msgIds)
+	if deadLetterTTL > 0 {
+		// garbage 为空时仍需执行，以清理超过保留时间的死信
+		return b.garbage2Dead(ctx, now, deadLetterTTL, msgIds)
 	}
 	if len(msgIds) == 0 {
-		return nil
+		return 0, nil
 	}
 	// allow concurrent clean
-	msgKeys := make([]string, 0, len(msgIds))
+	msgKeys := make([]string, 0, len(msgIds)*4)
 	for _, idStr := range msgIds {
-		msgKeys = append(msgKeys, q.genMsgKey(idStr))
+		msgKeys = append(msgKeys, q.genMsgKey(idStr), q.genHistoryKey(idStr), q.genHeadersKey(idStr), q.genOwnerKey(idStr))
 	}
 	err = q.redisCli.Del(ctx, msgKeys...).Err()
 	if err != nil && err != redis.Nil {
-		return fmt.Errorf("del msgs failed: %v", err)
+		return 0, fmt.Errorf("del msgs failed: %v", err)
 	}
 	err = q.redisCli.SRem(ctx, q.garbageKey, msgIds).Err()
 	if err != nil && err != redis.Nil {
-		return fmt.Errorf("remove from garbage key failed:%v", err)
+		return 0, fmt.Errorf("remove from garbage key failed:%v", err)
 	}
-	return nil
+	return 0, nil
 }
 
-// consume 消费消息
-func (q *DelayQueue) consume() error {
-	//pending2Ready
-	err := q.pending2Ready()
-	if err != nil {
-		return err
-	}
-	//consume
-	ids := make([]string, 0, q.fetchLimit)
+// fetch 从 ready 或 retry 中取出至多 limit 条消息，limit 为 0 表示不限制
+func (q *DelayQueue) fetch(pop func() (string, error), limit uint) ([]string, error) {
+	ids := make([]string, 0, limit)
 	for true {
-		idStr, err := q.ready2Unack()
-		if err == redis.Nil {
+		if q.limiter != nil && !q.limiter.allow(q.clock.Now()) {
+			break
+		}
+		idStr, err := pop()
+		if err != nil && q.limiter != nil {
+			q.limiter.refund()
+		}
+		if err == ErrNoMessage {
 			break
 		}
 		if err != nil {
-			return err
+			return ids, err
 		}
 		ids = append(ids, idStr)
-		if q.fetchLimit > 0 && len(ids) >= int(q.fetchLimit) {
+		if limit > 0 && len(ids) >= int(limit) {
 			break
 		}
 	}
-	if len(ids) > 0 {
-		q.batchCallback(ids)
+	return ids, nil
+}
+
+// consume 消费消息
+func (q *DelayQueue) consume() error {
+	q.flow.reset()
+	defer q.saveFlow()
+	// 某个阶段出错时记录错误并继续执行之后的阶段，保证 unack2Retry 和垃圾回收在每个消费周期都会执行
+	var errs consumeErrors
+	errs.add(q.registerGroup(context.Background()))
+	if q.works() {
+		errs.add(q.rebalance(context.Background()))
+	}
+	if q.tickEnabled() {
+		q.consumeTick(&errs)
+		return errs.err()
+	}
+	//pending2Ready
+	if q.schedules() {
+		n, err := q.pending2Ready()
+		errs.add(err)
+		q.flow.add(&q.flow.pending2Ready, n)
+		q.debugFlow(StagePending, StageReady, n)
+	}
+	deliver := false
+	if q.works() {
+		var err error
+		deliver, err = q.canDeliver()
+		errs.add(err)
+	}
+	fetchLimit, concurrent := q.consumeLimits()
+	if q.BreakerState() == BreakerHalfOpen {
+		fetchLimit, concurrent = 1, 1
+	}
+	//consume
+	if deliver && q.partitions != nil {
+		errs.add(q.deliverPartitions(fetchLimit, concurrent))
+	} else if deliver && q.retryOrder == RetryInterleave {
+		errs.add(q.deliver(q.interleave(), nil, fetchLimit, concurrent))
+	} else if deliver && q.retryOrder == RetryFirst {
+		errs.add(q.deliver(q.retry2Unack, &q.flow.retry2Unack, fetchLimit, concurrent))
+		errs.add(q.deliver(q.ready2Unack, &q.flow.ready2Unack, fetchLimit, concurrent))
+	} else if deliver {
+		errs.add(q.deliver(q.ready2Unack, &q.flow.ready2Unack, fetchLimit, concurrent))
 	}
 	// unack to retry
-	err = q.unack2Retry()
-	if err != nil {
-		return err
+	if q.schedules() {
+		errs.add(q.unack2Retry())
+		errs.add(q.garbageCollect())
 	}
-	err = q.garbageCollect()
-	if err != nil {
+	//retry
+	if q.partitions != nil {
+		// 分区模式下重试的消息放回所在分区，由持有分区的消费者按顺序投递
+		errs.add(q.requeueRetries(context.Background()))
+	} else if deliver && q.retryOrder == RetryLast {
+		errs.add(q.deliver(q.retry2Unack, &q.flow.retry2Unack, fetchLimit, concurrent))
+	}
+	if q.schedules() {
+		errs.add(q.detectStuck())
+	}
+	return errs.err()
+}
+
+// unack2Retry 将处理超时的消息移入 retry，已达重试上限的消息移入 garbage
+func (q *DelayQueue) unack2Retry() error {
+	retried, dropped, err := q.broker.Unack2Retry(context.Background(), q.clock.Now())
+	q.flow.add(&q.flow.unack2Retry, retried)
+	q.flow.add(&q.flow.unack2Garbage, dropped)
+	q.incCounter(MetricRetried, retried)
+	q.incCounter(MetricDead, dropped)
+	q.debugFlow(StageUnack, StageRetry, retried)
+	q.debugFlow(StageUnack, StageGarbage, dropped)
+	return err
+}
+
+// deliver 从 ready 或 retry 中取出消息并交给 Handler 处理，counter 为记录流转数量的字段，为 nil 时由 pop 记录
+// 取出部分消息后发生错误时，已取出的消息仍会被处理
+func (q *DelayQueue) deliver(pop func() (string, error), counter *int64, fetchLimit, concurrent uint) error {
+	limit, ok, err := q.backpressureLimit(fetchLimit)
+	if err != nil || !ok {
 		return err
 	}
-	//retry
-	ids = make([]string, 0, q.fetchLimit)
-	for true {
-		idStr, err := q.retry2Unack()
-		if err == redis.Nil {
-			break
-		}
-		if err != nil {
-			return err
-		}
-		ids = append(ids, idStr)
-		if q.fetchLimit > 0 && len(ids) >= int(q.fetchLimit) {
-			break
-		}
+	deadline := q.clock.Now().Add(q.maxConsumeDuration)
+	ids, err := q.fetch(pop, limit)
+	if counter != nil {
+		q.flow.add(counter, int64(len(ids)))
 	}
 	if len(ids) > 0 {
-		q.batchCallback(ids)
+		q.batchCallback(ids, concurrent, deadline)
 	}
-	return nil
+	return err
+}
+
+// consumeErrors 一个消费周期中各阶段发生的错误
+type consumeErrors []error
+
+func (e *consumeErrors) add(err error) {
+	if err != nil {
+		*e = append(*e, err)
+	}
+}
+
+// err 没有错误时返回 nil，只有一个错误时直接返回该错误
+func (e consumeErrors) err() error {
+	switch len(e) {
+	case 0:
+		return nil
+	case 1:
+		return e[0]
+	}
+	return e
+}
+
+func (e consumeErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ProcessOnce 执行一次消费周期：将到期的消息移入 ready 并投递，处理超时重试并清理已达重试上限的消息，
+// 返回本次消费周期内各阶段之间流转的消息数量
+// 适用于由定时任务（如 Lambda、Cloud Run Job）驱动队列而不常驻消费协程的场景，不应与 StartConsume 同时使用
+func (q *DelayQueue) ProcessOnce() (FlowStats, error) {
+	if q.deleted.Load() {
+		return FlowStats{}, ErrQueueDeleted
+	}
+	if q.configErr != nil {
+		return FlowStats{}, q.configErr
+	}
+	err := q.consume()
+	return q.LastFlow(), err
 }
 
 // StartConsume 创建一个协程去队列中消费消息
 // 使用 `<-done`来让消费者等待
 func (q *DelayQueue) StartConsume() (done <-chan struct{}) {
-	q.ticker = time.NewTicker(q.fetchInterval)
 	done0 := make(chan struct{})
+	if q.deleted.Load() {
+		close(done0)
+		return done0
+	}
+	// 配置错误时不启动消费协程，错误交给 WithErrorHandler 或输出日志
+	if q.configErr != nil {
+		q.handleError(q.configErr)
+		close(done0)
+		return done0
+	}
+	q.started.Store(true)
+	q.startedAt.Store(q.clock.Now().UnixNano())
+	q.ticker = q.clock.NewTicker(q.fetchInterval)
+	q.registerConsumer()
+	go q.watchCancel(q.close)
+	go q.watchWakeup(q.close)
 	go func() {
+		defer q.unregisterConsumer()
+		defer q.leavePartitions()
 	tickerLoop:
 		for true {
 			select {
-			case <-q.ticker.C:
-				err := q.consume()
-				if err != nil {
-					log.Printf("consume error: %v", err)
-				}
+			case <-q.ticker.C():
+			case <-q.wakeup:
+				q.debugLog("consumer woken up")
 			case <-q.close:
 				break tickerLoop
 			}
+			q.tick()
+			err := q.consumeWithBackoff()
+			if err != nil {
+				q.handleError(err)
+			}
 		}
 		close(done0)
 	}()
 	return done0
 }
 
-// StopConsume 停止消费者协程
+// StopConsume 停止消费者协程，可以重复调用
 func (q *DelayQueue) StopConsume() {
-	close(q.close)
-	if q.ticker != nil {
-		q.ticker.Stop()
-	}
+	q.closeOnce.Do(func() {
+		close(q.close)
+		if q.ticker != nil {
+			q.ticker.Stop()
+		}
+		q.cache.close()
+	})
 }
@@ -4,9 +4,11 @@ import (
 	"context"
 	"fmt"
 	"github.com/go-redis/redis/v8"
+	"io"
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -124,3 +126,181 @@ func TestDelayQueue_ConcurrentConsume(t *testing.T) {
 		}
 	}
 }
+
+func TestDelayQueue_Peek(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	}).WithShards(3)
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		err := queue.SendScheduleMsg(strconv.Itoa(i), now.Add(time.Duration(10-i)*time.Minute))
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	msgs, err := queue.PeekPending(ctx, 3)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(msgs) != 3 || msgs[0].Payload != "9" || msgs[1].Payload != "8" || msgs[2].Payload != "7" {
+		t.Errorf("unexpected pending messages: %+v", msgs)
+	}
+	for i := 0; i < 4; i++ {
+		err := queue.SendDelayMsg("ready", 0)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := queue.pending2Ready(); err != nil {
+		t.Error(err)
+		return
+	}
+	msgs, err = queue.PeekReady(ctx, 10)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(msgs) != 4 {
+		t.Errorf("expect 4 ready messages, actual %d", len(msgs))
+	}
+	stats, _ := queue.Stats(ctx)
+	if stats.Ready != 4 || stats.Pending != 10 {
+		t.Errorf("peek should not change state: %+v", stats)
+	}
+}
+
+func TestDelayQueue_ProcessOnce(t *testing.T) {
+	redisCli := newTestRedis(t)
+	size := 5
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	}).WithFetchLimit(3)
+	for i := 0; i < size; i++ {
+		err := queue.SendDelayMsg(strconv.Itoa(i), 0)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	flow, err := queue.ProcessOnce()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if flow != (FlowStats{Pending2Ready: int64(size), Ready2Unack: 3, Unack2Ack: 3}) {
+		t.Errorf("unexpected flow of first cycle: %+v", flow)
+	}
+	flow, err = queue.ProcessOnce()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if flow != (FlowStats{Ready2Unack: 2, Unack2Ack: 2}) {
+		t.Errorf("unexpected flow of second cycle: %+v", flow)
+	}
+}
+
+func TestDelayQueue_ErrorHandler(t *testing.T) {
+	redisCli := redis.NewClient(&redis.Options{
+		Addr: "127.0.0.1:6379",
+	})
+	errs := make(chan error, 10)
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	}).WithFetchInterval(time.Millisecond * 10).WithErrorHandler(func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	})
+	_ = redisCli.Close()
+	done := queue.StartConsume()
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Error("expect non-nil error")
+		}
+	case <-time.After(time.Second):
+		t.Error("expect error handler called")
+	}
+	queue.StopConsume()
+	<-done
+}
+
+func TestDelayQueue_CallbackPanic(t *testing.T) {
+	redisCli := newTestRedis(t)
+	calls := 0
+	var handled error
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		calls++
+		if calls == 1 {
+			panic("boom")
+		}
+		return true
+	}).WithLogger(log.New(io.Discard, "", 0)).WithErrorHandler(func(err error) {
+		handled = err
+	})
+	err := queue.SendDelayMsg("hello", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	flow, err := queue.ProcessOnce()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// 回调函数 panic 后消息立即重试，并在同一个消费周期内再次投递
+	if flow.Unack2Retry != 1 || flow.Retry2Unack != 1 || flow.Unack2Ack != 1 {
+		t.Errorf("expect panicked message retried, flow: %+v", flow)
+	}
+	if handled == nil || !strings.Contains(handled.Error(), "boom") {
+		t.Errorf("expect panic reported to error handler, actual: %v", handled)
+	}
+}
+
+func TestDelayQueue_Jitter(t *testing.T) {
+	queue := NewMemoryQueue("test", func(string) bool { return true })
+	at := time.Now().Add(time.Hour).Truncate(time.Second)
+	times := map[int64]bool{}
+	for i := 0; i < 50; i++ {
+		msg, err := queue.SendScheduleMsgV2("retry", at, WithJitter(10*time.Minute))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if msg.Time.Before(at) || !msg.Time.Before(at.Add(10*time.Minute)) {
+			t.Errorf("deliver time %s out of jitter window", msg.Time)
+		}
+		times[msg.Time.Unix()] = true
+	}
+	if len(times) < 2 {
+		t.Error("expect deliver times spread by jitter")
+	}
+}
+
+func TestDelayQueue_SendRateLimit(t *testing.T) {
+	redisCli := newTestRedis(t)
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	}).WithSendRateLimit(1, 2)
+	for i := 0; i < 2; i++ {
+		if err := queue.SendDelayMsg("msg", time.Hour); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if err := queue.SendDelayMsg("msg", time.Hour); err != ErrSendRateLimited {
+		t.Errorf("expect ErrSendRateLimited, actual %v", err)
+	}
+	state := queue.SendLimiterState()
+	if state.Tokens >= 1 || state.RetryAfter <= 0 || state.RetryAfter > time.Second {
+		t.Errorf("unexpected state: %+v", state)
+	}
+	time.Sleep(state.RetryAfter)
+	if err := queue.SendDelayMsg("msg", time.Hour); err != nil {
+		t.Error(err)
+	}
+}
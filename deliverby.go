@@ -0,0 +1,98 @@
+package delayqueue
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// HeaderDeliverBy WithDeliverBy 使用的 header，值为最晚投递时间的 unix 秒
+const HeaderDeliverBy = "delayqueue-deliver-by"
+
+// WithDeliverBy 设置消息的最晚投递时间，超过该时间才被取出的消息（例如故障恢复后积压的消息）不再投递给 Handler，
+// 而是调用 WithExpiredHandler 注册的回调函数并按达到重试上限处理：启用死信队列时移入死信队列，否则删除
+// 每次投递前都会检查，重试时已超过最晚投递时间的消息同样会被丢弃
+func WithDeliverBy(t time.Time) SendOption {
+	return WithHeader(HeaderDeliverBy, strconv.FormatInt(t.Unix(), 10))
+}
+
+// WithExpiredHandler 注册超过最晚投递时间的消息的回调函数，在消息移入死信队列或删除之前调用
+func (q *DelayQueue) WithExpiredHandler(handler func(msg *Message)) *DelayQueue {
+	if q.frozen("WithExpiredHandler") {
+		return q
+	}
+	q.expiredHandler = handler
+	return q
+}
+
+// deliverBy 返回消息的最晚投递时间，未设置时返回 false
+func (m *Message) deliverBy() (time.Time, bool) {
+	v, ok := m.Headers[HeaderDeliverBy]
+	if !ok {
+		return time.Time{}, false
+	}
+	sec, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(sec, 0), true
+}
+
+// expireIfStale 消息已超过最晚投递时间时将其丢弃并返回 true
+func (q *DelayQueue) expireIfStale(ctx context.Context, msg *Message) (bool, error) {
+	deliverBy, ok := msg.deliverBy()
+	if !ok || !q.clock.Now().After(deliverBy) {
+		return false, nil
+	}
+	if q.expiredHandler != nil {
+		q.expiredHandler(msg)
+	}
+	err := q.broker.Drop(ctx, msg.ID, q.clock.Now(), HistoryExpired)
+	if err != nil {
+		return true, err
+	}
+	status := StatusExpired
+	if q.deadLetterTTL > 0 {
+		status = StatusDead
+	}
+	q.recordStatus(ctx, msg.ID, status, time.Time{})
+	q.incCounter(MetricDead, 1)
+	q.audit(ctx, AuditDead, msg.ID)
+	q.debugLog("message expired", "id", msg.ID, "deliverBy", deliverBy.Format(time.RFC3339))
+	return true, nil
+}
+
+// dropScript 将 unack 中的消息直接移入 garbage，不再重试
+// KEYS: unackKey, retryCountKey, garbageKey, attemptKey
+// ARGV: 消息ID, currentTime, 投递历史 key 前缀, 投递历史中记录的事件
+const dropScript = recordHistoryScript + msgFieldScript + `
+if redis.call('ZRem', KEYS[1], ARGV[1]) == 0 then return 0 end
+delField(KEYS[2], ARGV[1], 'retry')
+delField(KEYS[4], ARGV[1], 'attempt')
+redis.call('SAdd', KEYS[3], ARGV[1])
+recordHistory(ARGV[3], ARGV[1], ARGV[2], ARGV[4])
+return 1
+`
+
+func (b *redisBroker) Drop(ctx context.Context, idStr string, now time.Time, event string) error {
+	q := b.q
+	keys := []string{q.unAckKey, q.retryCountKey, q.garbageKey, q.attemptKey}
+	err := q.eval(ctx, dropScript, keys, idStr, now.Unix(), q.historyPrefix(), event).Err()
+	if err != nil {
+		return fmt.Errorf("drop msg failed: %v", err)
+	}
+	return nil
+}
+
+func (b *memoryBroker) Drop(ctx context.Context, idStr string, now time.Time, event string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.unack[idStr]; !ok {
+		return nil
+	}
+	delete(b.unack, idStr)
+	b.garbage[idStr] = struct{}{}
+	b.appendHistory(idStr, &HistoryRecord{Time: now.Unix(), Event: event})
+	return nil
+}
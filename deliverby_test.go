@@ -0,0 +1,58 @@
+package delayqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_DeliverBy(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	var delivered []string
+	var expired []string
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		delivered = append(delivered, s)
+		return true
+	}).WithDeadLetter(time.Hour).WithStatusTracking(time.Hour).WithExpiredHandler(func(msg *Message) {
+		expired = append(expired, msg.Payload)
+	})
+	now := time.Now()
+	stale, err := queue.SendScheduleMsgV2("stale", now.Add(-time.Minute), WithDeliverBy(now.Add(-time.Second)))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if err := queue.SendScheduleMsg("fresh", now.Add(-time.Minute), WithDeliverBy(now.Add(time.Hour))); err != nil {
+		t.Error(err)
+		return
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := queue.ProcessOnce(); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if len(delivered) != 1 || delivered[0] != "fresh" {
+		t.Errorf("unexpected delivered: %v", delivered)
+	}
+	if len(expired) != 1 || expired[0] != "stale" {
+		t.Errorf("unexpected expired: %v", expired)
+	}
+	dead, _, err := queue.ListDead(ctx, "", 10)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(dead) != 1 || dead[0].ID != stale.ID {
+		t.Errorf("unexpected dead messages: %+v", dead)
+		return
+	}
+	if len(dead[0].History) == 0 || dead[0].History[len(dead[0].History)-1].Event != HistoryExpired {
+		t.Errorf("unexpected history: %+v", dead[0].History)
+	}
+	status, err := queue.GetStatus(ctx, stale.ID)
+	if err != nil || status.Status != StatusDead {
+		t.Errorf("unexpected status: %+v, %v", status, err)
+	}
+}
@@ -0,0 +1,97 @@
+package delayqueue
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// QueueInfo 队列的基本信息
+type QueueInfo struct {
+	Name   string      `json:"name"`
+	Shards uint        `json:"shards"` // 根据 redis 中存在的分片 key 推断的分片数
+	Stats  *QueueStats `json:"stats"`
+}
+
+// queueKeySuffixes 队列结构 key 的后缀，较长的后缀在前以免误匹配
+var queueKeySuffixes = []string{":retry:cnt", ":attempt", ":pending", ":ready", ":unack", ":retry", ":garbage", ":paused", ":dead"}
+
+// parseQueueKey 从队列结构 key 中解析出队列名称和分片号，消息 key 及无法识别的 key 返回 false
+func parseQueueKey(key string, prefix string) (name string, shard uint, ok bool) {
+	if !strings.HasPrefix(key, prefix) {
+		return "", 0, false
+	}
+	key = key[len(prefix):]
+	if strings.Contains(key, ":msg:") {
+		return "", 0, false
+	}
+	// pending 和 ready 的分片 key 形如 dp:{name}:pending:{shard}
+	if i := strings.LastIndexByte(key, ':'); i > 0 {
+		if n, err := strconv.ParseUint(key[i+1:], 10, 32); err == nil {
+			base := key[:i]
+			for _, suffix := range []string{":pending", ":ready"} {
+				if strings.HasSuffix(base, suffix) && len(base) > len(suffix) {
+					return strings.TrimSuffix(base, suffix), uint(n), true
+				}
+			}
+		}
+	}
+	for _, suffix := range queueKeySuffixes {
+		if strings.HasSuffix(key, suffix) && len(key) > len(suffix) {
+			return strings.TrimSuffix(key, suffix), 0, true
+		}
+	}
+	return "", 0, false
+}
+
+// ListQueues 扫描 redis 中的 dp:* key，返回已存在的队列及其各阶段的消息数量
+// 仅包含消息 key 的队列不会被列出
+func ListQueues(ctx context.Context, redisCli *redis.Client) ([]*QueueInfo, error) {
+	return ListQueuesWithPrefix(ctx, redisCli, DefaultKeyPrefix)
+}
+
+// ListQueuesWithPrefix 与 ListQueues 相同，扫描使用 WithKeyPrefix 自定义前缀的队列
+func ListQueuesWithPrefix(ctx context.Context, redisCli *redis.Client, prefix string) ([]*QueueInfo, error) {
+	shards := make(map[string]uint)
+	var cursor uint64
+	for {
+		keys, next, err := redisCli.Scan(ctx, cursor, escapePattern(prefix)+"*", 1000).Result()
+		if err != nil {
+			return nil, fmt.Errorf("scan queue keys failed: %v", err)
+		}
+		for _, key := range keys {
+			name, shard, ok := parseQueueKey(key, prefix)
+			if !ok {
+				continue
+			}
+			if shard+1 > shards[name] {
+				shards[name] = shard + 1
+			}
+		}
+		cursor = next
+		if cursor == 0 {
+			break
+		}
+	}
+	queues := make([]*QueueInfo, 0, len(shards))
+	for name, n := range shards {
+		q := newDelayQueue(name, redisCli).WithKeyPrefix(prefix).WithShards(n)
+		stats, err := q.Stats(ctx)
+		if err != nil {
+			return nil, err
+		}
+		queues = append(queues, &QueueInfo{
+			Name:   name,
+			Shards: n,
+			Stats:  stats,
+		})
+	}
+	sort.Slice(queues, func(i, j int) bool {
+		return queues[i].Name < queues[j].Name
+	})
+	return queues, nil
+}
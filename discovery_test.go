@@ -0,0 +1,86 @@
+package delayqueue
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListQueues(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	cb := func(s string) bool {
+		return true
+	}
+	orders := NewDelayQueue("orders", redisCli, cb).WithShards(3)
+	for i := 0; i < 10; i++ {
+		err := orders.SendDelayMsg("order", time.Hour)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	mails := NewDelayQueue("mail:daily", redisCli, cb)
+	if err := mails.SendDelayMsg("mail", time.Hour); err != nil {
+		t.Error(err)
+	}
+	queues, err := ListQueues(ctx, redisCli)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(queues) != 2 {
+		t.Errorf("expect 2 queues, actual %d", len(queues))
+		return
+	}
+	if queues[0].Name != "mail:daily" || queues[0].Stats.Pending != 1 {
+		t.Errorf("unexpected queue: %+v", queues[0])
+	}
+	if queues[1].Name != "orders" || queues[1].Stats.Pending != 10 {
+		t.Errorf("unexpected queue: %+v", queues[1])
+	}
+}
+
+func TestKeyPrefix(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	cb := func(s string) bool {
+		return true
+	}
+	staging := NewDelayQueue("orders", redisCli, cb).WithKeyPrefix("staging:dp:")
+	prod := NewDelayQueue("orders", redisCli, cb)
+	for i := 0; i < 3; i++ {
+		if err := staging.SendDelayMsg("order", time.Hour); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := prod.SendDelayMsg("order", time.Hour); err != nil {
+		t.Error(err)
+	}
+	stats, err := prod.Stats(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if stats.Pending != 1 {
+		t.Errorf("expect 1 pending message, actual %d", stats.Pending)
+	}
+	queues, err := ListQueuesWithPrefix(ctx, redisCli, "staging:dp:")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(queues) != 1 || queues[0].Name != "orders" || queues[0].Stats.Pending != 3 {
+		t.Errorf("unexpected queues: %+v", queues)
+	}
+	keys, err := redisCli.Keys(ctx, "*").Result()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "dp:") && !strings.HasPrefix(key, "staging:dp:") {
+			t.Errorf("unexpected key: %s", key)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package delayqueue
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// WithDeadLetter 启用死信队列，已达重试上限的消息不再直接删除，而是移入死信队列并保留 ttl 时间
+// 死信消息可以通过 RequeueDead 重新投递
+func (q *DelayQueue) WithDeadLetter(ttl time.Duration) *DelayQueue {
+	if q.frozen("WithDeadLetter") {
+		return q
+	}
+	q.deadLetterTTL = ttl
+	return q
+}
+
+// garbage2DeadScript 将 garbage 中的消息移入死信队列，并将消息内容、投递历史及 header 的过期时间延长为死信保留时间
+// 同时从死信队列中移除超过保留时间的消息，它们的消息内容等已经过期
+// 只移动 ARGV 中指定的消息，脚本执行前新进入 garbage 的消息留到下一次清理
+// KEYS: garbageKey, deadKey
+// ARGV: currentTime, deadLetterTTL(秒), 消息 key 的前缀, 消息ID...
+const garbage2DeadScript = `
+redis.call('ZRemRangeByScore', KEYS[2], '0', tonumber(ARGV[1]) - tonumber(ARGV[2]))
+local count = 0
+for i = 4, #ARGV do
+	local id = ARGV[i]
+	if redis.call('SRem', KEYS[1], id) == 1 then
+		redis.call('ZAdd', KEYS[2], ARGV[1], id)
+		redis.call('Expire', ARGV[3] .. id, ARGV[2])
+		redis.call('Expire', ARGV[3] .. id .. ':history', ARGV[2])
+		redis.call('Expire', ARGV[3] .. id .. ':headers', ARGV[2])
+		count = count + 1
+	end
+end
+return count
+`
+
+func (b *redisBroker) garbage2Dead(ctx context.Context, now time.Time, deadLetterTTL time.Duration, ids []string) (int64, error) {
+	q := b.q
+	keys := []string{q.garbageKey, q.deadKey}
+	ttl := int64(deadLetterTTL / time.Second)
+	if ttl < 1 {
+		ttl = 1
+	}
+	args := make([]interface{}, 0, len(ids)+3)
+	args = append(args, now.Unix(), ttl, q.genMsgKey(""))
+	for _, idStr := range ids {
+		args = append(args, idStr)
+	}
+	n, err := q.eval(ctx, garbage2DeadScript, keys, args...).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("garbage2DeadScript failed: %v", err)
+	}
+	return n, nil
+}
+
+// requeueDeadScript 将死信消息重新放入 ready，并重置重试次数和消息内容、投递历史的过期时间
+// 消息内容已过期的死信消息会被直接移除
+// KEYS: deadKey, readyKey, retryCountKey, attemptKey[, streamIndexKey]
+// 启用 WithStreams 时 readyKey 为 streamKey，消息追加到 stream 中并写入索引
+// ARGV: retryCount, msgTTL(秒), 消息 key 的前缀, 消息ID...
+const requeueDeadScript = recordHistoryScript + msgFieldScript + `
+local function pushReady(id)
+	if KEYS[5] then
+		local entry = redis.call('XAdd', KEYS[2], '*', 'id', id)
+		redis.call('HSet', KEYS[5], id, entry)
+	else
+		redis.call('LPush', KEYS[2], id)
+	end
+end
+local now = redis.call('Time')[1]
+local count = 0
+for i = 4, #ARGV do
+	local id = ARGV[i]
+	if redis.call('ZRem', KEYS[1], id) > 0 then
+		if redis.call('Expire', ARGV[3] .. id, ARGV[2]) == 1 then
+			setField(KEYS[3], id, 'retry', ARGV[1])
+			delField(KEYS[4], id, 'attempt')
+			pushReady(id)
+			recordHistory(ARGV[3], id, now, 'requeued')
+			redis.call('Expire', ARGV[3] .. id .. ':history', ARGV[2])
+			redis.call('Expire', ARGV[3] .. id .. ':headers', ARGV[2])
+			count = count + 1
+		end
+	end
+end
+return count
+`
+
+// RequeueDead 将死信消息重新投递，并重置重试次数，不指定消息ID时重新投递所有死信消息
+// 返回重新投递的消息数量，内容已过期的死信消息会被移除且不计入数量
+func (q *DelayQueue) RequeueDead(ctx context.Context, ids ...string) (int, error) {
+	return q.broker.RequeueDead(ctx, q.defaultRetryCount, q.msgTTL, ids...)
+}
+
+func (b *redisBroker) RequeueDead(ctx context.Context, retryCount uint, msgTTL time.Duration, ids ...string) (int, error) {
+	q := b.q
+	if len(ids) == 0 {
+		all, err := q.redisCli.ZRange(ctx, q.deadKey, 0, -1).Result()
+		if err != nil {
+			return 0, fmt.Errorf("get dead msgs failed: %v", err)
+		}
+		ids = all
+	}
+	// 消息需要放回所属的 ready 分片，启用 WithStreams 时 ready 不分片
+	shards := make(map[uint][]interface{})
+	for _, idStr := range ids {
+		shard := uint(0)
+		if !q.streams {
+			shard = q.shardOf(idStr)
+		}
+		shards[shard] = append(shards[shard], idStr)
+	}
+	ttl := int64(msgTTL / time.Second)
+	if ttl < 1 {
+		ttl = 1
+	}
+	var total int
+	for shard, shardIds := range shards {
+		keys := []string{q.deadKey, q.shardKey(q.readyKey, shard), q.retryCountKey, q.attemptKey}
+		if q.streams {
+			keys = []string{q.deadKey, q.streamKey(), q.retryCountKey, q.attemptKey, q.streamIndexKey()}
+		}
+		args := append([]interface{}{retryCount, ttl, q.genMsgKey("")}, shardIds...)
+		n, err := q.eval(ctx, requeueDeadScript, keys, args...).Int()
+		if err != nil {
+			return total, fmt.Errorf("requeueDeadScript failed: %v", err)
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// DeadMessage 死信消息
+type DeadMessage struct {
+	*MessageInfo
+	// LastError 最后一次投递失败的原因
+	LastError string `json:"lastError"`
+	// Failures 每次投递失败的时间及原因，按时间顺序排列，受投递历史数量的限制只包含最近的几次
+	Failures []*Failure `json:"failures"`
+	// History 投递历史，最多保留最近 20 条
+	History []*HistoryRecord `json:"history"`
+}
+
+// ListDead 分页遍历死信消息，并返回最后一次投递失败的原因及投递历史，cursor 的用法与 List 相同
+func (q *DelayQueue) ListDead(ctx context.Context, cursor string, count int64) ([]*DeadMessage, string, error) {
+	return q.broker.ListDead(ctx, cursor, count)
+}
+
+func (b *redisBroker) ListDead(ctx context.Context, cursor string, count int64) ([]*DeadMessage, string, error) {
+	q := b.q
+	msgs, next, err := q.List(ctx, StageDead, cursor, count)
+	if err != nil {
+		return nil, "", err
+	}
+	dead := make([]*DeadMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		history, err := q.GetHistory(ctx, msg.ID)
+		if err != nil {
+			return nil, "", fmt.Errorf("get history failed: %v", err)
+		}
+		dead = append(dead, &DeadMessage{
+			MessageInfo: msg,
+			LastError:   lastError(history),
+			Failures:    failures(history),
+			History:     history,
+		})
+	}
+	return dead, next, nil
+}
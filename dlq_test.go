@@ -0,0 +1,152 @@
+package delayqueue
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestDelayQueue_DeadLetter(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	size := 3
+	retryCount := 2
+	fail := true
+	deliveryCount := make(map[string]int)
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		deliveryCount[s]++
+		return !fail
+	}).WithDeadLetter(time.Hour).WithMaxConsumeDuration(0)
+	for i := 0; i < size; i++ {
+		err := queue.SendDelayMsg(strconv.Itoa(i), 0, WithRetryCount(retryCount))
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		if err := queue.consume(); err != nil {
+			t.Errorf("consume error: %v", err)
+			return
+		}
+	}
+	dead, next, err := queue.ListDead(ctx, "", 10)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(dead) != size || next != "" {
+		t.Errorf("expect %d dead messages, actual %d", size, len(dead))
+		return
+	}
+	for _, msg := range dead {
+		if msg.LastError != "negative ack" {
+			t.Errorf("unexpected last error: %s", msg.LastError)
+		}
+		delivered := 0
+		for _, record := range msg.History {
+			if record.Event == HistoryDelivered {
+				delivered++
+			}
+		}
+		if delivered != retryCount+1 {
+			t.Errorf("expect %d deliveries in history, actual %d", retryCount+1, delivered)
+		}
+	}
+
+	fail = false
+	n, err := queue.RequeueDead(ctx)
+	if err != nil || n != size {
+		t.Errorf("expect %d requeued, actual %d %v", size, n, err)
+	}
+	if err := queue.consume(); err != nil {
+		t.Errorf("consume error: %v", err)
+		return
+	}
+	stats, _ := queue.Stats(ctx)
+	if stats.Dead != 0 || stats.Unack != 0 || stats.Ready != 0 {
+		t.Errorf("unexpected stats after requeue: %+v", stats)
+	}
+	for k, v := range deliveryCount {
+		if v != retryCount+2 {
+			t.Errorf("expect %d delivery, actual %d. key: %s", retryCount+2, v, k)
+		}
+	}
+	if n := redisCli.Keys(ctx, queue.genMsgKey("*")).Val(); len(n) != 0 {
+		t.Errorf("expect message keys removed after ack, actual %v", n)
+	}
+}
+
+func TestDelayQueue_DeadLetterFailures(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	queue := NewDelayQueueWithHandler("test", redisCli, func(ctx context.Context, msg *Message) error {
+		return fmt.Errorf("fail %d", msg.Attempt)
+	}).WithDeadLetter(time.Hour).WithDefaultRetryCount(2)
+	if err := queue.SendDelayMsg("hello", 0); err != nil {
+		t.Error(err)
+		return
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := queue.ProcessOnce(); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	dead, _, err := queue.ListDead(ctx, "", 10)
+	if err != nil || len(dead) != 1 {
+		t.Errorf("expect 1 dead message: %d, %v", len(dead), err)
+		return
+	}
+	var reasons []string
+	for _, failure := range dead[0].Failures {
+		reasons = append(reasons, failure.Reason)
+	}
+	if !reflect.DeepEqual(reasons, []string{"fail 1", "fail 2", "fail 3"}) || dead[0].LastError != "fail 3" {
+		t.Errorf("unexpected failures: %v, last error: %s", reasons, dead[0].LastError)
+	}
+}
+
+func TestFailures(t *testing.T) {
+	records := []*HistoryRecord{
+		{Time: 1, Event: HistoryDelivered},
+		{Time: 2, Event: HistoryNack, Error: "boom"},
+		{Time: 2, Event: HistoryRetry},
+		{Time: 3, Event: HistoryDelivered},
+		{Time: 9, Event: HistoryDead},
+	}
+	expect := []*Failure{{Time: 2, Reason: "boom"}, {Time: 9, Reason: errConsumeTimeout}}
+	if actual := failures(records); !reflect.DeepEqual(actual, expect) {
+		t.Errorf("unexpected failures: %+v", actual)
+	}
+}
+
+func TestDelayQueue_DeadLetterExpire(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	}).WithDeadLetter(time.Hour)
+	now := time.Now()
+	redisCli.ZAdd(ctx, queue.deadKey,
+		&redis.Z{Score: float64(now.Add(-2 * time.Hour).Unix()), Member: "expired"},
+		&redis.Z{Score: float64(now.Add(-time.Minute).Unix()), Member: "alive"},
+	)
+	if err := queue.garbageCollect(); err != nil {
+		t.Error(err)
+		return
+	}
+	ids, err := redisCli.ZRange(ctx, queue.deadKey, 0, -1).Result()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// 超过保留时间的死信消息应被移除
+	if len(ids) != 1 || ids[0] != "alive" {
+		t.Errorf("unexpected dead msgs: %v", ids)
+	}
+}
@@ -0,0 +1,61 @@
+package delayqueue
+
+// EventCode 事件类型
+type EventCode int
+
+const (
+	// QueueDeletedEvent 队列已被删除
+	QueueDeletedEvent EventCode = iota + 1
+	// QueuePurgedEvent 队列已被清空
+	QueuePurgedEvent
+	// BreakerOpenEvent 熔断器打开，暂停投递，MsgCount 为连续失败的次数
+	BreakerOpenEvent
+	// BreakerHalfOpenEvent 熔断器冷却结束，开始探测
+	BreakerHalfOpenEvent
+	// BreakerClosedEvent 熔断器关闭，恢复正常投递
+	BreakerClosedEvent
+	// QueueDegradedEvent redis 暂时不可用，消费周期开始退避
+	QueueDegradedEvent
+	// QueueRecoveredEvent redis 恢复可用，消费周期恢复正常间隔
+	QueueRecoveredEvent
+)
+
+// Event 队列事件
+type Event struct {
+	Code      EventCode
+	Queue     string // 队列名称
+	Timestamp int64  // 事件发生时间，unix 秒
+	MsgCount  int    // 事件涉及的消息数量
+}
+
+// EventListener 事件监听器
+type EventListener interface {
+	OnEvent(*Event)
+}
+
+// WithEventListener 注册事件监听器，可以多次调用注册多个监听器
+// OnEvent 在消费协程中同步调用，不应执行耗时操作
+func (q *DelayQueue) WithEventListener(listener EventListener) *DelayQueue {
+	if q.frozen("WithEventListener") {
+		return q
+	}
+	if listener != nil {
+		q.listeners = append(q.listeners, listener)
+	}
+	return q
+}
+
+func (q *DelayQueue) emit(code EventCode, msgCount int) {
+	if len(q.listeners) == 0 {
+		return
+	}
+	event := &Event{
+		Code:      code,
+		Queue:     q.name,
+		Timestamp: q.clock.Now().Unix(),
+		MsgCount:  msgCount,
+	}
+	for _, listener := range q.listeners {
+		listener.OnEvent(event)
+	}
+}
@@ -0,0 +1,293 @@
+package delayqueue
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// exportVersion 导出格式的版本，格式不兼容时递增
+const exportVersion = 1
+
+// ErrUnsupportedExport 导入的数据不是 Export 导出的格式或版本不受支持
+var ErrUnsupportedExport = errors.New("unsupported export format")
+
+// exportHeader 导出数据的第一行
+type exportHeader struct {
+	Version int    `json:"version"`
+	Queue   string `json:"queue"`
+	Time    int64  `json:"time"` // 导出时间，unix 秒
+}
+
+// exportRecord 导出数据中的一条消息，每行一条
+type exportRecord struct {
+	ID         string `json:"id"`
+	Payload    string `json:"payload"`
+	State      string `json:"state"`
+	Score      int64  `json:"score,omitempty"` // pending、unack 和 dead 中的 score，unix 秒
+	RetryCount int64  `json:"retryCount"`
+	// ExpireAt 消息内容的过期时间，unix 毫秒，为 0 时表示不过期
+	ExpireAt int64             `json:"expireAt,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	History  []*HistoryRecord  `json:"history,omitempty"`
+}
+
+// exportBatch Export 每次批量读取的消息数量
+const exportBatch = 100
+
+// Export 将队列中所有消息的内容、所处阶段、重试次数、header 及投递历史以 JSON Lines 格式写入 w，返回导出的消息数量
+// 各阶段的消息ID在同一个事务中读取，导出期间被确认或过期的消息会被跳过
+func (q *DelayQueue) Export(ctx context.Context, w io.Writer) (int, error) {
+	if err := q.requireRedis("Export"); err != nil {
+		return 0, err
+	}
+	snapshot, err := q.snapshot(ctx)
+	if err != nil {
+		return 0, err
+	}
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	err = enc.Encode(&exportHeader{
+		Version: exportVersion,
+		Queue:   q.name,
+		Time:    q.clock.Now().Unix(),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("write export failed: %v", err)
+	}
+	count := 0
+	for _, key := range q.stageKeys() {
+		entries := snapshot.entries[key]
+		for start := 0; start < len(entries); start += exportBatch {
+			end := start + exportBatch
+			if end > len(entries) {
+				end = len(entries)
+			}
+			records, err := q.exportRecords(ctx, snapshot.stages[key], entries[start:end])
+			if err != nil {
+				return count, err
+			}
+			for _, record := range records {
+				if err := enc.Encode(record); err != nil {
+					return count, fmt.Errorf("write export failed: %v", err)
+				}
+				count++
+			}
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return count, fmt.Errorf("write export failed: %v", err)
+	}
+	return count, nil
+}
+
+// exportRecords 批量读取消息内容、重试次数、header、过期时间和投递历史
+func (q *DelayQueue) exportRecords(ctx context.Context, state string, entries []redis.Z) ([]*exportRecord, error) {
+	pipe := q.redisCli.Pipeline()
+	msgs := make([]*msgCmds, len(entries))
+	ttls := make([]*redis.DurationCmd, len(entries))
+	histories := make([]*redis.StringSliceCmd, len(entries))
+	for i, entry := range entries {
+		idStr := entry.Member.(string)
+		msgs[i] = q.readMsg(ctx, pipe, idStr)
+		ttls[i] = pipe.PTTL(ctx, q.genMsgKey(idStr))
+		histories[i] = pipe.LRange(ctx, q.genHistoryKey(idStr), 0, -1)
+	}
+	_, err := pipe.Exec(ctx)
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("read msgs failed: %v", err)
+	}
+	now := q.clock.Now()
+	records := make([]*exportRecord, 0, len(entries))
+	for i, entry := range entries {
+		stored, err := msgs[i].result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read msg failed: %v", err)
+		}
+		record := &exportRecord{
+			ID:         entry.Member.(string),
+			Payload:    stored.payload,
+			State:      state,
+			RetryCount: stored.retryCount,
+			Headers:    stored.headers,
+		}
+		switch state {
+		case StagePending, StageUnack, StageDead:
+			record.Score = int64(entry.Score)
+		}
+		if ttl := ttls[i].Val(); ttl > 0 {
+			record.ExpireAt = now.Add(ttl).UnixMilli()
+		}
+		for _, item := range histories[i].Val() {
+			history := &HistoryRecord{}
+			if err := json.Unmarshal([]byte(item), history); err == nil {
+				record.History = append(record.History, history)
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// importScript 写入一条消息，消息已存在时跳过
+// KEYS: stateKey, retryCountKey, msgKey, historyKey, headersKey(使用 WithHashStorage 时为 msgKey)[, streamIndexKey]
+// ARGV: 消息ID, 消息内容, 过期时间(毫秒，0 表示不过期), 重试次数(为空时不写入), 存储类型, score,
+// header 字段数 n, n 个 header 字段和值, 投递历史...
+// 返回是否写入
+const importScript = msgFieldScript + `
+if redis.call('Exists', KEYS[3]) == 1 then return 0 end
+if isHashStorage(KEYS[2]) then
+	redis.call('HSet', KEYS[3], 'payload', ARGV[2])
+else
+	redis.call('Set', KEYS[3], ARGV[2])
+end
+if ARGV[3] ~= '0' then
+	redis.call('PExpire', KEYS[3], ARGV[3])
+end
+if ARGV[5] == 'zset' then
+	redis.call('ZAdd', KEYS[1], ARGV[6], ARGV[1])
+elseif ARGV[5] == 'list' then
+	redis.call('RPush', KEYS[1], ARGV[1])
+elseif ARGV[5] == 'stream' then
+	local entry = redis.call('XAdd', KEYS[1], '*', 'id', ARGV[1])
+	redis.call('HSet', KEYS[6], ARGV[1], entry)
+else
+	redis.call('SAdd', KEYS[1], ARGV[1])
+end
+if ARGV[4] ~= '' then
+	setField(KEYS[2], ARGV[1], 'retry', ARGV[4])
+end
+local n = tonumber(ARGV[7])
+if n > 0 then
+	if KEYS[5] ~= KEYS[3] then
+		redis.call('Del', KEYS[5])
+	end
+	local args = {'HSet', KEYS[5]}
+	for i = 8, 7 + n * 2 do
+		table.insert(args, ARGV[i])
+	end
+	redis.call(unpack(args))
+	if KEYS[5] ~= KEYS[3] and ARGV[3] ~= '0' then
+		redis.call('PExpire', KEYS[5], ARGV[3])
+	end
+end
+local h = 8 + n * 2
+if #ARGV >= h then
+	redis.call('Del', KEYS[4])
+	for i = h, #ARGV do
+		redis.call('RPush', KEYS[4], ARGV[i])
+	end
+	if ARGV[3] ~= '0' then
+		redis.call('PExpire', KEYS[4], ARGV[3])
+	end
+end
+return 1
+`
+
+// Import 导入 Export 导出的消息，返回导入的消息数量
+// 消息会按当前队列的分片数放入对应阶段，并保留投递时间、重试次数、header 和投递历史；已存在的消息会被跳过
+// 导出时已设置过期时间但导入时已过期的消息，会以 msgTTL 作为过期时间
+func (q *DelayQueue) Import(ctx context.Context, r io.Reader) (int, error) {
+	if err := q.requireRedis("Import"); err != nil {
+		return 0, err
+	}
+	if q.deleted.Load() {
+		return 0, ErrQueueDeleted
+	}
+	dec := json.NewDecoder(bufio.NewReader(r))
+	header := &exportHeader{}
+	if err := dec.Decode(header); err != nil {
+		return 0, fmt.Errorf("read export header failed: %v", err)
+	}
+	if header.Version != exportVersion {
+		return 0, ErrUnsupportedExport
+	}
+	count := 0
+	for {
+		record := &exportRecord{}
+		err := dec.Decode(record)
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, fmt.Errorf("read export record failed: %v", err)
+		}
+		imported, err := q.importRecord(ctx, record)
+		if err != nil {
+			return count, err
+		}
+		if imported {
+			count++
+		}
+	}
+}
+
+func (q *DelayQueue) importRecord(ctx context.Context, record *exportRecord) (bool, error) {
+	shard := q.shardOf(record.ID)
+	var key, kind string
+	switch record.State {
+	case StagePending:
+		key, kind = q.shardKey(q.pendingKey, shard), "zset"
+	case StageReady:
+		key, kind = q.shardKey(q.readyKey, shard), "list"
+		if q.streams {
+			key, kind = q.streamKey(), "stream"
+		}
+	case StageUnack:
+		key, kind = q.unAckKey, "zset"
+	case StageRetry:
+		key, kind = q.retryKey, "list"
+	case StageGarbage:
+		key, kind = q.garbageKey, "set"
+	case StageDead:
+		key, kind = q.deadKey, "zset"
+	default:
+		return false, fmt.Errorf("unknown state of msg %s: %s", record.ID, record.State)
+	}
+	// 消息内容保存在外部存储中，没有外部存储时导入后无法投递
+	if record.Headers[HeaderPayloadRef] != "" && q.payloadStore == nil {
+		return false, fmt.Errorf("payload of %s is in external store, but no PayloadStore is configured", record.ID)
+	}
+	var ttl int64
+	if record.ExpireAt > 0 {
+		ttl = time.UnixMilli(record.ExpireAt).Sub(q.clock.Now()).Milliseconds()
+		if ttl <= 0 {
+			ttl = q.msgTTL.Milliseconds()
+		}
+	}
+	retryCount := ""
+	if needsPayload(record.State) {
+		retryCount = fmt.Sprint(record.RetryCount)
+	}
+	headersKey := q.genHeadersKey(record.ID)
+	headerPrefix := ""
+	if q.hashStorage {
+		headersKey, headerPrefix = q.genMsgKey(record.ID), hashHeaderPrefix
+	}
+	args := []interface{}{record.ID, record.Payload, ttl, retryCount, kind, record.Score, len(record.Headers)}
+	for k, v := range record.Headers {
+		args = append(args, headerPrefix+k, v)
+	}
+	for _, history := range record.History {
+		data, _ := json.Marshal(history)
+		args = append(args, data)
+	}
+	keys := []string{key, q.retryCountKey, q.genMsgKey(record.ID), q.genHistoryKey(record.ID), headersKey}
+	if kind == "stream" {
+		keys = append(keys, q.streamIndexKey())
+	}
+	imported, err := q.eval(ctx, importScript, keys, args...).Int()
+	if err != nil {
+		return false, fmt.Errorf("importScript failed: %v", err)
+	}
+	return imported == 1, nil
+}
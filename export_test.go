@@ -0,0 +1,189 @@
+package delayqueue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_ExportImport(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return false
+	}).WithDeadLetter(time.Hour).WithMaxConsumeDuration(0)
+	pending, err := queue.SendDelayMsgV2("pending", time.Hour, WithRetryCount(5), WithHeader("trace", "abc"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	dead, err := queue.SendDelayMsgV2("dead", 0, WithRetryCount(0))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for i := 0; i < 2; i++ {
+		if err := queue.consume(); err != nil {
+			t.Errorf("consume error: %v", err)
+			return
+		}
+	}
+	ready, err := queue.SendDelayMsgV2("ready", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := queue.pending2Ready(); err != nil {
+		t.Error(err)
+		return
+	}
+	ids := []string{pending.ID, dead.ID, ready.ID}
+	before := make(map[string]*MessageInfo)
+	for _, idStr := range ids {
+		before[idStr], err = queue.GetMessage(ctx, idStr)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	history, _ := queue.GetHistory(ctx, dead.ID)
+
+	buf := &bytes.Buffer{}
+	n, err := queue.Export(ctx, buf)
+	if err != nil || n != len(ids) {
+		t.Errorf("expect %d exported messages, actual %d, err: %v", len(ids), n, err)
+		return
+	}
+	if err := queue.Purge(ctx); err != nil {
+		t.Error(err)
+		return
+	}
+	data := buf.Bytes()
+	n, err = queue.Import(ctx, bytes.NewReader(data))
+	if err != nil || n != len(ids) {
+		t.Errorf("expect %d imported messages, actual %d, err: %v", len(ids), n, err)
+		return
+	}
+	for _, idStr := range ids {
+		after, err := queue.GetMessage(ctx, idStr)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !reflect.DeepEqual(before[idStr], after) {
+			t.Errorf("expect %+v, actual %+v", before[idStr], after)
+		}
+	}
+	if restored, _ := queue.GetHistory(ctx, dead.ID); !reflect.DeepEqual(history, restored) {
+		t.Errorf("history of dead msg not restored")
+	}
+	report, err := queue.Verify(ctx)
+	if err != nil || !report.OK() {
+		t.Errorf("unexpected verify report: %+v, err: %v", report, err)
+	}
+	// 已存在的消息不会被重复导入
+	n, err = queue.Import(ctx, bytes.NewReader(data))
+	if err != nil || n != 0 {
+		t.Errorf("expect no imported messages, actual %d, err: %v", n, err)
+	}
+}
+
+func TestDelayQueue_ExportImportHeaders(t *testing.T) {
+	for _, hashStorage := range []bool{false, true} {
+		redisCli := newTestRedis(t)
+		ctx := context.Background()
+		queue := NewDelayQueue("test", redisCli, func(s string) bool {
+			return true
+		})
+		if hashStorage {
+			queue.WithHashStorage()
+		}
+		headers := map[string]string{"trace": "abc", "tenant": "t1"}
+		msg, err := queue.SendDelayMsgV2("hello", time.Hour, WithHeaders(headers))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		buf := &bytes.Buffer{}
+		if _, err := queue.Export(ctx, buf); err != nil {
+			t.Error(err)
+			return
+		}
+		if err := queue.Purge(ctx); err != nil {
+			t.Error(err)
+			return
+		}
+		if _, err := queue.Import(ctx, buf); err != nil {
+			t.Error(err)
+			return
+		}
+		info, err := queue.GetMessage(ctx, msg.ID)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !reflect.DeepEqual(info.Headers, headers) {
+			t.Errorf("hash storage %v: expect headers %v, actual %v", hashStorage, headers, info.Headers)
+		}
+		if !hashStorage {
+			// header 的过期时间与消息内容一致
+			if ttl := redisCli.TTL(ctx, queue.genHeadersKey(msg.ID)).Val(); ttl <= 0 {
+				t.Errorf("expect headers with ttl, actual %v", ttl)
+			}
+		}
+	}
+}
+
+func TestDelayQueue_ExportClock(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	// 时钟比系统时间快一天，导出的时间戳及过期时间都应以队列的时钟为准
+	clock := &driftingClock{}
+	clock.skew.Store(int64(-24 * time.Hour))
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	}).WithClock(clock)
+	if _, err := queue.SendDelayMsgV2("hello", time.Hour); err != nil {
+		t.Error(err)
+		return
+	}
+	buf := &bytes.Buffer{}
+	if _, err := queue.Export(ctx, buf); err != nil {
+		t.Error(err)
+		return
+	}
+	exported := buf.Bytes()
+	dec := json.NewDecoder(bytes.NewReader(exported))
+	header, record := &exportHeader{}, &exportRecord{}
+	if err := dec.Decode(header); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := dec.Decode(record); err != nil {
+		t.Error(err)
+		return
+	}
+	if diff := header.Time - clock.Now().Unix(); diff < -1 || diff > 1 {
+		t.Errorf("export time should come from queue clock: %d", header.Time)
+	}
+	expireAt := clock.Now().Add(queue.msgTTL + time.Hour)
+	if diff := time.UnixMilli(record.ExpireAt).Sub(expireAt); diff < -time.Second || diff > time.Second {
+		t.Errorf("expect expire at %s, actual %s", expireAt, time.UnixMilli(record.ExpireAt))
+	}
+	if err := queue.Purge(ctx); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := queue.Import(ctx, bytes.NewReader(exported)); err != nil {
+		t.Error(err)
+		return
+	}
+	// 导入时按同一个时钟计算剩余的过期时间
+	ttl := redisCli.PTTL(ctx, queue.genMsgKey(record.ID)).Val()
+	if diff := ttl - (queue.msgTTL + time.Hour); diff < -time.Second || diff > time.Second {
+		t.Errorf("unexpected ttl after import: %v", ttl)
+	}
+}
@@ -0,0 +1,56 @@
+package delayqueue
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+// ExpvarMetrics 将指标发布到 expvar，无需额外依赖即可通过 /debug/vars 查看
+// 指标按队列名称分组，如 {"delayqueue": {"orders": {"sent": 10, "acked": 8, ...}}}，
+// 耗时类指标发布为 name_count 和 name_seconds 两个累计值
+type ExpvarMetrics struct {
+	mu   sync.Mutex
+	root *expvar.Map
+}
+
+// NewExpvarMetrics 创建发布在 expvar 变量 name 下的 ExpvarMetrics，name 已被发布时复用已有的变量
+// name 已被其它类型的变量使用时 panic
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	if v := expvar.Get(name); v != nil {
+		return &ExpvarMetrics{root: v.(*expvar.Map)}
+	}
+	return &ExpvarMetrics{root: expvar.NewMap(name)}
+}
+
+// IncCounter 计数器增加 delta
+func (m *ExpvarMetrics) IncCounter(name string, delta int64, tags ...string) {
+	m.queueMap(tags).Add(name, delta)
+}
+
+// ObserveDuration 累加次数和耗时
+func (m *ExpvarMetrics) ObserveDuration(name string, d time.Duration, tags ...string) {
+	queue := m.queueMap(tags)
+	queue.Add(name+"_count", 1)
+	queue.AddFloat(name+"_seconds", d.Seconds())
+}
+
+// queueMap 返回 tags 中 queue 标签对应的 expvar.Map
+func (m *ExpvarMetrics) queueMap(tags []string) *expvar.Map {
+	queue := ""
+	for i := 0; i+1 < len(tags); i += 2 {
+		if tags[i] == "queue" {
+			queue = tags[i+1]
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if v := m.root.Get(queue); v != nil {
+		return v.(*expvar.Map)
+	}
+	created := new(expvar.Map).Init()
+	m.root.Set(queue, created)
+	return created
+}
+
+var _ Metrics = (*ExpvarMetrics)(nil)
@@ -0,0 +1,33 @@
+package delayqueue
+
+import (
+	"expvar"
+	"testing"
+)
+
+func TestExpvarMetrics(t *testing.T) {
+	redisCli := newTestRedis(t)
+	queue := NewDelayQueue("expvar", redisCli, func(s string) bool {
+		return true
+	}).WithMetrics(NewExpvarMetrics("delayqueue_test"))
+	if err := queue.SendDelayMsg("msg", 0); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	// 重复创建时复用已发布的变量
+	root := NewExpvarMetrics("delayqueue_test").root
+	if expvar.Get("delayqueue_test") != root {
+		t.Error("expect published map reused")
+	}
+	vars := root.Get("expvar").(*expvar.Map)
+	for _, name := range []string{MetricSent, MetricDelivered, MetricAcked, MetricConsumeDuration + "_count"} {
+		v := vars.Get(name)
+		if v == nil || v.String() != "1" {
+			t.Errorf("unexpected %s: %v", name, v)
+		}
+	}
+}
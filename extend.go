@@ -0,0 +1,44 @@
+package delayqueue
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// extendScript 仅当消息在 unack 中时更新其处理超时时间
+// KEYS: unackKey
+// ARGV: deadline, 消息ID
+const extendScript = `
+if not redis.call('ZScore', KEYS[1], ARGV[2]) then return 0 end
+redis.call('ZAdd', KEYS[1], ARGV[1], ARGV[2])
+return 1
+`
+
+// Extend 将正在处理的消息的处理超时时间设置为当前时间之后的 d，避免耗时较长的消息在处理完成前被重新投递
+// 消息由当前实例处理时，传给 Handler 的 ctx 的取消时间也会相应推迟
+// 消息不在处理中（未投递、已确认或已超时）时返回 ErrMessageNotFound
+func (q *DelayQueue) Extend(ctx context.Context, idStr string, d time.Duration) error {
+	deadline := q.clock.Now().Add(d)
+	err := q.broker.Extend(ctx, idStr, deadline)
+	if err != nil {
+		return err
+	}
+	if v, ok := q.deliveries.Load(idStr); ok {
+		v.(*delivery).extend(deadline, d)
+	}
+	q.debugLog("message extended", "id", idStr, "deadline", deadline.Format(time.RFC3339))
+	return nil
+}
+
+func (b *redisBroker) Extend(ctx context.Context, idStr string, deadline time.Time) error {
+	q := b.q
+	n, err := q.eval(ctx, extendScript, []string{q.unAckKey}, deadline.Unix(), idStr).Int64()
+	if err != nil {
+		return fmt.Errorf("extend msg failed: %v", err)
+	}
+	if n == 0 {
+		return ErrMessageNotFound
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package delayqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_Extend(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	var queue *DelayQueue
+	queue = NewDelayQueueWithHandler("test", redisCli, func(ctx context.Context, msg *Message) error {
+		err := queue.Extend(ctx, msg.ID, time.Minute)
+		if err != nil {
+			return err
+		}
+		deadline, _ := ctx.Deadline()
+		if deadline.Before(time.Now().Add(30 * time.Second)) {
+			t.Errorf("expect deadline of context extended, actual: %s", deadline)
+		}
+		info, err := queue.GetMessage(ctx, msg.ID)
+		if err != nil {
+			return err
+		}
+		if info.State != StageUnack || info.Time.Before(time.Now().Add(30*time.Second)) {
+			t.Errorf("expect unack deadline extended, actual: %+v", info)
+		}
+		select {
+		case <-ctx.Done():
+			t.Error("expect context not cancelled after extend")
+		case <-time.After(300 * time.Millisecond):
+		}
+		return nil
+	}).WithMaxConsumeDuration(100 * time.Millisecond)
+	_, err := queue.SendDelayMsgV2("hello", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	flow, err := queue.ProcessOnce()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if flow.Unack2Ack != 1 {
+		t.Errorf("expect message acked, flow: %+v", flow)
+	}
+	err = queue.Extend(ctx, "not-exist", time.Minute)
+	if err != ErrMessageNotFound {
+		t.Errorf("expect ErrMessageNotFound, actual: %v", err)
+	}
+}
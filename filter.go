@@ -0,0 +1,71 @@
+package delayqueue
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// WithHeaderFilter 只处理 header 满足 filter 的消息，使多个专门的消费者可以共用一个队列
+// 不满足的消息不会交给 Handler：reroute 不为 nil 时以相同的内容和 header 立即发送到 reroute 并确认，
+// 否则放回 pending 由下一个消费周期重新投递给其它消费者，放回不消耗重试次数和投递次数
+// 没有任何消费者接受的消息会一直被放回，直到消息内容过期
+func (q *DelayQueue) WithHeaderFilter(filter func(headers map[string]string) bool, reroute *DelayQueue) *DelayQueue {
+	if q.frozen("WithHeaderFilter") {
+		return q
+	}
+	q.headerFilter = filter
+	q.reroute = reroute
+	return q
+}
+
+// filterOut 消息不满足 WithHeaderFilter 时将其转发或放回，返回 true
+func (q *DelayQueue) filterOut(ctx context.Context, msg *Message) (bool, error) {
+	if q.headerFilter == nil || q.headerFilter(msg.Headers) {
+		return false, nil
+	}
+	if q.reroute == nil {
+		q.debugLog("message filtered out, requeue", "id", msg.ID)
+		return true, q.broker.Requeue(ctx, msg.ID, q.clock.Now())
+	}
+	forwarded, err := q.reroute.SendDelayMsgV2(msg.Payload, 0, WithHeaders(msg.Headers))
+	if err != nil {
+		return true, fmt.Errorf("reroute msg failed: %v", err)
+	}
+	q.debugLog("message filtered out, rerouted", "id", msg.ID, "queue", q.reroute.name, "newID", forwarded.ID)
+	return true, q.broker.Ack(ctx, msg.ID)
+}
+
+// requeueScript 将 unack 中的消息放回 pending 并撤销本次投递的计数
+// KEYS: unackKey, pendingKey, attemptKey
+// ARGV: 消息ID, currentTime
+const requeueScript = msgFieldScript + `
+if redis.call('ZRem', KEYS[1], ARGV[1]) == 0 then return 0 end
+redis.call('ZAdd', KEYS[2], ARGV[2], ARGV[1])
+incrField(KEYS[3], ARGV[1], 'attempt', -1)
+return 1
+`
+
+func (b *redisBroker) Requeue(ctx context.Context, idStr string, now time.Time) error {
+	q := b.q
+	keys := []string{q.unAckKey, q.shardKey(q.pendingKey, q.shardOf(idStr)), q.attemptKey}
+	err := q.eval(ctx, requeueScript, keys, idStr, now.Unix()).Err()
+	if err != nil {
+		return fmt.Errorf("requeueScript failed: %v", err)
+	}
+	return nil
+}
+
+func (b *memoryBroker) Requeue(ctx context.Context, idStr string, now time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.unack[idStr]; !ok {
+		return nil
+	}
+	delete(b.unack, idStr)
+	b.pending[idStr] = now
+	if msg, ok := b.msgs[idStr]; ok && msg.attempt > 0 {
+		msg.attempt--
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package delayqueue
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDelayQueue_HeaderFilter(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	var images, videos []string
+	imageQueue := NewDelayQueue("test", redisCli, func(s string) bool {
+		images = append(images, s)
+		return true
+	}).WithHeaderFilter(func(headers map[string]string) bool {
+		return headers["kind"] == "image"
+	}, nil)
+	videoQueue := NewDelayQueue("test", redisCli, func(s string) bool {
+		videos = append(videos, s)
+		return true
+	}).WithHeaderFilter(func(headers map[string]string) bool {
+		return headers["kind"] == "video"
+	}, nil)
+	for _, kind := range []string{"image", "video", "image"} {
+		if _, err := imageQueue.SendDelayMsgV2(kind, 0, WithHeader("kind", kind)); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := imageQueue.ProcessOnce(); err != nil {
+			t.Error(err)
+			return
+		}
+		if _, err := videoQueue.ProcessOnce(); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if len(images) != 2 || images[0] != "image" || images[1] != "image" {
+		t.Errorf("unexpected images: %v", images)
+	}
+	if len(videos) != 1 || videos[0] != "video" {
+		t.Errorf("unexpected videos: %v", videos)
+	}
+	n, err := redisCli.HLen(ctx, imageQueue.attemptKey).Result()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if n != 0 {
+		t.Errorf("all messages should be acked, %d left", n)
+	}
+}
+
+func TestDelayQueue_HeaderFilterReroute(t *testing.T) {
+	redisCli := newTestRedis(t)
+	var received, rerouted []string
+	slowQueue := NewDelayQueue("slow", redisCli, func(s string) bool {
+		rerouted = append(rerouted, s)
+		return true
+	})
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		received = append(received, s)
+		return true
+	}).WithHeaderFilter(func(headers map[string]string) bool {
+		return headers["size"] != "large"
+	}, slowQueue)
+	if _, err := queue.SendDelayMsgV2("small", 0); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := queue.SendDelayMsgV2("large", 0, WithHeader("size", "large")); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := slowQueue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(received) != 1 || received[0] != "small" {
+		t.Errorf("unexpected received: %v", received)
+	}
+	if len(rerouted) != 1 || rerouted[0] != "large" {
+		t.Errorf("unexpected rerouted: %v", rerouted)
+	}
+}
+
+func TestMemoryQueue_HeaderFilter(t *testing.T) {
+	var received []string
+	queue := NewMemoryQueue("test", func(s string) bool {
+		received = append(received, s)
+		return true
+	}).WithHeaderFilter(func(headers map[string]string) bool {
+		return headers["kind"] == "a"
+	})
+	if _, err := queue.SendDelayMsgV2("a", 0, WithHeader("kind", "a")); err != nil {
+		t.Error(err)
+		return
+	}
+	msg, err := queue.SendDelayMsgV2("b", 0, WithHeader("kind", "b"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := queue.ProcessOnce(); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if len(received) != 1 || received[0] != "a" {
+		t.Errorf("unexpected received: %v", received)
+	}
+	broker := queue.q.broker.(*memoryBroker)
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	if attempt := broker.msgs[msg.ID].attempt; attempt != 0 {
+		t.Errorf("requeue should not count attempt: %d", attempt)
+	}
+}
@@ -0,0 +1,160 @@
+package delayqueue
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// 消息流转图中的阶段
+const (
+	StagePending = "pending"
+	StageReady   = "ready"
+	StageUnack   = "unack"
+	StageRetry   = "retry"
+	StageGarbage = "garbage"
+	StageDead    = "dead"
+	StageAcked   = "acked"
+)
+
+// flowCounter 记录一个消费周期内各阶段之间流转的消息数量
+// 回调可能并发执行，因此所有字段都通过 atomic 读写
+type flowCounter struct {
+	pending2Ready int64
+	ready2Unack   int64
+	unack2Ack     int64
+	unack2Retry   int64
+	unack2Garbage int64
+	retry2Unack   int64
+	garbage2Dead  int64
+}
+
+func (c *flowCounter) add(field *int64, n int64) {
+	if n != 0 {
+		atomic.AddInt64(field, n)
+	}
+}
+
+func (c *flowCounter) reset() {
+	atomic.StoreInt64(&c.pending2Ready, 0)
+	atomic.StoreInt64(&c.ready2Unack, 0)
+	atomic.StoreInt64(&c.unack2Ack, 0)
+	atomic.StoreInt64(&c.unack2Retry, 0)
+	atomic.StoreInt64(&c.unack2Garbage, 0)
+	atomic.StoreInt64(&c.retry2Unack, 0)
+	atomic.StoreInt64(&c.garbage2Dead, 0)
+}
+
+func (c *flowCounter) snapshot() FlowStats {
+	return FlowStats{
+		Pending2Ready: atomic.LoadInt64(&c.pending2Ready),
+		Ready2Unack:   atomic.LoadInt64(&c.ready2Unack),
+		Unack2Ack:     atomic.LoadInt64(&c.unack2Ack),
+		Unack2Retry:   atomic.LoadInt64(&c.unack2Retry),
+		Unack2Garbage: atomic.LoadInt64(&c.unack2Garbage),
+		Retry2Unack:   atomic.LoadInt64(&c.retry2Unack),
+		Garbage2Dead:  atomic.LoadInt64(&c.garbage2Dead),
+	}
+}
+
+// FlowStats 一个消费周期内各阶段之间流转的消息数量
+type FlowStats struct {
+	Pending2Ready int64 `json:"pending2Ready"`
+	Ready2Unack   int64 `json:"ready2Unack"`
+	Unack2Ack     int64 `json:"unack2Ack"`
+	Unack2Retry   int64 `json:"unack2Retry"`
+	Unack2Garbage int64 `json:"unack2Garbage"`
+	Retry2Unack   int64 `json:"retry2Unack"`
+	Garbage2Dead  int64 `json:"garbage2Dead"`
+}
+
+func (q *DelayQueue) saveFlow() {
+	stats := q.flow.snapshot()
+	q.flowMu.Lock()
+	q.lastFlow = stats
+	q.flowMu.Unlock()
+}
+
+// LastFlow 返回上一个消费周期内各阶段之间流转的消息数量
+func (q *DelayQueue) LastFlow() FlowStats {
+	q.flowMu.Lock()
+	defer q.flowMu.Unlock()
+	return q.lastFlow
+}
+
+// FlowNode 消息流转图的节点，字段名与 Grafana Node Graph 的 nodes 数据帧一致
+type FlowNode struct {
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	MainStat int64  `json:"mainStat"` // 当前处于该阶段的消息数量
+}
+
+// FlowEdge 消息流转图的边，字段名与 Grafana Node Graph 的 edges 数据帧一致
+type FlowEdge struct {
+	ID       string `json:"id"`
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	MainStat int64  `json:"mainStat"` // 上一个消费周期内流转的消息数量
+}
+
+// FlowGraph 队列的拓扑结构及消息流转情况
+// 可以直接序列化为 JSON 供 Grafana Node Graph 使用，或通过 Mermaid 导出为 Mermaid 流程图
+type FlowGraph struct {
+	Nodes []FlowNode `json:"nodes"`
+	Edges []FlowEdge `json:"edges"`
+}
+
+// FlowGraph 导出队列的拓扑结构，节点为消息所处的阶段，边为上一个消费周期内的流转数量
+func (q *DelayQueue) FlowGraph(ctx context.Context) (*FlowGraph, error) {
+	stats, err := q.Stats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	flow := q.LastFlow()
+	graph := &FlowGraph{
+		Nodes: []FlowNode{
+			{ID: StagePending, Title: StagePending, MainStat: stats.Pending},
+			{ID: StageReady, Title: StageReady, MainStat: stats.Ready},
+			{ID: StageUnack, Title: StageUnack, MainStat: stats.Unack},
+			{ID: StageRetry, Title: StageRetry, MainStat: stats.Retry},
+			{ID: StageGarbage, Title: StageGarbage, MainStat: stats.Garbage},
+			{ID: StageDead, Title: StageDead, MainStat: stats.Dead},
+			{ID: StageAcked, Title: StageAcked, MainStat: flow.Unack2Ack},
+		},
+	}
+	edges := []struct {
+		from, to string
+		count    int64
+	}{
+		{StagePending, StageReady, flow.Pending2Ready},
+		{StageReady, StageUnack, flow.Ready2Unack},
+		{StageUnack, StageAcked, flow.Unack2Ack},
+		{StageUnack, StageRetry, flow.Unack2Retry},
+		{StageUnack, StageGarbage, flow.Unack2Garbage},
+		{StageRetry, StageUnack, flow.Retry2Unack},
+		{StageGarbage, StageDead, flow.Garbage2Dead},
+	}
+	for _, e := range edges {
+		graph.Edges = append(graph.Edges, FlowEdge{
+			ID:       e.from + "->" + e.to,
+			Source:   e.from,
+			Target:   e.to,
+			MainStat: e.count,
+		})
+	}
+	return graph, nil
+}
+
+// Mermaid 将流转图导出为 Mermaid flowchart
+func (g *FlowGraph) Mermaid() string {
+	var sb strings.Builder
+	sb.WriteString("flowchart LR\n")
+	for _, n := range g.Nodes {
+		sb.WriteString(fmt.Sprintf("    %s[\"%s (%d)\"]\n", n.ID, n.Title, n.MainStat))
+	}
+	for _, e := range g.Edges {
+		sb.WriteString(fmt.Sprintf("    %s -->|%d| %s\n", e.Source, e.MainStat, e.Target))
+	}
+	return sb.String()
+}
@@ -0,0 +1,39 @@
+package delayqueue
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDelayQueue_FlowGraph(t *testing.T) {
+	redisCli := newTestRedis(t)
+	size := 3
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	})
+	for i := 0; i < size; i++ {
+		err := queue.SendDelayMsg(strconv.Itoa(i), 0)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if err := queue.consume(); err != nil {
+		t.Errorf("consume error: %v", err)
+		return
+	}
+	flow := queue.LastFlow()
+	if flow.Pending2Ready != int64(size) || flow.Ready2Unack != int64(size) || flow.Unack2Ack != int64(size) {
+		t.Errorf("unexpected flow stats: %+v", flow)
+	}
+	graph, err := queue.FlowGraph(context.Background())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	mermaid := graph.Mermaid()
+	if !strings.Contains(mermaid, "pending -->|3| ready") {
+		t.Errorf("unexpected mermaid output:\n%s", mermaid)
+	}
+}
@@ -0,0 +1,157 @@
+package delayqueue
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// redis function 的加载状态
+const (
+	functionsUnknown     int32 = iota // 尚未加载
+	functionsLoaded                   // 已加载，使用 FCALL 执行脚本
+	functionsUnsupported              // redis 版本低于 7，使用 EVAL 执行脚本
+)
+
+// functionScripts 注册为 redis function 的脚本，名称 -> 脚本
+var functionScripts = map[string]string{
+	"pending2ready":  pending2ReadyScript,
+	"ready2unack":    ready2UnackScript,
+	"unack2retry":    unack2RetryScript,
+	"ack":            ackScript,
+	"nack":           nackScript,
+	"extend":         extendScript,
+	"drop":           dropScript,
+	"garbage2dead":   garbage2DeadScript,
+	"requeuedead":    requeueDeadScript,
+	"cancel":         cancelScript,
+	"purge":          purgeScript,
+	"import":         importScript,
+	"pending2stream": pending2StreamScript,
+	"stream2unack":   stream2UnackScript,
+	"rebalance":      rebalanceScript,
+	"leavepartition": leavePartitionsScript,
+	"retry2ready":    retry2PartitionScript,
+	"recordfailure":  recordFailureScript,
+	"requeue":        requeueScript,
+	"archive":        archiveScript,
+	"tick":           tickScript,
+}
+
+var (
+	libraryOnce sync.Once
+	libraryName string
+	libraryCode string
+	libraryFunc map[string]string // 脚本 -> function 名称
+)
+
+// functionLibrary 生成包含所有脚本的 redis function 库
+// 库名称为 delayqueue_ 加上脚本内容的哈希，脚本变化后使用新的库，不同版本的实例可以共存
+func functionLibrary() (name string, code string, funcs map[string]string) {
+	libraryOnce.Do(func() {
+		names := make([]string, 0, len(functionScripts))
+		for name := range functionScripts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		h := sha1.New()
+		for _, name := range names {
+			h.Write([]byte(name))
+			h.Write([]byte(functionScripts[name]))
+		}
+		libraryName = "delayqueue_" + hex.EncodeToString(h.Sum(nil))[:12]
+		libraryFunc = make(map[string]string, len(names))
+		var sb strings.Builder
+		sb.WriteString("#!lua name=" + libraryName + "\n")
+		for _, name := range names {
+			fn := libraryName + "_" + name
+			libraryFunc[functionScripts[name]] = fn
+			sb.WriteString("redis.register_function('" + fn + "', function(KEYS, ARGV)\n")
+			sb.WriteString(functionScripts[name])
+			sb.WriteString("\nend)\n")
+		}
+		libraryCode = sb.String()
+	})
+	return libraryName, libraryCode, libraryFunc
+}
+
+// WithRedisFunctions 在 redis 7 及以上版本中将消息流转的 lua 脚本加载为 redis function 库，使用 FCALL 代替 EVAL 执行
+// 库名称为 delayqueue_ 加上脚本内容的哈希，可以通过 FUNCTION LIST 查看；
+// function 被 FUNCTION FLUSH 删除后会自动重新加载，redis 版本不支持时回退为 EVAL
+func (q *DelayQueue) WithRedisFunctions() *DelayQueue {
+	if q.frozen("WithRedisFunctions") {
+		return q
+	}
+	q.functions = true
+	return q
+}
+
+// scripter 执行脚本的 redis 客户端或 pipeline
+type scripter interface {
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd
+	Do(ctx context.Context, args ...interface{}) *redis.Cmd
+}
+
+// eval 执行 lua 脚本，启用 WithRedisFunctions 时使用 FCALL 执行
+func (q *DelayQueue) eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+	cmd := q.pipeEval(ctx, q.redisCli, script, keys, args...)
+	if cmd.Err() != nil && strings.Contains(cmd.Err().Error(), "Function not found") {
+		// function 已被删除，重新加载后重试
+		q.functionState.Store(functionsUnknown)
+		cmd = q.pipeEval(ctx, q.redisCli, script, keys, args...)
+	}
+	return cmd
+}
+
+// pipeEval 在 c 中执行 lua 脚本，c 为 pipeline 时 function 被删除后不会重试
+func (q *DelayQueue) pipeEval(ctx context.Context, c scripter, script string, keys []string, args ...interface{}) *redis.Cmd {
+	fn, ok := q.function(ctx, script)
+	if !ok {
+		return c.Eval(ctx, script, keys, args...)
+	}
+	cmdArgs := make([]interface{}, 0, 3+len(keys)+len(args))
+	cmdArgs = append(cmdArgs, "FCall", fn, len(keys))
+	for _, key := range keys {
+		cmdArgs = append(cmdArgs, key)
+	}
+	cmdArgs = append(cmdArgs, args...)
+	return c.Do(ctx, cmdArgs...)
+}
+
+// function 返回脚本对应的 function 名称，未启用或不支持 redis function 时返回 false
+func (q *DelayQueue) function(ctx context.Context, script string) (string, bool) {
+	if !q.functions {
+		return "", false
+	}
+	name, code, funcs := functionLibrary()
+	fn, ok := funcs[script]
+	if !ok {
+		return "", false
+	}
+	switch q.functionState.Load() {
+	case functionsLoaded:
+		return fn, true
+	case functionsUnsupported:
+		return "", false
+	}
+	err := q.redisCli.Do(ctx, "Function", "Load", code).Err()
+	switch {
+	case err == nil, strings.Contains(err.Error(), "already exists"):
+		q.functionState.Store(functionsLoaded)
+		q.logger.Info("redis functions loaded", "queue", q.name, "library", name)
+		return fn, true
+	case strings.Contains(strings.ToLower(err.Error()), "unknown command"):
+		q.functionState.Store(functionsUnsupported)
+		q.logger.Warn("redis functions not supported, fallback to eval", "queue", q.name, "error", err)
+		return "", false
+	default:
+		// 加载失败时本次使用 EVAL，下次重新加载
+		q.logger.Error("load redis functions failed", "queue", q.name, "library", name, "error", err)
+		return "", false
+	}
+}
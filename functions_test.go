@@ -0,0 +1,190 @@
+package delayqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestFunctionLibrary(t *testing.T) {
+	name, code, funcs := functionLibrary()
+	if !strings.HasPrefix(code, "#!lua name="+name+"\n") {
+		t.Errorf("unexpected library header: %q", code[:strings.Index(code, "\n")])
+	}
+	if len(funcs) != len(functionScripts) {
+		t.Errorf("expect %d functions, actual %d", len(functionScripts), len(funcs))
+	}
+	for script, fn := range funcs {
+		if !strings.HasPrefix(fn, name+"_") {
+			t.Errorf("unexpected function name: %s", fn)
+		}
+		if !strings.Contains(code, "redis.register_function('"+fn+"', function(KEYS, ARGV)\n"+script) {
+			t.Errorf("function %s not registered", fn)
+		}
+	}
+	if again, _, _ := functionLibrary(); again != name {
+		t.Errorf("library name changed: %s -> %s", name, again)
+	}
+}
+
+func TestDelayQueue_RedisFunctionsFallback(t *testing.T) {
+	redisCli := newTestRedis(t)
+	received := 0
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		received++
+		return true
+	}).WithRedisFunctions()
+	if err := queue.SendDelayMsg("foo", 0); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	if received != 1 {
+		t.Errorf("expect 1 delivery, actual %d", received)
+	}
+	// 测试使用的 redis 不支持 FUNCTION 命令，应回退为 EVAL
+	if err := redisCli.Do(context.Background(), "Function", "List").Err(); err != nil {
+		if state := queue.functionState.Load(); state != functionsUnsupported {
+			t.Errorf("expect fallback to eval, actual state %d", state)
+		}
+	} else if state := queue.functionState.Load(); state != functionsLoaded {
+		t.Errorf("expect functions loaded, actual state %d", state)
+	}
+}
+
+// errFakeHandled 表示命令已由 fakeFunctions 处理，不发送到 redis
+var errFakeHandled = errors.New("handled by fake functions")
+
+// fakeFunctions 在不支持 FUNCTION 的 redis 上模拟 redis 7 的 function：
+// FUNCTION LOAD/FLUSH 只记录加载状态，FCALL 改写为执行对应脚本的 EVAL，库未加载时返回 Function not found
+type fakeFunctions struct {
+	loaded  bool
+	loads   int
+	fcalls  int
+	scripts map[string]string // function 名称 -> 脚本
+}
+
+func newFakeFunctions() *fakeFunctions {
+	_, _, funcs := functionLibrary()
+	f := &fakeFunctions{scripts: make(map[string]string, len(funcs))}
+	for script, fn := range funcs {
+		f.scripts[fn] = script
+	}
+	return f
+}
+
+func (f *fakeFunctions) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	args := cmd.Args()
+	switch strings.ToLower(cmd.Name()) {
+	case "function":
+		switch strings.ToLower(fmt.Sprint(args[1])) {
+		case "load":
+			if f.loaded {
+				return ctx, errors.New("ERR Library already exists")
+			}
+			f.loaded = true
+			f.loads++
+		case "flush":
+			f.loaded = false
+		}
+		return ctx, errFakeHandled
+	case "fcall":
+		if !f.loaded {
+			return ctx, errors.New("ERR Function not found")
+		}
+		script, ok := f.scripts[fmt.Sprint(args[1])]
+		if !ok {
+			return ctx, errors.New("ERR Function not found")
+		}
+		f.fcalls++
+		args[0], args[1] = "eval", script
+	}
+	return ctx, nil
+}
+
+func (f *fakeFunctions) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	if cmd.Err() == errFakeHandled {
+		cmd.SetErr(nil)
+	}
+	return nil
+}
+
+func (f *fakeFunctions) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	for _, cmd := range cmds {
+		if _, err := f.BeforeProcess(ctx, cmd); err != nil && err != errFakeHandled {
+			return ctx, err
+		}
+	}
+	return ctx, nil
+}
+
+func (f *fakeFunctions) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+func TestDelayQueue_RedisFunctions(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	fake := newFakeFunctions()
+	redisCli.AddHook(fake)
+	received := 0
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		received++
+		return true
+	}).WithRedisFunctions()
+	if err := queue.SendDelayMsg("foo", 0); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	if received != 1 {
+		t.Errorf("expect 1 delivery, actual %d", received)
+	}
+	if state := queue.functionState.Load(); state != functionsLoaded {
+		t.Errorf("expect functions loaded, actual state %d", state)
+	}
+	if fake.loads != 1 || fake.fcalls == 0 {
+		t.Errorf("expect library loaded once and scripts called by fcall, actual loads %d, fcalls %d", fake.loads, fake.fcalls)
+	}
+
+	// 其它实例已加载同名的库
+	other := NewDelayQueue("test", redisCli, func(s string) bool { return true }).WithRedisFunctions()
+	if _, err := other.pending2Ready(); err != nil {
+		t.Error(err)
+		return
+	}
+	if state := other.functionState.Load(); state != functionsLoaded {
+		t.Errorf("expect functions loaded, actual state %d", state)
+	}
+
+	// function 被删除后自动重新加载
+	if err := redisCli.Do(ctx, "Function", "Flush").Err(); err != nil {
+		t.Error(err)
+		return
+	}
+	fcalls := fake.fcalls
+	if err := queue.SendDelayMsg("bar", 0); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	if received != 2 {
+		t.Errorf("expect 2 deliveries, actual %d", received)
+	}
+	if fake.loads != 2 || fake.fcalls == fcalls {
+		t.Errorf("expect library reloaded, actual loads %d, fcalls %d", fake.loads, fake.fcalls-fcalls)
+	}
+}
@@ -2,9 +2,12 @@ module delayqueue
 
 go 1.19
 
+require (
+	github.com/go-redis/redis/v8 v8.11.0
+	github.com/google/uuid v1.3.0
+)
+
 require (
 	github.com/cespare/xxhash/v2 v2.1.1 // indirect
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
-	github.com/go-redis/redis/v8 v8.11.0 // indirect
-	github.com/google/uuid v1.3.0 // indirect
 )
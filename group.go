@@ -0,0 +1,164 @@
+package delayqueue
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WithGroup 使用消费组消费队列，每个消费组都会收到每条消息的一个副本，各消费组的确认和重试互不影响
+// 消费组在第一次执行消费周期时注册，注册之前发送的消息不会投递给该消费组
+// 存在已注册的消费组时，发送到队列的消息只投递给各消费组，不再投递给未使用消费组的消费者
+func (q *DelayQueue) WithGroup(group string) *DelayQueue {
+	if q.frozen("WithGroup") {
+		return q
+	}
+	if q.redisCli == nil {
+		q.invalidOption("WithGroup", "consumer group requires redis")
+		return q
+	}
+	if group == "" {
+		q.invalidOption("WithGroup", "group is required")
+		return q
+	}
+	// 消费组名称会拼接到消息副本的 ID 中，参见 copyID
+	if strings.ContainsAny(group, ":{}") {
+		q.invalidOption("WithGroup", "group must not contain ':', '{' or '}'")
+		return q
+	}
+	q.group = group
+	q.initKeys(q.baseName + "@" + group)
+	return q
+}
+
+// Groups 返回队列已注册的消费组，按名称排序
+func (q *DelayQueue) Groups(ctx context.Context) ([]string, error) {
+	if q.redisCli == nil {
+		return nil, nil
+	}
+	cached, err := q.cache.get(ctx, q.groupsKey, func() (interface{}, error) {
+		groups, err := q.redisCli.SMembers(ctx, q.groupsKey).Result()
+		sort.Strings(groups)
+		return groups, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get groups failed: %v", err)
+	}
+	return append([]string(nil), cached.([]string)...), nil
+}
+
+// RemoveGroup 注销消费组，之后发送的消息不再投递给该消费组，已投递的消息仍保留在该消费组中
+// 可以对 WithGroup 创建的队列调用 DeleteQueue 删除消费组中的消息
+func (q *DelayQueue) RemoveGroup(ctx context.Context, group string) error {
+	if err := q.requireRedis("RemoveGroup"); err != nil {
+		return err
+	}
+	defer q.cache.invalidate(q.groupsKey)
+	err := q.redisCli.SRem(ctx, q.groupsKey, group).Err()
+	if err != nil {
+		return fmt.Errorf("remove group failed: %v", err)
+	}
+	if group == q.group {
+		q.groupRegistered.Store(false)
+	}
+	return nil
+}
+
+// registerGroup 注册当前实例的消费组
+func (q *DelayQueue) registerGroup(ctx context.Context) error {
+	if q.group == "" || q.groupRegistered.Load() {
+		return nil
+	}
+	defer q.cache.invalidate(q.groupsKey)
+	err := q.redisCli.SAdd(ctx, q.groupsKey, q.group).Err()
+	if err != nil {
+		return fmt.Errorf("register group failed: %v", err)
+	}
+	q.groupRegistered.Store(true)
+	return nil
+}
+
+// groupQueue 返回用于向消费组发送消息的队列，group 为空时返回未使用消费组的队列
+func (q *DelayQueue) groupQueue(group string) *DelayQueue {
+	if group == q.group {
+		return q
+	}
+	if v, ok := q.groupQueues.Load(group); ok {
+		return v.(*DelayQueue)
+	}
+	gq := newDelayQueue(q.baseName, q.redisCli).WithKeyPrefix(q.prefix).WithShards(q.shards)
+	if q.partitions != nil {
+		gq.WithPartitions(q.shards)
+	}
+	if q.compat {
+		gq.WithUpstreamCompat(q.hashTagKeys)
+	}
+	if q.hashStorage {
+		gq.WithHashStorage()
+	}
+	if group != "" {
+		gq.WithGroup(group)
+	}
+	v, _ := q.groupQueues.LoadOrStore(group, gq)
+	return v.(*DelayQueue)
+}
+
+// push 保存消息，存在已注册的消费组时为每个消费组保存一个使用不同ID的副本
+// 返回当前实例所在消费组收到的消息，当前实例未使用消费组时返回第一个消费组收到的消息
+func (q *DelayQueue) push(ctx context.Context, msg *MessageInfo, ttl time.Duration) (*MessageInfo, error) {
+	if q.redisCli == nil {
+		if err := q.makeRoom(ctx, q, 1); err != nil {
+			return nil, err
+		}
+		return msg, q.pushStored(ctx, q, msg, ttl)
+	}
+	groups, err := q.Groups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		target := q.groupQueue("")
+		if err := q.makeRoom(ctx, target, 1); err != nil {
+			return nil, err
+		}
+		return msg, q.pushStored(ctx, target, msg, ttl)
+	}
+	// 所有消费组的副本在同一个事务中写入，避免部分消费组收到消息而发送返回错误，重试时重复投递
+	var refs []string
+	pipe := q.redisCli.TxPipeline()
+	var result *MessageInfo
+	for i, group := range groups {
+		copied := *msg
+		if i > 0 {
+			copied.ID, err = q.copyID(msg, group)
+			if err != nil {
+				q.deletePayloads(ctx, refs...)
+				return nil, err
+			}
+		}
+		target := q.groupQueue(group)
+		if err := q.makeRoom(ctx, target, 1); err != nil {
+			q.deletePayloads(ctx, refs...)
+			return nil, err
+		}
+		stored, err := q.offload(ctx, &copied, ttl)
+		if err != nil {
+			q.deletePayloads(ctx, refs...)
+			return nil, err
+		}
+		if stored != &copied {
+			refs = append(refs, stored.Headers[HeaderPayloadRef])
+		}
+		target.pushPipe(ctx, pipe, stored, ttl)
+		if result == nil || group == q.group {
+			result = &copied
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		q.deletePayloads(ctx, refs...)
+		return nil, fmt.Errorf("push to groups failed: %v", err)
+	}
+	return result, nil
+}
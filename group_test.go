@@ -0,0 +1,128 @@
+package delayqueue
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestDelayQueue_Group(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	received := make(map[string][]string)
+	newConsumer := func(group string) *DelayQueue {
+		return NewDelayQueue("test", redisCli, func(s string) bool {
+			received[group] = append(received[group], s)
+			return true
+		}).WithGroup(group)
+	}
+	billing, shipping := newConsumer("billing"), newConsumer("shipping")
+	for _, q := range []*DelayQueue{billing, shipping} {
+		if _, err := q.ProcessOnce(); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	producer := NewDelayQueue("test", redisCli, func(s string) bool {
+		t.Error("expect no delivery to queue without group")
+		return true
+	})
+	groups, err := producer.Groups(ctx)
+	if err != nil || !reflect.DeepEqual(groups, []string{"billing", "shipping"}) {
+		t.Errorf("unexpected groups: %v, %v", groups, err)
+	}
+	if err := producer.SendDelayMsg("order.created", 0); err != nil {
+		t.Error(err)
+		return
+	}
+	for _, q := range []*DelayQueue{billing, shipping, producer} {
+		if _, err := q.ProcessOnce(); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	expect := map[string][]string{"billing": {"order.created"}, "shipping": {"order.created"}}
+	if !reflect.DeepEqual(received, expect) {
+		t.Errorf("unexpected received: %v", received)
+	}
+	if err := producer.RemoveGroup(ctx, "shipping"); err != nil {
+		t.Error(err)
+	}
+	msg, err := billing.SendDelayMsgV2("order.paid", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if info, err := billing.GetMessage(ctx, msg.ID); err != nil || info.Payload != "order.paid" {
+		t.Errorf("expect message sent to own group: %v", err)
+	}
+	if stats, _ := shipping.Stats(ctx); stats.Pending != 0 {
+		t.Errorf("expect no message sent to removed group, stats: %+v", stats)
+	}
+}
+
+func TestDelayQueue_GroupPushAtomic(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	newConsumer := func(group string) *DelayQueue {
+		return NewDelayQueue("test", redisCli, func(s string) bool {
+			return true
+		}).WithGroup(group)
+	}
+	billing, shipping := newConsumer("billing"), newConsumer("shipping")
+	for _, q := range []*DelayQueue{billing, shipping} {
+		if err := q.registerGroup(ctx); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	producer := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	}).WithMaxLength(1, OverflowReject)
+	// shipping 已满，billing 也不应收到消息，否则重试发送会重复投递给 billing
+	redisCli.ZAdd(ctx, shipping.pendingKey, &redis.Z{Score: 1, Member: "old"})
+	if err := producer.SendDelayMsg("order.created", 0); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("expect ErrQueueFull, actual %v", err)
+	}
+	if stats, _ := billing.Stats(ctx); stats.Pending != 0 {
+		t.Errorf("expect no message sent to any group, stats: %+v", stats)
+	}
+}
+
+func TestDelayQueue_GroupSendAndWait(t *testing.T) {
+	redisCli := newTestRedis(t)
+	billing := NewDelayQueueWithHandler("test", redisCli, func(ctx context.Context, msg *Message) error {
+		msg.Reply("re: " + msg.Payload)
+		return nil
+	}).WithGroup("billing").WithFetchInterval(50 * time.Millisecond)
+	done := billing.StartConsume()
+	defer func() {
+		billing.StopConsume()
+		<-done
+	}()
+	producer := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// 等待消费组注册，之前发送的消息不会投递给消费组
+	for {
+		groups, err := producer.Groups(ctx)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(groups) == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	result, err := producer.SendAndWait(ctx, "ping", 0)
+	if err != nil || result != "re: ping" {
+		t.Errorf("unexpected result: %s, err: %v", result, err)
+	}
+}
@@ -0,0 +1,64 @@
+// delayqueued 是提供 gRPC 接口的延迟队列守护进程，接口定义见 proto/delayqueue.proto
+//
+//	delayqueued [-url redis://127.0.0.1:6379/0] [-prefix dp:] [-shards n] [-listen :9090]
+package main
+
+import (
+	"delayqueue"
+	"delayqueue/grpcserver"
+	"delayqueue/grpcserver/delayqueuev1"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/go-redis/redis/v8"
+	"google.golang.org/grpc"
+)
+
+func main() {
+	url := flag.String("url", envOr("DELAYQUEUE_REDIS_URL", "redis://127.0.0.1:6379/0"), "redis url, env DELAYQUEUE_REDIS_URL")
+	shards := flag.Uint("shards", 1, "shard count of the queues")
+	prefix := flag.String("prefix", delayqueue.DefaultKeyPrefix, "key prefix of the queues")
+	listen := flag.String("listen", ":9090", "grpc listen address")
+	flag.Parse()
+	opt, err := redis.ParseURL(*url)
+	if err != nil {
+		fatal(fmt.Errorf("parse redis url failed: %v", err))
+	}
+	redisCli := redis.NewClient(opt)
+	defer redisCli.Close()
+
+	lis, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fatal(fmt.Errorf("listen failed: %v", err))
+	}
+	srv := grpc.NewServer()
+	delayqueuev1.RegisterDelayQueueServer(srv, grpcserver.NewServer(redisCli, func(q *delayqueue.DelayQueue) *delayqueue.DelayQueue {
+		return q.WithKeyPrefix(*prefix).WithShards(*shards)
+	}))
+	// 收到退出信号后等待进行中的请求结束，Consume 流断开后未确认的消息按重试策略重新投递
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sig
+		srv.GracefulStop()
+	}()
+	if err := srv.Serve(lis); err != nil {
+		fatal(err)
+	}
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "delayqueued:", err)
+	os.Exit(1)
+}
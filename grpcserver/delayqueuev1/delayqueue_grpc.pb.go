@@ -0,0 +1,271 @@
+// delayqueue 的 gRPC 接口定义，供其它语言的服务通过守护进程使用延迟队列，无需实现 redis 中的 key 结构
+//
+// 服务端实现位于独立的 module delayqueue/grpcserver 中，只有使用 gRPC 的服务需要依赖 grpc 和 protobuf。
+// 修改本文件后在 grpcserver 目录下重新生成代码：
+//
+//	protoc -I ../proto --go_out=. --go_opt=module=delayqueue/grpcserver \
+//		--go-grpc_out=. --go-grpc_opt=module=delayqueue/grpcserver delayqueue.proto
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: delayqueue.proto
+
+package delayqueuev1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	DelayQueue_Send_FullMethodName    = "/delayqueue.v1.DelayQueue/Send"
+	DelayQueue_Cancel_FullMethodName  = "/delayqueue.v1.DelayQueue/Cancel"
+	DelayQueue_Stats_FullMethodName   = "/delayqueue.v1.DelayQueue/Stats"
+	DelayQueue_Consume_FullMethodName = "/delayqueue.v1.DelayQueue/Consume"
+)
+
+// DelayQueueClient is the client API for DelayQueue service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type DelayQueueClient interface {
+	// Send 发送定时消息
+	Send(ctx context.Context, in *SendRequest, opts ...grpc.CallOption) (*SendResponse, error)
+	// Cancel 取消消息，消息不存在时返回 NOT_FOUND
+	Cancel(ctx context.Context, in *CancelRequest, opts ...grpc.CallOption) (*CancelResponse, error)
+	// Stats 查询队列中各阶段的消息数量
+	Stats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsResponse, error)
+	// Consume 双向流，服务端推送到期的消息，客户端对每条消息回复 Ack
+	// 流断开时未确认的消息在处理超时后按重试策略重新投递
+	Consume(ctx context.Context, opts ...grpc.CallOption) (DelayQueue_ConsumeClient, error)
+}
+
+type delayQueueClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDelayQueueClient(cc grpc.ClientConnInterface) DelayQueueClient {
+	return &delayQueueClient{cc}
+}
+
+func (c *delayQueueClient) Send(ctx context.Context, in *SendRequest, opts ...grpc.CallOption) (*SendResponse, error) {
+	out := new(SendResponse)
+	err := c.cc.Invoke(ctx, DelayQueue_Send_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *delayQueueClient) Cancel(ctx context.Context, in *CancelRequest, opts ...grpc.CallOption) (*CancelResponse, error) {
+	out := new(CancelResponse)
+	err := c.cc.Invoke(ctx, DelayQueue_Cancel_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *delayQueueClient) Stats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsResponse, error) {
+	out := new(StatsResponse)
+	err := c.cc.Invoke(ctx, DelayQueue_Stats_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *delayQueueClient) Consume(ctx context.Context, opts ...grpc.CallOption) (DelayQueue_ConsumeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &DelayQueue_ServiceDesc.Streams[0], DelayQueue_Consume_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &delayQueueConsumeClient{stream}
+	return x, nil
+}
+
+type DelayQueue_ConsumeClient interface {
+	Send(*ConsumeRequest) error
+	Recv() (*Message, error)
+	grpc.ClientStream
+}
+
+type delayQueueConsumeClient struct {
+	grpc.ClientStream
+}
+
+func (x *delayQueueConsumeClient) Send(m *ConsumeRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *delayQueueConsumeClient) Recv() (*Message, error) {
+	m := new(Message)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// DelayQueueServer is the server API for DelayQueue service.
+// All implementations must embed UnimplementedDelayQueueServer
+// for forward compatibility
+type DelayQueueServer interface {
+	// Send 发送定时消息
+	Send(context.Context, *SendRequest) (*SendResponse, error)
+	// Cancel 取消消息，消息不存在时返回 NOT_FOUND
+	Cancel(context.Context, *CancelRequest) (*CancelResponse, error)
+	// Stats 查询队列中各阶段的消息数量
+	Stats(context.Context, *StatsRequest) (*StatsResponse, error)
+	// Consume 双向流，服务端推送到期的消息，客户端对每条消息回复 Ack
+	// 流断开时未确认的消息在处理超时后按重试策略重新投递
+	Consume(DelayQueue_ConsumeServer) error
+	mustEmbedUnimplementedDelayQueueServer()
+}
+
+// UnimplementedDelayQueueServer must be embedded to have forward compatible implementations.
+type UnimplementedDelayQueueServer struct {
+}
+
+func (UnimplementedDelayQueueServer) Send(context.Context, *SendRequest) (*SendResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Send not implemented")
+}
+func (UnimplementedDelayQueueServer) Cancel(context.Context, *CancelRequest) (*CancelResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Cancel not implemented")
+}
+func (UnimplementedDelayQueueServer) Stats(context.Context, *StatsRequest) (*StatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stats not implemented")
+}
+func (UnimplementedDelayQueueServer) Consume(DelayQueue_ConsumeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Consume not implemented")
+}
+func (UnimplementedDelayQueueServer) mustEmbedUnimplementedDelayQueueServer() {}
+
+// UnsafeDelayQueueServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DelayQueueServer will
+// result in compilation errors.
+type UnsafeDelayQueueServer interface {
+	mustEmbedUnimplementedDelayQueueServer()
+}
+
+func RegisterDelayQueueServer(s grpc.ServiceRegistrar, srv DelayQueueServer) {
+	s.RegisterService(&DelayQueue_ServiceDesc, srv)
+}
+
+func _DelayQueue_Send_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SendRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DelayQueueServer).Send(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DelayQueue_Send_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DelayQueueServer).Send(ctx, req.(*SendRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DelayQueue_Cancel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DelayQueueServer).Cancel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DelayQueue_Cancel_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DelayQueueServer).Cancel(ctx, req.(*CancelRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DelayQueue_Stats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DelayQueueServer).Stats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DelayQueue_Stats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DelayQueueServer).Stats(ctx, req.(*StatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DelayQueue_Consume_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(DelayQueueServer).Consume(&delayQueueConsumeServer{stream})
+}
+
+type DelayQueue_ConsumeServer interface {
+	Send(*Message) error
+	Recv() (*ConsumeRequest, error)
+	grpc.ServerStream
+}
+
+type delayQueueConsumeServer struct {
+	grpc.ServerStream
+}
+
+func (x *delayQueueConsumeServer) Send(m *Message) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *delayQueueConsumeServer) Recv() (*ConsumeRequest, error) {
+	m := new(ConsumeRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// DelayQueue_ServiceDesc is the grpc.ServiceDesc for DelayQueue service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var DelayQueue_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "delayqueue.v1.DelayQueue",
+	HandlerType: (*DelayQueueServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Send",
+			Handler:    _DelayQueue_Send_Handler,
+		},
+		{
+			MethodName: "Cancel",
+			Handler:    _DelayQueue_Cancel_Handler,
+		},
+		{
+			MethodName: "Stats",
+			Handler:    _DelayQueue_Stats_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Consume",
+			Handler:       _DelayQueue_Consume_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "delayqueue.proto",
+}
@@ -0,0 +1,236 @@
+// Package grpcserver 实现 proto/delayqueue.proto 定义的 gRPC 接口，供其它语言的服务通过守护进程使用延迟队列
+// 作为独立的 module 发布，只有使用 gRPC 的服务需要依赖 grpc 和 protobuf，delayqueue 本身的依赖不受影响
+package grpcserver
+
+import (
+	"context"
+	"delayqueue"
+	"delayqueue/grpcserver/delayqueuev1"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errStreamClosed Consume 的流已断开，处理中的消息按重试策略重新投递
+var errStreamClosed = errors.New("consume stream closed")
+
+// Server 将 gRPC 请求转发给 delayqueue.DelayQueue 的同名方法，每个队列名称对应一个 DelayQueue
+type Server struct {
+	delayqueuev1.UnimplementedDelayQueueServer
+
+	redisCli  *redis.Client
+	configure func(q *delayqueue.DelayQueue) *delayqueue.DelayQueue
+
+	mu     sync.Mutex
+	queues map[string]*delayqueue.DelayQueue // 用于发送、取消和查询的队列
+}
+
+// NewServer 创建 Server，configure 用于设置各队列的 key 前缀、分片数、处理超时时间等选项，为 nil 时使用默认配置
+// 同一个队列的发送方和消费方使用相同的 configure，与直接使用 delayqueue 的服务共享队列时配置也必须一致
+func NewServer(redisCli *redis.Client, configure func(q *delayqueue.DelayQueue) *delayqueue.DelayQueue) *Server {
+	if redisCli == nil {
+		panic("redis client is required")
+	}
+	if configure == nil {
+		configure = func(q *delayqueue.DelayQueue) *delayqueue.DelayQueue { return q }
+	}
+	return &Server{
+		redisCli:  redisCli,
+		configure: configure,
+		queues:    make(map[string]*delayqueue.DelayQueue),
+	}
+}
+
+// queue 返回用于发送、取消和查询的队列
+func (s *Server) queue(name string) *delayqueue.DelayQueue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, ok := s.queues[name]
+	if !ok {
+		q = s.configure(delayqueue.NewDelayQueue(name, s.redisCli, func(string) bool { return false }))
+		s.queues[name] = q
+	}
+	return q
+}
+
+// Send 发送定时消息，deliver_at 和 delay_seconds 都为 0 时立即投递
+func (s *Server) Send(ctx context.Context, req *delayqueuev1.SendRequest) (*delayqueuev1.SendResponse, error) {
+	if req.Queue == "" {
+		return nil, status.Error(codes.InvalidArgument, "queue is required")
+	}
+	if req.DeliverAt != 0 && req.DelaySeconds != 0 {
+		return nil, status.Error(codes.InvalidArgument, "deliver_at and delay_seconds are mutually exclusive")
+	}
+	opts := []delayqueue.SendOption{delayqueue.WithContext(ctx)}
+	if req.RetryCount != nil {
+		opts = append(opts, delayqueue.WithRetryCount(int(req.GetRetryCount())))
+	}
+	if req.TtlSeconds != nil {
+		opts = append(opts, delayqueue.WithMsgTTL(time.Duration(req.GetTtlSeconds())*time.Second))
+	}
+	q := s.queue(req.Queue)
+	var msg *delayqueue.MessageInfo
+	var err error
+	if req.DeliverAt != 0 {
+		msg, err = q.SendScheduleMsgV2(req.Payload, time.Unix(req.DeliverAt, 0), opts...)
+	} else {
+		msg, err = q.SendDelayMsgV2(req.Payload, time.Duration(req.DelaySeconds)*time.Second, opts...)
+	}
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &delayqueuev1.SendResponse{Id: msg.ID, DeliverAt: msg.Time.Unix()}, nil
+}
+
+// Cancel 取消消息，消息不存在时返回 NOT_FOUND
+func (s *Server) Cancel(ctx context.Context, req *delayqueuev1.CancelRequest) (*delayqueuev1.CancelResponse, error) {
+	if req.Queue == "" || req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "queue and id are required")
+	}
+	if err := s.queue(req.Queue).Cancel(ctx, req.Id); err != nil {
+		return nil, toStatus(err)
+	}
+	return &delayqueuev1.CancelResponse{}, nil
+}
+
+// Stats 查询队列中各阶段的消息数量
+func (s *Server) Stats(ctx context.Context, req *delayqueuev1.StatsRequest) (*delayqueuev1.StatsResponse, error) {
+	if req.Queue == "" {
+		return nil, status.Error(codes.InvalidArgument, "queue is required")
+	}
+	stats, err := s.queue(req.Queue).Stats(ctx)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &delayqueuev1.StatsResponse{
+		Pending: stats.Pending,
+		Ready:   stats.Ready,
+		Unack:   stats.Unack,
+		Retry:   stats.Retry,
+		Garbage: stats.Garbage,
+		Dead:    stats.Dead,
+	}, nil
+}
+
+// Consume 每个流使用一个独立的消费者，Handler 将消息写入流并等待客户端的 Ack
+// 流断开时等待 Ack 的消息视为消费失败，按重试策略重新投递
+func (s *Server) Consume(stream delayqueuev1.DelayQueue_ConsumeServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	sub := req.GetSubscribe()
+	if sub == nil || sub.Queue == "" {
+		return status.Error(codes.InvalidArgument, "first request must subscribe to a queue")
+	}
+	c := &consumer{
+		stream: stream,
+		acks:   make(map[string]chan error),
+		closed: make(chan struct{}),
+	}
+	q := s.configure(delayqueue.NewDelayQueueWithHandler(sub.Queue, s.redisCli, c.handle))
+	if sub.Concurrent > 0 {
+		q.WithConcurrent(uint(sub.Concurrent))
+	}
+	done := q.StartConsume()
+	defer func() {
+		close(c.closed)
+		q.StopConsume()
+		<-done
+	}()
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		ack := req.GetAck()
+		if ack == nil {
+			return status.Error(codes.InvalidArgument, "only ack is allowed after subscribe")
+		}
+		c.ack(ack.Id, ack.Error)
+	}
+}
+
+// consumer 将一个 Consume 流包装为 delayqueue.Handler
+type consumer struct {
+	stream delayqueuev1.DelayQueue_ConsumeServer
+	sendMu sync.Mutex // grpc 的流不支持并发写入
+
+	mu     sync.Mutex
+	acks   map[string]chan error // 等待 Ack 的消息
+	closed chan struct{}
+}
+
+func (c *consumer) handle(ctx context.Context, msg *delayqueue.Message) error {
+	ch := make(chan error, 1)
+	c.mu.Lock()
+	c.acks[msg.ID] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.acks, msg.ID)
+		c.mu.Unlock()
+	}()
+	c.sendMu.Lock()
+	err := c.stream.Send(&delayqueuev1.Message{
+		Id:          msg.ID,
+		Payload:     msg.Payload,
+		Attempt:     int32(msg.Attempt),
+		RetriesLeft: int32(msg.RetriesLeft),
+		Deadline:    msg.Deadline.Unix(),
+	})
+	c.sendMu.Unlock()
+	if err != nil {
+		return err
+	}
+	select {
+	case err := <-ch:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.closed:
+		return errStreamClosed
+	}
+}
+
+// ack 确认消息，errMsg 不为空时表示消费失败；消息已超时或重复确认时忽略
+func (c *consumer) ack(id string, errMsg string) {
+	c.mu.Lock()
+	ch, ok := c.acks[id]
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+	var err error
+	if errMsg != "" {
+		err = errors.New(errMsg)
+	}
+	select {
+	case ch <- err:
+	default:
+	}
+}
+
+// toStatus 将 delayqueue 的错误转换为 gRPC 状态码
+func toStatus(err error) error {
+	var scheduleErr *delayqueue.ScheduleError
+	switch {
+	case errors.Is(err, delayqueue.ErrMessageNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, delayqueue.ErrQueueDeleted):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, delayqueue.ErrSendRateLimited), errors.Is(err, delayqueue.ErrQueueFull):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.As(err, &scheduleErr), errors.Is(err, delayqueue.ErrInvalidID):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
@@ -0,0 +1,137 @@
+package grpcserver
+
+import (
+	"context"
+	"delayqueue"
+	"delayqueue/grpcserver/delayqueuev1"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newTestClient(t *testing.T) (delayqueuev1.DelayQueueClient, *redis.Client) {
+	t.Helper()
+	redisCli := redis.NewClient(&redis.Options{
+		Addr: "127.0.0.1:6379",
+	})
+	redisCli.FlushDB(context.Background())
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	delayqueuev1.RegisterDelayQueueServer(srv, NewServer(redisCli, func(q *delayqueue.DelayQueue) *delayqueue.DelayQueue {
+		return q.WithFetchInterval(10 * time.Millisecond)
+	}))
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		srv.Stop()
+	})
+	return delayqueuev1.NewDelayQueueClient(conn), redisCli
+}
+
+func TestServer_SendCancelStats(t *testing.T) {
+	client, _ := newTestClient(t)
+	ctx := context.Background()
+	sent, err := client.Send(ctx, &delayqueuev1.SendRequest{Queue: "test", Payload: "hello", DelaySeconds: 3600})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if sent.Id == "" || sent.DeliverAt < time.Now().Add(59*time.Minute).Unix() {
+		t.Errorf("unexpected response: %+v", sent)
+	}
+	stats, err := client.Stats(ctx, &delayqueuev1.StatsRequest{Queue: "test"})
+	if err != nil || stats.Pending != 1 {
+		t.Errorf("expect 1 pending message, actual %+v, err: %v", stats, err)
+	}
+	if _, err := client.Cancel(ctx, &delayqueuev1.CancelRequest{Queue: "test", Id: sent.Id}); err != nil {
+		t.Error(err)
+	}
+	_, err = client.Cancel(ctx, &delayqueuev1.CancelRequest{Queue: "test", Id: sent.Id})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expect NOT_FOUND, actual %v", err)
+	}
+	_, err = client.Send(ctx, &delayqueuev1.SendRequest{Queue: "test", DeliverAt: 1, DelaySeconds: 1})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expect INVALID_ARGUMENT, actual %v", err)
+	}
+}
+
+func TestServer_Consume(t *testing.T) {
+	client, _ := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	retryCount := uint32(1)
+	sent, err := client.Send(ctx, &delayqueuev1.SendRequest{Queue: "test", Payload: "hello", RetryCount: &retryCount})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	stream, err := client.Consume(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	err = stream.Send(&delayqueuev1.ConsumeRequest{Request: &delayqueuev1.ConsumeRequest_Subscribe{
+		Subscribe: &delayqueuev1.Subscribe{Queue: "test", Concurrent: 1},
+	}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// 第一次消费失败，消息按重试策略重新投递
+	for attempt := int32(1); attempt <= 2; attempt++ {
+		msg, err := stream.Recv()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if msg.Id != sent.Id || msg.Payload != "hello" || msg.Attempt != attempt {
+			t.Errorf("unexpected message: %+v", msg)
+		}
+		ack := &delayqueuev1.Ack{Id: msg.Id}
+		if attempt == 1 {
+			ack.Error = "failed"
+		}
+		if err := stream.Send(&delayqueuev1.ConsumeRequest{Request: &delayqueuev1.ConsumeRequest_Ack{Ack: ack}}); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	for {
+		stats, err := client.Stats(ctx, &delayqueuev1.StatsRequest{Queue: "test"})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if stats.Pending+stats.Ready+stats.Unack+stats.Retry+stats.Garbage == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Errorf("message should be acked: %+v", stats)
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,158 @@
+package delayqueue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// errNegativeAck 回调函数返回 false
+var errNegativeAck = errors.New("negative ack")
+
+// ErrAckLater Handler 返回 ErrAckLater 表示消息已交给其它协程或进程处理，稍后通过 Ack 或 Nack 确认
+// 确认前消息保留在 unack 中，超过处理超时时间仍未确认的消息会被重新投递，可以通过 Extend 延长处理超时时间
+var ErrAckLater = errors.New("ack later")
+
+// Message 投递给 Handler 的消息
+type Message struct {
+	ID      string
+	Payload string
+	// Attempt 第几次投递，从 1 开始
+	Attempt int
+	// RetriesLeft 本次消费失败后剩余的重试次数，为 0 表示本次是最后一次投递
+	RetriesLeft int
+	// Deadline 处理超时时间，超过该时间未确认的消息会被重新投递，传给 Handler 的 ctx 也会在此时取消
+	Deadline time.Time
+	// Headers 发送时通过 WithHeader 设置的 header
+	Headers map[string]string
+
+	next  []*chainedMessage // 通过 Chain 添加的后续消息
+	reply *string           // 通过 Reply 设置的处理结果
+	queue *DelayQueue       // 投递消息的队列，用于上报处理进度
+
+	payloadRef string // 外部存储中消息内容的引用
+}
+
+// Handler 消费消息的函数，返回 nil 表示确认消息，返回 ErrAckLater 表示稍后确认，
+// 返回其它 error 表示消费失败，消息会按重试策略重新投递；
+// 返回 Permanent(err) 时不再重试，直接移入死信队列，返回 Transient(err, d) 时在 d 之后重试
+// ctx 在处理超时时取消，Handler 应在 ctx 取消后尽快返回，避免与重新投递的消息同时处理
+type Handler func(ctx context.Context, msg *Message) error
+
+// callbackHandler 将 func(string) bool 形式的回调函数转换为 Handler
+func callbackHandler(callback func(string) bool) Handler {
+	return func(ctx context.Context, msg *Message) error {
+		if callback(msg.Payload) {
+			return nil
+		}
+		return errNegativeAck
+	}
+}
+
+// NewDelayQueueWithHandler 使用 Handler 创建新的Queue
+func NewDelayQueueWithHandler(name string, redisCli *redis.Client, handler Handler) *DelayQueue {
+	if name == "" {
+		panic("name is required")
+	}
+	if redisCli == nil {
+		panic("redis client is required")
+	}
+	if handler == nil {
+		panic("handler is required")
+	}
+	q := newDelayQueue(name, redisCli)
+	q.handler = handler
+	return q
+}
+
+// delivery 传给 Handler 的 ctx，在处理超时时取消，Extend 可以推迟取消的时间
+type delivery struct {
+	context.Context
+	cancel   context.CancelFunc
+	mu       sync.Mutex
+	deadline time.Time
+	timer    *time.Timer
+	gen      int // 每次 extend 后递增，使旧的定时器失效
+	expired  bool
+	aborted  bool // 消息在处理过程中被取消
+}
+
+// newDelivery 创建在 timeout 后取消的 delivery，deadline 为对应的处理超时时间
+func newDelivery(parent context.Context, deadline time.Time, timeout time.Duration) *delivery {
+	ctx, cancel := context.WithCancel(parent)
+	d := &delivery{Context: ctx, cancel: cancel, deadline: deadline}
+	d.timer = time.AfterFunc(timeout, d.expireFunc(0))
+	return d
+}
+
+func (d *delivery) Deadline() (time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.deadline, true
+}
+
+func (d *delivery) Err() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.expired {
+		return context.DeadlineExceeded
+	}
+	return d.Context.Err()
+}
+
+func (d *delivery) expireFunc(gen int) func() {
+	return func() {
+		d.mu.Lock()
+		if gen != d.gen || d.Context.Err() != nil {
+			d.mu.Unlock()
+			return
+		}
+		d.expired = true
+		d.mu.Unlock()
+		d.cancel()
+	}
+}
+
+// extend 将取消时间推迟到 timeout 之后，已经取消的 delivery 不会恢复
+func (d *delivery) extend(deadline time.Time, timeout time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.expired || d.Context.Err() != nil {
+		return
+	}
+	d.timer.Stop()
+	d.gen++
+	d.deadline = deadline
+	d.timer = time.AfterFunc(timeout, d.expireFunc(d.gen))
+}
+
+// abort 消息被取消时取消 ctx
+func (d *delivery) abort() {
+	d.mu.Lock()
+	if d.expired || d.Context.Err() != nil {
+		d.mu.Unlock()
+		return
+	}
+	d.aborted = true
+	d.timer.Stop()
+	d.mu.Unlock()
+	d.cancel()
+}
+
+// isAborted 消息是否在处理过程中被取消
+func (d *delivery) isAborted() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.aborted
+}
+
+// finish 停止定时器并取消 ctx
+func (d *delivery) finish() {
+	d.mu.Lock()
+	d.timer.Stop()
+	d.mu.Unlock()
+	d.cancel()
+}
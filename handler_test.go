@@ -0,0 +1,70 @@
+package delayqueue
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_Handler(t *testing.T) {
+	redisCli := newTestRedis(t)
+	var received *Message
+	var handleErr error
+	queue := NewDelayQueueWithHandler("test", redisCli, func(ctx context.Context, msg *Message) error {
+		received = msg
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("expect context with deadline")
+		}
+		<-ctx.Done()
+		handleErr = ctx.Err()
+		return handleErr
+	}).WithMaxConsumeDuration(100 * time.Millisecond).WithDefaultRetryCount(0)
+	msg, err := queue.SendDelayMsgV2("hello", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	start := time.Now()
+	_, err = queue.ProcessOnce()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if time.Since(start) > time.Second {
+		t.Error("expect handler cancelled at deadline")
+	}
+	if received == nil || received.ID != msg.ID || received.Payload != "hello" || received.Deadline.IsZero() {
+		t.Errorf("unexpected message: %+v", received)
+	}
+	if handleErr != context.DeadlineExceeded {
+		t.Errorf("expect deadline exceeded, actual: %v", handleErr)
+	}
+}
+
+func TestDelayQueue_Attempt(t *testing.T) {
+	redisCli := newTestRedis(t)
+	var attempts, retriesLeft []int
+	queue := NewDelayQueueWithHandler("test", redisCli, func(ctx context.Context, msg *Message) error {
+		attempts = append(attempts, msg.Attempt)
+		retriesLeft = append(retriesLeft, msg.RetriesLeft)
+		return errors.New("fail")
+	}).WithDefaultRetryCount(2)
+	if err := queue.SendDelayMsg("hello", 0); err != nil {
+		t.Error(err)
+		return
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := queue.ProcessOnce(); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if !reflect.DeepEqual(attempts, []int{1, 2, 3}) || !reflect.DeepEqual(retriesLeft, []int{2, 1, 0}) {
+		t.Errorf("unexpected attempts: %v, retries left: %v", attempts, retriesLeft)
+	}
+	if n, _ := redisCli.HLen(context.Background(), queue.attemptKey).Result(); n != 0 {
+		t.Errorf("expect attempt count removed, actual: %d", n)
+	}
+}
@@ -0,0 +1,78 @@
+package delayqueue
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// ErrHandlerAbandoned Handler 超过处理超时时间加 WithHardTimeout 设置的宽限时间仍未返回，消费协程不再等待，消息按消费失败处理
+var ErrHandlerAbandoned = errors.New("handler abandoned")
+
+// maxGoroutineDump 放弃 Handler 时记录的协程堆栈的最大长度
+const maxGoroutineDump = 1 << 20
+
+// 启用 WithHardTimeout 时 Handler 协程的状态
+const (
+	handlerRunning int32 = iota
+	handlerFinished
+	handlerAbandoned
+)
+
+// WithHardTimeout 在独立的协程中执行 Handler，Handler 的 ctx 被取消（处理超时或消息被取消）后超过 grace 仍未返回时，
+// 消费协程不再等待，消息按消费失败处理（重试次数耗尽时移入死信队列），并记录所有协程的堆栈用于排查卡住的位置，
+// 避免一个不响应 ctx 的 Handler 永久占用一个并发数
+// 被放弃的 Handler 协程无法被强制结束，仍会继续运行直到返回，其返回值被忽略，数量可以通过 AbandonedHandlers 查询
+func (q *DelayQueue) WithHardTimeout(grace time.Duration) *DelayQueue {
+	if q.frozen("WithHardTimeout") {
+		return q
+	}
+	q.hardTimeout = grace
+	return q
+}
+
+// AbandonedHandlers 返回已被放弃但仍在运行的 Handler 数量
+func (q *DelayQueue) AbandonedHandlers() int64 {
+	return q.abandoned.Load()
+}
+
+// runHandler 执行 Handler，启用 WithHardTimeout 时 ctx 取消后超过宽限时间仍未返回则返回 ErrHandlerAbandoned
+func (q *DelayQueue) runHandler(handleCtx *delivery, msg *Message) error {
+	if q.hardTimeout <= 0 {
+		return q.safeHandle(handleCtx, msg)
+	}
+	var state atomic.Int32
+	result := make(chan error, 1)
+	go func() {
+		result <- q.safeHandle(handleCtx, msg)
+		if !state.CompareAndSwap(handlerRunning, handlerFinished) {
+			q.abandoned.Add(-1)
+			q.logger.Info("abandoned handler returned", "queue", q.name, "id", msg.ID)
+		}
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-handleCtx.Done():
+	}
+	timer := time.NewTimer(q.hardTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-result:
+		return err
+	case <-timer.C:
+	}
+	if !state.CompareAndSwap(handlerRunning, handlerAbandoned) {
+		return <-result
+	}
+	q.abandoned.Add(1)
+	buf := make([]byte, maxGoroutineDump)
+	n := runtime.Stack(buf, true)
+	q.logger.Error("handler abandoned", "queue", q.name, "id", msg.ID, "grace", q.hardTimeout, "goroutines", string(buf[:n]))
+	if q.errorHandler != nil {
+		q.errorHandler(fmt.Errorf("consume msg %s failed: %v", msg.ID, ErrHandlerAbandoned))
+	}
+	return ErrHandlerAbandoned
+}
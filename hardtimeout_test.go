@@ -0,0 +1,61 @@
+package delayqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_HardTimeout(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	release := make(chan struct{})
+	returned := make(chan struct{})
+	var errs []error
+	// Handler 忽略 ctx，一直阻塞到测试结束
+	queue := NewDelayQueueWithHandler("test", redisCli, func(ctx context.Context, msg *Message) error {
+		<-release
+		close(returned)
+		return nil
+	}).WithMaxConsumeDuration(100 * time.Millisecond).WithHardTimeout(100 * time.Millisecond).
+		WithDefaultRetryCount(0).WithDeadLetter(time.Hour).WithErrorHandler(func(err error) {
+		errs = append(errs, err)
+	})
+	msg, err := queue.SendDelayMsgV2("wedged", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	start := time.Now()
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	if cost := time.Since(start); cost > 2*time.Second {
+		t.Errorf("wedged handler should be abandoned, cost: %v", cost)
+	}
+	if n := queue.AbandonedHandlers(); n != 1 {
+		t.Errorf("expect 1 abandoned handler, actual: %d", n)
+	}
+	if len(errs) != 1 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+	// 按消费失败处理，没有剩余重试次数的消息移入死信队列
+	dead, _, err := queue.ListDead(ctx, "", 10)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(dead) != 1 || dead[0].ID != msg.ID {
+		t.Errorf("message should be dead lettered: %v", dead)
+	}
+	close(release)
+	<-returned
+	for i := 0; queue.AbandonedHandlers() != 0; i++ {
+		if i >= 100 {
+			t.Error("abandoned handler should be released after it returns")
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
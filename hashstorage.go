@@ -0,0 +1,166 @@
+package delayqueue
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 启用 WithHashStorage 时消息 HASH 中的字段
+const (
+	hashFieldPayload   = "payload"   // 消息内容
+	hashFieldRetry     = "retry"     // 剩余重试次数
+	hashFieldAttempt   = "attempt"   // 已投递的次数
+	hashFieldSentAt    = "sentAt"    // 发送时间，unix 秒
+	hashFieldDeliverAt = "deliverAt" // 投递时间，unix 秒
+	hashHeaderPrefix   = "h:"        // header 字段的前缀
+)
+
+// WithHashStorage 将每条消息的内容、重试次数、投递次数、header 及发送和投递时间保存在同一个 HASH {prefix}{name}:msg:{id} 中，
+// 代替默认的消息内容 key、retry:cnt 和 attempt hash 中的字段及 headers key，
+// 消息的各项数据随消息 key 一起过期和删除，不会因部分写入或清理而不一致，也可以通过 HGETALL 一次读取
+// 同一队列的生产者和消费者必须同时启用，切换前应确保队列中没有消息；不能与 WithUpstreamCompat 同时使用，仅支持 redis
+func (q *DelayQueue) WithHashStorage() *DelayQueue {
+	if q.frozen("WithHashStorage") {
+		return q
+	}
+	if q.redisCli == nil {
+		q.invalidOption("WithHashStorage", "hash storage requires redis")
+		return q
+	}
+	if q.compat {
+		q.invalidOption("WithHashStorage", "hash storage can not be used with upstream compat")
+		return q
+	}
+	q.hashStorage = true
+	q.initKeys(q.name)
+	return q
+}
+
+// msgFieldScript 读写消息的重试次数、投递次数的 lua 函数
+// 默认存储在以消息ID为 field 的 hash（retryCountKey、attemptKey）中；
+// 启用 WithHashStorage 时传入的 key 为消息 key 的前缀（以 ':' 结尾），字段存储在消息的 HASH 中，
+// 消息已不存在时不写入，避免留下没有过期时间的 HASH
+const msgFieldScript = `
+local function isHashStorage(key)
+	return string.sub(key, -1) == ':'
+end
+local function fieldOf(key, id, field)
+	if isHashStorage(key) then return key .. id, field end
+	return key, id
+end
+local function getField(key, id, field)
+	local k, f = fieldOf(key, id, field)
+	return redis.call('HGet', k, f)
+end
+local function setField(key, id, field, value)
+	local k, f = fieldOf(key, id, field)
+	if k ~= key and redis.call('Exists', k) == 0 then return end
+	redis.call('HSet', k, f, value)
+end
+local function incrField(key, id, field, n)
+	local k, f = fieldOf(key, id, field)
+	if k ~= key and redis.call('Exists', k) == 0 then return end
+	redis.call('HIncrBy', k, f, n)
+end
+local function delField(key, id, field)
+	local k, f = fieldOf(key, id, field)
+	redis.call('HDel', k, f)
+end
+`
+
+// storedMsg 从 redis 中读取的消息
+type storedMsg struct {
+	payload    string
+	retryCount int64
+	attempt    int64
+	headers    map[string]string
+}
+
+// msgCmds 在 pipeline 中读取消息的命令，兼容两种存储方式
+type msgCmds struct {
+	hash       *redis.StringStringMapCmd
+	payload    *redis.StringCmd
+	retryCount *redis.StringCmd
+	attempt    *redis.StringCmd
+	headers    *redis.StringStringMapCmd
+}
+
+// readMsg 在 pipe 中读取消息的内容、重试次数、投递次数和 header
+func (q *DelayQueue) readMsg(ctx context.Context, pipe redis.Pipeliner, idStr string) *msgCmds {
+	if q.hashStorage {
+		return &msgCmds{hash: pipe.HGetAll(ctx, q.genMsgKey(idStr))}
+	}
+	return &msgCmds{
+		payload:    pipe.Get(ctx, q.genMsgKey(idStr)),
+		retryCount: pipe.HGet(ctx, q.retryCountKey, idStr),
+		attempt:    pipe.HGet(ctx, q.attemptKey, idStr),
+		headers:    pipe.HGetAll(ctx, q.genHeadersKey(idStr)),
+	}
+}
+
+// result 返回 pipeline 执行后读取到的消息，消息不存在时返回 redis.Nil
+func (c *msgCmds) result() (*storedMsg, error) {
+	msg := &storedMsg{}
+	if c.hash != nil {
+		fields, err := c.hash.Result()
+		if err != nil {
+			return nil, err
+		}
+		payload, ok := fields[hashFieldPayload]
+		if !ok {
+			return nil, redis.Nil
+		}
+		msg.payload = payload
+		msg.retryCount, _ = strconv.ParseInt(fields[hashFieldRetry], 10, 64)
+		msg.attempt, _ = strconv.ParseInt(fields[hashFieldAttempt], 10, 64)
+		for k, v := range fields {
+			if strings.HasPrefix(k, hashHeaderPrefix) {
+				if msg.headers == nil {
+					msg.headers = make(map[string]string)
+				}
+				msg.headers[strings.TrimPrefix(k, hashHeaderPrefix)] = v
+			}
+		}
+		return msg, nil
+	}
+	payload, err := c.payload.Result()
+	if err != nil {
+		return nil, err
+	}
+	msg.payload = payload
+	msg.retryCount, _ = c.retryCount.Int64()
+	msg.attempt, _ = c.attempt.Int64()
+	if len(c.headers.Val()) > 0 {
+		msg.headers = c.headers.Val()
+	}
+	return msg, nil
+}
+
+// writeMsgHash 在 pipe 中将消息保存为一个 HASH
+func (q *DelayQueue) writeMsgHash(ctx context.Context, pipe redis.Pipeliner, msg *MessageInfo, ttl time.Duration) {
+	fields := make([]interface{}, 0, 10+len(msg.Headers)*2)
+	fields = append(fields,
+		hashFieldPayload, msg.Payload,
+		hashFieldRetry, msg.RetryCount,
+		hashFieldAttempt, 0,
+		hashFieldSentAt, q.clock.Now().Unix(),
+		hashFieldDeliverAt, msg.Time.Unix(),
+	)
+	for k, v := range msg.Headers {
+		fields = append(fields, hashHeaderPrefix+k, v)
+	}
+	pipe.HSet(ctx, q.genMsgKey(msg.ID), fields...)
+	pipe.Expire(ctx, q.genMsgKey(msg.ID), ttl)
+}
+
+// retryCountExists 在 pipe 中检查消息是否有重试次数
+func (q *DelayQueue) retryCountExists(ctx context.Context, pipe redis.Pipeliner, idStr string) *redis.BoolCmd {
+	if q.hashStorage {
+		return pipe.HExists(ctx, q.genMsgKey(idStr), hashFieldRetry)
+	}
+	return pipe.HExists(ctx, q.retryCountKey, idStr)
+}
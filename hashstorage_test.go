@@ -0,0 +1,139 @@
+package delayqueue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_HashStorage(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	var attempts, retriesLeft []int
+	queue := NewDelayQueueWithHandler("test", redisCli, func(ctx context.Context, msg *Message) error {
+		attempts = append(attempts, msg.Attempt)
+		retriesLeft = append(retriesLeft, msg.RetriesLeft)
+		if msg.Headers["kind"] != "image" {
+			t.Errorf("unexpected headers: %v", msg.Headers)
+		}
+		if len(attempts) == 1 {
+			return errors.New("fail")
+		}
+		return nil
+	}).WithHashStorage().WithDefaultRetryCount(2)
+	msg, err := queue.SendDelayMsgV2("hello", 0, WithHeader("kind", "image"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// 消息的各项数据保存在同一个 HASH 中
+	fields, err := redisCli.HGetAll(ctx, queue.genMsgKey(msg.ID)).Result()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if fields[hashFieldPayload] != "hello" || fields[hashFieldRetry] != "2" || fields[hashHeaderPrefix+"kind"] != "image" ||
+		fields[hashFieldSentAt] == "" || fields[hashFieldDeliverAt] == "" {
+		t.Errorf("unexpected msg hash: %v", fields)
+	}
+	n, err := redisCli.Exists(ctx, "dp:test:retry:cnt", "dp:test:attempt", queue.genHeadersKey(msg.ID)).Result()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if n != 0 {
+		t.Errorf("legacy keys should not be used, %d found", n)
+	}
+	info, err := queue.GetMessage(ctx, msg.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if info.Payload != "hello" || info.RetryCount != 2 || info.Headers["kind"] != "image" || info.State != StagePending {
+		t.Errorf("unexpected message: %+v", info)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := queue.ProcessOnce(); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if len(attempts) != 2 || attempts[0] != 1 || attempts[1] != 2 || retriesLeft[0] != 2 || retriesLeft[1] != 1 {
+		t.Errorf("unexpected attempts %v, retries left %v", attempts, retriesLeft)
+	}
+	if redisCli.Exists(ctx, queue.genMsgKey(msg.ID)).Val() != 0 {
+		t.Errorf("msg hash should be deleted after ack")
+	}
+}
+
+func TestDelayQueue_HashStorageDeadLetter(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return false
+	}).WithHashStorage().WithDefaultRetryCount(0).WithDeadLetter(time.Hour)
+	msg, err := queue.SendDelayMsgV2("hello", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := queue.ProcessOnce(); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	info, err := queue.GetMessage(ctx, msg.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if info.State != StageDead || info.Payload != "hello" {
+		t.Errorf("unexpected message: %+v", info)
+	}
+	queue.defaultRetryCount = 3
+	if n, err := queue.RequeueDead(ctx, msg.ID); err != nil || n != 1 {
+		t.Errorf("requeue dead failed: %d, %v", n, err)
+		return
+	}
+	fields, err := redisCli.HGetAll(ctx, queue.genMsgKey(msg.ID)).Result()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if fields[hashFieldRetry] != "3" || fields[hashFieldAttempt] != "" || fields[hashFieldPayload] != "hello" {
+		t.Errorf("unexpected msg hash: %v", fields)
+	}
+}
+
+func TestDelayQueue_HashStorageVerify(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	}).WithHashStorage()
+	var ids []string
+	for i := 0; i < 2; i++ {
+		msg, err := queue.SendDelayMsgV2("payload", time.Hour)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		ids = append(ids, msg.ID)
+	}
+	redisCli.Del(ctx, queue.genMsgKey(ids[0]))
+	redisCli.HDel(ctx, queue.genMsgKey(ids[1]), hashFieldRetry)
+	report, err := queue.Verify(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	kinds := make(map[string]string)
+	for _, v := range report.Violations {
+		kinds[v.ID] = v.Kind
+	}
+	if len(report.Violations) != 2 || kinds[ids[0]] != ViolationMissingPayload || kinds[ids[1]] != ViolationMissingRetryCount {
+		t.Errorf("unexpected violations: %+v", report.Violations)
+	}
+}
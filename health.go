@@ -0,0 +1,80 @@
+package delayqueue
+
+import (
+	"context"
+	"time"
+)
+
+// 消费协程的健康状态
+const (
+	ConsumerNotStarted = "not started" // 未调用 StartConsume，只用于发送消息的实例
+	ConsumerRunning    = "running"     // 消费周期正常执行
+	ConsumerStalled    = "stalled"     // 消费周期长时间未执行，可能阻塞在 Handler 中
+	ConsumerStopped    = "stopped"     // 已调用 StopConsume 或队列已被删除
+)
+
+// HealthStatus 队列的健康状态，可以直接序列化为 JSON 作为就绪探针的响应
+type HealthStatus struct {
+	Healthy  bool      `json:"healthy"`
+	Redis    string    `json:"redis"`   // "ok"、错误信息，未使用 redis 时为 "skipped"
+	Scripts  string    `json:"scripts"` // lua 脚本能否执行，取值与 Redis 相同
+	Consumer string    `json:"consumer"`
+	LastTick time.Time `json:"lastTick,omitempty"` // 最近一次执行消费周期的时间
+}
+
+// healthScript 用于检查 redis 是否允许执行 lua 脚本
+const healthScript = `return 1`
+
+// Health 检查 redis 连接、lua 脚本的执行及消费协程的状态，用于就绪探针
+// 消费协程超过 3 个拉取间隔加上处理超时时间仍未执行消费周期时视为 stalled
+// 只用于发送消息的实例不检查消费协程
+func (q *DelayQueue) Health(ctx context.Context) *HealthStatus {
+	status := &HealthStatus{Healthy: true, Redis: "skipped", Scripts: "skipped"}
+	if q.redisCli != nil {
+		status.Redis, status.Scripts = "ok", "ok"
+		if err := q.redisCli.Ping(ctx).Err(); err != nil {
+			status.Healthy = false
+			status.Redis = err.Error()
+		}
+		if err := q.redisCli.Eval(ctx, healthScript, nil).Err(); err != nil {
+			status.Healthy = false
+			status.Scripts = err.Error()
+		}
+	}
+	status.Consumer = q.consumerState(status)
+	if status.Consumer == ConsumerStalled || status.Consumer == ConsumerStopped {
+		status.Healthy = false
+	}
+	return status
+}
+
+// consumerState 返回消费协程的状态，并将最近一次执行消费周期的时间写入 status
+func (q *DelayQueue) consumerState(status *HealthStatus) string {
+	if !q.started.Load() {
+		return ConsumerNotStarted
+	}
+	select {
+	case <-q.close:
+		return ConsumerStopped
+	default:
+	}
+	if q.deleted.Load() {
+		return ConsumerStopped
+	}
+	last := q.lastTick.Load()
+	if last != 0 {
+		status.LastTick = time.Unix(0, last)
+	} else {
+		// 尚未执行第一个消费周期，以启动时间为准
+		last = q.startedAt.Load()
+	}
+	if q.clock.Now().Sub(time.Unix(0, last)) > 3*q.fetchInterval+q.maxConsumeDuration {
+		return ConsumerStalled
+	}
+	return ConsumerRunning
+}
+
+// tick 记录执行消费周期的时间
+func (q *DelayQueue) tick() {
+	q.lastTick.Store(q.clock.Now().UnixNano())
+}
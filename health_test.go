@@ -0,0 +1,43 @@
+package delayqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_Health(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	block := make(chan struct{})
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		<-block
+		return true
+	}).WithFetchInterval(50 * time.Millisecond).WithMaxConsumeDuration(100 * time.Millisecond)
+	status := queue.Health(ctx)
+	if !status.Healthy || status.Redis != "ok" || status.Scripts != "ok" || status.Consumer != ConsumerNotStarted {
+		t.Errorf("unexpected status: %+v", status)
+	}
+	queue.StartConsume()
+	time.Sleep(200 * time.Millisecond)
+	status = queue.Health(ctx)
+	if !status.Healthy || status.Consumer != ConsumerRunning || status.LastTick.IsZero() {
+		t.Errorf("unexpected status: %+v", status)
+	}
+	// Handler 阻塞时消费周期无法执行
+	if err := queue.SendDelayMsg("block", 0); err != nil {
+		t.Error(err)
+		return
+	}
+	time.Sleep(500 * time.Millisecond)
+	status = queue.Health(ctx)
+	if status.Healthy || status.Consumer != ConsumerStalled {
+		t.Errorf("unexpected status: %+v", status)
+	}
+	close(block)
+	queue.StopConsume()
+	status = queue.Health(ctx)
+	if status.Healthy || status.Consumer != ConsumerStopped {
+		t.Errorf("unexpected status: %+v", status)
+	}
+}
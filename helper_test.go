@@ -0,0 +1,18 @@
+package delayqueue
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// newTestRedis 连接测试使用的 redis 并清空数据
+func newTestRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	redisCli := redis.NewClient(&redis.Options{
+		Addr: "127.0.0.1:6379",
+	})
+	redisCli.FlushDB(context.Background())
+	return redisCli
+}
@@ -0,0 +1,168 @@
+package delayqueue
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// 投递历史中的事件
+const (
+	HistoryEnqueued  = "enqueued"  // 消息被发送到队列
+	HistoryDelivered = "delivered" // 消息被投递给消费者
+	HistoryNack      = "nack"      // 消费者处理失败
+	HistoryRetry     = "retry"     // 消息进入重试队列
+	HistoryDead      = "dead"      // 消息达到重试上限
+	HistoryRequeued  = "requeued"  // 死信消息被重新投递
+	HistoryExpired   = "expired"   // 消息超过最晚投递时间
+	HistoryPoisoned  = "poisoned"  // 消息被识别为毒消息并隔离
+	HistoryPermanent = "permanent" // 消费者返回永久错误，不再重试
+)
+
+// maxHistory 每条消息最多保留的投递历史数量
+const maxHistory = 20
+
+// errConsumeTimeout 消费者未在 maxConsumeDuration 内确认消息
+const errConsumeTimeout = "consume timeout"
+
+// HistoryRecord 消息的一条投递历史
+type HistoryRecord struct {
+	Time  int64  `json:"time"` // unix 秒
+	Event string `json:"event"`
+	Error string `json:"error,omitempty"`
+}
+
+// genHistoryKey list 存储消息的投递历史，过期时间与消息内容一致
+func (q *DelayQueue) genHistoryKey(idStr string) string {
+	return q.genMsgKey(idStr) + ":history"
+}
+
+// WithHistory 启用消息的投递历史，记录发送、每次投递、失败及最终结果（死信、过期），
+// 每条消息最多保留最近 20 条，可以通过 GetMessage 查询。启用死信队列时总是记录投递历史
+func (q *DelayQueue) WithHistory() *DelayQueue {
+	if q.frozen("WithHistory") {
+		return q
+	}
+	q.historyTracking = true
+	return q
+}
+
+// historyEnabled 调用 WithHistory 或启用死信队列时记录消息的投递历史
+func (q *DelayQueue) historyEnabled() bool {
+	return q.historyTracking || q.deadLetterTTL > 0
+}
+
+// historyPrefix 传给 lua 脚本的投递历史 key 前缀，不记录投递历史时为空
+func (q *DelayQueue) historyPrefix() string {
+	if !q.historyEnabled() {
+		return ""
+	}
+	return q.genMsgKey("")
+}
+
+// recordHistoryScript 供其它脚本拼接使用的记录投递历史的 lua 函数，保留的数量与 maxHistory 一致
+// 参数: 投递历史 key 前缀（为空时不记录）、消息ID、时间、事件
+const recordHistoryScript = `
+local function recordHistory(prefix, id, now, event)
+	if prefix == '' then return end
+	local key = prefix .. id .. ':history'
+	redis.call('RPush', key, '{"time":' .. now .. ',"event":"' .. event .. '"}')
+	redis.call('LTrim', key, -20, -1)
+end
+`
+
+func (q *DelayQueue) recordHistory(ctx context.Context, idStr string, record *HistoryRecord) {
+	if !q.historyEnabled() {
+		return
+	}
+	err := q.broker.RecordHistory(ctx, idStr, record)
+	if err != nil {
+		q.logger.Error("record history failed", "queue", q.name, "id", idStr, "error", err)
+	}
+}
+
+func (b *redisBroker) RecordHistory(ctx context.Context, idStr string, record *HistoryRecord) error {
+	q := b.q
+	data, _ := json.Marshal(record)
+	key := q.genHistoryKey(idStr)
+	pipe := q.redisCli.Pipeline()
+	pipe.RPush(ctx, key, data)
+	pipe.LTrim(ctx, key, -maxHistory, -1)
+	pipe.Expire(ctx, key, q.msgTTL)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetHistory 查询消息的投递历史，仅在调用 WithHistory 或启用死信队列时记录
+func (q *DelayQueue) GetHistory(ctx context.Context, idStr string) ([]*HistoryRecord, error) {
+	if err := q.requireRedis("GetHistory"); err != nil {
+		return nil, err
+	}
+	items, err := q.redisCli.LRange(ctx, q.genHistoryKey(idStr), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	records := make([]*HistoryRecord, 0, len(items))
+	for _, item := range items {
+		record := &HistoryRecord{}
+		if err := json.Unmarshal([]byte(item), record); err != nil {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// lastError 根据投递历史推断最后一次投递失败的原因
+func lastError(records []*HistoryRecord) string {
+	for i := len(records) - 1; i >= 0; i-- {
+		switch records[i].Event {
+		case HistoryNack:
+			return records[i].Error
+		case HistoryDelivered:
+			// 投递之后没有 nack 记录，说明消费超时
+			return errConsumeTimeout
+		}
+	}
+	return ""
+}
+
+// Failure 一次投递失败的记录
+type Failure struct {
+	Time   int64  `json:"time"` // unix 秒
+	Reason string `json:"reason"`
+}
+
+// lastDelivered 返回投递历史中最后一次投递的时间，没有投递记录时返回零值
+func lastDelivered(records []*HistoryRecord) time.Time {
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].Event == HistoryDelivered {
+			return time.Unix(records[i].Time, 0)
+		}
+	}
+	return time.Time{}
+}
+
+// failures 根据投递历史推断每次投递失败的时间及原因，按时间顺序排列
+// 投递之后有 nack 记录时使用 nack 的原因，否则在消息进入重试或死信时视为消费超时
+func failures(records []*HistoryRecord) []*Failure {
+	var result []*Failure
+	delivered := false
+	for _, record := range records {
+		switch record.Event {
+		case HistoryDelivered:
+			delivered = true
+		case HistoryNack:
+			if delivered {
+				result = append(result, &Failure{Time: record.Time, Reason: record.Error})
+				delivered = false
+			}
+		case HistoryRetry, HistoryDead:
+			if delivered {
+				result = append(result, &Failure{Time: record.Time, Reason: errConsumeTimeout})
+				delivered = false
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,58 @@
+package delayqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_GetMessageHistory(t *testing.T) {
+	redisCli := newTestRedis(t)
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return false
+	}).WithDefaultRetryCount(1).WithHistory()
+	testGetMessageHistory(t, queue)
+}
+
+func TestMemoryQueue_GetMessageHistory(t *testing.T) {
+	queue := NewMemoryQueue("test", func(s string) bool {
+		return false
+	}).WithDefaultRetryCount(1).WithHistory()
+	testGetMessageHistory(t, queue.q)
+}
+
+func testGetMessageHistory(t *testing.T, queue *DelayQueue) {
+	ctx := context.Background()
+	msg, err := queue.SendDelayMsgV2("foo", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	info, err := queue.GetMessage(ctx, msg.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var events []string
+	for _, record := range info.History {
+		events = append(events, record.Event)
+	}
+	expect := []string{HistoryEnqueued, HistoryDelivered, HistoryNack, HistoryRetry, HistoryDelivered, HistoryNack}
+	if len(events) != len(expect) {
+		t.Errorf("unexpected history: %v", events)
+		return
+	}
+	for i := range expect {
+		if events[i] != expect[i] {
+			t.Errorf("unexpected history: %v", events)
+			return
+		}
+	}
+	if info.History[0].Time < time.Now().Add(-time.Minute).Unix() {
+		t.Errorf("unexpected time: %d", info.History[0].Time)
+	}
+}
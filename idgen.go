@@ -0,0 +1,75 @@
+package delayqueue
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidID IDGenerator 生成的消息 ID 为空或包含保留的字符
+var ErrInvalidID = errors.New("invalid message id")
+
+// IDGenerator 生成消息 ID，默认使用随机的 UUIDv4
+// 可以替换为 ULID、雪花算法等有序的 ID，或根据 payload 中的业务键生成确定的 ID
+type IDGenerator interface {
+	NewID(payload string) string
+}
+
+// IDGeneratorFunc 将函数转换为 IDGenerator
+type IDGeneratorFunc func(payload string) string
+
+// NewID 调用 f(payload)
+func (f IDGeneratorFunc) NewID(payload string) string {
+	return f(payload)
+}
+
+type uuidGenerator struct{}
+
+func (uuidGenerator) NewID(string) string {
+	return uuid.Must(uuid.NewRandom()).String()
+}
+
+// WithIDGenerator 自定义消息 ID 的生成方式
+// ID 会作为 redis key 的一部分，同一个队列中未过期的消息 ID 不能重复，否则新消息会覆盖旧消息
+// ID 不能包含 ':'（用于投递历史、header 等附属 key），启用 WithPartitions 时也不能包含 '{' 和 '}'，
+// 否则发送时返回 ErrInvalidID
+func (q *DelayQueue) WithIDGenerator(gen IDGenerator) *DelayQueue {
+	if q.frozen("WithIDGenerator") {
+		return q
+	}
+	if gen == nil {
+		gen = uuidGenerator{}
+	}
+	q.idGenerator = gen
+	return q
+}
+
+// checkID 检查 IDGenerator 生成的消息 ID 是否合法
+func (q *DelayQueue) checkID(id string) error {
+	reserved := ":"
+	if q.partitions != nil {
+		reserved = ":{}"
+	}
+	if id == "" || strings.ContainsAny(id, reserved) {
+		return fmt.Errorf("%w: %q", ErrInvalidID, id)
+	}
+	return nil
+}
+
+// copyID 生成发送给其它消费组的消息副本的 ID
+// 确定的 ID 对同一个 payload 返回相同的值，此时在原 ID 后追加 '@' 和消费组名称以区分副本
+func (q *DelayQueue) copyID(msg *MessageInfo, group string) (string, error) {
+	id := q.idGenerator.NewID(msg.Payload)
+	if err := q.checkID(id); err != nil {
+		return "", err
+	}
+	if id == msg.ID {
+		id += "@" + group
+	}
+	if tag := hashTag(msg.ID); q.partitions != nil && tag != "" {
+		id += "{" + tag + "}"
+	}
+	return id, nil
+}
@@ -0,0 +1,79 @@
+package delayqueue
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestDelayQueue_IDGenerator(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	cb := func(s string) bool {
+		return true
+	}
+	// 根据业务键生成确定的 ID
+	gen := IDGeneratorFunc(func(payload string) string {
+		return "order-" + payload
+	})
+	queue := NewDelayQueue("test", redisCli, cb).WithIDGenerator(gen)
+	msg, err := queue.SendDelayMsgV2("1001", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if msg.ID != "order-1001" {
+		t.Errorf("unexpected id: %s", msg.ID)
+	}
+	info, err := queue.GetMessage(ctx, "order-1001")
+	if err != nil || info.Payload != "1001" {
+		t.Errorf("unexpected message: %+v, %v", info, err)
+	}
+
+	// 消费组的副本使用不同的 ID
+	redisCli.FlushDB(ctx)
+	billing := NewDelayQueue("test", redisCli, cb).WithGroup("billing")
+	shipping := NewDelayQueue("test", redisCli, cb).WithGroup("shipping")
+	for _, q := range []*DelayQueue{billing, shipping} {
+		if _, err := q.ProcessOnce(); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	producer := NewDelayQueue("test", redisCli, cb).WithIDGenerator(gen)
+	if err := producer.SendDelayMsg("1002", 0); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := billing.GetMessage(ctx, "order-1002"); err != nil {
+		t.Errorf("expect billing copy: %v", err)
+	}
+	if _, err := shipping.GetMessage(ctx, "order-1002@shipping"); err != nil {
+		t.Errorf("expect shipping copy: %v", err)
+	}
+}
+
+func TestDelayQueue_InvalidID(t *testing.T) {
+	redisCli := newTestRedis(t)
+	cb := func(s string) bool {
+		return true
+	}
+	gen := IDGeneratorFunc(func(payload string) string {
+		return payload
+	})
+	queue := NewDelayQueue("test", redisCli, cb).WithIDGenerator(gen)
+	// ':' 会与投递历史等附属 key 冲突
+	if _, err := queue.SendDelayMsgV2("order:history", 0); !errors.Is(err, ErrInvalidID) {
+		t.Errorf("expect ErrInvalidID, actual %v", err)
+	}
+	if _, err := queue.SendDelayMsgV2("", 0); !errors.Is(err, ErrInvalidID) {
+		t.Errorf("expect ErrInvalidID for empty id, actual %v", err)
+	}
+	if _, err := queue.SendDelayMsgV2("order{1}", 0); err != nil {
+		t.Errorf("braces are allowed without partitions: %v", err)
+	}
+	partitioned := NewDelayQueue("partitioned", redisCli, cb).WithIDGenerator(gen).WithPartitions(2)
+	if _, err := partitioned.SendDelayMsgV2("order{1}", 0); !errors.Is(err, ErrInvalidID) {
+		t.Errorf("expect ErrInvalidID with partitions, actual %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package delayqueue
+
+import "context"
+
+// SendFunc 保存一条消息
+type SendFunc func(ctx context.Context, msg *PendingMessage) error
+
+// SendInterceptor 发送消息的拦截器，可以在调用 next 之前修改消息的内容、header、投递时间等，
+// 或者不调用 next 直接返回 error 拒绝发送，error 会原样返回给发送方
+type SendInterceptor func(ctx context.Context, msg *PendingMessage, next SendFunc) error
+
+// UseSend 注册发送消息的拦截器，用于修改 header、限制消息大小、注入链路追踪信息、在冻结期间禁止发送等
+// 拦截器按注册顺序执行，SendScheduleMsg 等方法在最后一个拦截器调用 next 时保存消息；
+// SendSpread 和 Message.Chain 的消息按批在同一个事务中保存，所有消息通过拦截器后才会写入，
+// 拦截器拒绝 Chain 添加的后续消息时当前消息不会被确认
+func (q *DelayQueue) UseSend(interceptors ...SendInterceptor) *DelayQueue {
+	if q.frozen("UseSend") {
+		return q
+	}
+	q.sendInterceptors = append(q.sendInterceptors, interceptors...)
+	return q
+}
+
+// WithContext 设置发送消息时使用的 ctx，ctx 会传给拦截器，也用于访问 redis
+// example: queue.SendDelayMsg(payload, duration, delayqueue.WithContext(ctx))
+func WithContext(ctx context.Context) SendOption {
+	return func(c *sendConfig) {
+		c.ctx = ctx
+	}
+}
+
+// intercept 依次执行第 i 个及之后的拦截器，最后校验消息内容并调用 send
+func (q *DelayQueue) intercept(ctx context.Context, msg *PendingMessage, i int, send SendFunc) error {
+	if i >= len(q.sendInterceptors) {
+		if err := q.validate(msg); err != nil {
+			return err
+		}
+		return send(ctx, msg)
+	}
+	return q.sendInterceptors[i](ctx, msg, func(ctx context.Context, msg *PendingMessage) error {
+		return q.intercept(ctx, msg, i+1, send)
+	})
+}
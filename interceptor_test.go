@@ -0,0 +1,66 @@
+package delayqueue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type traceKey struct{}
+
+func TestDelayQueue_UseSend(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	errTooLarge := errors.New("payload too large")
+	var received []*Message
+	queue := NewDelayQueueWithHandler("test", redisCli, func(ctx context.Context, msg *Message) error {
+		received = append(received, msg)
+		if msg.Payload == "first" {
+			msg.Chain("this payload is too large", 0)
+		}
+		return nil
+	}).UseSend(func(ctx context.Context, msg *PendingMessage, next SendFunc) error {
+		if len(msg.Payload) > 10 {
+			return errTooLarge
+		}
+		return next(ctx, msg)
+	}, func(ctx context.Context, msg *PendingMessage, next SendFunc) error {
+		if traceID, ok := ctx.Value(traceKey{}).(string); ok {
+			if msg.Headers == nil {
+				msg.Headers = make(map[string]string)
+			}
+			msg.Headers["trace-id"] = traceID
+		}
+		return next(ctx, msg)
+	})
+	traceCtx := context.WithValue(ctx, traceKey{}, "trace-1")
+	if err := queue.SendDelayMsg("first", 0, WithContext(traceCtx)); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := queue.SendDelayMsg("this payload is too large", 0); err != errTooLarge {
+		t.Errorf("expected errTooLarge, got %v", err)
+	}
+	sent, err := queue.SendSpread(ctx, []string{"a", "this payload is too large"}, time.Now(), time.Second)
+	if err != errTooLarge || len(sent) != 0 {
+		t.Errorf("expected spread rejected, got %v, %v", sent, err)
+	}
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(received) == 0 || received[0].Headers["trace-id"] != "trace-1" {
+		t.Errorf("unexpected received: %+v", received)
+		return
+	}
+	// 后续消息被拒绝，当前消息不会被确认
+	stats, err := queue.Stats(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if stats.Pending+stats.Ready != 0 || stats.Unack+stats.Retry != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
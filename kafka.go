@@ -0,0 +1,87 @@
+package delayqueue
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// KafkaProducer 发送消息到 Kafka 的接口，由使用方基于 sarama、kafka-go 等客户端实现，本仓库不依赖具体的 Kafka 客户端
+type KafkaProducer interface {
+	Produce(ctx context.Context, topic string, key []byte, value []byte, headers map[string]string) error
+}
+
+// KafkaRecord 从 Kafka 消费的一条消息
+type KafkaRecord struct {
+	Key     []byte
+	Value   []byte
+	Headers map[string]string
+}
+
+// KafkaBridge 将延迟队列作为 Kafka 之前的延迟阶段：到期的消息被发送到 Kafka 的 topic，
+// 也可以通过 ScheduleKafkaRecord 将从 Kafka 消费的消息按 header 中指定的时间放入延迟队列
+//
+//	bridge := delayqueue.NewKafkaBridge(producer, "orders")
+//	queue := delayqueue.NewDelayQueueWithHandler("orders-delay", redisCli, bridge.Handle)
+type KafkaBridge struct {
+	producer KafkaProducer
+	topic    string
+}
+
+// Kafka 消息的 header
+const (
+	KafkaMessageIDHeader = "delayqueue-id"         // 转发时携带的消息ID，可用于下游去重
+	KafkaDeliverAtHeader = "delayqueue-deliver-at" // ScheduleKafkaRecord 使用的投递时间，unix 秒
+	KafkaDelayHeader     = "delayqueue-delay"      // ScheduleKafkaRecord 使用的延迟时间，格式与 time.ParseDuration 相同
+)
+
+// NewKafkaBridge 创建转发到 topic 的 KafkaBridge
+func NewKafkaBridge(producer KafkaProducer, topic string) *KafkaBridge {
+	if producer == nil {
+		panic("producer is required")
+	}
+	if topic == "" {
+		panic("topic is required")
+	}
+	return &KafkaBridge{producer: producer, topic: topic}
+}
+
+// Handle 将消息发送到 Kafka，发送失败时消息按重试策略重新投递，可以作为 Handler 使用
+// 重试可能导致重复发送，下游可以使用 delayqueue-id header 去重
+func (b *KafkaBridge) Handle(ctx context.Context, msg *Message) error {
+	headers := map[string]string{KafkaMessageIDHeader: msg.ID}
+	err := b.producer.Produce(ctx, b.topic, nil, []byte(msg.Payload), headers)
+	if err != nil {
+		return fmt.Errorf("produce to kafka failed: %v", err)
+	}
+	return nil
+}
+
+// ScheduleKafkaRecord 将从 Kafka 消费的消息放入 queue，投递时间取自 delayqueue-deliver-at 或 delayqueue-delay header，
+// 都未设置时立即投递，opts 与 SendScheduleMsg 相同。返回 nil 后再提交 Kafka 的 offset，避免消息丢失
+func ScheduleKafkaRecord(queue Queue, record *KafkaRecord, opts ...SendOption) (*MessageInfo, error) {
+	at, err := kafkaDeliverAt(record.Headers, clockOf(queue).Now())
+	if err != nil {
+		return nil, err
+	}
+	return queue.SendScheduleMsgV2(string(record.Value), at, opts...)
+}
+
+func kafkaDeliverAt(headers map[string]string, now time.Time) (time.Time, error) {
+	if v, ok := headers[KafkaDeliverAtHeader]; ok {
+		ts, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid %s header %q: %v", KafkaDeliverAtHeader, v, err)
+		}
+		return time.Unix(ts, 0), nil
+	}
+	if v, ok := headers[KafkaDelayHeader]; ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid %s header %q: %v", KafkaDelayHeader, v, err)
+		}
+		return now.Add(d), nil
+	}
+	return now, nil
+}
@@ -0,0 +1,84 @@
+package delayqueue
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type fakeProducer struct {
+	fail    bool
+	records []*KafkaRecord
+}
+
+func (p *fakeProducer) Produce(ctx context.Context, topic string, key []byte, value []byte, headers map[string]string) error {
+	if p.fail {
+		return errors.New("broker not available")
+	}
+	p.records = append(p.records, &KafkaRecord{Key: key, Value: value, Headers: headers})
+	return nil
+}
+
+func TestKafkaBridge(t *testing.T) {
+	producer := &fakeProducer{}
+	bridge := NewKafkaBridge(producer, "orders")
+	ctx := context.Background()
+	if err := bridge.Handle(ctx, &Message{ID: "1", Payload: "order 1"}); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(producer.records) != 1 || string(producer.records[0].Value) != "order 1" || producer.records[0].Headers[KafkaMessageIDHeader] != "1" {
+		t.Errorf("unexpected records: %+v", producer.records)
+	}
+	producer.fail = true
+	if err := bridge.Handle(ctx, &Message{ID: "2", Payload: "order 2"}); err == nil {
+		t.Error("expect error when produce failed")
+	}
+}
+
+func TestScheduleKafkaRecord(t *testing.T) {
+	queue := NewMemoryQueue("test", func(string) bool { return true })
+	deliverAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	cases := []struct {
+		headers map[string]string
+		at      time.Time
+		err     bool
+	}{
+		{headers: map[string]string{KafkaDeliverAtHeader: strconv.FormatInt(deliverAt.Add(time.Hour).Unix(), 10)}, at: deliverAt.Add(time.Hour)},
+		{headers: map[string]string{KafkaDelayHeader: "1h"}, at: deliverAt},
+		{headers: map[string]string{KafkaDelayHeader: "soon"}, err: true},
+	}
+	for _, c := range cases {
+		msg, err := ScheduleKafkaRecord(queue, &KafkaRecord{Value: []byte("payload"), Headers: c.headers})
+		if c.err {
+			if err == nil {
+				t.Errorf("expect error for headers %v", c.headers)
+			}
+			continue
+		}
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if diff := msg.Time.Sub(c.at); diff < 0 || diff > time.Second {
+			t.Errorf("headers %v: expect deliver at %s, actual %s", c.headers, c.at, msg.Time)
+		}
+	}
+}
+
+func TestScheduleKafkaRecord_Clock(t *testing.T) {
+	clock := &driftingClock{}
+	clock.skew.Store(int64(-24 * time.Hour))
+	queue := NewMemoryQueue("test", func(string) bool { return true }).WithClock(clock)
+	msg, err := ScheduleKafkaRecord(queue, &KafkaRecord{Value: []byte("payload"), Headers: map[string]string{KafkaDelayHeader: "1h"}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// 延迟时间以队列的时钟为起点
+	if diff := msg.Time.Sub(clock.Now().Add(time.Hour)); diff < -time.Second || diff > time.Second {
+		t.Errorf("expect deliver at %s, actual %s", clock.Now().Add(time.Hour), msg.Time)
+	}
+}
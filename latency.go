@@ -0,0 +1,218 @@
+package delayqueue
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// HeaderScheduledAt 启用 WithLatencyTracking 时记录投递时间的 header，值为 unix 秒
+const HeaderScheduledAt = "delayqueue-scheduled-at"
+
+// DefaultLatencyBuckets WithLatencyTracking 默认使用的延迟分桶
+var DefaultLatencyBuckets = []time.Duration{
+	time.Second, 5 * time.Second, 15 * time.Second, 30 * time.Second,
+	time.Minute, 5 * time.Minute, 15 * time.Minute, time.Hour,
+}
+
+// LatencyBucket 延迟直方图的一个分桶
+type LatencyBucket struct {
+	UpperBound time.Duration
+	Count      int64 // 延迟不超过 UpperBound 的投递次数，与 Prometheus 相同为累计值
+}
+
+// LatencyStats 消息首次投递时间与投递时间之间的延迟
+type LatencyStats struct {
+	Count   int64 // 统计的投递次数
+	Sum     time.Duration
+	Max     time.Duration
+	Buckets []LatencyBucket
+}
+
+// QueueLag 队列中最早的消息已经延迟的时间，用于在消息积压时报警
+type QueueLag struct {
+	// OldestPending pending 中已到投递时间但尚未移入 ready 的最早消息的延迟，没有时为 0
+	OldestPending time.Duration
+	// OldestReady ready 中即将被取出的消息距离投递时间的延迟，没有时为 0，需要生产者启用 WithLatencyTracking
+	OldestReady time.Duration
+}
+
+// latencyHistogram 记录投递延迟的直方图
+type latencyHistogram struct {
+	mu     sync.Mutex
+	bounds []time.Duration
+	counts []int64 // 第 i 个元素为延迟不超过 bounds[i] 且超过 bounds[i-1] 的次数
+	count  int64
+	sum    time.Duration
+	max    time.Duration
+}
+
+func newLatencyHistogram(bounds []time.Duration) *latencyHistogram {
+	bounds = append([]time.Duration(nil), bounds...)
+	sort.Slice(bounds, func(i, j int) bool {
+		return bounds[i] < bounds[j]
+	})
+	return &latencyHistogram{bounds: bounds, counts: make([]int64, len(bounds))}
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.count++
+	h.sum += d
+	if d > h.max {
+		h.max = d
+	}
+	i := sort.Search(len(h.bounds), func(i int) bool {
+		return h.bounds[i] >= d
+	})
+	if i < len(h.bounds) {
+		h.counts[i]++
+	}
+}
+
+func (h *latencyHistogram) snapshot() *LatencyStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	stats := &LatencyStats{Count: h.count, Sum: h.sum, Max: h.max, Buckets: make([]LatencyBucket, len(h.bounds))}
+	var cumulative int64
+	for i, bound := range h.bounds {
+		cumulative += h.counts[i]
+		stats.Buckets[i] = LatencyBucket{UpperBound: bound, Count: cumulative}
+	}
+	return stats
+}
+
+// WithLatencyTracking 记录消息首次投递时距离投递时间的延迟，buckets 为直方图的分桶，为空时使用 DefaultLatencyBuckets
+// 投递时间保存在 HeaderScheduledAt 中，生产者和消费者需要同时启用，可以通过 LatencyStats 和 Lag 查询
+func (q *DelayQueue) WithLatencyTracking(buckets ...time.Duration) *DelayQueue {
+	if q.frozen("WithLatencyTracking") {
+		return q
+	}
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	q.latency = newLatencyHistogram(buckets)
+	return q
+}
+
+// LatencyStats 返回当前实例投递消息的延迟统计，未启用 WithLatencyTracking 时返回 nil
+func (q *DelayQueue) LatencyStats() *LatencyStats {
+	if q.latency == nil {
+		return nil
+	}
+	return q.latency.snapshot()
+}
+
+// scheduledAt 返回消息的投递时间，生产者未启用 WithLatencyTracking 时返回 false
+func (m *Message) scheduledAt() (time.Time, bool) {
+	v, ok := m.Headers[HeaderScheduledAt]
+	if !ok {
+		return time.Time{}, false
+	}
+	sec, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(sec, 0), true
+}
+
+// observeLatency 记录消息首次投递的延迟，重试的消息不计入
+func (q *DelayQueue) observeLatency(msg *Message) {
+	if msg.Attempt > 1 {
+		return
+	}
+	at, ok := msg.scheduledAt()
+	if !ok {
+		return
+	}
+	d := q.clock.Now().Sub(at)
+	if q.latency != nil {
+		q.latency.observe(d)
+	}
+	q.observeDuration(MetricDeliveryLatency, d)
+}
+
+// Lag 查询队列中最早的消息已经延迟的时间
+func (q *DelayQueue) Lag(ctx context.Context) (*QueueLag, error) {
+	now := q.clock.Now()
+	oldestPending, readyIDs, err := q.broker.Oldest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lag := &QueueLag{}
+	if !oldestPending.IsZero() && now.After(oldestPending) {
+		lag.OldestPending = now.Sub(oldestPending)
+	}
+	for _, idStr := range readyIDs {
+		msg, err := q.broker.Message(ctx, idStr)
+		if err == ErrMessageNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if at, ok := msg.scheduledAt(); ok && now.Sub(at) > lag.OldestReady {
+			lag.OldestReady = now.Sub(at)
+		}
+	}
+	return lag, nil
+}
+
+func (b *redisBroker) Oldest(ctx context.Context) (time.Time, []string, error) {
+	q := b.q
+	pipe := q.redisCli.Pipeline()
+	var pendings []*redis.ZSliceCmd
+	var readys []*redis.StringCmd
+	for _, key := range q.shardKeys(q.pendingKey) {
+		pendings = append(pendings, pipe.ZRangeWithScores(ctx, key, 0, 0))
+	}
+	for _, key := range q.shardKeys(q.readyKey) {
+		// ready 从右侧取出
+		readys = append(readys, pipe.LIndex(ctx, key, -1))
+	}
+	_, err := pipe.Exec(ctx)
+	if err != nil && err != redis.Nil {
+		return time.Time{}, nil, fmt.Errorf("get oldest msgs failed: %v", err)
+	}
+	var oldest time.Time
+	for _, cmd := range pendings {
+		for _, z := range cmd.Val() {
+			at := time.Unix(int64(z.Score), 0)
+			if oldest.IsZero() || at.Before(oldest) {
+				oldest = at
+			}
+		}
+	}
+	var ids []string
+	for _, cmd := range readys {
+		if cmd.Err() == nil {
+			ids = append(ids, cmd.Val())
+		}
+	}
+	return oldest, ids, nil
+}
+
+func (b *memoryBroker) Oldest(ctx context.Context) (time.Time, []string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var oldest time.Time
+	for _, at := range b.pending {
+		if oldest.IsZero() || at.Before(oldest) {
+			oldest = at
+		}
+	}
+	var ids []string
+	if len(b.ready) > 0 {
+		ids = append(ids, b.ready[0])
+	}
+	return oldest, ids, nil
+}
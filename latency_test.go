@@ -0,0 +1,61 @@
+package delayqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_Latency(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	}).WithLatencyTracking()
+	// 早于当前时间的投递时间会被修改为当前时间，因此发送后将时钟拨快，模拟消息晚了 10 秒
+	clock := &driftingClock{}
+	queue.WithClock(clock)
+	if err := queue.SendDelayMsg("late", 0); err != nil {
+		t.Error(err)
+		return
+	}
+	clock.skew.Store(int64(-10 * time.Second))
+	lag, err := queue.Lag(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if lag.OldestPending < 9*time.Second || lag.OldestReady != 0 {
+		t.Errorf("unexpected lag: %+v", lag)
+	}
+	if _, err := queue.broker.Pending2Ready(ctx, clock.Now()); err != nil {
+		t.Error(err)
+		return
+	}
+	lag, err = queue.Lag(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if lag.OldestPending != 0 || lag.OldestReady < 9*time.Second {
+		t.Errorf("unexpected lag: %+v", lag)
+	}
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	stats := queue.LatencyStats()
+	if stats.Count != 1 || stats.Max < 9*time.Second || stats.Max > 15*time.Second {
+		t.Errorf("unexpected latency stats: %+v", stats)
+		return
+	}
+	for _, bucket := range stats.Buckets {
+		expect := int64(0)
+		if bucket.UpperBound >= 15*time.Second {
+			expect = 1
+		}
+		if bucket.Count != expect {
+			t.Errorf("unexpected bucket: %+v", bucket)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package delayqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor List 的游标不合法
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ErrUnknownState List 的 state 不合法
+var ErrUnknownState = errors.New("unknown state")
+
+// List 分页遍历处于 state 阶段的消息，state 可以是 StagePending、StageReady、StageUnack、StageRetry、StageGarbage 或 StageDead
+// cursor 首次调用时传入空字符串，之后传入上一次返回的 next，next 为空字符串时表示遍历结束
+// sortedset、set 和 stream（WithStreams）基于 ZSCAN/SSCAN/HSCAN 遍历，count 仅作为参考，单页返回的数量可能多于或少于 count，
+// 遍历期间发生变化的消息可能被重复返回或遗漏；list 基于 LRANGE 按位置遍历
+// 返回的消息内容超过 256 字节时会被截断，完整内容可以通过 GetMessage 查询
+func (q *DelayQueue) List(ctx context.Context, state string, cursor string, count int64) (msgs []*MessageInfo, next string, err error) {
+	if err := q.requireRedis("List"); err != nil {
+		return nil, "", err
+	}
+	if count <= 0 {
+		count = 10
+	}
+	var keys []string
+	switch state {
+	case StagePending:
+		keys = q.shardKeys(q.pendingKey)
+	case StageReady:
+		keys = q.readyKeys()
+	case StageUnack:
+		keys = []string{q.unAckKey}
+	case StageRetry:
+		keys = []string{q.retryKey}
+	case StageGarbage:
+		keys = []string{q.garbageKey}
+	case StageDead:
+		keys = []string{q.deadKey}
+	default:
+		return nil, "", fmt.Errorf("%w: %s", ErrUnknownState, state)
+	}
+	shard, pos, err := parseListCursor(cursor)
+	if err != nil || shard >= len(keys) {
+		return nil, "", ErrInvalidCursor
+	}
+	key := keys[shard]
+	var nextPos uint64
+	switch {
+	case q.streams && key == q.streamIndexKey():
+		var fields []string
+		fields, nextPos, err = q.redisCli.HScan(ctx, key, pos, "", count).Result()
+		if err != nil {
+			return nil, "", fmt.Errorf("hscan failed: %v", err)
+		}
+		for i := 0; i+1 < len(fields); i += 2 {
+			msgs = append(msgs, &MessageInfo{ID: fields[i], State: state})
+		}
+	case state == StagePending, state == StageUnack, state == StageDead:
+		var members []string
+		members, nextPos, err = q.redisCli.ZScan(ctx, key, pos, "", count).Result()
+		if err != nil {
+			return nil, "", fmt.Errorf("zscan failed: %v", err)
+		}
+		for i := 0; i+1 < len(members); i += 2 {
+			score, _ := strconv.ParseFloat(members[i+1], 64)
+			msgs = append(msgs, &MessageInfo{
+				ID:    members[i],
+				State: state,
+				Time:  time.Unix(int64(score), 0),
+			})
+		}
+	case state == StageGarbage:
+		var members []string
+		members, nextPos, err = q.redisCli.SScan(ctx, key, pos, "", count).Result()
+		if err != nil {
+			return nil, "", fmt.Errorf("sscan failed: %v", err)
+		}
+		for _, idStr := range members {
+			msgs = append(msgs, &MessageInfo{ID: idStr, State: state})
+		}
+	default:
+		ids, err := q.redisCli.LRange(ctx, key, int64(pos), int64(pos)+count-1).Result()
+		if err != nil {
+			return nil, "", fmt.Errorf("lrange failed: %v", err)
+		}
+		for _, idStr := range ids {
+			msgs = append(msgs, &MessageInfo{ID: idStr, State: state})
+		}
+		if int64(len(ids)) == count {
+			nextPos = pos + uint64(count)
+		}
+	}
+	// 当前分片遍历结束后继续遍历下一个分片
+	switch {
+	case nextPos != 0:
+		next = formatListCursor(shard, nextPos)
+	case shard+1 < len(keys):
+		next = formatListCursor(shard+1, 0)
+	}
+	if err := q.fillPreview(ctx, msgs); err != nil {
+		return msgs, next, err
+	}
+	return msgs, next, q.fillOwners(ctx, msgs)
+}
+
+// 游标格式为 {分片}:{位置}
+func formatListCursor(shard int, pos uint64) string {
+	return strconv.Itoa(shard) + ":" + strconv.FormatUint(pos, 10)
+}
+
+func parseListCursor(cursor string) (shard int, pos uint64, err error) {
+	if cursor == "" {
+		return 0, 0, nil
+	}
+	i := strings.IndexByte(cursor, ':')
+	if i < 0 {
+		return 0, 0, ErrInvalidCursor
+	}
+	shard, err = strconv.Atoi(cursor[:i])
+	if err != nil || shard < 0 {
+		return 0, 0, ErrInvalidCursor
+	}
+	pos, err = strconv.ParseUint(cursor[i+1:], 10, 64)
+	if err != nil {
+		return 0, 0, ErrInvalidCursor
+	}
+	return shard, pos, nil
+}
@@ -0,0 +1,60 @@
+package delayqueue
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestDelayQueue_List(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	}).WithShards(2)
+	size := 25
+	for i := 0; i < size; i++ {
+		err := queue.SendDelayMsg(strconv.Itoa(i), time.Hour)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	for _, state := range []string{StagePending, StageReady} {
+		seen := make(map[string]bool)
+		cursor := ""
+		for {
+			msgs, next, err := queue.List(ctx, state, cursor, 4)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			for _, msg := range msgs {
+				seen[msg.Payload] = true
+			}
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+		if len(seen) != size {
+			t.Errorf("expect %d messages, actual %d", size, len(seen))
+		}
+		// 将所有消息移入 ready 后再遍历一次
+		for _, key := range queue.shardKeys(queue.pendingKey) {
+			ids, _ := redisCli.ZRange(ctx, key, 0, -1).Result()
+			for _, idStr := range ids {
+				redisCli.ZAdd(ctx, key, &redis.Z{Score: 0, Member: idStr})
+			}
+		}
+		if _, err := queue.pending2Ready(); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if _, _, err := queue.List(ctx, StageReady, "bad", 10); err != ErrInvalidCursor {
+		t.Errorf("expect ErrInvalidCursor, actual %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package delayqueue
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Logger 结构化日志接口，args 为交替出现的字段名和字段值，如 "queue", name, "id", id
+// Go 1.21 及以上版本的 *slog.Logger 满足该接口，可以直接传入 WithStructuredLogger
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// stdLogger 将结构化日志以 key=value 的形式输出到 *log.Logger
+type stdLogger struct {
+	l *log.Logger
+}
+
+// NewStdLogger 将 *log.Logger 包装为 Logger
+func NewStdLogger(l *log.Logger) Logger {
+	return &stdLogger{l: l}
+}
+
+func (s *stdLogger) Debug(msg string, args ...interface{}) {
+	s.output("DEBUG", msg, args)
+}
+
+func (s *stdLogger) Info(msg string, args ...interface{}) {
+	s.output("INFO", msg, args)
+}
+
+func (s *stdLogger) Warn(msg string, args ...interface{}) {
+	s.output("WARN", msg, args)
+}
+
+func (s *stdLogger) Error(msg string, args ...interface{}) {
+	s.output("ERROR", msg, args)
+}
+
+func (s *stdLogger) output(level, msg string, args []interface{}) {
+	b := strings.Builder{}
+	b.WriteString(level)
+	b.WriteString(" ")
+	b.WriteString(msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 < len(args) {
+			fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+		} else {
+			fmt.Fprintf(&b, " !BADKEY=%v", args[i])
+		}
+	}
+	s.l.Print(b.String())
+}
+
+// SetDebug 开启或关闭消息流转的调试日志，可以在运行时调用
+// 开启后以 Debug 级别记录每条消息的发送、投递、确认和重试，以及各消费周期中批量流转的消息数量，
+// 用于排查消息的去向，消息数量较多时会产生大量日志
+func (q *DelayQueue) SetDebug(enabled bool) {
+	q.debug.Store(enabled)
+}
+
+// debugLog 在开启调试日志时输出 Debug 级别的日志，自动携带队列名称
+func (q *DelayQueue) debugLog(msg string, args ...interface{}) {
+	if !q.debug.Load() {
+		return
+	}
+	fields := append([]interface{}{"queue", q.name}, args...)
+	q.logger.Debug(msg, fields...)
+}
+
+// debugTransition 记录一条消息在阶段之间的流转
+func (q *DelayQueue) debugTransition(idStr, from, to string, args ...interface{}) {
+	if !q.debug.Load() {
+		return
+	}
+	fields := append([]interface{}{"id", idStr, "from", from, "to", to, "time", q.clock.Now().Format(time.RFC3339)}, args...)
+	q.debugLog("message transition", fields...)
+}
+
+// debugFlow 记录消费周期中由脚本批量完成的流转，只包含消息数量，单条消息的去向可以通过投递历史查询
+func (q *DelayQueue) debugFlow(from, to string, n int64) {
+	if n == 0 {
+		return
+	}
+	q.debugLog("batch transition", "from", from, "to", to, "count", n)
+}
@@ -0,0 +1,45 @@
+package delayqueue
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestStdLogger(t *testing.T) {
+	buf := bytes.Buffer{}
+	logger := NewStdLogger(log.New(&buf, "", 0))
+	logger.Error("consume failed", "queue", "test", "error", errors.New("timeout"))
+	if buf.String() != "ERROR consume failed queue=test error=timeout\n" {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+	buf.Reset()
+	logger.Info("queue purged", "messages")
+	if buf.String() != "INFO queue purged !BADKEY=messages\n" {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+}
+
+func TestDelayQueue_SetDebug(t *testing.T) {
+	buf := bytes.Buffer{}
+	queue := NewMemoryQueue("test", func(s string) bool {
+		return true
+	}).WithLogger(log.New(&buf, "", 0))
+	err := queue.SendDelayMsg("hello", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if buf.Len() > 0 {
+		t.Errorf("unexpected output before debug enabled: %q", buf.String())
+	}
+	queue.SetDebug(true)
+	queue.q.consume()
+	for _, expect := range []string{"from=pending to=ready count=1", "from=ready to=unack", "from=unack to=acked"} {
+		if !strings.Contains(buf.String(), expect) {
+			t.Errorf("expect %q in output: %q", expect, buf.String())
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package delayqueue
+
+import "time"
+
+// MaintenanceWindow 每天的维护时间段，维护期间暂停投递消息
+// Start 和 End 为距离当天零点的时长，End 小于 Start 时表示跨越零点，如 23:00 到次日 01:00
+type MaintenanceWindow struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// contains 返回 t 是否在维护时间段内，包含 Start 不包含 End
+func (w MaintenanceWindow) contains(t time.Time) bool {
+	y, m, d := t.Date()
+	offset := t.Sub(time.Date(y, m, d, 0, 0, 0, 0, t.Location()))
+	if w.Start <= w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// WithMaintenanceWindows 配置每天的维护时间段，loc 为时间段所在的时区，为 nil 时使用本地时区
+// 维护期间不投递消息，消息留在 pending、ready 或 retry 中，维护结束后自动恢复投递
+func (q *DelayQueue) WithMaintenanceWindows(loc *time.Location, windows ...MaintenanceWindow) *DelayQueue {
+	if q.frozen("WithMaintenanceWindows") {
+		return q
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+	q.maintenanceLoc = loc
+	q.maintenanceWindows = windows
+	return q
+}
+
+// inMaintenance 返回 now 是否在维护时间段内，进入或离开维护时间段时记录日志
+func (q *DelayQueue) inMaintenance(now time.Time) bool {
+	in := false
+	for _, w := range q.maintenanceWindows {
+		if w.contains(now.In(q.maintenanceLoc)) {
+			in = true
+			break
+		}
+	}
+	if in != q.maintaining {
+		q.maintaining = in
+		if in {
+			q.logger.Info("enter maintenance window", "queue", q.name)
+		} else {
+			q.logger.Info("leave maintenance window", "queue", q.name)
+		}
+	}
+	return in
+}
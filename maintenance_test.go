@@ -0,0 +1,52 @@
+package delayqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceWindow(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	window := MaintenanceWindow{Start: 23 * time.Hour, End: time.Hour}
+	for offset, expect := range map[time.Duration]bool{
+		22 * time.Hour:                false,
+		23 * time.Hour:                true,
+		30 * time.Minute:              true,
+		time.Hour:                     false,
+		12 * time.Hour:                false,
+		23*time.Hour + 59*time.Minute: true,
+	} {
+		if actual := window.contains(day.Add(offset)); actual != expect {
+			t.Errorf("expect contains(%s) = %v, actual %v", offset, expect, actual)
+		}
+	}
+}
+
+func TestDelayQueue_MaintenanceWindows(t *testing.T) {
+	delivered := 0
+	queue := NewMemoryQueue("test", func(s string) bool {
+		delivered++
+		return true
+	}).WithMaintenanceWindows(time.UTC, MaintenanceWindow{Start: 0, End: 24 * time.Hour})
+	if err := queue.SendDelayMsg("hello", 0); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	stats, _ := queue.Stats(context.Background())
+	if delivered != 0 || stats.Ready != 1 {
+		t.Errorf("expect message kept in ready during maintenance, delivered: %d, stats: %+v", delivered, stats)
+	}
+	queue.WithMaintenanceWindows(time.UTC)
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	if delivered != 1 {
+		t.Errorf("expect message delivered after maintenance, delivered: %d", delivered)
+	}
+}
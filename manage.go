@@ -0,0 +1,230 @@
+package delayqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrQueueNotEmpty 队列中仍有消息
+	ErrQueueNotEmpty = errors.New("queue is not empty")
+	// ErrQueueDeleted 队列已被删除
+	ErrQueueDeleted = errors.New("queue has been deleted")
+)
+
+// consumers 记录当前进程中正在消费的队列，删除队列时通知它们停止消费
+var consumers = struct {
+	sync.Mutex
+	m map[string]map[*DelayQueue]struct{}
+}{m: make(map[string]map[*DelayQueue]struct{})}
+
+// consumerKey 唯一标识一个 redis 实例上的队列
+func (q *DelayQueue) consumerKey() string {
+	if q.redisCli == nil {
+		return fmt.Sprintf("%p/%s", q.broker, q.name)
+	}
+	opt := q.redisCli.Options()
+	return opt.Addr + "/" + strconv.Itoa(opt.DB) + "/" + q.name
+}
+
+func (q *DelayQueue) registerConsumer() {
+	consumers.Lock()
+	defer consumers.Unlock()
+	key := q.consumerKey()
+	if consumers.m[key] == nil {
+		consumers.m[key] = make(map[*DelayQueue]struct{})
+	}
+	consumers.m[key][q] = struct{}{}
+}
+
+func (q *DelayQueue) unregisterConsumer() {
+	consumers.Lock()
+	defer consumers.Unlock()
+	key := q.consumerKey()
+	delete(consumers.m[key], q)
+	if len(consumers.m[key]) == 0 {
+		delete(consumers.m, key)
+	}
+}
+
+// invalidateConsumers 将当前进程中同一队列的所有实例标记为已删除，并停止它们的消费协程
+func (q *DelayQueue) invalidateConsumers() {
+	consumers.Lock()
+	instances := make([]*DelayQueue, 0, len(consumers.m[q.consumerKey()])+1)
+	for instance := range consumers.m[q.consumerKey()] {
+		instances = append(instances, instance)
+	}
+	consumers.Unlock()
+	instances = append(instances, q)
+	for _, instance := range instances {
+		instance.deleted.Store(true)
+		instance.StopConsume()
+	}
+}
+
+// DeleteQueue 删除队列在 redis 中的所有 key
+// 队列中仍有消息时返回 ErrQueueNotEmpty，force 为 true 时强制删除
+// 删除后当前进程中该队列的所有实例都会停止消费，且无法再发送消息
+// 其它进程中的消费者不受影响，应在删除前停止
+func (q *DelayQueue) DeleteQueue(ctx context.Context, force bool) error {
+	return q.deleteQueue(ctx, force, false)
+}
+
+// Destroy 强制删除队列，除 DeleteQueue 删除的 key 外，还会按前缀扫描并删除所有残留的消息 key 和分片 key
+// 适用于按租户或按测试创建的临时队列，避免 key 泄漏
+func (q *DelayQueue) Destroy(ctx context.Context) error {
+	return q.deleteQueue(ctx, true, true)
+}
+
+func (q *DelayQueue) deleteQueue(ctx context.Context, force bool, scan bool) error {
+	if err := q.requireRedis("DeleteQueue"); err != nil {
+		return err
+	}
+	stats, err := q.Stats(ctx)
+	if err != nil {
+		return err
+	}
+	total := stats.Pending + stats.Ready + stats.Unack + stats.Retry + stats.Garbage + stats.Dead
+	if total > 0 && !force {
+		return ErrQueueNotEmpty
+	}
+	n, err := q.purge(ctx)
+	if err != nil {
+		return err
+	}
+	keys := []string{q.pausedKey}
+	if q.group == "" {
+		keys = append(keys, q.groupsKey)
+	}
+	err = q.redisCli.Del(ctx, keys...).Err()
+	if err != nil {
+		return fmt.Errorf("delete queue keys failed: %v", err)
+	}
+	if scan {
+		patterns := []string{
+			escapePattern(q.genMsgKey("")) + "*",
+			escapePattern(q.genReplyKey("")) + "*",
+			escapePattern(q.genResultKey("")) + "*",
+			escapePattern(q.genStatusKey("")) + "*",
+			escapePattern(q.genProgressKey("")) + "*",
+			escapePattern(q.genTagKey("")) + "*",
+			escapePattern(q.genDedupKey("")) + "*",
+			escapePattern(q.pendingKey) + ":*",
+			escapePattern(q.readyKey) + ":*",
+		}
+		for _, pattern := range patterns {
+			deleted, err := q.deleteByPattern(ctx, pattern)
+			if err != nil {
+				return err
+			}
+			n += deleted
+		}
+	}
+	q.invalidateConsumers()
+	q.logger.Info("queue deleted", "queue", q.name, "force", force, "messages", n)
+	q.emit(QueueDeletedEvent, n)
+	return nil
+}
+
+// deleteByPattern 使用 SCAN 查找并删除匹配 pattern 的 key，返回删除的数量
+func (q *DelayQueue) deleteByPattern(ctx context.Context, pattern string) (int, error) {
+	var cursor uint64
+	var deleted int
+	for {
+		keys, next, err := q.redisCli.Scan(ctx, cursor, pattern, 1000).Result()
+		if err != nil {
+			return deleted, fmt.Errorf("scan %s failed: %v", pattern, err)
+		}
+		if len(keys) > 0 {
+			n, err := q.redisCli.Del(ctx, keys...).Result()
+			if err != nil {
+				return deleted, fmt.Errorf("delete keys failed: %v", err)
+			}
+			deleted += int(n)
+		}
+		cursor = next
+		if cursor == 0 {
+			return deleted, nil
+		}
+	}
+}
+
+// escapePattern 转义 redis glob 模式中的特殊字符
+func escapePattern(s string) string {
+	var sb strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			sb.WriteRune('\\')
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
+
+// purgeScript 删除队列中的所有消息
+// KEYS: 存储消息ID的 sortedset/list/set/hash
+// ARGV: 消息 key 的前缀，同时删除消息内容及投递历史
+// 返回删除的消息数量
+const purgeScript = `
+local ids = {}
+local count = 0
+local function collect(members)
+	for _, id in ipairs(members) do
+		if not ids[id] then
+			ids[id] = true
+			count = count + 1
+		end
+	end
+end
+for _, key in ipairs(KEYS) do
+	local t = redis.call('Type', key)['ok']
+	if t == 'zset' then
+		collect(redis.call('ZRange', key, 0, -1))
+	elseif t == 'list' then
+		collect(redis.call('LRange', key, 0, -1))
+	elseif t == 'set' then
+		collect(redis.call('SMembers', key))
+	elseif t == 'hash' then
+		collect(redis.call('HKeys', key))
+	end
+end
+for id in pairs(ids) do
+	redis.call('Del', ARGV[1] .. id, ARGV[1] .. id .. ':history', ARGV[1] .. id .. ':headers', ARGV[1] .. id .. ':owner')
+end
+redis.call('Del', unpack(KEYS))
+return count
+`
+
+// purge 原子地删除队列中的所有消息及其 payload
+func (q *DelayQueue) purge(ctx context.Context) (int, error) {
+	if err := q.requireRedis("Purge"); err != nil {
+		return 0, err
+	}
+	keys := make([]string, 0, 2*int(q.shards)+8)
+	keys = append(keys, q.shardKeys(q.pendingKey)...)
+	keys = append(keys, q.shardKeys(q.readyKey)...)
+	keys = append(keys, q.unAckKey, q.retryKey, q.retryCountKey, q.attemptKey, q.garbageKey, q.deadKey)
+	keys = append(keys, q.streamIndexKey(), q.streamKey())
+	n, err := q.eval(ctx, purgeScript, keys, q.genMsgKey("")).Int()
+	if err != nil {
+		return 0, fmt.Errorf("purgeScript failed: %v", err)
+	}
+	return n, nil
+}
+
+// Purge 原子地清空队列中所有状态的消息，包括 pending、ready、unack、retry、garbage、死信、重试次数及消息内容
+// 与 DeleteQueue 不同，Purge 后队列仍可正常使用，暂停标记等配置也会保留
+func (q *DelayQueue) Purge(ctx context.Context) error {
+	n, err := q.purge(ctx)
+	if err != nil {
+		return err
+	}
+	q.logger.Info("queue purged", "queue", q.name, "messages", n)
+	q.emit(QueuePurgedEvent, n)
+	return nil
+}
@@ -0,0 +1,110 @@
+package delayqueue
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type eventRecorder struct {
+	events []*Event
+}
+
+func (r *eventRecorder) OnEvent(e *Event) {
+	r.events = append(r.events, e)
+}
+
+func TestDelayQueue_DeleteQueue(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	recorder := &eventRecorder{}
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	}).WithShards(2).WithEventListener(recorder)
+	for i := 0; i < 5; i++ {
+		err := queue.SendDelayMsg(strconv.Itoa(i), 0)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if err := queue.DeleteQueue(ctx, false); err != ErrQueueNotEmpty {
+		t.Errorf("expect ErrQueueNotEmpty, actual %v", err)
+	}
+	done := queue.StartConsume()
+	if err := queue.DeleteQueue(ctx, true); err != nil {
+		t.Error(err)
+		return
+	}
+	<-done
+	if n := redisCli.DBSize(ctx).Val(); n != 0 {
+		t.Errorf("expect no keys left, actual %d", n)
+	}
+	if err := queue.SendDelayMsg("0", 0); err != ErrQueueDeleted {
+		t.Errorf("expect ErrQueueDeleted, actual %v", err)
+	}
+	if len(recorder.events) != 1 || recorder.events[0].Code != QueueDeletedEvent || recorder.events[0].MsgCount != 5 {
+		t.Errorf("unexpected events: %+v", recorder.events)
+	}
+}
+
+func TestDelayQueue_Purge(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return false
+	}).WithFetchLimit(2)
+	for i := 0; i < 6; i++ {
+		err := queue.SendDelayMsg(strconv.Itoa(i), 0)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	// 让消息分布在不同的状态中
+	if err := queue.consume(); err != nil {
+		t.Errorf("consume error: %v", err)
+		return
+	}
+	if err := queue.PauseAll(ctx); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := queue.Purge(ctx); err != nil {
+		t.Error(err)
+		return
+	}
+	keys, err := redisCli.Keys(ctx, "*").Result()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(keys) != 1 || keys[0] != queue.pausedKey {
+		t.Errorf("expect only paused flag left, actual %v", keys)
+	}
+}
+
+func TestDelayQueue_Destroy(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	}).WithShards(2)
+	for i := 0; i < 5; i++ {
+		err := queue.SendDelayMsg(strconv.Itoa(i), time.Hour)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	// 没有被任何状态引用的消息 key 和多余的分片
+	redisCli.Set(ctx, queue.genMsgKey("orphan"), "orphan", time.Hour)
+	redisCli.ZAdd(ctx, queue.shardKey(queue.pendingKey, 5), &redis.Z{Score: 0, Member: "orphan"})
+	if err := queue.Destroy(ctx); err != nil {
+		t.Error(err)
+		return
+	}
+	if n := redisCli.DBSize(ctx).Val(); n != 0 {
+		t.Errorf("expect no keys left, actual %d", n)
+	}
+}
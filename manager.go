@@ -0,0 +1,194 @@
+package delayqueue
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// QueueManager 在同一个定时器和协程池上运行多个队列
+// 服务中存在大量队列时，无需为每个队列单独创建定时器和消费协程
+// 每个队列使用各自的回调函数、拉取数量和并发数等配置，fetchInterval 以 QueueManager 的配置为准
+type QueueManager struct {
+	mu        sync.Mutex
+	queues    []*DelayQueue
+	interval  time.Duration
+	workers   uint
+	slots     chan struct{} // 所有队列共享的处理并发数，为 nil 时使用各队列自身的并发数
+	logger    Logger
+	ticker    *time.Ticker
+	close     chan struct{}
+	closeOnce sync.Once
+}
+
+// NewQueueManager 创建新的 QueueManager
+func NewQueueManager() *QueueManager {
+	return &QueueManager{
+		interval: time.Second,
+		workers:  1,
+		logger:   NewStdLogger(log.Default()),
+		close:    make(chan struct{}),
+	}
+}
+
+// WithFetchInterval 配置从 redis 中拉取消息的时间间隔
+func (m *QueueManager) WithFetchInterval(d time.Duration) *QueueManager {
+	m.interval = d
+	return m
+}
+
+// WithWorkers 配置同时消费的队列数量
+func (m *QueueManager) WithWorkers(n uint) *QueueManager {
+	if n > 0 {
+		m.workers = n
+	}
+	return m
+}
+
+// WithConcurrent 配置所有队列共享的并发数，即同一时间最多 n 条消息（不论属于哪个队列）在处理中
+// 设置后每个消费周期同时拉取所有队列，各队列自身的 WithConcurrent 和 QueueManager 的 WithWorkers 不再生效，
+// 消息较多的队列可以使用空闲的并发，不会因为其它队列处理缓慢而等待
+// 应在 StartConsume 之前调用
+func (m *QueueManager) WithConcurrent(n uint) *QueueManager {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.slots = nil
+	if n > 0 {
+		m.slots = make(chan struct{}, n)
+	}
+	for _, q := range m.queues {
+		q.slots = m.slots
+	}
+	return m
+}
+
+// WithLogger 自定义日志
+func (m *QueueManager) WithLogger(logger *log.Logger) *QueueManager {
+	m.logger = NewStdLogger(logger)
+	return m
+}
+
+// WithStructuredLogger 自定义结构化日志
+func (m *QueueManager) WithStructuredLogger(logger Logger) *QueueManager {
+	m.logger = logger
+	return m
+}
+
+// Add 添加需要消费的队列，可以在 StartConsume 之后调用
+// 添加到 QueueManager 的队列不应再调用自身的 StartConsume
+func (m *QueueManager) Add(queues ...*DelayQueue) *QueueManager {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, q := range queues {
+		q.slots = m.slots
+	}
+	m.queues = append(m.queues, queues...)
+	return m
+}
+
+// Subscribe 创建名为 name、使用 handler 处理消息的队列并添加到 QueueManager，
+// 返回的队列可以继续配置重试次数等选项，不应再调用自身的 StartConsume
+func (m *QueueManager) Subscribe(name string, redisCli *redis.Client, handler Handler) *DelayQueue {
+	queue := NewDelayQueueWithHandler(name, redisCli, handler)
+	m.Add(queue)
+	return queue
+}
+
+// Remove 停止消费指定的队列
+func (m *QueueManager) Remove(queue *DelayQueue) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, q := range m.queues {
+		if q == queue {
+			m.queues = append(m.queues[:i], m.queues[i+1:]...)
+			q.slots = nil
+			return
+		}
+	}
+}
+
+// snapshot 返回当前需要消费的队列，已被删除的队列会被移除
+func (m *QueueManager) snapshot() []*DelayQueue {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	queues := m.queues[:0]
+	for _, q := range m.queues {
+		if !q.deleted.Load() {
+			queues = append(queues, q)
+		}
+	}
+	m.queues = queues
+	return append([]*DelayQueue(nil), queues...)
+}
+
+// consume 使用协程池依次消费所有队列，等待所有队列消费完成后返回
+func (m *QueueManager) consume() {
+	queues := m.snapshot()
+	ch := make(chan *DelayQueue, len(queues))
+	for _, q := range queues {
+		ch <- q
+	}
+	close(ch)
+	workers := int(m.workers)
+	if m.sharedConcurrent() {
+		// 并发数由共享的 slots 限制，同时拉取所有队列
+		workers = len(queues)
+	}
+	if workers > len(queues) {
+		workers = len(queues)
+	}
+	wg := sync.WaitGroup{}
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for q := range ch {
+				err := q.consumeWithBackoff()
+				if err != nil && q.errorHandler != nil {
+					q.errorHandler(err)
+				} else if err != nil {
+					m.logger.Error("consume failed", "queue", q.name, "error", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func (m *QueueManager) sharedConcurrent() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.slots != nil
+}
+
+// StartConsume 创建一个协程消费所有队列
+// 使用 `<-done`来让消费者等待
+func (m *QueueManager) StartConsume() (done <-chan struct{}) {
+	m.ticker = time.NewTicker(m.interval)
+	done0 := make(chan struct{})
+	go func() {
+	tickerLoop:
+		for true {
+			select {
+			case <-m.ticker.C:
+				m.consume()
+			case <-m.close:
+				break tickerLoop
+			}
+		}
+		close(done0)
+	}()
+	return done0
+}
+
+// StopConsume 停止消费协程，可以重复调用
+func (m *QueueManager) StopConsume() {
+	m.closeOnce.Do(func() {
+		close(m.close)
+		if m.ticker != nil {
+			m.ticker.Stop()
+		}
+	})
+}
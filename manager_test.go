@@ -0,0 +1,95 @@
+package delayqueue
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueueManager(t *testing.T) {
+	redisCli := newTestRedis(t)
+	size := 5
+	mu := sync.Mutex{}
+	received := make(map[string]int)
+	manager := NewQueueManager().WithFetchInterval(50 * time.Millisecond).WithWorkers(2)
+	for i := 0; i < 3; i++ {
+		name := "test" + strconv.Itoa(i)
+		queue := NewDelayQueue(name, redisCli, func(s string) bool {
+			mu.Lock()
+			received[name]++
+			mu.Unlock()
+			return true
+		})
+		for j := 0; j < size; j++ {
+			err := queue.SendDelayMsg(strconv.Itoa(j), 0)
+			if err != nil {
+				t.Error(err)
+			}
+		}
+		manager.Add(queue)
+	}
+	done := manager.StartConsume()
+	time.Sleep(300 * time.Millisecond)
+	manager.StopConsume()
+	<-done
+	mu.Lock()
+	defer mu.Unlock()
+	for i := 0; i < 3; i++ {
+		name := "test" + strconv.Itoa(i)
+		if received[name] != size {
+			t.Errorf("expect %d delivery for %s, actual %d", size, name, received[name])
+		}
+	}
+}
+
+func TestQueueManager_SharedConcurrent(t *testing.T) {
+	redisCli := newTestRedis(t)
+	size := 4
+	mu := sync.Mutex{}
+	received := make(map[string]int)
+	running, maxRunning := 0, 0
+	manager := NewQueueManager().WithFetchInterval(50 * time.Millisecond).WithConcurrent(3)
+	for i := 0; i < 3; i++ {
+		name := "test" + strconv.Itoa(i)
+		queue := manager.Subscribe(name, redisCli, func(ctx context.Context, msg *Message) error {
+			mu.Lock()
+			received[name]++
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return nil
+		})
+		for j := 0; j < size; j++ {
+			err := queue.SendDelayMsg(strconv.Itoa(j), 0)
+			if err != nil {
+				t.Error(err)
+			}
+		}
+	}
+	done := manager.StartConsume()
+	time.Sleep(300 * time.Millisecond)
+	manager.StopConsume()
+	<-done
+	mu.Lock()
+	defer mu.Unlock()
+	for i := 0; i < 3; i++ {
+		name := "test" + strconv.Itoa(i)
+		if received[name] != size {
+			t.Errorf("expect %d delivery for %s, actual %d", size, name, received[name])
+		}
+	}
+	if maxRunning > 3 {
+		t.Errorf("expect at most 3 running handlers, actual %d", maxRunning)
+	}
+	if maxRunning < 2 {
+		t.Errorf("expect handlers of different queues run concurrently, actual %d", maxRunning)
+	}
+}
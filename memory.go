@@ -0,0 +1,1094 @@
+package delayqueue
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// memoryMessage 内存中的一条消息
+type memoryMessage struct {
+	payload    string
+	expireAt   time.Time
+	retryCount uint
+	attempt    int
+	history    []*HistoryRecord
+	headers    map[string]string
+	owner      *Owner
+
+	failureSignature string // 最近一次处理失败的错误特征
+	failures         int64  // 以 failureSignature 连续失败的次数
+}
+
+// memoryBroker 基于内存的 Broker，在内存中模拟 redis 中各阶段的数据结构，消息的流转规则与 redis 实现一致
+type memoryBroker struct {
+	mu       sync.Mutex
+	now      func() time.Time // 用于判断消息内容是否过期
+	paused   bool
+	msgs     map[string]*memoryMessage
+	pending  map[string]time.Time // 消息ID -> 投递时间
+	ready    []string             // 从头部取出，从尾部放入
+	unack    map[string]time.Time // 消息ID -> 处理超时时间
+	retry    []string
+	garbage  map[string]struct{}
+	dead     map[string]time.Time // 消息ID -> 进入死信队列的时间
+	replies  map[string]chan string
+	results  map[string]memoryResult
+	status   map[string]*memoryStatus
+	progress map[string]*memoryProgress
+	tags     map[string]map[string]struct{} // 标签 -> 消息ID
+	dedup    map[string]memoryResult        // 去重 key -> 消息ID
+
+	poisonSignatures map[string]struct{} // 已导致消息被隔离的错误特征
+}
+
+type memoryProgress struct {
+	progress *Progress
+	expireAt time.Time
+}
+
+type memoryStatus struct {
+	info     *StatusInfo
+	at       time.Time
+	expireAt time.Time
+}
+
+type memoryResult struct {
+	value    string
+	expireAt time.Time
+}
+
+// NewMemoryBroker 创建基于内存的 Broker，可以配合 NewDelayQueueWithBroker 使用
+func NewMemoryBroker() Broker {
+	return newMemoryBroker()
+}
+
+func newMemoryBroker() *memoryBroker {
+	return &memoryBroker{
+		now:      time.Now,
+		msgs:     make(map[string]*memoryMessage),
+		pending:  make(map[string]time.Time),
+		unack:    make(map[string]time.Time),
+		garbage:  make(map[string]struct{}),
+		dead:     make(map[string]time.Time),
+		replies:  make(map[string]chan string),
+		results:  make(map[string]memoryResult),
+		status:   make(map[string]*memoryStatus),
+		progress: make(map[string]*memoryProgress),
+		tags:     make(map[string]map[string]struct{}),
+		dedup:    make(map[string]memoryResult),
+
+		poisonSignatures: make(map[string]struct{}),
+	}
+}
+
+// sortedKeys 返回排序后的消息ID，保证结果稳定
+func sortedKeys(m map[string]struct{}) []string {
+	ids := make([]string, 0, len(m))
+	for idStr := range m {
+		ids = append(ids, idStr)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// sortByTime 按时间排序消息ID，时间相同时按ID排序，保证结果稳定
+func sortByTime(m map[string]time.Time) []string {
+	ids := make([]string, 0, len(m))
+	for idStr := range m {
+		ids = append(ids, idStr)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		ti, tj := m[ids[i]], m[ids[j]]
+		if ti.Equal(tj) {
+			return ids[i] < ids[j]
+		}
+		return ti.Before(tj)
+	})
+	return ids
+}
+
+// due 返回时间不晚于 now 的消息ID，按时间排序
+func due(m map[string]time.Time, now time.Time) []string {
+	ids := sortByTime(m)
+	for i, idStr := range ids {
+		if m[idStr].After(now) {
+			return ids[:i]
+		}
+	}
+	return ids
+}
+
+// removeFromList 从 list 中移除所有 idStr，返回是否存在
+func removeFromList(list *[]string, idStr string) bool {
+	found := false
+	kept := (*list)[:0]
+	for _, v := range *list {
+		if v == idStr {
+			found = true
+			continue
+		}
+		kept = append(kept, v)
+	}
+	*list = kept
+	return found
+}
+
+func (b *memoryBroker) useClock(clock Clock) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.now = clock.Now
+}
+
+func (b *memoryBroker) Push(ctx context.Context, msg *MessageInfo, ttl time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.msgs[msg.ID] = &memoryMessage{
+		payload:    msg.Payload,
+		expireAt:   b.now().Add(ttl),
+		retryCount: uint(msg.RetryCount),
+		headers:    msg.Headers,
+	}
+	b.pending[msg.ID] = msg.Time
+	b.indexTags(msg)
+	return nil
+}
+
+// indexTags 将消息加入标签索引，调用时需要持有锁
+func (b *memoryBroker) indexTags(msg *MessageInfo) {
+	for _, tag := range msg.Tags {
+		ids, ok := b.tags[tag]
+		if !ok {
+			ids = make(map[string]struct{})
+			b.tags[tag] = ids
+		}
+		ids[msg.ID] = struct{}{}
+	}
+}
+
+func (b *memoryBroker) Reserve(ctx context.Context, key string, idStr string, ttl time.Duration) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if existing, ok := b.dedup[key]; ok && b.now().Before(existing.expireAt) {
+		return existing.value, nil
+	}
+	b.dedup[key] = memoryResult{value: idStr, expireAt: b.now().Add(ttl)}
+	return "", nil
+}
+
+func (b *memoryBroker) Release(ctx context.Context, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.dedup, key)
+	return nil
+}
+
+func (b *memoryBroker) PushMany(ctx context.Context, msgs []*PendingMessage) error {
+	for _, msg := range msgs {
+		_ = b.Push(ctx, msg.MessageInfo, msg.TTL)
+	}
+	return nil
+}
+
+func (b *memoryBroker) Pending2Ready(ctx context.Context, now time.Time) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ids := due(b.pending, now)
+	for _, idStr := range ids {
+		delete(b.pending, idStr)
+		b.ready = append(b.ready, idStr)
+	}
+	return int64(len(ids)), nil
+}
+
+func (b *memoryBroker) Ready2Unack(ctx context.Context, deadline time.Time) (string, error) {
+	return b.move2Unack(&b.ready, deadline)
+}
+
+func (b *memoryBroker) Retry2Unack(ctx context.Context, deadline time.Time) (string, error) {
+	return b.move2Unack(&b.retry, deadline)
+}
+
+// move2Unack 从 list 头部取出一条消息移入 unack
+func (b *memoryBroker) move2Unack(list *[]string, deadline time.Time) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(*list) == 0 {
+		return "", ErrNoMessage
+	}
+	idStr := (*list)[0]
+	*list = (*list)[1:]
+	b.unack[idStr] = deadline
+	if msg, ok := b.msgs[idStr]; ok {
+		msg.attempt++
+	}
+	return idStr, nil
+}
+
+// alive 返回未过期的消息
+func (b *memoryBroker) alive(idStr string) (*memoryMessage, bool) {
+	msg, ok := b.msgs[idStr]
+	if !ok || !msg.expireAt.After(b.now()) {
+		return nil, false
+	}
+	return msg, true
+}
+
+func (b *memoryBroker) Message(ctx context.Context, idStr string) (*Message, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	msg, ok := b.alive(idStr)
+	if !ok {
+		return nil, ErrMessageNotFound
+	}
+	return &Message{ID: idStr, Payload: msg.payload, Attempt: msg.attempt, RetriesLeft: int(msg.retryCount), Headers: msg.headers}, nil
+}
+
+func (b *memoryBroker) RecordHistory(ctx context.Context, idStr string, record *HistoryRecord) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.appendHistory(idStr, record)
+	return nil
+}
+
+func (b *memoryBroker) appendHistory(idStr string, record *HistoryRecord) {
+	msg, ok := b.msgs[idStr]
+	if !ok {
+		return
+	}
+	msg.history = append(msg.history, record)
+	if len(msg.history) > maxHistory {
+		msg.history = msg.history[len(msg.history)-maxHistory:]
+	}
+}
+
+func (b *memoryBroker) Ack(ctx context.Context, idStr string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.unack, idStr)
+	delete(b.msgs, idStr)
+	return nil
+}
+
+func (b *memoryBroker) Nack(ctx context.Context, idStr string, now time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.unack[idStr]; ok {
+		b.unack[idStr] = now
+	}
+	return nil
+}
+
+func (b *memoryBroker) AckAndPush(ctx context.Context, idStr string, msgs []*PendingMessage) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.unack, idStr)
+	delete(b.msgs, idStr)
+	for _, msg := range msgs {
+		b.msgs[msg.ID] = &memoryMessage{
+			payload:    msg.Payload,
+			expireAt:   b.now().Add(msg.TTL),
+			retryCount: uint(msg.RetryCount),
+			headers:    msg.Headers,
+		}
+		b.pending[msg.ID] = msg.Time
+		b.indexTags(msg.MessageInfo)
+	}
+	return nil
+}
+
+// replyChan 返回存放消息处理结果的 channel，调用时需要持有锁
+func (b *memoryBroker) replyChan(idStr string) chan string {
+	ch, ok := b.replies[idStr]
+	if !ok {
+		ch = make(chan string, 1)
+		b.replies[idStr] = ch
+	}
+	return ch
+}
+
+func (b *memoryBroker) Reply(ctx context.Context, idStr string, result string, ttl time.Duration) error {
+	b.mu.Lock()
+	ch := b.replyChan(idStr)
+	b.results[idStr] = memoryResult{value: result, expireAt: b.now().Add(ttl)}
+	b.mu.Unlock()
+	select {
+	case ch <- result:
+	default:
+	}
+	if ttl > 0 {
+		// 没有生产者等待时，处理结果在 ttl 后删除
+		time.AfterFunc(ttl, func() {
+			b.mu.Lock()
+			if b.replies[idStr] == ch {
+				delete(b.replies, idStr)
+			}
+			b.mu.Unlock()
+		})
+	}
+	return nil
+}
+
+func (b *memoryBroker) Result(ctx context.Context, idStr string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	result, ok := b.results[idStr]
+	if !ok {
+		return "", ErrResultNotFound
+	}
+	if !b.now().Before(result.expireAt) {
+		delete(b.results, idStr)
+		return "", ErrResultNotFound
+	}
+	return result.value, nil
+}
+
+func (b *memoryBroker) SetStatus(ctx context.Context, idStr string, status JobStatus, now time.Time, at time.Time, ttl time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, ok := b.status[idStr]
+	if !ok || !b.now().Before(s.expireAt) {
+		s = &memoryStatus{info: &StatusInfo{ID: idStr, Times: make(map[JobStatus]time.Time)}}
+		b.status[idStr] = s
+	}
+	s.info.Status = status
+	s.info.Times[status] = now
+	if !at.IsZero() {
+		s.at = at
+	}
+	s.expireAt = b.now().Add(ttl)
+	return nil
+}
+
+func (b *memoryBroker) Status(ctx context.Context, idStr string) (*StatusInfo, time.Time, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, ok := b.status[idStr]
+	if !ok {
+		return nil, time.Time{}, ErrMessageNotFound
+	}
+	if !b.now().Before(s.expireAt) {
+		delete(b.status, idStr)
+		return nil, time.Time{}, ErrMessageNotFound
+	}
+	info := &StatusInfo{ID: idStr, Status: s.info.Status, Times: make(map[JobStatus]time.Time, len(s.info.Times))}
+	for status, t := range s.info.Times {
+		info.Times[status] = t
+	}
+	return info, s.at, nil
+}
+
+func (b *memoryBroker) SetProgress(ctx context.Context, idStr string, progress *Progress, ttl time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	copied := *progress
+	b.progress[idStr] = &memoryProgress{progress: &copied, expireAt: b.now().Add(ttl)}
+	return nil
+}
+
+func (b *memoryBroker) Progress(ctx context.Context, idStr string) (*Progress, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p, ok := b.progress[idStr]
+	if !ok {
+		return nil, ErrMessageNotFound
+	}
+	if !b.now().Before(p.expireAt) {
+		delete(b.progress, idStr)
+		return nil, ErrMessageNotFound
+	}
+	copied := *p.progress
+	return &copied, nil
+}
+
+func (b *memoryBroker) WaitReply(ctx context.Context, idStr string) (string, error) {
+	b.mu.Lock()
+	ch := b.replyChan(idStr)
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.replies, idStr)
+		b.mu.Unlock()
+	}()
+	select {
+	case result := <-ch:
+		return result, nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (b *memoryBroker) AckMany(ctx context.Context, ids []string) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var acked []string
+	for _, idStr := range ids {
+		if _, ok := b.unack[idStr]; ok {
+			acked = append(acked, idStr)
+		}
+		delete(b.unack, idStr)
+		delete(b.msgs, idStr)
+	}
+	return acked, nil
+}
+
+func (b *memoryBroker) NackMany(ctx context.Context, ids []string, now time.Time) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var nacked []string
+	for _, idStr := range ids {
+		if _, ok := b.unack[idStr]; ok {
+			b.unack[idStr] = now
+			nacked = append(nacked, idStr)
+		}
+	}
+	return nacked, nil
+}
+
+func (b *memoryBroker) Extend(ctx context.Context, idStr string, deadline time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.unack[idStr]; !ok {
+		return ErrMessageNotFound
+	}
+	b.unack[idStr] = deadline
+	return nil
+}
+
+// Unack2Retry 将处理超时的消息移入 retry，已达重试上限的消息移入 garbage，并记录投递历史
+func (b *memoryBroker) Unack2Retry(ctx context.Context, now time.Time) (retried, dropped int64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, idStr := range due(b.unack, now) {
+		delete(b.unack, idStr)
+		msg, ok := b.msgs[idStr]
+		if ok && msg.retryCount > 0 {
+			msg.retryCount--
+			b.retry = append(b.retry, idStr)
+			b.appendHistory(idStr, &HistoryRecord{Time: now.Unix(), Event: HistoryRetry})
+			retried++
+		} else {
+			b.garbage[idStr] = struct{}{}
+			b.appendHistory(idStr, &HistoryRecord{Time: now.Unix(), Event: HistoryDead})
+			dropped++
+		}
+	}
+	return retried, dropped, nil
+}
+
+func (b *memoryBroker) CollectGarbage(ctx context.Context, now time.Time, deadLetterTTL time.Duration) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var n int64
+	if deadLetterTTL > 0 {
+		// 移除超过保留时间的死信消息
+		for idStr, at := range b.dead {
+			if !at.After(now.Add(-deadLetterTTL)) {
+				delete(b.dead, idStr)
+				delete(b.msgs, idStr)
+			}
+		}
+	}
+	for idStr := range b.garbage {
+		delete(b.garbage, idStr)
+		if deadLetterTTL <= 0 {
+			delete(b.msgs, idStr)
+			continue
+		}
+		b.dead[idStr] = now
+		if msg, ok := b.msgs[idStr]; ok {
+			msg.expireAt = now.Add(deadLetterTTL)
+		}
+		n++
+	}
+	return n, nil
+}
+
+func (b *memoryBroker) SetPaused(ctx context.Context, paused bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.paused = paused
+	return nil
+}
+
+func (b *memoryBroker) Paused(ctx context.Context) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.paused, nil
+}
+
+func (b *memoryBroker) Stats(ctx context.Context) (*QueueStats, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return &QueueStats{
+		Pending: int64(len(b.pending)),
+		Ready:   int64(len(b.ready)),
+		Unack:   int64(len(b.unack)),
+		Retry:   int64(len(b.retry)),
+		Garbage: int64(len(b.garbage)),
+		Dead:    int64(len(b.dead)),
+	}, nil
+}
+
+func (b *memoryBroker) Get(ctx context.Context, idStr string) (*MessageInfo, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	info := &MessageInfo{ID: idStr}
+	if msg, ok := b.alive(idStr); ok {
+		info.Payload = msg.payload
+		info.RetryCount = int64(msg.retryCount)
+		info.Headers = msg.headers
+		info.History = append(info.History, msg.history...)
+	}
+	if t, ok := b.pending[idStr]; ok {
+		info.State, info.Time = StagePending, t
+	} else if contains(b.ready, idStr) {
+		info.State = StageReady
+	} else if t, ok := b.unack[idStr]; ok {
+		info.State, info.Time = StageUnack, t
+	} else if contains(b.retry, idStr) {
+		info.State = StageRetry
+	} else if _, ok := b.garbage[idStr]; ok {
+		info.State = StageGarbage
+	} else if t, ok := b.dead[idStr]; ok {
+		info.State, info.Time = StageDead, t
+	} else {
+		return nil, ErrMessageNotFound
+	}
+	return info, nil
+}
+
+func contains(list []string, idStr string) bool {
+	for _, v := range list {
+		if v == idStr {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *memoryBroker) Cancel(ctx context.Context, idStr string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.cancel(idStr) {
+		return ErrMessageNotFound
+	}
+	return nil
+}
+
+func (b *memoryBroker) CancelByTag(ctx context.Context, tag string) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var cancelled []string
+	for _, idStr := range sortedKeys(b.tags[tag]) {
+		if b.cancel(idStr) {
+			cancelled = append(cancelled, idStr)
+		}
+	}
+	delete(b.tags, tag)
+	return cancelled, nil
+}
+
+// cancel 从所有阶段中移除消息，返回消息是否存在，调用时需要持有锁
+func (b *memoryBroker) cancel(idStr string) bool {
+	found := false
+	for _, m := range []map[string]time.Time{b.pending, b.unack, b.dead} {
+		if _, ok := m[idStr]; ok {
+			delete(m, idStr)
+			found = true
+		}
+	}
+	if _, ok := b.garbage[idStr]; ok {
+		delete(b.garbage, idStr)
+		found = true
+	}
+	if removeFromList(&b.ready, idStr) {
+		found = true
+	}
+	if removeFromList(&b.retry, idStr) {
+		found = true
+	}
+	delete(b.msgs, idStr)
+	return found
+}
+
+// ListDead 按进入死信队列的时间分页遍历死信消息，cursor 为偏移量
+func (b *memoryBroker) ListDead(ctx context.Context, cursor string, count int64) ([]*DeadMessage, string, error) {
+	if count <= 0 {
+		count = 10
+	}
+	offset := 0
+	if cursor != "" {
+		var err error
+		offset, err = strconv.Atoi(cursor)
+		if err != nil || offset < 0 {
+			return nil, "", ErrInvalidCursor
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ids := sortByTime(b.dead)
+	if offset >= len(ids) {
+		return nil, "", nil
+	}
+	end := offset + int(count)
+	if end > len(ids) {
+		end = len(ids)
+	}
+	dead := make([]*DeadMessage, 0, end-offset)
+	for _, idStr := range ids[offset:end] {
+		info := &MessageInfo{ID: idStr, State: StageDead, Time: b.dead[idStr]}
+		var history []*HistoryRecord
+		if msg, ok := b.alive(idStr); ok {
+			info.Payload = msg.payload
+			history = append(history, msg.history...)
+		}
+		dead = append(dead, &DeadMessage{
+			MessageInfo: info,
+			LastError:   lastError(history),
+			Failures:    failures(history),
+			History:     history,
+		})
+	}
+	if end == len(ids) {
+		return dead, "", nil
+	}
+	return dead, strconv.Itoa(end), nil
+}
+
+// RequeueDead 将死信消息放入 ready，并重置重试次数和过期时间，内容已过期的死信消息会被直接移除
+func (b *memoryBroker) RequeueDead(ctx context.Context, retryCount uint, msgTTL time.Duration, ids ...string) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(ids) == 0 {
+		ids = sortByTime(b.dead)
+	}
+	now := b.now()
+	count := 0
+	for _, idStr := range ids {
+		if _, ok := b.dead[idStr]; !ok {
+			continue
+		}
+		delete(b.dead, idStr)
+		msg, ok := b.alive(idStr)
+		if !ok {
+			delete(b.msgs, idStr)
+			continue
+		}
+		msg.retryCount = retryCount
+		msg.attempt = 0
+		msg.expireAt = now.Add(msgTTL)
+		b.appendHistory(idStr, &HistoryRecord{Time: now.Unix(), Event: HistoryRequeued})
+		b.ready = append(b.ready, idStr)
+		count++
+	}
+	return count, nil
+}
+
+// MemoryQueue 基于内存的延迟队列，使用与 DelayQueue 相同的消费流程（投递、超时重试、死信队列等），
+// 无需 redis 即可在单元测试中验证业务逻辑。消息仅保存在当前进程中，不能用于生产环境
+type MemoryQueue struct {
+	q *DelayQueue
+}
+
+// NewMemoryQueue 创建基于内存的队列，默认配置与 NewDelayQueue 相同
+func NewMemoryQueue(name string, callback func(string) bool) *MemoryQueue {
+	return &MemoryQueue{q: NewDelayQueueWithBroker(name, newMemoryBroker(), callback)}
+}
+
+// WithLogger 自定义日志
+func (q *MemoryQueue) WithLogger(logger *log.Logger) *MemoryQueue {
+	q.q.WithLogger(logger)
+	return q
+}
+
+// WithStructuredLogger 自定义结构化日志
+func (q *MemoryQueue) WithStructuredLogger(logger Logger) *MemoryQueue {
+	q.q.WithStructuredLogger(logger)
+	return q
+}
+
+// WithFetchInterval 配置拉取消息的时间间隔
+func (q *MemoryQueue) WithFetchInterval(d time.Duration) *MemoryQueue {
+	q.q.WithFetchInterval(d)
+	return q
+}
+
+// WithMaxConsumeDuration 配置消息的超时时间
+func (q *MemoryQueue) WithMaxConsumeDuration(d time.Duration) *MemoryQueue {
+	q.q.WithMaxConsumeDuration(d)
+	return q
+}
+
+// WithFetchLimit 配置单次拉取消息的数量
+func (q *MemoryQueue) WithFetchLimit(limit uint) *MemoryQueue {
+	q.q.WithFetchLimit(limit)
+	return q
+}
+
+// WithDefaultRetryCount 自定义最大重试次数
+func (q *MemoryQueue) WithDefaultRetryCount(count uint) *MemoryQueue {
+	q.q.WithDefaultRetryCount(count)
+	return q
+}
+
+// WithConcurrent 自定义并发数
+func (q *MemoryQueue) WithConcurrent(c uint) *MemoryQueue {
+	q.q.WithConcurrent(c)
+	return q
+}
+
+// WithClock 自定义时钟，消息内容的过期时间也由该时钟计算
+func (q *MemoryQueue) WithClock(clock Clock) *MemoryQueue {
+	q.q.WithClock(clock)
+	return q
+}
+
+// WithErrorHandler 配置消费过程中发生错误时的回调函数
+func (q *MemoryQueue) WithErrorHandler(handler func(error)) *MemoryQueue {
+	q.q.WithErrorHandler(handler)
+	return q
+}
+
+// Ack 确认正在处理的消息
+func (q *MemoryQueue) Ack(ctx context.Context, idStr string) error {
+	return q.q.Ack(ctx, idStr)
+}
+
+// Nack 将正在处理的消息标记为消费失败
+func (q *MemoryQueue) Nack(ctx context.Context, idStr string, reason error) error {
+	return q.q.Nack(ctx, idStr, reason)
+}
+
+// AckMany 批量确认正在处理的消息
+func (q *MemoryQueue) AckMany(ctx context.Context, ids ...string) (int, error) {
+	return q.q.AckMany(ctx, ids...)
+}
+
+// NackMany 批量将正在处理的消息标记为消费失败
+func (q *MemoryQueue) NackMany(ctx context.Context, ids ...string) (int, error) {
+	return q.q.NackMany(ctx, ids...)
+}
+
+// Extend 延长正在处理的消息的处理超时时间
+func (q *MemoryQueue) Extend(ctx context.Context, idStr string, d time.Duration) error {
+	return q.q.Extend(ctx, idStr, d)
+}
+
+// SetDebug 开启或关闭消息流转的调试日志
+func (q *MemoryQueue) SetDebug(enabled bool) {
+	q.q.SetDebug(enabled)
+}
+
+// WithMaintenanceWindows 配置每天的维护时间段，维护期间不投递消息
+func (q *MemoryQueue) WithMaintenanceWindows(loc *time.Location, windows ...MaintenanceWindow) *MemoryQueue {
+	q.q.WithMaintenanceWindows(loc, windows...)
+	return q
+}
+
+// WithCircuitBreaker 启用熔断器
+func (q *MemoryQueue) WithCircuitBreaker(threshold uint, coolDown time.Duration) *MemoryQueue {
+	q.q.WithCircuitBreaker(threshold, coolDown)
+	return q
+}
+
+// WithEventListener 注册事件监听器
+func (q *MemoryQueue) WithEventListener(listener EventListener) *MemoryQueue {
+	q.q.WithEventListener(listener)
+	return q
+}
+
+// BreakerState 返回熔断器当前的状态
+func (q *MemoryQueue) BreakerState() BreakerState {
+	return q.q.BreakerState()
+}
+
+// WithMaxBackoff 配置暂时性错误时消费周期的最大退避时间
+func (q *MemoryQueue) WithMaxBackoff(d time.Duration) *MemoryQueue {
+	q.q.WithMaxBackoff(d)
+	return q
+}
+
+// WithDeadLetter 启用死信队列
+func (q *MemoryQueue) WithDeadLetter(ttl time.Duration) *MemoryQueue {
+	q.q.WithDeadLetter(ttl)
+	return q
+}
+
+// SendScheduleMsg 发送定时消息
+func (q *MemoryQueue) SendScheduleMsg(payload string, t time.Time, opts ...SendOption) error {
+	return q.q.SendScheduleMsg(payload, t, opts...)
+}
+
+// SendScheduleMsgV2 发送定时消息，并返回消息信息
+func (q *MemoryQueue) SendScheduleMsgV2(payload string, t time.Time, opts ...SendOption) (*MessageInfo, error) {
+	return q.q.SendScheduleMsgV2(payload, t, opts...)
+}
+
+// SendDelayMsg 发送延时消息
+func (q *MemoryQueue) SendDelayMsg(payload string, duration time.Duration, opts ...SendOption) error {
+	return q.q.SendDelayMsg(payload, duration, opts...)
+}
+
+// SendDelayMsgV2 发送延时消息，并返回消息信息
+func (q *MemoryQueue) SendDelayMsgV2(payload string, duration time.Duration, opts ...SendOption) (*MessageInfo, error) {
+	return q.q.SendDelayMsgV2(payload, duration, opts...)
+}
+
+// SendAndWait 发送延时消息，并等待消费者返回处理结果
+func (q *MemoryQueue) SendAndWait(ctx context.Context, payload string, duration time.Duration, opts ...SendOption) (string, error) {
+	return q.q.SendAndWait(ctx, payload, duration, opts...)
+}
+
+// WithResultTTL 自定义处理结果的保留时间
+func (q *MemoryQueue) WithResultTTL(d time.Duration) *MemoryQueue {
+	q.q.WithResultTTL(d)
+	return q
+}
+
+// GetResult 查询消息的处理结果
+func (q *MemoryQueue) GetResult(ctx context.Context, idStr string) (string, error) {
+	return q.q.GetResult(ctx, idStr)
+}
+
+// WithIDGenerator 自定义消息 ID 的生成方式
+func (q *MemoryQueue) WithIDGenerator(gen IDGenerator) *MemoryQueue {
+	q.q.WithIDGenerator(gen)
+	return q
+}
+
+// WithExpiredHandler 注册超过最晚投递时间的消息的回调函数
+func (q *MemoryQueue) WithExpiredHandler(handler func(msg *Message)) *MemoryQueue {
+	q.q.WithExpiredHandler(handler)
+	return q
+}
+
+// WithMaxLength 配置 pending 与 ready 中消息数量的上限
+func (q *MemoryQueue) WithMaxLength(n uint, policy OverflowPolicy) *MemoryQueue {
+	q.q.WithMaxLength(n, policy)
+	return q
+}
+
+// WithSendRateLimit 限制发送消息的速率
+func (q *MemoryQueue) WithSendRateLimit(rate float64, burst int) *MemoryQueue {
+	q.q.WithSendRateLimit(rate, burst)
+	return q
+}
+
+// SendLimiterState 返回发送限流器的当前状态
+func (q *MemoryQueue) SendLimiterState() *SendLimiterState {
+	return q.q.SendLimiterState()
+}
+
+// WithLatencyTracking 记录消息首次投递时距离投递时间的延迟
+func (q *MemoryQueue) WithLatencyTracking(buckets ...time.Duration) *MemoryQueue {
+	q.q.WithLatencyTracking(buckets...)
+	return q
+}
+
+// LatencyStats 返回投递消息的延迟统计
+func (q *MemoryQueue) LatencyStats() *LatencyStats {
+	return q.q.LatencyStats()
+}
+
+// Lag 查询队列中最早的消息已经延迟的时间
+func (q *MemoryQueue) Lag(ctx context.Context) (*QueueLag, error) {
+	return q.q.Lag(ctx)
+}
+
+// WithMetrics 配置指标上报
+func (q *MemoryQueue) WithMetrics(metrics Metrics) *MemoryQueue {
+	q.q.WithMetrics(metrics)
+	return q
+}
+
+// Health 检查消费协程的状态
+func (q *MemoryQueue) Health(ctx context.Context) *HealthStatus {
+	return q.q.Health(ctx)
+}
+
+// WithSlowConsumer 记录 Handler 的处理耗时，并在超过 threshold 时调用 hook
+func (q *MemoryQueue) WithSlowConsumer(threshold time.Duration, hook func(msg *Message, cost time.Duration)) *MemoryQueue {
+	q.q.WithSlowConsumer(threshold, hook)
+	return q
+}
+
+// ConsumeDurationStats 返回最近的处理耗时统计
+func (q *MemoryQueue) ConsumeDurationStats() *ConsumeDurationStats {
+	return q.q.ConsumeDurationStats()
+}
+
+// WithHistory 启用消息的投递历史
+func (q *MemoryQueue) WithHistory() *MemoryQueue {
+	q.q.WithHistory()
+	return q
+}
+
+// Use 注册消费消息的中间件
+func (q *MemoryQueue) Use(middleware ...func(Handler) Handler) *MemoryQueue {
+	q.q.Use(middleware...)
+	return q
+}
+
+// UseSend 注册发送消息的拦截器
+func (q *MemoryQueue) UseSend(interceptors ...SendInterceptor) *MemoryQueue {
+	q.q.UseSend(interceptors...)
+	return q
+}
+
+// WithValidator 在发送消息时校验消息内容
+func (q *MemoryQueue) WithValidator(v Validator) *MemoryQueue {
+	q.q.WithValidator(v)
+	return q
+}
+
+// WithPayloadVersion 设置当前的消息内容格式版本
+func (q *MemoryQueue) WithPayloadVersion(version int) *MemoryQueue {
+	q.q.WithPayloadVersion(version)
+	return q
+}
+
+// RegisterPayloadUpgrade 注册将 from 版本的消息内容升级为 from+1 版本的函数
+func (q *MemoryQueue) RegisterPayloadUpgrade(from int, upgrade PayloadUpgrade) *MemoryQueue {
+	q.q.RegisterPayloadUpgrade(from, upgrade)
+	return q
+}
+
+// WithContentDedup 丢弃 window 内已经发送过相同内容的消息
+func (q *MemoryQueue) WithContentDedup(window time.Duration) *MemoryQueue {
+	q.q.WithContentDedup(window)
+	return q
+}
+
+// WithPoisonQuarantine 隔离以相同错误连续处理失败 threshold 次的消息
+func (q *MemoryQueue) WithPoisonQuarantine(threshold uint, hook func(signature string, msg *Message)) *MemoryQueue {
+	q.q.WithPoisonQuarantine(threshold, hook)
+	return q
+}
+
+// WithRetryOrder 配置 ready 与 retry 中消息的投递顺序
+func (q *MemoryQueue) WithRetryOrder(order RetryOrder) *MemoryQueue {
+	q.q.WithRetryOrder(order)
+	return q
+}
+
+// WithRetryWeight 按 fresh:retry 的比例交替投递 ready 与 retry 中的消息
+func (q *MemoryQueue) WithRetryWeight(fresh, retry uint) *MemoryQueue {
+	q.q.WithRetryWeight(fresh, retry)
+	return q
+}
+
+// WithHeaderFilter 只处理 header 满足 filter 的消息，不满足的消息放回 pending
+func (q *MemoryQueue) WithHeaderFilter(filter func(headers map[string]string) bool) *MemoryQueue {
+	q.q.WithHeaderFilter(filter, nil)
+	return q
+}
+
+// WithPayloadStore 将长度超过 threshold 字节的消息内容保存到外部存储
+func (q *MemoryQueue) WithPayloadStore(store PayloadStore, threshold int) *MemoryQueue {
+	q.q.WithPayloadStore(store, threshold)
+	return q
+}
+
+// WithScheduleValidation 发送消息时校验投递时间
+func (q *MemoryQueue) WithScheduleValidation(maxDelay time.Duration) *MemoryQueue {
+	q.q.WithScheduleValidation(maxDelay)
+	return q
+}
+
+// WithPastSchedulePolicy 配置投递时间早于当前时间的消息的处理方式
+func (q *MemoryQueue) WithPastSchedulePolicy(policy PastSchedulePolicy, minDelay time.Duration) *MemoryQueue {
+	q.q.WithPastSchedulePolicy(policy, minDelay)
+	return q
+}
+
+// WithCalendar 按工作日历调整消息的投递时间
+func (q *MemoryQueue) WithCalendar(cal *Calendar) *MemoryQueue {
+	q.q.WithCalendar(cal)
+	return q
+}
+
+// WithHardTimeout Handler 的 ctx 取消后超过 grace 仍未返回时放弃等待
+func (q *MemoryQueue) WithHardTimeout(grace time.Duration) *MemoryQueue {
+	q.q.WithHardTimeout(grace)
+	return q
+}
+
+// WithStatusTracking 启用消息状态跟踪
+func (q *MemoryQueue) WithStatusTracking(ttl time.Duration) *MemoryQueue {
+	q.q.WithStatusTracking(ttl)
+	return q
+}
+
+// GetStatus 查询消息的状态
+func (q *MemoryQueue) GetStatus(ctx context.Context, idStr string) (*StatusInfo, error) {
+	return q.q.GetStatus(ctx, idStr)
+}
+
+// GetProgress 查询消息的处理进度
+func (q *MemoryQueue) GetProgress(ctx context.Context, idStr string) (*Progress, error) {
+	return q.q.GetProgress(ctx, idStr)
+}
+
+// SendSpread 将 payloads 均匀地分布在 [start, start+window) 内发送
+func (q *MemoryQueue) SendSpread(ctx context.Context, payloads []string, start time.Time, window time.Duration, opts ...SendOption) ([]*MessageInfo, error) {
+	return q.q.SendSpread(ctx, payloads, start, window, opts...)
+}
+
+// CancelByTag 取消带有 tag 的所有消息
+func (q *MemoryQueue) CancelByTag(ctx context.Context, tag string) (int, error) {
+	return q.q.CancelByTag(ctx, tag)
+}
+
+// StartConsume 创建一个协程消费消息，使用 `<-done` 等待消费者退出
+func (q *MemoryQueue) StartConsume() (done <-chan struct{}) {
+	return q.q.StartConsume()
+}
+
+// StopConsume 停止消费者协程，可以重复调用
+func (q *MemoryQueue) StopConsume() {
+	q.q.StopConsume()
+}
+
+// ProcessOnce 执行一次消费周期，返回本次消费周期内各阶段之间流转的消息数量
+func (q *MemoryQueue) ProcessOnce() (FlowStats, error) {
+	return q.q.ProcessOnce()
+}
+
+// Pause 暂停消息投递
+func (q *MemoryQueue) Pause() {
+	q.q.Pause()
+}
+
+// Resume 恢复消息投递
+func (q *MemoryQueue) Resume() {
+	q.q.Resume()
+}
+
+// Stats 获取队列中各阶段的消息数量
+func (q *MemoryQueue) Stats(ctx context.Context) (*QueueStats, error) {
+	return q.q.Stats(ctx)
+}
+
+// GetMessage 查询消息的内容及当前所处的阶段
+func (q *MemoryQueue) GetMessage(ctx context.Context, idStr string) (*MessageInfo, error) {
+	return q.q.GetMessage(ctx, idStr)
+}
+
+// Cancel 取消消息，消息不存在时返回 ErrMessageNotFound
+func (q *MemoryQueue) Cancel(ctx context.Context, idStr string) error {
+	return q.q.Cancel(ctx, idStr)
+}
+
+// ListDead 按进入死信队列的时间分页遍历死信消息，cursor 的用法与 DelayQueue.ListDead 相同
+func (q *MemoryQueue) ListDead(ctx context.Context, cursor string, count int64) ([]*DeadMessage, string, error) {
+	return q.q.ListDead(ctx, cursor, count)
+}
+
+// RequeueDead 将死信消息重新投递，并重置重试次数，不指定消息ID时重新投递所有死信消息
+func (q *MemoryQueue) RequeueDead(ctx context.Context, ids ...string) (int, error) {
+	return q.q.RequeueDead(ctx, ids...)
+}
@@ -0,0 +1,170 @@
+package delayqueue
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryQueue_consume(t *testing.T) {
+	size := 10
+	retryCount := 2
+	deliveryCount := make(map[string]int)
+	queue := NewMemoryQueue("test", func(s string) bool {
+		deliveryCount[s]++
+		i, _ := strconv.Atoi(s)
+		return i%2 == 0
+	}).WithDeadLetter(time.Hour).WithMaxConsumeDuration(0)
+	ctx := context.Background()
+	for i := 0; i < size; i++ {
+		err := queue.SendDelayMsg(strconv.Itoa(i), 0, WithRetryCount(retryCount))
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	pending, err := queue.SendDelayMsgV2("pending", time.Hour)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for i := 0; i < 5; i++ {
+		if err := queue.q.consume(); err != nil {
+			t.Errorf("consume error: %v", err)
+			return
+		}
+	}
+	for k, v := range deliveryCount {
+		i, _ := strconv.Atoi(k)
+		if i%2 == 0 && v != 1 {
+			t.Errorf("expect 1 delivery of msg %s, actual %d", k, v)
+		}
+		if i%2 == 1 && v != retryCount+1 {
+			t.Errorf("expect %d deliveries of msg %s, actual %d", retryCount+1, k, v)
+		}
+	}
+	stats, _ := queue.Stats(ctx)
+	if *stats != (QueueStats{Pending: 1, Dead: int64(size / 2)}) {
+		t.Errorf("unexpected stats: %+v", *stats)
+	}
+	dead, next, err := queue.ListDead(ctx, "", 3)
+	if err != nil || len(dead) != 3 || next == "" {
+		t.Errorf("unexpected first page: %d, %q, %v", len(dead), next, err)
+		return
+	}
+	if dead[0].LastError != "negative ack" {
+		t.Errorf("unexpected last error: %s", dead[0].LastError)
+	}
+	dead, next, err = queue.ListDead(ctx, next, 3)
+	if err != nil || len(dead) != 2 || next != "" {
+		t.Errorf("unexpected last page: %d, %q, %v", len(dead), next, err)
+	}
+	n, _ := queue.RequeueDead(ctx)
+	if n != size/2 {
+		t.Errorf("expect %d requeued messages, actual %d", size/2, n)
+	}
+	info, err := queue.GetMessage(ctx, pending.ID)
+	if err != nil || info.State != StagePending || info.Payload != "pending" {
+		t.Errorf("unexpected message: %+v, err: %v", info, err)
+	}
+	if err := queue.Cancel(ctx, pending.ID); err != nil {
+		t.Error(err)
+	}
+	if _, err := queue.GetMessage(ctx, pending.ID); err != ErrMessageNotFound {
+		t.Errorf("canceled message should not be found")
+	}
+}
+
+func TestMemoryQueue_StopConsume(t *testing.T) {
+	size := 10
+	received := 0
+	var queue *MemoryQueue
+	queue = NewMemoryQueue("test", func(s string) bool {
+		received++
+		if received == size {
+			queue.StopConsume()
+		}
+		return true
+	}).WithFetchInterval(time.Millisecond)
+	for i := 0; i < size; i++ {
+		err := queue.SendDelayMsg(strconv.Itoa(i), 0)
+		if err != nil {
+			t.Errorf("send message failed: %v", err)
+		}
+	}
+	done := queue.StartConsume()
+	<-done
+}
+
+// failingBroker Pending2Ready 总是返回错误的 Broker
+type failingBroker struct {
+	*memoryBroker
+}
+
+func (b failingBroker) Pending2Ready(ctx context.Context, now time.Time) (int64, error) {
+	return 0, errors.New("pending2Ready failed")
+}
+
+func TestDelayQueue_ConsumeContinueOnError(t *testing.T) {
+	broker := newMemoryBroker()
+	broker.msgs["1"] = &memoryMessage{payload: "hello", expireAt: time.Now().Add(time.Hour), retryCount: 1}
+	broker.retry = append(broker.retry, "1")
+	acked := 0
+	queue := NewDelayQueueWithBroker("test", failingBroker{broker}, func(s string) bool {
+		acked++
+		return true
+	})
+	flow, err := queue.ProcessOnce()
+	if err == nil || err.Error() != "pending2Ready failed" {
+		t.Errorf("expect error of pending2Ready, actual: %v", err)
+	}
+	if acked != 1 || flow.Retry2Unack != 1 || flow.Unack2Ack != 1 {
+		t.Errorf("expect remaining phases executed, acked: %d, flow: %+v", acked, flow)
+	}
+}
+
+func TestDelayQueue_BrokerUnsupported(t *testing.T) {
+	ctx := context.Background()
+	queue := NewDelayQueueWithBroker("test", NewMemoryBroker(), func(string) bool { return true })
+	redisQueue := NewDelayQueue("test", newTestRedis(t), func(string) bool { return true })
+	calls := map[string]func() error{
+		"Purge":       func() error { return queue.Purge(ctx) },
+		"DeleteQueue": func() error { return queue.DeleteQueue(ctx, true) },
+		"Destroy":     func() error { return queue.Destroy(ctx) },
+		"PeekPending": func() error { _, err := queue.PeekPending(ctx, 1); return err },
+		"PeekReady":   func() error { _, err := queue.PeekReady(ctx, 1); return err },
+		"List":        func() error { _, _, err := queue.List(ctx, StagePending, "", 1); return err },
+		"ListByTag":   func() error { _, _, err := queue.ListByTag(ctx, "tag", "", 1); return err },
+		"CountByTag":  func() error { _, err := queue.CountByTag(ctx, "tag"); return err },
+		"Verify":      func() error { _, err := queue.Verify(ctx); return err },
+		"Export":      func() error { _, err := queue.Export(ctx, &bytes.Buffer{}); return err },
+		"Import":      func() error { _, err := queue.Import(ctx, strings.NewReader("")); return err },
+		"Repair":      func() error { _, err := queue.Repair(ctx); return err },
+		"GetHistory":  func() error { _, err := queue.GetHistory(ctx, "1"); return err },
+		"GetArchived": func() error { _, err := queue.GetArchived(ctx, "1"); return err },
+		"ListFailed":  func() error { _, err := queue.ListFailed(ctx, time.Time{}, time.Now(), 1); return err },
+		"Replay":      func() error { _, err := queue.Replay(ctx, "1"); return err },
+		"RemoveGroup": func() error { return queue.RemoveGroup(ctx, "group") },
+		"ConsumerStats": func() error {
+			_, err := queue.ConsumerStats(ctx)
+			return err
+		},
+		"MigrateFrom": func() error { _, err := Migrate(ctx, queue, redisQueue); return err },
+		"MigrateTo":   func() error { _, err := Migrate(ctx, redisQueue, queue); return err },
+	}
+	for name, call := range calls {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("%s panicked: %v", name, r)
+				}
+			}()
+			if err := call(); !errors.Is(err, ErrUnsupported) {
+				t.Errorf("%s: expect ErrUnsupported, actual %v", name, err)
+			}
+		}()
+	}
+}
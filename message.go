@@ -0,0 +1,161 @@
+package delayqueue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrMessageNotFound 消息不存在，可能已被确认、取消或已过期
+var ErrMessageNotFound = errors.New("message not found")
+
+// MessageInfo 消息信息
+type MessageInfo struct {
+	ID      string `json:"id"`
+	Payload string `json:"payload"`
+	// State 消息当前所处的阶段，StagePending、StageReady 等
+	State string `json:"state"`
+	// Time 与阶段相关的时间：pending 为投递时间，unack 为处理超时时间，dead 为进入死信队列的时间
+	Time time.Time `json:"time,omitempty"`
+	// RetryCount 剩余重试次数
+	RetryCount int64 `json:"retryCount"`
+	// Tags 发送时通过 WithTags 设置的标签，GetMessage 等查询方法不返回
+	Tags []string `json:"tags,omitempty"`
+	// Headers 发送时通过 WithHeader 设置的 header
+	Headers map[string]string `json:"headers,omitempty"`
+	// Owner 正在处理消息的消费者，仅 unack 阶段的消息有效
+	Owner *Owner `json:"owner,omitempty"`
+	// History 投递历史，最多保留最近 20 条，仅 GetMessage 返回
+	History []*HistoryRecord `json:"history,omitempty"`
+}
+
+// GetMessage 查询消息的内容及当前所处的阶段
+func (q *DelayQueue) GetMessage(ctx context.Context, idStr string) (*MessageInfo, error) {
+	msg, err := q.broker.Get(ctx, idStr)
+	if err != nil {
+		return nil, err
+	}
+	return msg, q.fillOwners(ctx, []*MessageInfo{msg})
+}
+
+func (b *redisBroker) Get(ctx context.Context, idStr string) (*MessageInfo, error) {
+	q := b.q
+	shard := q.shardOf(idStr)
+	pipe := q.redisCli.Pipeline()
+	cmds := q.readMsg(ctx, pipe, idStr)
+	pending := pipe.ZScore(ctx, q.shardKey(q.pendingKey, shard), idStr)
+	ready := pipe.LPos(ctx, q.shardKey(q.readyKey, shard), idStr, redis.LPosArgs{})
+	unack := pipe.ZScore(ctx, q.unAckKey, idStr)
+	retry := pipe.LPos(ctx, q.retryKey, idStr, redis.LPosArgs{})
+	garbage := pipe.SIsMember(ctx, q.garbageKey, idStr)
+	dead := pipe.ZScore(ctx, q.deadKey, idStr)
+	history := pipe.LRange(ctx, q.genHistoryKey(idStr), 0, -1)
+	var streamed *redis.BoolCmd
+	if q.streams {
+		streamed = pipe.HExists(ctx, q.streamIndexKey(), idStr)
+	}
+	_, err := pipe.Exec(ctx)
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("get message failed: %v", err)
+	}
+	info := &MessageInfo{ID: idStr}
+	if stored, err := cmds.result(); err == nil {
+		info.Payload = stored.payload
+		info.RetryCount = stored.retryCount
+		info.Headers = stored.headers
+	}
+	for _, item := range history.Val() {
+		record := &HistoryRecord{}
+		if err := json.Unmarshal([]byte(item), record); err == nil {
+			info.History = append(info.History, record)
+		}
+	}
+	switch {
+	case pending.Err() == nil:
+		info.State = StagePending
+		info.Time = time.Unix(int64(pending.Val()), 0)
+	case ready.Err() == nil, streamed != nil && streamed.Val():
+		info.State = StageReady
+	case unack.Err() == nil:
+		info.State = StageUnack
+		info.Time = time.Unix(int64(unack.Val()), 0)
+	case retry.Err() == nil:
+		info.State = StageRetry
+	case garbage.Val():
+		info.State = StageGarbage
+	case dead.Err() == nil:
+		info.State = StageDead
+		info.Time = time.Unix(int64(dead.Val()), 0)
+	default:
+		return nil, ErrMessageNotFound
+	}
+	return info, nil
+}
+
+// cancelScript 从所有阶段中移除消息，并删除消息内容、header 和重试次数
+// KEYS: pendingKey, readyKey, unackKey, retryKey, retryCountKey, garbageKey, deadKey, msgKey, historyKey, attemptKey, headersKey, ownerKey, streamIndexKey
+// ready stream 中的 entry 在被取出时删除
+// ARGV: 消息ID
+// 返回消息是否存在
+const cancelScript = msgFieldScript + `
+local found = 0
+found = found + redis.call('ZRem', KEYS[1], ARGV[1])
+found = found + redis.call('LRem', KEYS[2], 0, ARGV[1])
+found = found + redis.call('ZRem', KEYS[3], ARGV[1])
+found = found + redis.call('LRem', KEYS[4], 0, ARGV[1])
+delField(KEYS[5], ARGV[1], 'retry')
+found = found + redis.call('SRem', KEYS[6], ARGV[1])
+found = found + redis.call('ZRem', KEYS[7], ARGV[1])
+found = found + redis.call('HDel', KEYS[13], ARGV[1])
+redis.call('Del', KEYS[8], KEYS[9], KEYS[11], KEYS[12])
+delField(KEYS[10], ARGV[1], 'attempt')
+return found
+`
+
+// Cancel 取消消息，消息不存在时返回 ErrMessageNotFound
+// 正在被消费的消息也会被取消，正在处理该消息的 Handler 的 ctx 会被取消，Handler 返回后不再确认消息
+func (q *DelayQueue) Cancel(ctx context.Context, idStr string) error {
+	err := q.broker.Cancel(ctx, idStr)
+	if err != nil {
+		return err
+	}
+	q.audit(ctx, AuditCancel, idStr)
+	q.publishCancel(ctx, idStr)
+	return nil
+}
+
+// cancelKeys cancelScript 使用的 KEYS
+func (q *DelayQueue) cancelKeys(idStr string) []string {
+	shard := q.shardOf(idStr)
+	return []string{
+		q.shardKey(q.pendingKey, shard),
+		q.shardKey(q.readyKey, shard),
+		q.unAckKey,
+		q.retryKey,
+		q.retryCountKey,
+		q.garbageKey,
+		q.deadKey,
+		q.genMsgKey(idStr),
+		q.genHistoryKey(idStr),
+		q.attemptKey,
+		q.genHeadersKey(idStr),
+		q.genOwnerKey(idStr),
+		q.streamIndexKey(),
+	}
+}
+
+func (b *redisBroker) Cancel(ctx context.Context, idStr string) error {
+	q := b.q
+	found, err := q.eval(ctx, cancelScript, q.cancelKeys(idStr), idStr).Int()
+	if err != nil {
+		return fmt.Errorf("cancelScript failed: %v", err)
+	}
+	if found == 0 {
+		return ErrMessageNotFound
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package delayqueue
+
+import "time"
+
+// 队列上报的指标名称
+const (
+	MetricSent            = "sent"             // 发送的消息数量
+	MetricDelivered       = "delivered"        // 投递给 Handler 的消息数量
+	MetricAcked           = "acked"            // 确认的消息数量
+	MetricNacked          = "nacked"           // 消费失败的消息数量
+	MetricRetried         = "retried"          // 进入重试队列的消息数量
+	MetricDead            = "dead"             // 达到重试上限或超过最晚投递时间的消息数量
+	MetricConsumeErrors   = "consume_errors"   // 消费过程中发生的错误数量
+	MetricConsumeDuration = "consume_duration" // Handler 的处理耗时
+	MetricDeliveryLatency = "delivery_latency" // 首次投递距离投递时间的延迟，需要生产者启用 WithLatencyTracking
+)
+
+// Metrics 指标上报接口，tags 为交替出现的标签名和标签值，队列上报的指标均带有 "queue" 标签
+// 包内提供了 StatsD 的实现，其它监控系统只需实现这两个方法即可接入
+type Metrics interface {
+	// IncCounter 计数器增加 delta
+	IncCounter(name string, delta int64, tags ...string)
+	// ObserveDuration 记录一次耗时
+	ObserveDuration(name string, d time.Duration, tags ...string)
+}
+
+// WithMetrics 配置指标上报，指标在消费协程和发送消息的协程中同步上报，实现不应阻塞
+func (q *DelayQueue) WithMetrics(metrics Metrics) *DelayQueue {
+	if q.frozen("WithMetrics") {
+		return q
+	}
+	q.metrics = metrics
+	return q
+}
+
+func (q *DelayQueue) incCounter(name string, delta int64) {
+	if q.metrics == nil || delta == 0 {
+		return
+	}
+	q.metrics.IncCounter(name, delta, "queue", q.name)
+}
+
+func (q *DelayQueue) observeDuration(name string, d time.Duration) {
+	if q.metrics == nil {
+		return
+	}
+	q.metrics.ObserveDuration(name, d, "queue", q.name)
+}
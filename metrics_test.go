@@ -0,0 +1,97 @@
+package delayqueue
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordMetrics struct {
+	mu       sync.Mutex
+	counters map[string]int64
+}
+
+func (m *recordMetrics) IncCounter(name string, delta int64, tags ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[name] += delta
+}
+
+func (m *recordMetrics) ObserveDuration(name string, d time.Duration, tags ...string) {
+	m.IncCounter(name, 1, tags...)
+}
+
+func TestDelayQueue_Metrics(t *testing.T) {
+	redisCli := newTestRedis(t)
+	metrics := &recordMetrics{counters: make(map[string]int64)}
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return s == "ok"
+	}).WithDefaultRetryCount(1).WithMetrics(metrics).WithLatencyTracking()
+	for _, payload := range []string{"ok", "fail"} {
+		if err := queue.SendDelayMsg(payload, 0); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := queue.ProcessOnce(); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	expect := map[string]int64{
+		MetricSent:            2,
+		MetricDelivered:       3,
+		MetricAcked:           1,
+		MetricNacked:          2,
+		MetricRetried:         1,
+		MetricDead:            1,
+		MetricConsumeDuration: 3,
+		MetricDeliveryLatency: 2,
+	}
+	for name, n := range expect {
+		if metrics.counters[name] != n {
+			t.Errorf("expect %s %d, actual %d", name, n, metrics.counters[name])
+		}
+	}
+}
+
+func TestStatsDMetrics(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer conn.Close()
+	read := func() string {
+		buf := make([]byte, 512)
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Error(err)
+		}
+		return string(buf[:n])
+	}
+	metrics, err := NewStatsDMetrics(conn.LocalAddr().String(), "app")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer metrics.Close()
+	metrics.IncCounter(MetricSent, 2, "queue", "mail:daily")
+	metrics.ObserveDuration(MetricConsumeDuration, 1500*time.Millisecond, "queue", "orders")
+	metrics.WithDogStatsDTags().IncCounter(MetricAcked, 1, "queue", "orders")
+	actual := []string{read(), read(), read()}
+	sort.Strings(actual)
+	expect := []string{
+		"app.acked:1|c|#queue:orders",
+		"app.mail_daily.sent:2|c",
+		"app.orders.consume_duration:1500|ms",
+	}
+	if strings.Join(actual, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("unexpected packets: %v", actual)
+	}
+}
@@ -0,0 +1,15 @@
+package delayqueue
+
+// Use 注册消费消息的中间件，用于日志、指标、鉴权、消息校验等通用逻辑
+// 中间件按注册顺序从外到内包装 Handler，即先注册的中间件先执行；中间件中的 panic 与 Handler 一样会被恢复并视为消费失败
+func (q *DelayQueue) Use(middleware ...func(Handler) Handler) *DelayQueue {
+	if q.frozen("Use") {
+		return q
+	}
+	q.middlewares = append(q.middlewares, middleware...)
+	q.chained = q.handler
+	for i := len(q.middlewares) - 1; i >= 0; i-- {
+		q.chained = q.middlewares[i](q.chained)
+	}
+	return q
+}
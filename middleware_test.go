@@ -0,0 +1,85 @@
+package delayqueue
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDelayQueue_Use(t *testing.T) {
+	redisCli := newTestRedis(t)
+	var calls []string
+	trace := func(name string) func(Handler) Handler {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, msg *Message) error {
+				calls = append(calls, name+":before")
+				err := next(ctx, msg)
+				calls = append(calls, name+":after")
+				return err
+			}
+		}
+	}
+	validate := func(next Handler) Handler {
+		return func(ctx context.Context, msg *Message) error {
+			if msg.Payload == "" {
+				return errors.New("empty payload")
+			}
+			return next(ctx, msg)
+		}
+	}
+	queue := NewDelayQueueWithHandler("test", redisCli, func(ctx context.Context, msg *Message) error {
+		calls = append(calls, "handler:"+msg.Payload)
+		return nil
+	}).Use(trace("outer"), trace("inner")).Use(validate).WithDefaultRetryCount(0)
+	for _, payload := range []string{"foo", ""} {
+		if err := queue.SendDelayMsg(payload, 0); err != nil {
+			t.Error(err)
+			return
+		}
+		if _, err := queue.ProcessOnce(); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	expect := []string{
+		"outer:before", "inner:before", "handler:foo", "inner:after", "outer:after",
+		"outer:before", "inner:before", "inner:after", "outer:after",
+	}
+	if !reflect.DeepEqual(calls, expect) {
+		t.Errorf("unexpected calls: %v", calls)
+	}
+}
+
+func TestDelayQueue_UseRecover(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	called := false
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		called = true
+		return true
+	}).Use(func(next Handler) Handler {
+		return func(ctx context.Context, msg *Message) error {
+			panic("boom")
+		}
+	})
+	if err := queue.SendDelayMsg("foo", 0); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	if called {
+		t.Error("handler should not be called")
+	}
+	stats, err := queue.Stats(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if stats.Unack != 1 {
+		t.Errorf("panicked message should be nacked, stats %+v", stats)
+	}
+}
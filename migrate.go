@@ -0,0 +1,88 @@
+package delayqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Migrate 将 src 中的所有消息移动到 dst，保留消息所处的阶段、投递时间、重试次数、header 及投递历史，返回移动的消息数量
+// src 和 dst 可以是同一 Redis 中不同名称的队列，也可以位于不同的 Redis 实例，分片数可以不同
+// 消息完整写入 dst 后才会从 src 中删除，中断后可以重新执行；dst 中已存在的消息不会被覆盖，
+// 其内容或 header 与 src 不一致时返回错误并保留 src 中的消息
+// 迁移期间应停止 src 的消费者，否则正在处理的消息可能被重复投递
+func Migrate(ctx context.Context, src, dst *DelayQueue) (int, error) {
+	if err := src.requireRedis("Migrate"); err != nil {
+		return 0, err
+	}
+	if err := dst.requireRedis("Migrate"); err != nil {
+		return 0, err
+	}
+	if src.redisCli == dst.redisCli && src.name == dst.name {
+		return 0, errors.New("cannot migrate a queue to itself")
+	}
+	if dst.deleted.Load() {
+		return 0, ErrQueueDeleted
+	}
+	snapshot, err := src.snapshot(ctx)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, key := range src.stageKeys() {
+		entries := snapshot.entries[key]
+		for start := 0; start < len(entries); start += exportBatch {
+			end := start + exportBatch
+			if end > len(entries) {
+				end = len(entries)
+			}
+			records, err := src.exportRecords(ctx, snapshot.stages[key], entries[start:end])
+			if err != nil {
+				return count, err
+			}
+			for _, record := range records {
+				imported, err := dst.importRecord(ctx, record)
+				if err != nil {
+					return count, err
+				}
+				if !imported {
+					// dst 中已存在该消息（例如上次迁移中断前已写入），确认内容一致后才能删除 src 中的消息
+					if err := dst.checkImported(ctx, record); err != nil {
+						return count, err
+					}
+				}
+				err = src.Cancel(ctx, record.ID)
+				if err != nil && err != ErrMessageNotFound {
+					return count, err
+				}
+				count++
+			}
+		}
+	}
+	src.logger.Info("queue migrated", "queue", src.name, "to", dst.name, "messages", count)
+	return count, nil
+}
+
+// checkImported 检查 dst 中已存在的消息与导出的消息内容及 header 是否一致
+func (q *DelayQueue) checkImported(ctx context.Context, record *exportRecord) error {
+	info, err := q.GetMessage(ctx, record.ID)
+	if err != nil {
+		return fmt.Errorf("check msg %s in %s failed: %v", record.ID, q.name, err)
+	}
+	if info.Payload != record.Payload || !sameHeaders(info.Headers, record.Headers) {
+		return fmt.Errorf("msg %s already exists in %s with different content", record.ID, q.name)
+	}
+	return nil
+}
+
+func sameHeaders(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,95 @@
+package delayqueue
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestMigrate(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	cb := func(s string) bool {
+		return true
+	}
+	src := NewDelayQueue("src", redisCli, cb)
+	dst := NewDelayQueue("dst", redisCli, cb).WithShards(3)
+	var msgs []*MessageInfo
+	for i := 0; i < 5; i++ {
+		msg, err := src.SendDelayMsgV2("payload", time.Duration(i)*time.Hour, WithRetryCount(i), WithHeader("index", strconv.Itoa(i)))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		msgs = append(msgs, msg)
+	}
+	if _, err := src.pending2Ready(); err != nil {
+		t.Error(err)
+		return
+	}
+	before := make(map[string]*MessageInfo)
+	for _, msg := range msgs {
+		info, err := src.GetMessage(ctx, msg.ID)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		before[msg.ID] = info
+	}
+
+	n, err := Migrate(ctx, src, dst)
+	if err != nil || n != len(msgs) {
+		t.Errorf("expect %d migrated messages, actual %d, err: %v", len(msgs), n, err)
+		return
+	}
+	for id, info := range before {
+		if _, err := src.GetMessage(ctx, id); err != ErrMessageNotFound {
+			t.Errorf("msg %s should be removed from src", id)
+		}
+		migrated, err := dst.GetMessage(ctx, id)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if migrated.State != info.State || !migrated.Time.Equal(info.Time) || migrated.RetryCount != info.RetryCount ||
+			!reflect.DeepEqual(migrated.Headers, info.Headers) {
+			t.Errorf("expect %+v, actual %+v", info, migrated)
+		}
+	}
+	stats, err := src.Stats(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if *stats != (QueueStats{}) {
+		t.Errorf("src should be empty: %+v", *stats)
+	}
+}
+
+func TestMigrate_Conflict(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	cb := func(s string) bool {
+		return true
+	}
+	src := NewDelayQueue("src", redisCli, cb)
+	dst := NewDelayQueue("dst", redisCli, cb)
+	msg, err := src.SendDelayMsgV2("payload", time.Hour)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// dst 中已存在内容不同的同ID消息
+	redisCli.Set(ctx, dst.genMsgKey(msg.ID), "other", time.Hour)
+	redisCli.ZAdd(ctx, dst.pendingKey, &redis.Z{Score: float64(time.Now().Add(time.Hour).Unix()), Member: msg.ID})
+	if _, err := Migrate(ctx, src, dst); err == nil {
+		t.Error("expect error when dst has a different msg with the same id")
+	}
+	if _, err := src.GetMessage(ctx, msg.ID); err != nil {
+		t.Errorf("msg should be kept in src: %v", err)
+	}
+}
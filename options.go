@@ -0,0 +1,178 @@
+package delayqueue
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Options NewDelayQueueWithOptions 使用的配置，零值表示使用默认值
+type Options struct {
+	// FetchInterval 拉取消息的时间间隔，默认为 1 秒
+	FetchInterval time.Duration
+	// MaxConsumeDuration 消息的处理超时时间，默认为 5 秒
+	MaxConsumeDuration time.Duration
+	// FetchLimit 单次拉取消息的数量，默认为 0 表示不限制
+	FetchLimit uint
+	// Concurrent 并发数，默认为 1
+	Concurrent uint
+	// DefaultRetryCount 最大重试次数，默认为 3，-1 表示不重试
+	DefaultRetryCount int
+	// MsgTTL 消息内容在投递时间之后的保留时间，默认为 1 小时
+	MsgTTL time.Duration
+	// Shards pending 和 ready 的分片数，默认为 1
+	Shards uint
+	// DeadLetterTTL 死信消息的保留时间，默认为 0 表示不启用死信队列
+	DeadLetterTTL time.Duration
+	// MaxBackoff redis 暂时不可用时消费周期的最大退避时间，默认为 30 秒
+	MaxBackoff time.Duration
+	// ResultTTL 处理结果的保留时间，默认为 1 小时
+	ResultTTL time.Duration
+	// StatusTTL 消息状态的保留时间，默认为 0 表示不跟踪消息状态
+	StatusTTL time.Duration
+	// MaxLength pending 与 ready 中消息数量的上限，默认为 0 表示不限制
+	MaxLength uint
+	// OverflowPolicy 消息数量达到 MaxLength 时的处理方式，默认为 OverflowReject
+	OverflowPolicy OverflowPolicy
+	// Role 实例在消费周期中的角色，默认为 RoleAll
+	Role Role
+	// Group 消费组名称，默认不使用消费组
+	Group string
+	// KeyPrefix key 前缀，默认为 "dp:"
+	KeyPrefix string
+	// IDGenerator 消息 ID 的生成方式，默认使用随机的 UUIDv4
+	IDGenerator IDGenerator
+	// Metrics 指标上报，默认不上报
+	Metrics Metrics
+	// Logger 日志，默认输出到 log.Default()
+	Logger Logger
+	// ErrorHandler 消费过程中发生错误时的回调函数
+	ErrorHandler func(error)
+}
+
+// validate 检查配置是否合法
+func (o *Options) validate() error {
+	durations := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"FetchInterval", o.FetchInterval},
+		{"MaxConsumeDuration", o.MaxConsumeDuration},
+		{"MsgTTL", o.MsgTTL},
+		{"DeadLetterTTL", o.DeadLetterTTL},
+		{"MaxBackoff", o.MaxBackoff},
+		{"ResultTTL", o.ResultTTL},
+		{"StatusTTL", o.StatusTTL},
+	}
+	for _, d := range durations {
+		if d.d < 0 {
+			return fmt.Errorf("invalid options: %s must not be negative", d.name)
+		}
+	}
+	if o.DefaultRetryCount < -1 {
+		return errors.New("invalid options: DefaultRetryCount must be -1 or non-negative")
+	}
+	if o.MaxBackoff > 0 && o.FetchInterval > o.MaxBackoff {
+		return errors.New("invalid options: FetchInterval must not exceed MaxBackoff")
+	}
+	return nil
+}
+
+// NewDelayQueueWithOptions 使用 Handler 和 Options 创建新的Queue，参数不合法时返回 error 而不是 panic
+// 之后调用的 With* 方法出现配置错误时同样不会 panic，错误由 ConfigErr、发送消息及 StartConsume 报告
+// 队列的配置在 StartConsume 之后不可修改，之后调用的 With* 方法会被忽略
+func NewDelayQueueWithOptions(name string, redisCli *redis.Client, handler Handler, opts Options) (*DelayQueue, error) {
+	if name == "" {
+		return nil, errors.New("name is required")
+	}
+	if redisCli == nil {
+		return nil, errors.New("redis client is required")
+	}
+	if handler == nil {
+		return nil, errors.New("handler is required")
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	q := newDelayQueue(name, redisCli)
+	q.handler = handler
+	if opts.KeyPrefix != "" {
+		q.WithKeyPrefix(opts.KeyPrefix)
+	}
+	if opts.FetchInterval > 0 {
+		q.fetchInterval = opts.FetchInterval
+	}
+	if opts.MaxConsumeDuration > 0 {
+		q.maxConsumeDuration = opts.MaxConsumeDuration
+	}
+	q.fetchLimit = opts.FetchLimit
+	if opts.Concurrent > 0 {
+		q.concurrent = opts.Concurrent
+	}
+	switch {
+	case opts.DefaultRetryCount == -1:
+		q.defaultRetryCount = 0
+	case opts.DefaultRetryCount > 0:
+		q.defaultRetryCount = uint(opts.DefaultRetryCount)
+	}
+	if opts.MsgTTL > 0 {
+		q.msgTTL = opts.MsgTTL
+	}
+	if opts.Shards > 0 {
+		q.shards = opts.Shards
+	}
+	q.deadLetterTTL = opts.DeadLetterTTL
+	if opts.MaxBackoff > 0 {
+		q.maxBackoff = opts.MaxBackoff
+	}
+	if opts.ResultTTL > 0 {
+		q.resultTTL = opts.ResultTTL
+	}
+	q.statusTTL = opts.StatusTTL
+	q.maxLength = opts.MaxLength
+	q.overflowPolicy = opts.OverflowPolicy
+	q.role = opts.Role
+	if opts.Group != "" {
+		q.WithGroup(opts.Group)
+	}
+	if opts.IDGenerator != nil {
+		q.idGenerator = opts.IDGenerator
+	}
+	if opts.Logger != nil {
+		q.logger = opts.Logger
+	}
+	q.errorHandler = opts.ErrorHandler
+	q.metrics = opts.Metrics
+	if q.configErr != nil {
+		return nil, q.configErr
+	}
+	return q, nil
+}
+
+// ErrInvalidOption With* 方法的参数不合法、与其它配置冲突或缺少依赖的 redis
+var ErrInvalidOption = errors.New("invalid option")
+
+// invalidOption 记录配置错误，该配置不会生效；NewDelayQueueWithOptions、发送消息、ProcessOnce 和 StartConsume 会返回或报告该错误
+// 只保留第一个错误
+func (q *DelayQueue) invalidOption(option string, reason string) {
+	q.logger.Error("invalid option", "queue", q.name, "option", option, "error", reason)
+	if q.configErr == nil {
+		q.configErr = fmt.Errorf("%w: %s: %s", ErrInvalidOption, option, reason)
+	}
+}
+
+// ConfigErr 返回 With* 方法记录的第一个配置错误，没有错误时返回 nil
+func (q *DelayQueue) ConfigErr() error {
+	return q.configErr
+}
+
+// frozen 消费协程启动后配置不可修改，修改会被忽略并输出日志
+func (q *DelayQueue) frozen(option string) bool {
+	if !q.started.Load() {
+		return false
+	}
+	q.logger.Warn("option ignored after StartConsume", "queue", q.name, "option", option)
+	return true
+}
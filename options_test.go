@@ -0,0 +1,106 @@
+package delayqueue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestNewDelayQueueWithOptions(t *testing.T) {
+	redisCli := redis.NewClient(&redis.Options{
+		Addr: "127.0.0.1:6379",
+	})
+	handler := func(ctx context.Context, msg *Message) error { return nil }
+	invalid := []struct {
+		name    string
+		cli     *redis.Client
+		handler Handler
+		opts    Options
+	}{
+		{"", redisCli, handler, Options{}},
+		{"test", nil, handler, Options{}},
+		{"test", redisCli, nil, Options{}},
+		{"test", redisCli, handler, Options{MaxConsumeDuration: -time.Second}},
+		{"test", redisCli, handler, Options{DefaultRetryCount: -2}},
+		{"test", redisCli, handler, Options{FetchInterval: time.Minute, MaxBackoff: time.Second}},
+	}
+	for i, c := range invalid {
+		if _, err := NewDelayQueueWithOptions(c.name, c.cli, c.handler, c.opts); err == nil {
+			t.Errorf("case %d: expect error", i)
+		}
+	}
+
+	queue, err := NewDelayQueueWithOptions("test", redisCli, handler, Options{
+		FetchInterval:     50 * time.Millisecond,
+		Concurrent:        4,
+		DefaultRetryCount: -1,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if queue.fetchInterval != 50*time.Millisecond || queue.concurrent != 4 || queue.defaultRetryCount != 0 {
+		t.Errorf("options not applied: %v %v %v", queue.fetchInterval, queue.concurrent, queue.defaultRetryCount)
+	}
+	if queue.maxConsumeDuration != 5*time.Second || queue.msgTTL != time.Hour {
+		t.Error("expect defaults for unset options")
+	}
+	done := queue.StartConsume()
+	queue.WithConcurrent(8)
+	queue.StopConsume()
+	<-done
+	if queue.concurrent != 4 {
+		t.Errorf("expect options immutable after start, concurrent: %d", queue.concurrent)
+	}
+}
+
+func TestDelayQueue_InvalidOption(t *testing.T) {
+	redisCli := newTestRedis(t)
+	handler := func(ctx context.Context, msg *Message) error { return nil }
+	if _, err := NewDelayQueueWithOptions("test", redisCli, handler, Options{Group: "a:b"}); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expect ErrInvalidOption for invalid group, actual %v", err)
+	}
+
+	var handled error
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	}).WithStreams().WithPartitions(2).WithErrorHandler(func(err error) {
+		handled = err
+	})
+	if !errors.Is(queue.ConfigErr(), ErrInvalidOption) || queue.partitions != nil {
+		t.Errorf("expect partitions rejected, err: %v", queue.ConfigErr())
+	}
+	if err := queue.SendDelayMsg("hello", 0); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expect send rejected, actual %v", err)
+	}
+	if _, err := queue.ProcessOnce(); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expect ProcessOnce rejected, actual %v", err)
+	}
+	select {
+	case <-queue.StartConsume():
+	case <-time.After(time.Second):
+		t.Error("expect consumer not started")
+	}
+	if !errors.Is(handled, ErrInvalidOption) {
+		t.Errorf("expect error reported to error handler, actual %v", handled)
+	}
+
+	// 使用自定义 Broker 的队列不支持依赖 redis 的配置
+	options := map[string]func(q *DelayQueue) *DelayQueue{
+		"WithGroup":       func(q *DelayQueue) *DelayQueue { return q.WithGroup("billing") },
+		"WithServerTime":  func(q *DelayQueue) *DelayQueue { return q.WithServerTime(time.Second) },
+		"WithHashStorage": func(q *DelayQueue) *DelayQueue { return q.WithHashStorage() },
+		"WithPartitions":  func(q *DelayQueue) *DelayQueue { return q.WithPartitions(2) },
+	}
+	for name, option := range options {
+		q := option(NewDelayQueueWithBroker("test", NewMemoryBroker(), func(s string) bool {
+			return true
+		}))
+		if !errors.Is(q.ConfigErr(), ErrInvalidOption) {
+			t.Errorf("%s: expect ErrInvalidOption, actual %v", name, q.ConfigErr())
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package delayqueue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Owner 正在处理消息的消费者
+type Owner struct {
+	Consumer string    `json:"consumer"` // 消费者ID，默认为 主机名-进程号
+	Since    time.Time `json:"since"`    // 开始处理的时间
+}
+
+// defaultConsumerID 返回默认的消费者ID，容器中主机名通常为 pod 名称
+func defaultConsumerID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "unknown"
+	}
+	return host + "-" + strconv.Itoa(os.Getpid())
+}
+
+// WithConsumerID 自定义消费者ID，默认为 主机名-进程号，用于记录正在处理消息的消费者
+func (q *DelayQueue) WithConsumerID(id string) *DelayQueue {
+	if q.frozen("WithConsumerID") {
+		return q
+	}
+	if id != "" {
+		q.consumerID = id
+	}
+	return q
+}
+
+// genOwnerKey string 存储正在处理消息的消费者
+func (q *DelayQueue) genOwnerKey(idStr string) string {
+	return q.genMsgKey(idStr) + ":owner"
+}
+
+// recordOwner 记录当前实例开始处理消息，保留到处理超时时间之后 msgTTL，确认后删除
+func (q *DelayQueue) recordOwner(ctx context.Context, idStr string, deadline time.Time) {
+	now := q.clock.Now()
+	err := q.broker.SetOwner(ctx, idStr, &Owner{Consumer: q.consumerID, Since: now}, deadline.Sub(now)+q.msgTTL)
+	if err != nil {
+		q.logger.Error("record owner failed", "queue", q.name, "id", idStr, "error", err)
+	}
+}
+
+// fillOwners 为处于 unack 阶段的消息填充正在处理的消费者
+func (q *DelayQueue) fillOwners(ctx context.Context, msgs []*MessageInfo) error {
+	var ids []string
+	for _, msg := range msgs {
+		if msg.State == StageUnack {
+			ids = append(ids, msg.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	owners, err := q.broker.Owners(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, msg := range msgs {
+		if msg.State == StageUnack {
+			msg.Owner = owners[msg.ID]
+		}
+	}
+	return nil
+}
+
+// ConsumerStats 统计每个消费者正在处理的消息数量，未记录消费者的消息计入空字符串
+func (q *DelayQueue) ConsumerStats(ctx context.Context) (map[string]int64, error) {
+	if err := q.requireRedis("ConsumerStats"); err != nil {
+		return nil, err
+	}
+	ids, err := q.redisCli.ZRange(ctx, q.unAckKey, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("get unack msgs failed: %v", err)
+	}
+	stats := make(map[string]int64)
+	if len(ids) == 0 {
+		return stats, nil
+	}
+	owners, err := q.broker.Owners(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, idStr := range ids {
+		consumer := ""
+		if owner := owners[idStr]; owner != nil {
+			consumer = owner.Consumer
+		}
+		stats[consumer]++
+	}
+	return stats, nil
+}
+
+func (b *redisBroker) SetOwner(ctx context.Context, idStr string, owner *Owner, ttl time.Duration) error {
+	q := b.q
+	data, err := json.Marshal(owner)
+	if err != nil {
+		return fmt.Errorf("marshal owner failed: %v", err)
+	}
+	err = q.redisCli.Set(ctx, q.genOwnerKey(idStr), data, ttl).Err()
+	if err != nil {
+		return fmt.Errorf("set owner failed: %v", err)
+	}
+	return nil
+}
+
+func (b *redisBroker) Owners(ctx context.Context, ids []string) (map[string]*Owner, error) {
+	q := b.q
+	keys := make([]string, 0, len(ids))
+	for _, idStr := range ids {
+		keys = append(keys, q.genOwnerKey(idStr))
+	}
+	values, err := q.redisCli.MGet(ctx, keys...).Result()
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("get owners failed: %v", err)
+	}
+	owners := make(map[string]*Owner, len(ids))
+	for i, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		owner := &Owner{}
+		if json.Unmarshal([]byte(s), owner) == nil {
+			owners[ids[i]] = owner
+		}
+	}
+	return owners, nil
+}
+
+func (b *memoryBroker) SetOwner(ctx context.Context, idStr string, owner *Owner, ttl time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if msg, ok := b.msgs[idStr]; ok {
+		msg.owner = owner
+	}
+	return nil
+}
+
+func (b *memoryBroker) Owners(ctx context.Context, ids []string) (map[string]*Owner, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	owners := make(map[string]*Owner, len(ids))
+	for _, idStr := range ids {
+		if msg, ok := b.msgs[idStr]; ok && msg.owner != nil {
+			owners[idStr] = msg.owner
+		}
+	}
+	return owners, nil
+}
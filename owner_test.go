@@ -0,0 +1,41 @@
+package delayqueue
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDelayQueue_Owner(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	var id string
+	var queue *DelayQueue
+	queue = NewDelayQueue("test", redisCli, func(s string) bool {
+		msg, err := queue.GetMessage(ctx, id)
+		if err != nil || msg.Owner == nil || msg.Owner.Consumer != "pod-1" || msg.Owner.Since.IsZero() {
+			t.Errorf("unexpected message: %+v, %v", msg, err)
+		}
+		msgs, _, err := queue.List(ctx, StageUnack, "", 10)
+		if err != nil || len(msgs) != 1 || msgs[0].Owner == nil || msgs[0].Owner.Consumer != "pod-1" {
+			t.Errorf("unexpected list: %+v, %v", msgs, err)
+		}
+		stats, err := queue.ConsumerStats(ctx)
+		if err != nil || len(stats) != 1 || stats["pod-1"] != 1 {
+			t.Errorf("unexpected consumer stats: %v, %v", stats, err)
+		}
+		return true
+	}).WithConsumerID("pod-1")
+	msg, err := queue.SendDelayMsgV2("msg", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	id = msg.ID
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	if n := redisCli.Exists(ctx, queue.genOwnerKey(id)).Val(); n != 0 {
+		t.Error("expect owner deleted after ack")
+	}
+}
@@ -0,0 +1,290 @@
+package delayqueue
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// WithPartitions 启用分区模式，将队列拆分为 n 个分区（即 n 个 pending 和 ready 分片），
+// 使用 WithPartitionKey 发送的消息按分区 key 散列到分区，相同 key 的消息总是在同一个分区中
+// 消费者通过 redis 协调，每个分区同一时间只属于一个消费者，分区在存活的消费者之间平均分配，消费者加入或退出后自动重新分配；
+// 消费者按顺序逐条处理每个分区中的消息，处理失败的消息放回所在分区的头部重试，因此相同 key 的消息按投递时间顺序处理，
+// 投递时间精确到秒，同一秒内投递的消息之间不保证顺序
+// 分区的租约时间为 3 个拉取间隔加上处理超时时间，消费者崩溃后其分区在租约过期后由其它消费者接管
+// 同一队列的生产者和消费者必须使用相同的分区数，不能与 WithShards、WithStreams 同时使用，仅支持 redis
+func (q *DelayQueue) WithPartitions(n uint) *DelayQueue {
+	if q.frozen("WithPartitions") {
+		return q
+	}
+	if q.redisCli == nil {
+		q.invalidOption("WithPartitions", "partitions require redis")
+		return q
+	}
+	if q.streams {
+		q.invalidOption("WithPartitions", "partitions can not be used with streams")
+		return q
+	}
+	if q.compat {
+		q.invalidOption("WithPartitions", "partitions can not be used with upstream compat")
+		return q
+	}
+	if n == 0 {
+		return q
+	}
+	q.shards = n
+	q.partitions = &partitionState{}
+	return q
+}
+
+// WithPartitionKey 设置消息的分区 key，启用 WithPartitions 时相同 key 的消息按顺序处理
+// 分区 key 以 {key} 的形式追加到消息ID中，未启用 WithPartitions 时忽略
+func WithPartitionKey(key string) SendOption {
+	return func(c *sendConfig) {
+		c.partitionKey = key
+	}
+}
+
+// hashTag 返回消息ID中第一个 {} 内的分区 key，没有时返回空字符串
+func hashTag(idStr string) string {
+	start := strings.IndexByte(idStr, '{')
+	if start < 0 {
+		return ""
+	}
+	end := strings.IndexByte(idStr[start+1:], '}')
+	if end <= 0 {
+		return ""
+	}
+	return idStr[start+1 : start+1+end]
+}
+
+// partitionState 当前消费者持有的分区
+type partitionState struct {
+	mu     sync.Mutex
+	owned  []uint
+	taken  map[uint]bool // 本轮已取出消息或为空的分区
+	popped int           // 本轮取出的消息数量
+}
+
+// Partitions 返回当前消费者持有的分区，未启用 WithPartitions 时返回 nil
+func (q *DelayQueue) Partitions() []uint {
+	if q.partitions == nil {
+		return nil
+	}
+	q.partitions.mu.Lock()
+	defer q.partitions.mu.Unlock()
+	return append([]uint(nil), q.partitions.owned...)
+}
+
+// partitionKey 分区相关的 key 的前缀
+func (q *DelayQueue) partitionKey() string {
+	return q.keyBase(q.name) + ":partition"
+}
+
+// partitionLease 分区的租约时间，消费周期最长持续一个拉取间隔加上处理超时时间
+func (q *DelayQueue) partitionLease() time.Duration {
+	return 3*q.fetchInterval + q.maxConsumeDuration
+}
+
+// rebalanceScript 记录消费者的心跳，并按存活的消费者数量分配分区
+// 存活的消费者按ID排序，前 n % members 个消费者多分配一个分区；持有的分区超过配额时释放多余的分区，不足时认领空闲的分区
+// KEYS: membersKey
+// ARGV: 消费者ID, 当前时间(毫秒), 租约时间(毫秒), 分区数, 分区 key 的前缀
+// 返回持有的分区
+const rebalanceScript = `
+redis.call('ZAdd', KEYS[1], ARGV[2], ARGV[1])
+redis.call('ZRemRangeByScore', KEYS[1], '-inf', tonumber(ARGV[2]) - tonumber(ARGV[3]))
+redis.call('PExpire', KEYS[1], ARGV[3])
+local members = redis.call('ZRange', KEYS[1], 0, -1)
+table.sort(members)
+local rank = 0
+for i, member in ipairs(members) do
+	if member == ARGV[1] then rank = i - 1 end
+end
+local n = tonumber(ARGV[4])
+local quota = math.floor(n / #members)
+if rank < n % #members then quota = quota + 1 end
+local owned = {}
+for i = 0, n - 1 do
+	local key = ARGV[5] .. i
+	if redis.call('Get', key) == ARGV[1] then
+		if #owned < quota then
+			redis.call('PExpire', key, ARGV[3])
+			table.insert(owned, i)
+		else
+			redis.call('Del', key)
+		end
+	end
+end
+for i = 0, n - 1 do
+	if #owned >= quota then break end
+	if redis.call('Set', ARGV[5] .. i, ARGV[1], 'PX', ARGV[3], 'NX') then
+		table.insert(owned, i)
+	end
+end
+return owned
+`
+
+// rebalance 续约持有的分区并按存活的消费者重新分配，失败时不持有任何分区
+func (q *DelayQueue) rebalance(ctx context.Context) error {
+	if q.partitions == nil {
+		return nil
+	}
+	keys := []string{q.partitionKey() + ":members"}
+	now := q.clock.Now().UnixNano() / int64(time.Millisecond)
+	lease := q.partitionLease().Milliseconds()
+	ret, err := q.eval(ctx, rebalanceScript, keys, q.consumerID, now, lease, q.shards, q.partitionKey()+":").Result()
+	if err != nil && err != redis.Nil {
+		q.setPartitions(nil)
+		return fmt.Errorf("rebalanceScript failed: %v", err)
+	}
+	owned, _ := ret.([]interface{})
+	partitions := make([]uint, 0, len(owned))
+	for _, p := range owned {
+		if i, ok := p.(int64); ok {
+			partitions = append(partitions, uint(i))
+		}
+	}
+	q.setPartitions(partitions)
+	return nil
+}
+
+func (q *DelayQueue) setPartitions(owned []uint) {
+	q.partitions.mu.Lock()
+	defer q.partitions.mu.Unlock()
+	q.partitions.owned = owned
+}
+
+// leavePartitionsScript 释放消费者持有的分区并移除心跳
+// KEYS: membersKey
+// ARGV: 消费者ID, 分区 key 的前缀, 持有的分区
+const leavePartitionsScript = `
+redis.call('ZRem', KEYS[1], ARGV[1])
+for i = 3, #ARGV do
+	local key = ARGV[2] .. ARGV[i]
+	if redis.call('Get', key) == ARGV[1] then redis.call('Del', key) end
+end
+`
+
+// leavePartitions 停止消费后立即释放持有的分区，其它消费者无需等待租约过期
+func (q *DelayQueue) leavePartitions() {
+	if q.partitions == nil {
+		return
+	}
+	args := []interface{}{q.consumerID, q.partitionKey() + ":"}
+	for _, p := range q.Partitions() {
+		args = append(args, p)
+	}
+	q.setPartitions(nil)
+	keys := []string{q.partitionKey() + ":members"}
+	err := q.eval(context.Background(), leavePartitionsScript, keys, args...).Err()
+	if err != nil && err != redis.Nil {
+		q.logger.Error("leave partitions failed", "queue", q.name, "error", err)
+	}
+}
+
+// deliverPartitions 分轮投递持有的分区中的消息，每轮从每个分区中至多取出一条消息并等待处理完成，
+// 每轮开始前将处理失败的消息放回所在分区的头部，保证同一分区的消息按顺序处理
+// 没有消息、达到 fetchLimit 或超过一个拉取间隔时结束
+func (q *DelayQueue) deliverPartitions(fetchLimit, concurrent uint) error {
+	start := q.clock.Now()
+	total := 0
+	for {
+		if err := q.unack2Retry(); err != nil {
+			return err
+		}
+		if err := q.requeueRetries(context.Background()); err != nil {
+			return err
+		}
+		p := q.partitions
+		p.mu.Lock()
+		p.taken, p.popped = make(map[uint]bool), 0
+		limit := uint(len(p.owned))
+		p.mu.Unlock()
+		if fetchLimit > 0 && limit > fetchLimit-uint(total) {
+			limit = fetchLimit - uint(total)
+		}
+		if limit == 0 {
+			return nil
+		}
+		if err := q.deliver(q.ready2Unack, &q.flow.ready2Unack, limit, concurrent); err != nil {
+			return err
+		}
+		p.mu.Lock()
+		popped := p.popped
+		p.mu.Unlock()
+		total += popped
+		if popped == 0 || q.clock.Now().Sub(start) >= q.fetchInterval {
+			return nil
+		}
+	}
+}
+
+// nextPartition 返回本轮下一个可以取出消息的分区
+func (p *partitionState) nextPartition() (uint, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, partition := range p.owned {
+		if !p.taken[partition] {
+			p.taken[partition] = true
+			return partition, true
+		}
+	}
+	return 0, false
+}
+
+func (p *partitionState) pop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.popped++
+}
+
+// partition2Unack 从本轮尚未取出消息的分区中取出一条消息移入 unack
+func (b *redisBroker) partition2Unack(ctx context.Context, deadline time.Time) (string, error) {
+	q := b.q
+	for {
+		partition, ok := q.partitions.nextPartition()
+		if !ok {
+			return "", ErrNoMessage
+		}
+		idStr, err := b.move2Unack(ctx, q.shardKey(q.readyKey, partition), deadline)
+		if err == ErrNoMessage {
+			continue
+		}
+		if err == nil {
+			q.partitions.pop()
+		}
+		return idStr, err
+	}
+}
+
+// retry2PartitionScript retry 中最早的消息仍为 ARGV[1] 时将其放回所在分区的头部
+// KEYS: retryKey, readyKey
+const retry2PartitionScript = `
+if redis.call('LIndex', KEYS[1], -1) ~= ARGV[1] then return 0 end
+redis.call('RPop', KEYS[1])
+redis.call('RPush', KEYS[2], ARGV[1])
+return 1
+`
+
+// requeueRetries 将 retry 中的消息放回所在分区的头部，使其在同一分区的后续消息之前重新投递
+func (q *DelayQueue) requeueRetries(ctx context.Context) error {
+	for {
+		idStr, err := q.redisCli.LIndex(ctx, q.retryKey, -1).Result()
+		if err == redis.Nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("get retry msg failed: %v", err)
+		}
+		keys := []string{q.retryKey, q.shardKey(q.readyKey, q.shardOf(idStr))}
+		err = q.eval(ctx, retry2PartitionScript, keys, idStr).Err()
+		if err != nil {
+			return fmt.Errorf("retry2PartitionScript failed: %v", err)
+		}
+	}
+}
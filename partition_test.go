@@ -0,0 +1,105 @@
+package delayqueue
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_PartitionOrdering(t *testing.T) {
+	redisCli := newTestRedis(t)
+	var mu sync.Mutex
+	received := make(map[string][]string)
+	failed := false
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		key := strings.Split(s, ":")[0]
+		received[key] = append(received[key], s)
+		if s == "k1:0" && !failed {
+			failed = true
+			return false
+		}
+		return true
+	}).WithPartitions(4).WithConcurrent(4).WithDefaultRetryCount(1)
+	// 早于当前时间的投递时间会被修改为当前时间，因此按未来的时间发送，再将时钟拨快使消息全部到期
+	clock := &driftingClock{}
+	queue.WithClock(clock)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		for _, key := range []string{"k1", "k2", "k3"} {
+			payload := fmt.Sprintf("%s:%d", key, i)
+			if err := queue.SendScheduleMsg(payload, now.Add(time.Duration(i+1)*time.Second), WithPartitionKey(key)); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}
+	clock.skew.Store(int64(-5 * time.Second))
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	expect := map[string][]string{
+		"k1": {"k1:0", "k1:0", "k1:1", "k1:2"},
+		"k2": {"k2:0", "k2:1", "k2:2"},
+		"k3": {"k3:0", "k3:1", "k3:2"},
+	}
+	if !reflect.DeepEqual(received, expect) {
+		t.Errorf("unexpected deliveries: %v", received)
+	}
+}
+
+func TestDelayQueue_PartitionRebalance(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	newQueue := func(id string) *DelayQueue {
+		return NewDelayQueue("test", redisCli, func(s string) bool {
+			return true
+		}).WithPartitions(4).WithConsumerID(id)
+	}
+	a, b := newQueue("a"), newQueue("b")
+	for _, q := range []*DelayQueue{a, b, a, b} {
+		if err := q.rebalance(ctx); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if len(a.Partitions()) != 2 || len(b.Partitions()) != 2 {
+		t.Errorf("expect 2 partitions each, actual %v %v", a.Partitions(), b.Partitions())
+	}
+	all := append(a.Partitions(), b.Partitions()...)
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+	if !reflect.DeepEqual(all, []uint{0, 1, 2, 3}) {
+		t.Errorf("expect all partitions assigned once, actual %v", all)
+	}
+	a.leavePartitions()
+	if err := b.rebalance(ctx); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(b.Partitions()) != 4 {
+		t.Errorf("expect 4 partitions after a left, actual %v", b.Partitions())
+	}
+}
+
+func TestHashTag(t *testing.T) {
+	cases := map[string]string{
+		"abc":          "",
+		"abc{k1}":      "k1",
+		"abc{}":        "",
+		"abc{k1}{k2}":  "k1",
+		"abc{k1":       "",
+		"abc:g{order}": "order",
+	}
+	for id, expect := range cases {
+		if actual := hashTag(id); actual != expect {
+			t.Errorf("hashTag(%q): expect %q, actual %q", id, expect, actual)
+		}
+	}
+}
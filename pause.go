@@ -0,0 +1,75 @@
+package delayqueue
+
+import (
+	"context"
+	"fmt"
+)
+
+// Pause 暂停当前实例的消息投递，消息会留在 ready 或 retry 中，调用 Resume 后继续投递
+// 与 StopConsume 不同，暂停不会停止消费协程，也不会丢失队列配置
+func (q *DelayQueue) Pause() {
+	q.paused.Store(true)
+}
+
+// Resume 恢复当前实例的消息投递
+func (q *DelayQueue) Resume() {
+	q.paused.Store(false)
+}
+
+// PauseAll 在 redis 中设置暂停标记，所有消费该队列的实例都将暂停投递
+func (q *DelayQueue) PauseAll(ctx context.Context) error {
+	return q.broker.SetPaused(ctx, true)
+}
+
+// ResumeAll 清除 redis 中的暂停标记，所有实例恢复投递（通过 Pause 暂停的实例除外）
+func (q *DelayQueue) ResumeAll(ctx context.Context) error {
+	return q.broker.SetPaused(ctx, false)
+}
+
+func (b *redisBroker) SetPaused(ctx context.Context, paused bool) error {
+	defer b.q.cache.invalidate(b.q.pausedKey)
+	if !paused {
+		err := b.q.redisCli.Del(ctx, b.q.pausedKey).Err()
+		if err != nil {
+			return fmt.Errorf("clear paused flag failed: %v", err)
+		}
+		return nil
+	}
+	err := b.q.redisCli.Set(ctx, b.q.pausedKey, 1, 0).Err()
+	if err != nil {
+		return fmt.Errorf("set paused flag failed: %v", err)
+	}
+	return nil
+}
+
+// IsPaused 返回当前实例是否处于暂停状态，包括通过 Pause 和 PauseAll 暂停
+func (q *DelayQueue) IsPaused(ctx context.Context) (bool, error) {
+	if q.paused.Load() {
+		return true, nil
+	}
+	return q.broker.Paused(ctx)
+}
+
+func (b *redisBroker) Paused(ctx context.Context) (bool, error) {
+	paused, err := b.q.cache.get(ctx, b.q.pausedKey, func() (interface{}, error) {
+		n, err := b.q.redisCli.Exists(ctx, b.q.pausedKey).Result()
+		return n > 0, err
+	})
+	if err != nil {
+		return false, fmt.Errorf("get paused flag failed: %v", err)
+	}
+	return paused.(bool), nil
+}
+
+// canDeliver 返回本次消费周期是否可以投递消息
+// 不可投递时仍会执行 pending2Ready、unack2Retry 等维护操作
+func (q *DelayQueue) canDeliver() (bool, error) {
+	if q.inMaintenance(q.clock.Now()) || !q.breakerAllow(q.clock.Now()) {
+		return false, nil
+	}
+	paused, err := q.IsPaused(context.Background())
+	if err != nil {
+		return false, err
+	}
+	return !paused, nil
+}
@@ -0,0 +1,56 @@
+package delayqueue
+
+import (
+	"context"
+	"strconv"
+	"testing"
+)
+
+func TestDelayQueue_Pause(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	size := 5
+	received := 0
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		received++
+		return true
+	})
+	other := NewDelayQueue("test", redisCli, func(s string) bool {
+		received++
+		return true
+	})
+	for i := 0; i < size; i++ {
+		err := queue.SendDelayMsg(strconv.Itoa(i), 0)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	queue.Pause()
+	if err := queue.consume(); err != nil {
+		t.Errorf("consume error: %v", err)
+		return
+	}
+	if err := other.PauseAll(ctx); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := other.consume(); err != nil {
+		t.Errorf("consume error: %v", err)
+		return
+	}
+	if received != 0 {
+		t.Errorf("expect no delivery when paused, actual %d", received)
+	}
+	queue.Resume()
+	if err := other.ResumeAll(ctx); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := queue.consume(); err != nil {
+		t.Errorf("consume error: %v", err)
+		return
+	}
+	if received != size {
+		t.Errorf("expect %d delivery after resume, actual %d", size, received)
+	}
+}
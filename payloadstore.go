@@ -0,0 +1,142 @@
+package delayqueue
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// HeaderPayloadRef 记录外部存储中消息内容的引用，设置后 redis 中的消息内容为空
+const HeaderPayloadRef = "delayqueue-payload-ref"
+
+// PayloadStore 存储较大消息内容的外部存储，例如 S3、GCS
+type PayloadStore interface {
+	// Put 保存消息内容，返回用于读取和删除的引用，ttl 为消息在 redis 中的保存时间，可用于设置对象的过期时间
+	Put(ctx context.Context, id string, payload string, ttl time.Duration) (ref string, err error)
+	// Get 读取消息内容
+	Get(ctx context.Context, ref string) (string, error)
+	// Delete 删除消息内容，对象不存在时应返回 nil
+	Delete(ctx context.Context, ref string) error
+}
+
+// WithPayloadStore 将长度超过 threshold 字节的消息内容保存到外部存储，redis 中只保存引用（header HeaderPayloadRef）
+// 投递前自动从外部存储读取消息内容，消息被确认或过期后（未启用死信队列时）删除外部存储中的内容；
+// 达到重试上限、进入死信队列或在 redis 中过期的消息不会删除，应通过 Put 的 ttl 或存储的生命周期规则清理
+// List、GetMessage 等查询方法返回的消息内容为空，同一队列的生产者和消费者必须使用相同的外部存储
+// Export 和 Migrate 导出的消息内容同样为空，引用通过 header 保留，导入的队列必须配置能读取该引用的外部存储，否则 Import 返回错误
+func (q *DelayQueue) WithPayloadStore(store PayloadStore, threshold int) *DelayQueue {
+	if q.frozen("WithPayloadStore") {
+		return q
+	}
+	q.payloadStore = store
+	q.payloadThreshold = threshold
+	return q
+}
+
+// offload 消息内容超过阈值时保存到外部存储，返回只包含引用的副本，未超过时返回 msg
+func (q *DelayQueue) offload(ctx context.Context, msg *MessageInfo, ttl time.Duration) (*MessageInfo, error) {
+	if q.payloadStore == nil || len(msg.Payload) <= q.payloadThreshold {
+		return msg, nil
+	}
+	ref, err := q.payloadStore.Put(ctx, msg.ID, msg.Payload, ttl)
+	if err != nil {
+		return nil, fmt.Errorf("put payload failed: %v", err)
+	}
+	stored := *msg
+	stored.Payload = ""
+	stored.Headers = make(map[string]string, len(msg.Headers)+1)
+	for k, v := range msg.Headers {
+		stored.Headers[k] = v
+	}
+	stored.Headers[HeaderPayloadRef] = ref
+	return &stored, nil
+}
+
+// pushStored 将消息保存到 target，内容超过阈值时先保存到外部存储，保存失败时删除外部存储中的内容
+func (q *DelayQueue) pushStored(ctx context.Context, target *DelayQueue, msg *MessageInfo, ttl time.Duration) error {
+	stored, err := q.offload(ctx, msg, ttl)
+	if err != nil {
+		return err
+	}
+	err = target.broker.Push(ctx, stored, ttl)
+	if err != nil && stored != msg {
+		_ = q.payloadStore.Delete(ctx, stored.Headers[HeaderPayloadRef])
+	}
+	return err
+}
+
+// pushManyStored 批量保存消息，外部存储的处理与 pushStored 相同
+func (q *DelayQueue) pushManyStored(ctx context.Context, target *DelayQueue, msgs []*PendingMessage) error {
+	if q.payloadStore == nil {
+		return target.broker.PushMany(ctx, msgs)
+	}
+	stored := make([]*PendingMessage, 0, len(msgs))
+	var refs []string
+	for _, msg := range msgs {
+		info, err := q.offload(ctx, msg.MessageInfo, msg.TTL)
+		if err != nil {
+			q.deletePayloads(ctx, refs...)
+			return err
+		}
+		if info != msg.MessageInfo {
+			refs = append(refs, info.Headers[HeaderPayloadRef])
+		}
+		copied := *msg
+		copied.MessageInfo = info
+		stored = append(stored, &copied)
+	}
+	err := target.broker.PushMany(ctx, stored)
+	if err != nil {
+		q.deletePayloads(ctx, refs...)
+	}
+	return err
+}
+
+// loadPayload 从外部存储读取消息内容，并从 msg 的 header 中移除引用
+func (q *DelayQueue) loadPayload(ctx context.Context, msg *Message) error {
+	ref := msg.Headers[HeaderPayloadRef]
+	if ref == "" {
+		return nil
+	}
+	if q.payloadStore == nil {
+		return fmt.Errorf("payload of %s is in external store, but no PayloadStore is configured", msg.ID)
+	}
+	payload, err := q.payloadStore.Get(ctx, ref)
+	if err != nil {
+		return fmt.Errorf("get payload failed: %v", err)
+	}
+	msg.Payload = payload
+	msg.payloadRef = ref
+	delete(msg.Headers, HeaderPayloadRef)
+	return nil
+}
+
+// payloadRefs 返回 unack 中消息的外部存储引用（消息ID -> 引用），用于在 Ack 之后删除
+func (q *DelayQueue) payloadRefs(ctx context.Context, ids []string) map[string]string {
+	if q.payloadStore == nil {
+		return nil
+	}
+	refs := make(map[string]string)
+	for _, idStr := range ids {
+		msg, err := q.broker.Message(ctx, idStr)
+		if err != nil {
+			continue
+		}
+		if ref := msg.Headers[HeaderPayloadRef]; ref != "" {
+			refs[idStr] = ref
+		}
+	}
+	return refs
+}
+
+// deletePayloads 删除外部存储中的消息内容，失败时只记录日志
+func (q *DelayQueue) deletePayloads(ctx context.Context, refs ...string) {
+	for _, ref := range refs {
+		if ref == "" {
+			continue
+		}
+		if err := q.payloadStore.Delete(ctx, ref); err != nil {
+			q.logger.Error("delete payload failed", "queue", q.name, "ref", ref, "error", err)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package delayqueue
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mapPayloadStore 测试用的外部存储
+type mapPayloadStore struct {
+	mu    sync.Mutex
+	blobs map[string]string
+}
+
+func (s *mapPayloadStore) Put(ctx context.Context, id string, payload string, ttl time.Duration) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ref := "blob/" + id
+	s.blobs[ref] = payload
+	return ref, nil
+}
+
+func (s *mapPayloadStore) Get(ctx context.Context, ref string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.blobs[ref], nil
+}
+
+func (s *mapPayloadStore) Delete(ctx context.Context, ref string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.blobs, ref)
+	return nil
+}
+
+func (s *mapPayloadStore) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.blobs)
+}
+
+func TestDelayQueue_PayloadStore(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	store := &mapPayloadStore{blobs: make(map[string]string)}
+	large := strings.Repeat("x", 100)
+	var received []string
+	var headers []map[string]string
+	queue := NewDelayQueueWithHandler("test", redisCli, func(ctx context.Context, msg *Message) error {
+		received = append(received, msg.Payload)
+		headers = append(headers, msg.Headers)
+		return nil
+	}).WithPayloadStore(store, 10)
+	small, err := queue.SendDelayMsgV2("small", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	msg, err := queue.SendDelayMsgV2(large, 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if msg.Payload != large {
+		t.Errorf("returned message should keep the payload")
+	}
+	// redis 中只保存引用
+	stored, err := redisCli.Get(ctx, queue.genMsgKey(msg.ID)).Result()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if stored != "" || store.len() != 1 {
+		t.Errorf("large payload should be offloaded, stored %q, blobs %d", stored, store.len())
+	}
+	stored, err = redisCli.Get(ctx, queue.genMsgKey(small.ID)).Result()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if stored != "small" {
+		t.Errorf("small payload should be kept in redis: %q", stored)
+	}
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(received) != 2 {
+		t.Errorf("unexpected received: %d", len(received))
+		return
+	}
+	for i, payload := range received {
+		if payload != "small" && payload != large {
+			t.Errorf("unexpected payload: %q", payload)
+		}
+		if _, ok := headers[i][HeaderPayloadRef]; ok {
+			t.Errorf("payload ref should be hidden from handler")
+		}
+	}
+	if store.len() != 0 {
+		t.Errorf("payload should be deleted after ack, %d left", store.len())
+	}
+}
+
+func TestDelayQueue_PayloadStoreExport(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	store := &mapPayloadStore{blobs: make(map[string]string)}
+	large := strings.Repeat("x", 100)
+	var received []string
+	handler := func(ctx context.Context, msg *Message) error {
+		received = append(received, msg.Payload)
+		return nil
+	}
+	src := NewDelayQueueWithHandler("src", redisCli, handler).WithPayloadStore(store, 10)
+	if _, err := src.SendDelayMsgV2(large, 0); err != nil {
+		t.Error(err)
+		return
+	}
+	buf := &bytes.Buffer{}
+	if _, err := src.Export(ctx, buf); err != nil {
+		t.Error(err)
+		return
+	}
+	data := buf.Bytes()
+	// 没有外部存储的队列无法读取引用，拒绝导入
+	plain := NewDelayQueueWithHandler("plain", redisCli, handler)
+	if _, err := plain.Import(ctx, bytes.NewReader(data)); err == nil {
+		t.Error("expect import without PayloadStore to fail")
+	}
+	if _, err := Migrate(ctx, src, plain); err == nil {
+		t.Error("expect migrate without PayloadStore to fail")
+	}
+	dst := NewDelayQueueWithHandler("dst", redisCli, handler).WithPayloadStore(store, 10)
+	if n, err := dst.Import(ctx, bytes.NewReader(data)); err != nil || n != 1 {
+		t.Errorf("expect 1 imported message, actual %d, err: %v", n, err)
+		return
+	}
+	if _, err := dst.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(received) != 1 || received[0] != large {
+		t.Errorf("imported message should load payload from store, received %d", len(received))
+	}
+}
+
+func TestMemoryQueue_PayloadStore(t *testing.T) {
+	store := &mapPayloadStore{blobs: make(map[string]string)}
+	var received []string
+	queue := NewMemoryQueue("test", func(s string) bool {
+		received = append(received, s)
+		return true
+	}).WithPayloadStore(store, 0)
+	if err := queue.SendDelayMsg("hello", 0); err != nil {
+		t.Error(err)
+		return
+	}
+	if store.len() != 1 {
+		t.Errorf("payload should be offloaded")
+	}
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(received) != 1 || received[0] != "hello" {
+		t.Errorf("unexpected received: %v", received)
+	}
+	if store.len() != 0 {
+		t.Errorf("payload should be deleted after ack")
+	}
+}
@@ -0,0 +1,143 @@
+package delayqueue
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// payloadPreviewSize Peek 返回的消息内容的最大长度（字节）
+const payloadPreviewSize = 256
+
+// PeekPending 返回投递时间最早的至多 n 条 pending 消息，不改变消息状态
+// 返回的消息内容超过 256 字节时会被截断，完整内容可以通过 GetMessage 查询
+func (q *DelayQueue) PeekPending(ctx context.Context, n int64) ([]*MessageInfo, error) {
+	if err := q.requireRedis("PeekPending"); err != nil {
+		return nil, err
+	}
+	if n <= 0 {
+		return nil, nil
+	}
+	var msgs []*MessageInfo
+	for _, key := range q.shardKeys(q.pendingKey) {
+		members, err := q.redisCli.ZRangeWithScores(ctx, key, 0, n-1).Result()
+		if err != nil {
+			return nil, fmt.Errorf("peek pending failed: %v", err)
+		}
+		for _, z := range members {
+			idStr, _ := z.Member.(string)
+			msgs = append(msgs, &MessageInfo{
+				ID:    idStr,
+				State: StagePending,
+				Time:  time.Unix(int64(z.Score), 0),
+			})
+		}
+	}
+	// 合并各个分片的结果
+	sort.SliceStable(msgs, func(i, j int) bool {
+		return msgs[i].Time.Before(msgs[j].Time)
+	})
+	if int64(len(msgs)) > n {
+		msgs = msgs[:n]
+	}
+	return msgs, q.fillPreview(ctx, msgs)
+}
+
+// PeekReady 返回即将投递的至多 n 条 ready 消息，不改变消息状态
+// 返回的消息内容超过 256 字节时会被截断，完整内容可以通过 GetMessage 查询
+func (q *DelayQueue) PeekReady(ctx context.Context, n int64) ([]*MessageInfo, error) {
+	if err := q.requireRedis("PeekReady"); err != nil {
+		return nil, err
+	}
+	if n <= 0 {
+		return nil, nil
+	}
+	// 消费者从 list 右端取出消息，并轮询各个分片
+	shards := make([][]string, 0, q.shards)
+	for _, key := range q.shardKeys(q.readyKey) {
+		ids, err := q.redisCli.LRange(ctx, key, -n, -1).Result()
+		if err != nil {
+			return nil, fmt.Errorf("peek ready failed: %v", err)
+		}
+		shards = append(shards, ids)
+	}
+	var msgs []*MessageInfo
+	for i := 1; int64(len(msgs)) < n; i++ {
+		found := false
+		for _, ids := range shards {
+			if len(ids) >= i {
+				found = true
+				msgs = append(msgs, &MessageInfo{ID: ids[len(ids)-i], State: StageReady})
+			}
+		}
+		if !found {
+			break
+		}
+	}
+	if int64(len(msgs)) > n {
+		msgs = msgs[:n]
+	}
+	return msgs, q.fillPreview(ctx, msgs)
+}
+
+// fillPreview 批量填充消息内容的预览及剩余重试次数
+func (q *DelayQueue) fillPreview(ctx context.Context, msgs []*MessageInfo) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	if q.hashStorage {
+		pipe := q.redisCli.Pipeline()
+		cmds := make([]*msgCmds, len(msgs))
+		for i, msg := range msgs {
+			cmds[i] = q.readMsg(ctx, pipe, msg.ID)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return fmt.Errorf("get payloads failed: %v", err)
+		}
+		for i, msg := range msgs {
+			if stored, err := cmds[i].result(); err == nil {
+				msg.Payload = preview(stored.payload)
+				msg.RetryCount = stored.retryCount
+			}
+		}
+		return nil
+	}
+	keys := make([]string, 0, len(msgs))
+	ids := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		keys = append(keys, q.genMsgKey(msg.ID))
+		ids = append(ids, msg.ID)
+	}
+	payloads, err := q.redisCli.MGet(ctx, keys...).Result()
+	if err != nil {
+		return fmt.Errorf("get payloads failed: %v", err)
+	}
+	retryCounts, err := q.redisCli.HMGet(ctx, q.retryCountKey, ids...).Result()
+	if err != nil {
+		return fmt.Errorf("get retry counts failed: %v", err)
+	}
+	for i, msg := range msgs {
+		if payload, ok := payloads[i].(string); ok {
+			msg.Payload = preview(payload)
+		}
+		if count, ok := retryCounts[i].(string); ok {
+			msg.RetryCount, _ = strconv.ParseInt(count, 10, 64)
+		}
+	}
+	return nil
+}
+
+// preview 截断过长的消息内容，保证不会截断多字节字符
+func preview(payload string) string {
+	if len(payload) <= payloadPreviewSize {
+		return payload
+	}
+	end := payloadPreviewSize
+	for end > 0 && !utf8.RuneStart(payload[end]) {
+		end--
+	}
+	return payload[:end]
+}
@@ -0,0 +1,102 @@
+package delayqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// PermanentError Handler 返回的永久错误，表示消息无法处理、重试也不会成功，消息不再重试，直接移入死信队列（未启用死信队列时删除）
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return "permanent error: " + e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent 将 err 包装为永久错误，err 为 nil 时返回 nil
+// example: return delayqueue.Permanent(fmt.Errorf("invalid order id: %s", msg.Payload))
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// IsPermanent 返回 err 是否为（或包装了）永久错误
+func IsPermanent(err error) bool {
+	var permanent *PermanentError
+	return errors.As(err, &permanent)
+}
+
+// TransientError Handler 返回的临时错误，消息在 RetryAfter 之后重试，仍占用一次重试次数
+type TransientError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *TransientError) Error() string {
+	return "transient error: " + e.Err.Error()
+}
+
+func (e *TransientError) Unwrap() error {
+	return e.Err
+}
+
+// Transient 将 err 包装为临时错误，消息在 retryAfter 之后重试，retryAfter 不大于 0 时与直接返回 err 相同，err 为 nil 时返回 nil
+// example: return delayqueue.Transient(err, 30*time.Second)
+func Transient(err error, retryAfter time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &TransientError{Err: err, RetryAfter: retryAfter}
+}
+
+// retryAfter 返回 Handler 返回的临时错误指定的重试延时，不是临时错误时返回 0
+func retryAfter(err error) time.Duration {
+	var transient *TransientError
+	if errors.As(err, &transient) {
+		return transient.RetryAfter
+	}
+	return 0
+}
+
+// dropIfPermanent Handler 返回永久错误时不再重试，将消息移入 garbage 并返回 true
+func (q *DelayQueue) dropIfPermanent(ctx context.Context, msg *Message, handleErr error) bool {
+	if !IsPermanent(handleErr) {
+		return false
+	}
+	if err := q.broker.Drop(ctx, msg.ID, q.clock.Now(), HistoryPermanent); err != nil {
+		q.handleError(fmt.Errorf("drop msg %s failed: %v", msg.ID, err))
+		return false
+	}
+	status := StatusFailed
+	if q.deadLetterTTL > 0 {
+		status = StatusDead
+	}
+	q.recordStatus(ctx, msg.ID, status, time.Time{})
+	q.incCounter(MetricNacked, 1)
+	q.incCounter(MetricDead, 1)
+	q.audit(ctx, AuditNack, msg.ID)
+	q.audit(ctx, AuditDead, msg.ID)
+	q.debugLog("message dropped by permanent error", "id", msg.ID, "error", handleErr)
+	return true
+}
+
+// nack 将消息标记为消费失败，Handler 返回临时错误且还有重试次数时在指定的延时之后重试
+func (q *DelayQueue) nack(ctx context.Context, msg *Message, handleErr error) error {
+	if d := retryAfter(handleErr); d > 0 && msg.RetriesLeft > 0 {
+		err := q.broker.Extend(ctx, msg.ID, q.clock.Now().Add(d))
+		if err == ErrMessageNotFound {
+			return nil
+		}
+		return err
+	}
+	return q.broker.Nack(ctx, msg.ID, q.clock.Now())
+}
@@ -0,0 +1,80 @@
+package delayqueue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_PermanentError(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	calls := 0
+	queue := NewDelayQueueWithHandler("test", redisCli, func(ctx context.Context, msg *Message) error {
+		calls++
+		return Permanent(errors.New("invalid payload"))
+	}).WithDeadLetter(time.Hour).WithDefaultRetryCount(3).WithHistory()
+	msg, err := queue.SendDelayMsgV2("bad", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	if calls != 1 {
+		t.Errorf("permanent error should not be retried, calls: %d", calls)
+	}
+	dead, _, err := queue.ListDead(ctx, "", 10)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(dead) != 1 || dead[0].ID != msg.ID {
+		t.Errorf("message should be dead lettered: %v", dead)
+	}
+	history, err := queue.GetHistory(ctx, msg.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(history) == 0 || history[len(history)-1].Event != HistoryPermanent {
+		t.Errorf("unexpected history: %+v", history)
+	}
+	if !IsPermanent(Permanent(errors.New("x"))) || IsPermanent(errors.New("x")) || Permanent(nil) != nil {
+		t.Error("unexpected IsPermanent result")
+	}
+}
+
+func TestDelayQueue_TransientError(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	calls := 0
+	queue := NewDelayQueueWithHandler("test", redisCli, func(ctx context.Context, msg *Message) error {
+		calls++
+		return Transient(errors.New("service unavailable"), time.Minute)
+	}).WithDefaultRetryCount(3)
+	msg, err := queue.SendDelayMsgV2("hello", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	if calls != 1 {
+		t.Errorf("transient error should be retried later, calls: %d", calls)
+	}
+	// 消息留在 unack 中，在一分钟后重试
+	score, err := redisCli.ZScore(ctx, queue.unAckKey, msg.ID).Result()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if d := time.Until(time.Unix(int64(score), 0)); d < 58*time.Second || d > time.Minute {
+		t.Errorf("unexpected retry time: %v", d)
+	}
+}
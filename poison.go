@@ -0,0 +1,156 @@
+package delayqueue
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// poisonDigits 错误信息中的数字，默认的错误特征忽略其中的ID、时间等变化的部分
+var poisonDigits = regexp.MustCompile(`[0-9]+`)
+
+// maxPoisonSignature 错误特征的最大长度
+const maxPoisonSignature = 200
+
+// WithPoisonQuarantine 隔离毒消息：消息连续 threshold 次处理失败且每次的错误特征相同时，不再等待重试次数耗尽，
+// 直接移入死信队列（未启用死信队列时删除），投递历史中记录 poisoned 事件
+// 错误特征默认为错误信息中的数字替换为 # 后的前 200 个字符，可以通过 WithPoisonSignature 自定义；
+// 某个错误特征第一次导致消息被隔离时调用 hook，用于通知发现了新的一类毒消息，hook 在消费协程中同步执行，不应阻塞
+func (q *DelayQueue) WithPoisonQuarantine(threshold uint, hook func(signature string, msg *Message)) *DelayQueue {
+	if q.frozen("WithPoisonQuarantine") {
+		return q
+	}
+	q.poisonThreshold = threshold
+	q.poisonHook = hook
+	return q
+}
+
+// WithPoisonSignature 自定义毒消息检测使用的错误特征，相同特征的错误视为同一类错误
+func (q *DelayQueue) WithPoisonSignature(signature func(err error) string) *DelayQueue {
+	if q.frozen("WithPoisonSignature") {
+		return q
+	}
+	q.poisonSignature = signature
+	return q
+}
+
+func defaultPoisonSignature(err error) string {
+	signature := poisonDigits.ReplaceAllString(err.Error(), "#")
+	if len(signature) > maxPoisonSignature {
+		signature = signature[:maxPoisonSignature]
+	}
+	return signature
+}
+
+// quarantineIfPoison 记录本次处理失败的错误特征，连续以相同特征失败 poisonThreshold 次时隔离消息并返回 true
+func (q *DelayQueue) quarantineIfPoison(ctx context.Context, msg *Message, handleErr error) bool {
+	if q.poisonThreshold == 0 {
+		return false
+	}
+	signature := defaultPoisonSignature(handleErr)
+	if q.poisonSignature != nil {
+		signature = q.poisonSignature(handleErr)
+	}
+	count, err := q.broker.RecordFailure(ctx, msg.ID, signature)
+	if err != nil {
+		q.handleError(fmt.Errorf("record failure of msg %s failed: %v", msg.ID, err))
+		return false
+	}
+	if count < int64(q.poisonThreshold) {
+		return false
+	}
+	if err := q.broker.Drop(ctx, msg.ID, q.clock.Now(), HistoryPoisoned); err != nil {
+		q.handleError(fmt.Errorf("quarantine msg %s failed: %v", msg.ID, err))
+		return false
+	}
+	status := StatusFailed
+	if q.deadLetterTTL > 0 {
+		status = StatusDead
+	}
+	q.recordStatus(ctx, msg.ID, status, time.Time{})
+	q.incCounter(MetricNacked, 1)
+	q.incCounter(MetricDead, 1)
+	q.audit(ctx, AuditNack, msg.ID)
+	q.audit(ctx, AuditDead, msg.ID)
+	q.logger.Warn("poison message quarantined", "queue", q.name, "id", msg.ID, "failures", count, "signature", signature)
+	if q.poisonHook == nil {
+		return true
+	}
+	added, err := q.broker.AddPoisonSignature(ctx, signature)
+	if err != nil {
+		q.handleError(fmt.Errorf("record poison signature failed: %v", err))
+		return true
+	}
+	if added {
+		q.poisonHook(signature, msg)
+	}
+	return true
+}
+
+// genFailureKey hash 存储消息最近一次处理失败的错误特征及以该特征连续失败的次数，过期时间与消息内容一致
+func (q *DelayQueue) genFailureKey(idStr string) string {
+	return q.genMsgKey(idStr) + ":failure"
+}
+
+// genPoisonKey set 存储已导致消息被隔离的错误特征，各消费组共用
+func (q *DelayQueue) genPoisonKey() string {
+	return q.keyBase(q.baseName) + ":poison"
+}
+
+// recordFailureScript 记录消息本次处理失败的错误特征，返回以该特征连续失败的次数
+// KEYS: failureKey, msgKey
+// ARGV: 错误特征
+const recordFailureScript = `
+local count = 1
+if redis.call('HGet', KEYS[1], 'signature') == ARGV[1] then
+	count = tonumber(redis.call('HGet', KEYS[1], 'count')) + 1
+end
+redis.call('HSet', KEYS[1], 'signature', ARGV[1], 'count', count)
+local ttl = redis.call('PTTL', KEYS[2])
+if ttl > 0 then redis.call('PExpire', KEYS[1], ttl) end
+return count
+`
+
+func (b *redisBroker) RecordFailure(ctx context.Context, idStr string, signature string) (int64, error) {
+	q := b.q
+	keys := []string{q.genFailureKey(idStr), q.genMsgKey(idStr)}
+	count, err := q.eval(ctx, recordFailureScript, keys, signature).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("recordFailureScript failed: %v", err)
+	}
+	return count, nil
+}
+
+func (b *redisBroker) AddPoisonSignature(ctx context.Context, signature string) (bool, error) {
+	n, err := b.q.redisCli.SAdd(ctx, b.q.genPoisonKey(), signature).Result()
+	if err != nil {
+		return false, fmt.Errorf("sadd failed: %v", err)
+	}
+	return n > 0, nil
+}
+
+func (b *memoryBroker) RecordFailure(ctx context.Context, idStr string, signature string) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	msg, ok := b.msgs[idStr]
+	if !ok {
+		return 0, nil
+	}
+	if msg.failureSignature == signature {
+		msg.failures++
+	} else {
+		msg.failureSignature, msg.failures = signature, 1
+	}
+	return msg.failures, nil
+}
+
+func (b *memoryBroker) AddPoisonSignature(ctx context.Context, signature string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.poisonSignatures[signature]; ok {
+		return false, nil
+	}
+	b.poisonSignatures[signature] = struct{}{}
+	return true, nil
+}
@@ -0,0 +1,70 @@
+package delayqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_PoisonQuarantine(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	attempts := make(map[string]int)
+	var hooked []string
+	queue := NewDelayQueueWithHandler("test", redisCli, func(ctx context.Context, msg *Message) error {
+		attempts[msg.Payload]++
+		if msg.Payload == "flaky" && attempts[msg.Payload]%2 == 0 {
+			return errors.New("connection refused")
+		}
+		if msg.Payload == "flaky" {
+			return fmt.Errorf("timeout after %d ms", attempts[msg.Payload]*100)
+		}
+		if msg.Payload == "changing" {
+			return errors.New(msg.Payload + string(rune('a'+attempts[msg.Payload])))
+		}
+		return fmt.Errorf("decode order %d failed: bad json", msg.Attempt)
+	}).WithDefaultRetryCount(5).WithDeadLetter(time.Hour).
+		WithPoisonQuarantine(3, func(signature string, msg *Message) {
+			hooked = append(hooked, signature)
+		}).
+		WithPoisonSignature(func(err error) string {
+			if strings.HasPrefix(err.Error(), "decode order") {
+				return "decode"
+			}
+			return defaultPoisonSignature(err)
+		})
+	for _, payload := range []string{"order-1", "order-2", "flaky", "changing"} {
+		if err := queue.SendDelayMsg(payload, 0); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := queue.ProcessOnce(); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	// 相同错误特征的消息在第 3 次失败后被隔离，特征第一次出现时调用 hook
+	if attempts["order-1"] != 3 || attempts["order-2"] != 3 {
+		t.Errorf("unexpected attempts: %v", attempts)
+	}
+	if len(hooked) != 1 || hooked[0] != "decode" {
+		t.Errorf("unexpected hooked: %v", hooked)
+	}
+	// 错误特征变化的消息按重试次数处理
+	if attempts["flaky"] != 6 || attempts["changing"] != 6 {
+		t.Errorf("unexpected attempts: %v", attempts)
+	}
+	dead, _, err := queue.ListDead(ctx, "", 10)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(dead) != 4 {
+		t.Errorf("unexpected dead: %d", len(dead))
+	}
+}
@@ -0,0 +1,66 @@
+package delayqueue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Progress Handler 上报的处理进度
+type Progress struct {
+	Percent    int       `json:"percent"`              // 完成百分比
+	Checkpoint string    `json:"checkpoint,omitempty"` // 自定义的检查点，如已处理到的行号
+	Time       time.Time `json:"time"`                 // 上报时间
+}
+
+// genProgressKey string 存储消息的处理进度，各消费组共用不含消费组的队列名称
+func (q *DelayQueue) genProgressKey(idStr string) string {
+	return q.keyBase(q.baseName) + ":progress:" + idStr
+}
+
+// ReportProgress 上报处理进度，覆盖之前的进度，进度的保留时间与消息内容的默认过期时间相同
+// 只能在 Handler 中调用，可以通过 GetProgress 查询
+func (m *Message) ReportProgress(ctx context.Context, percent int, checkpoint string) error {
+	if m.queue == nil {
+		return errors.New("message is not delivered by a queue")
+	}
+	q := m.queue
+	progress := &Progress{Percent: percent, Checkpoint: checkpoint, Time: q.clock.Now()}
+	return q.broker.SetProgress(ctx, m.ID, progress, q.msgTTL)
+}
+
+// GetProgress 查询消息的处理进度，没有上报过进度或进度已过期时返回 ErrMessageNotFound
+func (q *DelayQueue) GetProgress(ctx context.Context, idStr string) (*Progress, error) {
+	return q.broker.Progress(ctx, idStr)
+}
+
+func (b *redisBroker) SetProgress(ctx context.Context, idStr string, progress *Progress, ttl time.Duration) error {
+	q := b.q
+	data, _ := json.Marshal(progress)
+	err := q.redisCli.Set(ctx, q.genProgressKey(idStr), data, ttl).Err()
+	if err != nil {
+		return fmt.Errorf("set progress failed: %v", err)
+	}
+	return nil
+}
+
+func (b *redisBroker) Progress(ctx context.Context, idStr string) (*Progress, error) {
+	q := b.q
+	data, err := q.redisCli.Get(ctx, q.genProgressKey(idStr)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get progress failed: %v", err)
+	}
+	progress := &Progress{}
+	err = json.Unmarshal(data, progress)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal progress failed: %v", err)
+	}
+	return progress, nil
+}
@@ -0,0 +1,43 @@
+package delayqueue
+
+import (
+	"context"
+	"strconv"
+	"testing"
+)
+
+func TestDelayQueue_Progress(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	queue := NewDelayQueueWithHandler("test", redisCli, func(ctx context.Context, msg *Message) error {
+		for i := 1; i <= 2; i++ {
+			if err := msg.ReportProgress(ctx, i*50, "step "+strconv.Itoa(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	msg, err := queue.SendDelayMsgV2("export", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = queue.GetProgress(ctx, msg.ID); err != ErrMessageNotFound {
+		t.Errorf("expect ErrMessageNotFound before consume, actual: %v", err)
+	}
+	if _, err = queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	progress, err := queue.GetProgress(ctx, msg.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if progress.Percent != 100 || progress.Checkpoint != "step 2" || progress.Time.IsZero() {
+		t.Errorf("unexpected progress: %+v", progress)
+	}
+	if err = (&Message{ID: msg.ID}).ReportProgress(ctx, 0, ""); err == nil {
+		t.Error("expect error when message is not delivered by a queue")
+	}
+}
@@ -0,0 +1,42 @@
+package delayqueue
+
+import (
+	"context"
+	"time"
+)
+
+// Queue DelayQueue 和 MemoryQueue 共同支持的接口
+// 业务代码依赖 Queue 时，可以在单元测试中使用 MemoryQueue 代替 DelayQueue
+type Queue interface {
+	SendScheduleMsg(payload string, t time.Time, opts ...SendOption) error
+	SendScheduleMsgV2(payload string, t time.Time, opts ...SendOption) (*MessageInfo, error)
+	SendDelayMsg(payload string, duration time.Duration, opts ...SendOption) error
+	SendDelayMsgV2(payload string, duration time.Duration, opts ...SendOption) (*MessageInfo, error)
+	StartConsume() (done <-chan struct{})
+	StopConsume()
+	Stats(ctx context.Context) (*QueueStats, error)
+	GetMessage(ctx context.Context, idStr string) (*MessageInfo, error)
+	GetResult(ctx context.Context, idStr string) (string, error)
+	Cancel(ctx context.Context, idStr string) error
+	Extend(ctx context.Context, idStr string, d time.Duration) error
+	Ack(ctx context.Context, idStr string) error
+	Nack(ctx context.Context, idStr string, reason error) error
+	ListDead(ctx context.Context, cursor string, count int64) ([]*DeadMessage, string, error)
+	RequeueDead(ctx context.Context, ids ...string) (int, error)
+}
+
+// clockOf 返回 queue 使用的 Clock，其它 Queue 的实现使用系统时间
+func clockOf(queue Queue) Clock {
+	switch q := queue.(type) {
+	case *DelayQueue:
+		return q.clock
+	case *MemoryQueue:
+		return q.q.clock
+	}
+	return realClock{}
+}
+
+var (
+	_ Queue = (*DelayQueue)(nil)
+	_ Queue = (*MemoryQueue)(nil)
+)
@@ -0,0 +1,91 @@
+package queuetest
+
+import (
+	"sync"
+	"time"
+
+	"delayqueue"
+)
+
+// Clock 可手动推进的 delayqueue.Clock
+// 配合 DelayQueue.WithClock 或 MemoryQueue.WithClock 使用时，调用 Advance 会按时间顺序触发定时器，
+// 消费协程随后在虚拟时间下执行消费周期
+type Clock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*ticker
+}
+
+// NewClock 创建从 start 开始的 Clock
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// Now 返回当前的虚拟时间
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTicker 创建在虚拟时间下每隔 d 触发一次的定时器，与 time.Ticker 相同，消费者来不及处理时会丢弃触发
+func (c *Clock) NewTicker(d time.Duration) delayqueue.Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &ticker{clock: c, c: make(chan time.Time, 1), d: d, next: c.now.Add(d)}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+// Advance 将虚拟时间向后推进 d，并按时间顺序触发期间到期的定时器
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	end := c.now.Add(d)
+	for {
+		var next *ticker
+		for _, t := range c.tickers {
+			if !t.next.After(end) && (next == nil || t.next.Before(next.next)) {
+				next = t
+			}
+		}
+		if next == nil {
+			break
+		}
+		c.now = next.next
+		next.next = next.next.Add(next.d)
+		select {
+		case next.c <- c.now:
+		default:
+		}
+	}
+	c.now = end
+}
+
+type ticker struct {
+	clock *Clock
+	c     chan time.Time
+	d     time.Duration
+	next  time.Time
+}
+
+func (t *ticker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *ticker) Stop() {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, v := range c.tickers {
+		if v == t {
+			c.tickers = append(c.tickers[:i], c.tickers[i+1:]...)
+			return
+		}
+	}
+}
+
+var _ delayqueue.Clock = (*Clock)(nil)
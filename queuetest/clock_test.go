@@ -0,0 +1,41 @@
+package queuetest
+
+import (
+	"testing"
+	"time"
+
+	"delayqueue"
+)
+
+func TestClock(t *testing.T) {
+	clock := NewClock(time.Unix(0, 0))
+	delivered := make(chan time.Time, 1)
+	queue := delayqueue.NewMemoryQueue("test", func(payload string) bool {
+		delivered <- clock.Now()
+		return true
+	}).WithClock(clock)
+	if err := queue.SendDelayMsg("hello", 2*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	done := queue.StartConsume()
+	defer func() {
+		queue.StopConsume()
+		<-done
+	}()
+	clock.Advance(time.Hour)
+	select {
+	case <-delivered:
+		t.Fatal("message delivered before schedule time")
+	case <-time.After(50 * time.Millisecond):
+	}
+	// 消费周期使用推进后的虚拟时间，无需等待每一次定时器触发
+	clock.Advance(time.Hour)
+	select {
+	case at := <-delivered:
+		if at.Before(time.Unix(0, 0).Add(2 * time.Hour)) {
+			t.Errorf("message delivered too early: %s", at)
+		}
+	case <-time.After(time.Second):
+		t.Error("message not delivered")
+	}
+}
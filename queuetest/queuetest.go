@@ -0,0 +1,305 @@
+// Package queuetest 提供用于测试延迟队列业务代码的 FakeQueue 及断言方法
+//
+// FakeQueue 实现了 delayqueue.Queue 接口，消息保存在内存中并使用虚拟时间，
+// 只有调用 Advance 或 Tick 时才会投递消息，投递的顺序和次数完全确定，测试无需等待真实的时间流逝：
+//
+//	q := queuetest.New(handler)
+//	svc := NewService(q) // 业务代码依赖 delayqueue.Queue
+//	svc.PlaceOrder()
+//	q.AssertScheduled(t, "order:1", q.Now().Add(30*time.Minute))
+//	q.Advance(30 * time.Minute)
+//	q.AssertDelivered(t, "order:1", 1)
+package queuetest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"delayqueue"
+)
+
+// Delivery 一次投递记录
+type Delivery struct {
+	Payload string
+	Time    time.Time // 投递时的虚拟时间
+	Ack     bool      // 回调函数的返回值
+}
+
+// FakeQueue 使用虚拟时间的内存队列，每个消费周期的流程与 DelayQueue 完全相同
+type FakeQueue struct {
+	mu       sync.Mutex
+	q        *delayqueue.DelayQueue
+	clock    *Clock
+	interval time.Duration
+	done     chan struct{}
+	stopOnce sync.Once
+
+	sent       []*delayqueue.MessageInfo
+	deliveries []*Delivery
+}
+
+// New 创建 FakeQueue，虚拟时间从当前时间（精确到秒）开始，默认配置与 delayqueue.NewDelayQueue 相同
+func New(callback func(string) bool) *FakeQueue {
+	f := &FakeQueue{
+		clock:    NewClock(time.Now().Truncate(time.Second)),
+		interval: time.Second,
+		done:     make(chan struct{}),
+	}
+	cb := func(payload string) bool {
+		ack := callback(payload)
+		f.mu.Lock()
+		f.deliveries = append(f.deliveries, &Delivery{Payload: payload, Time: f.clock.Now(), Ack: ack})
+		f.mu.Unlock()
+		return ack
+	}
+	f.q = delayqueue.NewDelayQueueWithBroker("queuetest", delayqueue.NewMemoryBroker(), cb).WithClock(f.clock)
+	return f
+}
+
+// WithDefaultRetryCount 自定义最大重试次数
+func (f *FakeQueue) WithDefaultRetryCount(count uint) *FakeQueue {
+	f.q.WithDefaultRetryCount(count)
+	return f
+}
+
+// WithMaxConsumeDuration 配置消息的超时时间
+func (f *FakeQueue) WithMaxConsumeDuration(d time.Duration) *FakeQueue {
+	f.q.WithMaxConsumeDuration(d)
+	return f
+}
+
+// WithFetchLimit 配置单次拉取消息的数量
+func (f *FakeQueue) WithFetchLimit(limit uint) *FakeQueue {
+	f.q.WithFetchLimit(limit)
+	return f
+}
+
+// WithDeadLetter 启用死信队列
+func (f *FakeQueue) WithDeadLetter(ttl time.Duration) *FakeQueue {
+	f.q.WithDeadLetter(ttl)
+	return f
+}
+
+// WithFetchInterval 配置 Advance 中消费周期的间隔，默认为 1 秒
+func (f *FakeQueue) WithFetchInterval(d time.Duration) *FakeQueue {
+	if d > 0 {
+		f.interval = d
+	}
+	return f
+}
+
+// Now 返回当前的虚拟时间
+func (f *FakeQueue) Now() time.Time {
+	return f.clock.Now()
+}
+
+// Clock 返回 FakeQueue 使用的虚拟时钟
+func (f *FakeQueue) Clock() *Clock {
+	return f.clock
+}
+
+// Advance 将虚拟时间向后推进 d，按 WithFetchInterval 配置的间隔依次执行消费周期，返回投递的次数
+func (f *FakeQueue) Advance(d time.Duration) int {
+	delivered := 0
+	for d > 0 {
+		step := f.interval
+		if step > d {
+			step = d
+		}
+		f.clock.Advance(step)
+		d -= step
+		delivered += f.Tick()
+	}
+	return delivered
+}
+
+// Tick 在当前虚拟时间执行一次消费周期，返回投递的次数
+func (f *FakeQueue) Tick() int {
+	// 内存 Broker 的操作不会返回错误
+	flow, _ := f.q.ProcessOnce()
+	return int(flow.Ready2Unack + flow.Retry2Unack)
+}
+
+// Deliveries 返回所有的投递记录，按投递顺序排列
+func (f *FakeQueue) Deliveries() []*Delivery {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*Delivery(nil), f.deliveries...)
+}
+
+// Scheduled 返回尚未到投递时间的消息，按发送顺序排列
+func (f *FakeQueue) Scheduled() []*delayqueue.MessageInfo {
+	f.mu.Lock()
+	sent := append([]*delayqueue.MessageInfo(nil), f.sent...)
+	f.mu.Unlock()
+	var scheduled []*delayqueue.MessageInfo
+	for _, msg := range sent {
+		info, err := f.q.GetMessage(context.Background(), msg.ID)
+		if err == nil && info.State == delayqueue.StagePending {
+			scheduled = append(scheduled, info)
+		}
+	}
+	return scheduled
+}
+
+// SendScheduleMsg 发送定时消息
+func (f *FakeQueue) SendScheduleMsg(payload string, t time.Time, opts ...delayqueue.SendOption) error {
+	_, err := f.SendScheduleMsgV2(payload, t, opts...)
+	return err
+}
+
+// SendScheduleMsgV2 发送定时消息，并返回消息信息
+func (f *FakeQueue) SendScheduleMsgV2(payload string, t time.Time, opts ...delayqueue.SendOption) (*delayqueue.MessageInfo, error) {
+	msg, err := f.q.SendScheduleMsgV2(payload, t, opts...)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	f.sent = append(f.sent, msg)
+	f.mu.Unlock()
+	return msg, nil
+}
+
+// SendDelayMsg 发送延时消息，投递时间基于虚拟时间计算
+func (f *FakeQueue) SendDelayMsg(payload string, duration time.Duration, opts ...delayqueue.SendOption) error {
+	return f.SendScheduleMsg(payload, f.clock.Now().Add(duration), opts...)
+}
+
+// SendDelayMsgV2 发送延时消息，并返回消息信息，投递时间基于虚拟时间计算
+func (f *FakeQueue) SendDelayMsgV2(payload string, duration time.Duration, opts ...delayqueue.SendOption) (*delayqueue.MessageInfo, error) {
+	return f.SendScheduleMsgV2(payload, f.clock.Now().Add(duration), opts...)
+}
+
+// StartConsume FakeQueue 不会启动消费协程，消息只在调用 Advance 或 Tick 时投递
+func (f *FakeQueue) StartConsume() (done <-chan struct{}) {
+	return f.done
+}
+
+// StopConsume 关闭 StartConsume 返回的 done，可以重复调用
+func (f *FakeQueue) StopConsume() {
+	f.stopOnce.Do(func() {
+		close(f.done)
+	})
+}
+
+// Stats 获取队列中各阶段的消息数量
+func (f *FakeQueue) Stats(ctx context.Context) (*delayqueue.QueueStats, error) {
+	return f.q.Stats(ctx)
+}
+
+// GetMessage 查询消息的内容及当前所处的阶段
+func (f *FakeQueue) GetMessage(ctx context.Context, idStr string) (*delayqueue.MessageInfo, error) {
+	return f.q.GetMessage(ctx, idStr)
+}
+
+// GetResult 查询消息的处理结果
+func (f *FakeQueue) GetResult(ctx context.Context, idStr string) (string, error) {
+	return f.q.GetResult(ctx, idStr)
+}
+
+// Cancel 取消消息
+func (f *FakeQueue) Cancel(ctx context.Context, idStr string) error {
+	return f.q.Cancel(ctx, idStr)
+}
+
+// Extend 延长正在处理的消息的处理超时时间，d 基于虚拟时间计算
+func (f *FakeQueue) Extend(ctx context.Context, idStr string, d time.Duration) error {
+	return f.q.Extend(ctx, idStr, d)
+}
+
+// Ack 确认正在处理的消息
+func (f *FakeQueue) Ack(ctx context.Context, idStr string) error {
+	return f.q.Ack(ctx, idStr)
+}
+
+// Nack 将正在处理的消息标记为消费失败
+func (f *FakeQueue) Nack(ctx context.Context, idStr string, reason error) error {
+	return f.q.Nack(ctx, idStr, reason)
+}
+
+// ListDead 分页遍历死信消息
+func (f *FakeQueue) ListDead(ctx context.Context, cursor string, count int64) ([]*delayqueue.DeadMessage, string, error) {
+	return f.q.ListDead(ctx, cursor, count)
+}
+
+// RequeueDead 将死信消息重新投递
+func (f *FakeQueue) RequeueDead(ctx context.Context, ids ...string) (int, error) {
+	return f.q.RequeueDead(ctx, ids...)
+}
+
+// AssertScheduled 断言存在内容为 payload、投递时间为 at（精确到秒）且尚未投递的消息
+func (f *FakeQueue) AssertScheduled(t testing.TB, payload string, at time.Time) {
+	t.Helper()
+	for _, msg := range f.Scheduled() {
+		if msg.Payload == payload && msg.Time.Unix() == at.Unix() {
+			return
+		}
+	}
+	t.Errorf("expect message %q scheduled at %s, scheduled messages: %s", payload, at.Format(time.RFC3339), describe(f.Scheduled()))
+}
+
+// AssertNotScheduled 断言不存在内容为 payload 且尚未投递的消息
+func (f *FakeQueue) AssertNotScheduled(t testing.TB, payload string) {
+	t.Helper()
+	for _, msg := range f.Scheduled() {
+		if msg.Payload == payload {
+			t.Errorf("expect message %q not scheduled, but scheduled at %s", payload, msg.Time.Format(time.RFC3339))
+			return
+		}
+	}
+}
+
+// AssertDelivered 断言内容为 payload 的消息被投递了 times 次
+func (f *FakeQueue) AssertDelivered(t testing.TB, payload string, times int) {
+	t.Helper()
+	n := 0
+	for _, d := range f.Deliveries() {
+		if d.Payload == payload {
+			n++
+		}
+	}
+	if n != times {
+		t.Errorf("expect message %q delivered %d times, actual %d", payload, times, n)
+	}
+}
+
+// AssertDead 断言内容为 payload 的消息在死信队列中
+func (f *FakeQueue) AssertDead(t testing.TB, payload string) {
+	t.Helper()
+	cursor := ""
+	for {
+		dead, next, err := f.q.ListDead(context.Background(), cursor, 100)
+		if err != nil {
+			t.Errorf("list dead messages failed: %v", err)
+			return
+		}
+		for _, msg := range dead {
+			if msg.Payload == payload {
+				return
+			}
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	t.Errorf("expect message %q in dead letter queue", payload)
+}
+
+func describe(msgs []*delayqueue.MessageInfo) string {
+	if len(msgs) == 0 {
+		return "none"
+	}
+	s := ""
+	for i, msg := range msgs {
+		if i > 0 {
+			s += ", "
+		}
+		s += msg.Payload + "@" + msg.Time.Format(time.RFC3339)
+	}
+	return s
+}
+
+var _ delayqueue.Queue = (*FakeQueue)(nil)
@@ -0,0 +1,38 @@
+package queuetest
+
+import (
+	"testing"
+	"time"
+
+	"delayqueue"
+)
+
+func TestFakeQueue(t *testing.T) {
+	q := New(func(payload string) bool {
+		return payload != "fail"
+	}).WithDeadLetter(time.Hour)
+	start := q.Now()
+	if err := q.SendDelayMsg("ok", 30*time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.SendDelayMsg("fail", time.Hour, delayqueue.WithRetryCount(2)); err != nil {
+		t.Fatal(err)
+	}
+	q.AssertScheduled(t, "ok", start.Add(30*time.Minute))
+	q.AssertScheduled(t, "fail", start.Add(time.Hour))
+
+	if n := q.Advance(29 * time.Minute); n != 0 {
+		t.Errorf("expect no delivery, actual %d", n)
+	}
+	q.Advance(time.Minute)
+	q.AssertDelivered(t, "ok", 1)
+	q.AssertNotScheduled(t, "ok")
+	q.AssertDelivered(t, "fail", 0)
+
+	q.Advance(time.Hour)
+	q.AssertDelivered(t, "fail", 3)
+	q.AssertDead(t, "fail")
+	if !q.Now().Equal(start.Add(90 * time.Minute)) {
+		t.Errorf("unexpected virtual time: %s", q.Now())
+	}
+}
@@ -0,0 +1,124 @@
+package delayqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrQueueFull pending 与 ready 中的消息数量已达到 WithMaxLength 配置的上限
+var ErrQueueFull = errors.New("queue is full")
+
+// OverflowPolicy 消息数量达到上限时的处理方式
+type OverflowPolicy int
+
+const (
+	// OverflowReject 拒绝发送，返回 ErrQueueFull
+	OverflowReject OverflowPolicy = iota
+	// OverflowEvictOldest 取消最早投递的消息以腾出空间，先从 ready 中取消，ready 为空时取消 pending 中投递时间最早的消息
+	OverflowEvictOldest
+)
+
+// WithMaxLength 配置 pending 与 ready 中消息数量的上限，为 0 表示不限制，policy 为达到上限时的处理方式
+// 用于在消费者长时间停止时保护 redis 的内存，多个生产者并发发送时上限是近似的
+// 使用消费组时每个消费组的队列分别计算
+func (q *DelayQueue) WithMaxLength(n uint, policy OverflowPolicy) *DelayQueue {
+	if q.frozen("WithMaxLength") {
+		return q
+	}
+	q.maxLength = n
+	q.overflowPolicy = policy
+	return q
+}
+
+// makeRoom 检查 target 是否还能容纳 n 条消息，按 OverflowPolicy 拒绝发送或取消最早投递的消息
+// 属于租户的队列同时检查租户的配额
+func (q *DelayQueue) makeRoom(ctx context.Context, target *DelayQueue, n int) error {
+	if q.tenant != nil {
+		if err := q.tenant.admit(ctx, n); err != nil {
+			return err
+		}
+	}
+	if q.maxLength == 0 {
+		return nil
+	}
+	stats, err := target.broker.Stats(ctx)
+	if err != nil {
+		return fmt.Errorf("get queue length failed: %v", err)
+	}
+	over := stats.Pending + stats.Ready + int64(n) - int64(q.maxLength)
+	if over <= 0 {
+		return nil
+	}
+	if q.overflowPolicy != OverflowEvictOldest || int64(n) > int64(q.maxLength) {
+		return ErrQueueFull
+	}
+	evicted, err := target.broker.Evict(ctx, over)
+	if err != nil {
+		return err
+	}
+	q.logger.Warn("queue is full, evict oldest messages", "queue", target.name, "evicted", len(evicted))
+	return nil
+}
+
+func (b *redisBroker) Evict(ctx context.Context, n int64) ([]string, error) {
+	q := b.q
+	var ids []string
+	// ready 从右侧取出，最右侧的消息最早投递
+	for _, key := range q.shardKeys(q.readyKey) {
+		if int64(len(ids)) >= n {
+			break
+		}
+		members, err := q.redisCli.LRange(ctx, key, -(n - int64(len(ids))), -1).Result()
+		if err != nil {
+			return nil, fmt.Errorf("get ready msgs failed: %v", err)
+		}
+		for i := len(members) - 1; i >= 0; i-- {
+			ids = append(ids, members[i])
+		}
+	}
+	for _, key := range q.shardKeys(q.pendingKey) {
+		if int64(len(ids)) >= n {
+			break
+		}
+		members, err := q.redisCli.ZRange(ctx, key, 0, n-int64(len(ids))-1).Result()
+		if err != nil {
+			return nil, fmt.Errorf("get pending msgs failed: %v", err)
+		}
+		ids = append(ids, members...)
+	}
+	evicted := make([]string, 0, len(ids))
+	for _, idStr := range ids {
+		err := b.Cancel(ctx, idStr)
+		if err == ErrMessageNotFound {
+			continue
+		}
+		if err != nil {
+			return evicted, err
+		}
+		evicted = append(evicted, idStr)
+	}
+	return evicted, nil
+}
+
+func (b *memoryBroker) Evict(ctx context.Context, n int64) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var ids []string
+	for _, idStr := range b.ready {
+		if int64(len(ids)) >= n {
+			break
+		}
+		ids = append(ids, idStr)
+	}
+	for _, idStr := range sortByTime(b.pending) {
+		if int64(len(ids)) >= n {
+			break
+		}
+		ids = append(ids, idStr)
+	}
+	for _, idStr := range ids {
+		b.cancel(idStr)
+	}
+	return ids, nil
+}
@@ -0,0 +1,72 @@
+package delayqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_MaxLength(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	cb := func(s string) bool {
+		return true
+	}
+	queue := NewDelayQueue("test", redisCli, cb).WithMaxLength(3, OverflowReject)
+	for i := 0; i < 3; i++ {
+		if err := queue.SendDelayMsg("msg", time.Hour); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if err := queue.SendDelayMsg("msg", time.Hour); err != ErrQueueFull {
+		t.Errorf("expect ErrQueueFull, actual %v", err)
+	}
+
+	redisCli.FlushDB(ctx)
+	queue = NewDelayQueue("test", redisCli, cb).WithMaxLength(3, OverflowEvictOldest)
+	var ids []string
+	for i := 0; i < 5; i++ {
+		msg, err := queue.SendDelayMsgV2("msg", time.Duration(i+1)*time.Minute)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		ids = append(ids, msg.ID)
+	}
+	stats, err := queue.Stats(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if stats.Pending != 3 {
+		t.Errorf("expect 3 pending messages, actual %d", stats.Pending)
+	}
+	for i, id := range ids {
+		_, err := queue.GetMessage(ctx, id)
+		if i < 2 && err != ErrMessageNotFound {
+			t.Errorf("expect message %d evicted, actual %v", i, err)
+		}
+		if i >= 2 && err != nil {
+			t.Errorf("expect message %d kept, actual %v", i, err)
+		}
+	}
+}
+
+func TestMemoryQueue_MaxLength(t *testing.T) {
+	queue := NewMemoryQueue("test", func(s string) bool {
+		return true
+	}).WithMaxLength(1, OverflowEvictOldest)
+	first, err := queue.SendDelayMsgV2("first", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := queue.SendDelayMsgV2("second", time.Hour); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := queue.GetMessage(context.Background(), first.ID); err != ErrMessageNotFound {
+		t.Errorf("expect first message evicted, actual %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package delayqueue
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// tokenBucket 令牌桶限流器
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64 // 每秒生成的令牌数
+	burst  float64 // 桶容量
+	tokens float64
+	last   time.Time // 上次补充令牌的时间，为零值时表示尚未补充
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if b.last.IsZero() {
+		b.last = now
+		return
+	}
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+}
+
+// allow 尝试获取一个令牌
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// refund 归还一个未使用的令牌
+func (b *tokenBucket) refund() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens++
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// WithRateLimit 限制消息投递速率为每秒 rate 条，burst 为允许的突发数量
+// 即使大量消息同时到期（例如故障恢复后），投递速率也不会超过下游服务的承受能力
+// 超出速率的消息会留在 ready 或 retry 中等待下一个消费周期
+func (q *DelayQueue) WithRateLimit(rate float64, burst int) *DelayQueue {
+	if q.frozen("WithRateLimit") {
+		return q
+	}
+	if rate > 0 {
+		q.limiter = newTokenBucket(rate, burst)
+	}
+	return q
+}
+
+// ErrSendRateLimited 发送速率超过 WithSendRateLimit 配置的限制
+var ErrSendRateLimited = errors.New("send rate limited")
+
+// SendLimiterState 发送限流器的当前状态
+type SendLimiterState struct {
+	Rate       float64       // 每秒生成的令牌数
+	Burst      int           // 桶容量
+	Tokens     float64       // 当前可用的令牌数
+	RetryAfter time.Duration // 距离下一个令牌可用的时间，有可用令牌时为 0
+}
+
+// state 返回限流器在 now 时刻的状态
+func (b *tokenBucket) state(now time.Time) *SendLimiterState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	s := &SendLimiterState{Rate: b.rate, Burst: int(b.burst), Tokens: b.tokens}
+	if b.tokens < 1 {
+		s.RetryAfter = time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	}
+	return s
+}
+
+// WithSendRateLimit 限制当前实例发送消息的速率为每秒 rate 条，burst 为允许的突发数量
+// 超出速率时 SendScheduleMsg 等发送方法返回 ErrSendRateLimited，避免生产者的异常循环写满队列
+// 调用方可以根据 SendLimiterState 返回的 RetryAfter 退避后重新发送，SendSpread 不受限制
+func (q *DelayQueue) WithSendRateLimit(rate float64, burst int) *DelayQueue {
+	if q.frozen("WithSendRateLimit") {
+		return q
+	}
+	if rate > 0 {
+		q.sendLimiter = newTokenBucket(rate, burst)
+	}
+	return q
+}
+
+// SendLimiterState 返回发送限流器的当前状态，未配置 WithSendRateLimit 时返回 nil
+func (q *DelayQueue) SendLimiterState() *SendLimiterState {
+	if q.sendLimiter == nil {
+		return nil
+	}
+	return q.sendLimiter.state(q.clock.Now())
+}
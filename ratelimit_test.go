@@ -0,0 +1,29 @@
+package delayqueue
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestDelayQueue_RateLimit(t *testing.T) {
+	redisCli := newTestRedis(t)
+	size := 10
+	received := 0
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		received++
+		return true
+	}).WithRateLimit(1, 3)
+	for i := 0; i < size; i++ {
+		err := queue.SendDelayMsg(strconv.Itoa(i), 0)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if err := queue.consume(); err != nil {
+		t.Errorf("consume error: %v", err)
+		return
+	}
+	if received != 3 {
+		t.Errorf("expect 3 messages delivered, actual %d", received)
+	}
+}
@@ -0,0 +1,223 @@
+package delayqueue
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RepairReport Repair 的修复结果
+type RepairReport struct {
+	// OrphanPayloads 不属于任何阶段的消息内容，已删除
+	OrphanPayloads int `json:"orphanPayloads"`
+	// MissingPayloads 消息内容已过期或丢失的消息，已从所属阶段中移除
+	MissingPayloads int `json:"missingPayloads"`
+	// OrphanRetryCounts 不属于任何阶段的重试次数记录，已删除
+	OrphanRetryCounts int `json:"orphanRetryCounts"`
+}
+
+// queueSnapshot 某一时刻各阶段中的消息ID
+type queueSnapshot struct {
+	entries     map[string][]redis.Z // key -> 按存储顺序排列的消息ID，sortedset 带有 score
+	members     map[string][]string  // 消息ID -> 所在的 key，正常情况下只有一个
+	stages      map[string]string    // key -> 阶段
+	retryCounts []string
+}
+
+// stageKeys 按消息流转顺序返回存储各阶段消息ID的 key
+func (q *DelayQueue) stageKeys() []string {
+	keys := append(q.shardKeys(q.pendingKey), q.readyKeys()...)
+	return append(keys, q.unAckKey, q.retryKey, q.garbageKey, q.deadKey)
+}
+
+// stageOf 返回 key 对应的阶段
+func (q *DelayQueue) stageOf(key string) string {
+	switch key {
+	case q.unAckKey:
+		return StageUnack
+	case q.retryKey:
+		return StageRetry
+	case q.garbageKey:
+		return StageGarbage
+	case q.deadKey:
+		return StageDead
+	}
+	if strings.HasPrefix(key, q.pendingKey) {
+		return StagePending
+	}
+	return StageReady
+}
+
+// snapshot 在同一个事务中读取所有阶段的消息ID，保证读取期间消息不会在阶段之间移动
+func (q *DelayQueue) snapshot(ctx context.Context) (*queueSnapshot, error) {
+	snapshot := &queueSnapshot{
+		entries: make(map[string][]redis.Z),
+		members: make(map[string][]string),
+		stages:  make(map[string]string),
+	}
+	for _, key := range q.stageKeys() {
+		snapshot.stages[key] = q.stageOf(key)
+	}
+
+	pipe := q.redisCli.TxPipeline()
+	zsetCmds := make(map[string]*redis.ZSliceCmd)
+	cmds := make(map[string]*redis.StringSliceCmd)
+	var streamCmd *redis.StringStringMapCmd
+	for key, stage := range snapshot.stages {
+		if q.streams && key == q.streamIndexKey() {
+			streamCmd = pipe.HGetAll(ctx, key)
+			continue
+		}
+		switch stage {
+		case StagePending, StageUnack, StageDead:
+			zsetCmds[key] = pipe.ZRangeWithScores(ctx, key, 0, -1)
+		case StageReady, StageRetry:
+			cmds[key] = pipe.LRange(ctx, key, 0, -1)
+		case StageGarbage:
+			cmds[key] = pipe.SMembers(ctx, key)
+		}
+	}
+	retryCounts := pipe.HKeys(ctx, q.retryCountKey)
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read queue snapshot failed: %v", err)
+	}
+	snapshot.retryCounts = retryCounts.Val()
+	for key, cmd := range zsetCmds {
+		snapshot.entries[key] = cmd.Val()
+	}
+	for key, cmd := range cmds {
+		for _, idStr := range cmd.Val() {
+			snapshot.entries[key] = append(snapshot.entries[key], redis.Z{Member: idStr})
+		}
+	}
+	if streamCmd != nil {
+		// 按 entry ID 排序，即消息进入 stream 的顺序
+		index := streamCmd.Val()
+		ids := make([]string, 0, len(index))
+		for idStr := range index {
+			ids = append(ids, idStr)
+		}
+		sort.Slice(ids, func(i, j int) bool {
+			return streamIDLess(index[ids[i]], index[ids[j]])
+		})
+		for _, idStr := range ids {
+			snapshot.entries[q.streamIndexKey()] = append(snapshot.entries[q.streamIndexKey()], redis.Z{Member: idStr})
+		}
+	}
+	for key, entries := range snapshot.entries {
+		for _, entry := range entries {
+			idStr := entry.Member.(string)
+			snapshot.members[idStr] = append(snapshot.members[idStr], key)
+		}
+	}
+	return snapshot, nil
+}
+
+// msgAuxSuffixes 消息内容 key 之外，以消息 key 为前缀的附属 key 的后缀，参见 genHistoryKey 等
+var msgAuxSuffixes = []string{":history", ":headers", ":owner", ":failure"}
+
+// isMsgAuxKey 判断去掉消息 key 前缀后的部分是否为附属 key，消息ID本身可以包含 ':'
+func isMsgAuxKey(s string) bool {
+	for _, suffix := range msgAuxSuffixes {
+		if strings.HasSuffix(s, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// scanPayloadIds 扫描队列中所有消息内容 key，返回对应的消息ID
+func (q *DelayQueue) scanPayloadIds(ctx context.Context) ([]string, error) {
+	prefix := q.genMsgKey("")
+	pattern := escapePattern(prefix) + "*"
+	var ids []string
+	var cursor uint64
+	for {
+		keys, next, err := q.redisCli.Scan(ctx, cursor, pattern, 1000).Result()
+		if err != nil {
+			return nil, fmt.Errorf("scan %s failed: %v", pattern, err)
+		}
+		for _, key := range keys {
+			idStr := strings.TrimPrefix(key, prefix)
+			if isMsgAuxKey(idStr) {
+				continue
+			}
+			ids = append(ids, idStr)
+		}
+		cursor = next
+		if cursor == 0 {
+			return ids, nil
+		}
+	}
+}
+
+// Repair 检测并修复不一致的数据：
+//   - 不属于任何阶段的消息内容（例如旧版本发送消息时在写入 pending 之前崩溃）将被删除
+//   - 消息内容已过期或丢失的消息将从所属阶段中移除，避免被反复投递空消息
+//   - 不属于任何阶段的重试次数记录将被删除
+//
+// Repair 会读取整个队列，建议在低峰期执行
+func (q *DelayQueue) Repair(ctx context.Context) (*RepairReport, error) {
+	if err := q.requireRedis("Repair"); err != nil {
+		return nil, err
+	}
+	snapshot, err := q.snapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	payloadIds, err := q.scanPayloadIds(ctx)
+	if err != nil {
+		return nil, err
+	}
+	report := &RepairReport{}
+	hasPayload := make(map[string]bool, len(payloadIds))
+	for _, idStr := range payloadIds {
+		hasPayload[idStr] = true
+		if _, ok := snapshot.members[idStr]; ok {
+			continue
+		}
+		// 再次确认消息确实不属于任何阶段，避免误删在扫描期间刚发送的消息
+		if _, err := q.GetMessage(ctx, idStr); err != ErrMessageNotFound {
+			continue
+		}
+		err := q.redisCli.Del(ctx, q.genMsgKey(idStr), q.genHistoryKey(idStr)).Err()
+		if err != nil {
+			return report, fmt.Errorf("delete orphan payload failed: %v", err)
+		}
+		q.redisCli.HDel(ctx, q.retryCountKey, idStr)
+		q.redisCli.HDel(ctx, q.attemptKey, idStr)
+		report.OrphanPayloads++
+	}
+	for idStr := range snapshot.members {
+		if hasPayload[idStr] {
+			continue
+		}
+		// 扫描期间消息可能已被确认，此时 Cancel 返回 ErrMessageNotFound
+		err := q.Cancel(ctx, idStr)
+		if err == ErrMessageNotFound {
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+		report.MissingPayloads++
+	}
+	for _, idStr := range snapshot.retryCounts {
+		if _, ok := snapshot.members[idStr]; ok || hasPayload[idStr] {
+			continue
+		}
+		n, err := q.redisCli.HDel(ctx, q.retryCountKey, idStr).Result()
+		if err != nil {
+			return report, fmt.Errorf("delete orphan retry count failed: %v", err)
+		}
+		q.redisCli.HDel(ctx, q.attemptKey, idStr)
+		report.OrphanRetryCounts += int(n)
+	}
+	q.logger.Info("queue repaired", "queue", q.name, "orphanPayloads", report.OrphanPayloads,
+		"missingPayloads", report.MissingPayloads, "orphanRetryCounts", report.OrphanRetryCounts)
+	return report, nil
+}
@@ -0,0 +1,68 @@
+package delayqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestDelayQueue_Repair(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	})
+	healthy, err := queue.SendDelayMsgV2("healthy", time.Hour)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	missing, err := queue.SendDelayMsgV2("missing", time.Hour)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// 消息ID可以包含 ':'
+	redisCli.Set(ctx, queue.genMsgKey("order:42"), "order", time.Hour)
+	redisCli.ZAdd(ctx, queue.pendingKey, &redis.Z{Score: float64(time.Now().Add(time.Hour).Unix()), Member: "order:42"})
+	// 模拟消息内容过期、发送中途崩溃和残留的重试次数
+	redisCli.Del(ctx, queue.genMsgKey(missing.ID))
+	redisCli.Set(ctx, queue.genMsgKey("orphan"), "orphan", time.Hour)
+	redisCli.HSet(ctx, queue.retryCountKey, "orphan-count", 3)
+
+	report, err := queue.Repair(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expect := RepairReport{OrphanPayloads: 1, MissingPayloads: 1, OrphanRetryCounts: 1}
+	if *report != expect {
+		t.Errorf("unexpected report: %+v", *report)
+	}
+	if _, err := queue.GetMessage(ctx, healthy.ID); err != nil {
+		t.Errorf("healthy message should be kept: %v", err)
+	}
+	if _, err := queue.GetMessage(ctx, "order:42"); err != nil {
+		t.Errorf("message with ':' in its id should be kept: %v", err)
+	}
+	if _, err := queue.GetMessage(ctx, missing.ID); err != ErrMessageNotFound {
+		t.Errorf("message without payload should be removed")
+	}
+	if redisCli.Exists(ctx, queue.genMsgKey("orphan")).Val() != 0 {
+		t.Errorf("orphan payload should be deleted")
+	}
+	if redisCli.HExists(ctx, queue.retryCountKey, "orphan-count").Val() {
+		t.Errorf("orphan retry count should be deleted")
+	}
+
+	report, err = queue.Repair(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if *report != (RepairReport{}) {
+		t.Errorf("expect nothing to repair, actual %+v", *report)
+	}
+}
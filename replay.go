@@ -0,0 +1,150 @@
+package delayqueue
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// WithFailureArchive 将最终处理失败的消息（最后一次投递处理失败、超过最晚投递时间、被隔离的毒消息）保存到失败归档中，
+// 包括内容、header、最后一次失败的原因及投递历史（需要启用 WithHistory 或死信队列），修复消费者后可以通过 Replay 重新发送
+// 处理超时或通过 Nack 标记失败后达到重试上限的消息在清理 garbage 时归档，失败原因和投递时间取自投递历史
+// 保留时间和数量上限与 WithAckArchive 相同，仅支持 redis，写入失败时只输出日志
+func (q *DelayQueue) WithFailureArchive(retention time.Duration, maxLen int64) *DelayQueue {
+	if q.frozen("WithFailureArchive") {
+		return q
+	}
+	if q.redisCli == nil {
+		q.invalidOption("WithFailureArchive", "failure archive requires redis")
+		return q
+	}
+	q.failureArchive = &archiveConfig{kind: archiveFailed, retention: retention, maxLen: maxLen}
+	return q
+}
+
+// archiveFailure 归档最终处理失败的消息，handleErr 为 nil 时不记录失败原因
+func (q *DelayQueue) archiveFailure(ctx context.Context, msg *Message, deliveredAt time.Time, outcome string, handleErr error) {
+	if q.failureArchive == nil {
+		return
+	}
+	now := q.clock.Now()
+	archived := &ArchivedMessage{
+		ID:          msg.ID,
+		Payload:     msg.Payload,
+		Headers:     msg.Headers,
+		Outcome:     outcome,
+		Attempt:     msg.Attempt,
+		DeliveredAt: deliveredAt,
+		FinishedAt:  now,
+		Cost:        now.Sub(deliveredAt),
+	}
+	if handleErr != nil {
+		archived.LastError = handleErr.Error()
+	}
+	if q.historyEnabled() {
+		history, err := q.GetHistory(ctx, msg.ID)
+		if err != nil {
+			q.logger.Error("get history failed", "queue", q.name, "id", msg.ID, "error", err)
+		}
+		archived.History = history
+	}
+	q.archive(ctx, q.failureArchive, archived)
+}
+
+// archiveGarbage 在清理 garbage 之前归档其中尚未归档的消息，未启用 WithFailureArchive 时不做任何处理
+// 消费失败、永久错误和毒消息在处理时已经归档，这里补充处理超时及通过 Nack 标记失败后达到重试上限的消息
+func (q *DelayQueue) archiveGarbage(ctx context.Context, ids []string) {
+	if q.failureArchive == nil || len(ids) == 0 {
+		return
+	}
+	archived, err := q.redisCli.HMGet(ctx, q.genArchiveKey(archiveFailed), ids...).Result()
+	if err != nil {
+		q.logger.Error("check failure archive failed", "queue", q.name, "error", err)
+		return
+	}
+	now := q.clock.Now()
+	for i, idStr := range ids {
+		if archived[i] != nil {
+			continue
+		}
+		msg, err := q.broker.Message(ctx, idStr)
+		if err != nil {
+			continue
+		}
+		if err := q.loadPayload(ctx, msg); err != nil {
+			q.logger.Error("load archived payload failed", "queue", q.name, "id", idStr, "error", err)
+		}
+		records, _ := q.GetHistory(ctx, idStr)
+		record := &ArchivedMessage{
+			ID:          idStr,
+			Payload:     msg.Payload,
+			Headers:     msg.Headers,
+			Outcome:     OutcomeFailed,
+			Attempt:     msg.Attempt,
+			DeliveredAt: lastDelivered(records),
+			FinishedAt:  now,
+			LastError:   lastError(records),
+		}
+		if !record.DeliveredAt.IsZero() {
+			record.Cost = now.Sub(record.DeliveredAt)
+		}
+		if record.Attempt == 0 {
+			// 进入 garbage 时投递次数已被删除，根据投递历史计算
+			for _, r := range records {
+				if r.Event == HistoryDelivered {
+					record.Attempt++
+				}
+			}
+		}
+		if q.historyEnabled() {
+			record.History = records
+		}
+		q.archive(ctx, q.failureArchive, record)
+	}
+}
+
+// GetFailed 查询失败归档中的消息，不存在或已过期时返回 ErrMessageNotFound
+func (q *DelayQueue) GetFailed(ctx context.Context, idStr string) (*ArchivedMessage, error) {
+	return q.getArchived(ctx, archiveFailed, idStr)
+}
+
+// ListFailed 按失败时间顺序返回 [from, to] 之间失败归档中的消息，count 大于 0 时最多返回 count 条
+func (q *DelayQueue) ListFailed(ctx context.Context, from, to time.Time, count int64) ([]*ArchivedMessage, error) {
+	return q.listArchived(ctx, archiveFailed, from, to, count)
+}
+
+// replayDroppedHeaders 重新发送时不保留的 header，它们记录的是原消息的投递时间
+var replayDroppedHeaders = []string{HeaderDeliverBy, HeaderScheduledAt}
+
+// Replay 将失败归档中的消息以相同的内容和 header 立即重新发送（使用新的消息ID和默认的重试次数），
+// 重新发送后从失败归档中移除，返回重新发送的消息数量，不在归档中的消息被忽略
+func (q *DelayQueue) Replay(ctx context.Context, ids ...string) (int, error) {
+	replayed := 0
+	for _, idStr := range ids {
+		msg, err := q.GetFailed(ctx, idStr)
+		if err == ErrMessageNotFound {
+			continue
+		}
+		if err != nil {
+			return replayed, err
+		}
+		headers := make(map[string]string, len(msg.Headers))
+		for k, v := range msg.Headers {
+			headers[k] = v
+		}
+		for _, k := range replayDroppedHeaders {
+			delete(headers, k)
+		}
+		if _, err := q.SendDelayMsgV2(msg.Payload, 0, WithHeaders(headers), WithContext(ctx)); err != nil {
+			return replayed, fmt.Errorf("replay msg %s failed: %v", idStr, err)
+		}
+		pipe := q.redisCli.TxPipeline()
+		pipe.HDel(ctx, q.genArchiveKey(archiveFailed), idStr)
+		pipe.ZRem(ctx, q.genArchiveIndexKey(archiveFailed), idStr)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return replayed, fmt.Errorf("remove replayed msg %s failed: %v", idStr, err)
+		}
+		replayed++
+	}
+	return replayed, nil
+}
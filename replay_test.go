@@ -0,0 +1,122 @@
+package delayqueue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_FailureArchiveReplay(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	fixed := false
+	var received []string
+	queue := NewDelayQueueWithHandler("test", redisCli, func(ctx context.Context, msg *Message) error {
+		if !fixed {
+			return errors.New("bug")
+		}
+		received = append(received, msg.Payload+":"+msg.Headers["user"])
+		return nil
+	}).WithFailureArchive(24*time.Hour, 0).WithHistory().WithDefaultRetryCount(1)
+	msg, err := queue.SendDelayMsgV2("hello", 0, WithHeader("user", "u1"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := queue.ProcessOnce(); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	// 第一次失败后仍可重试，只归档最后一次投递的失败
+	failed, err := queue.GetFailed(ctx, msg.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if failed.Outcome != OutcomeFailed || failed.LastError != "bug" || failed.Attempt != 2 ||
+		failed.Payload != "hello" || len(failed.History) == 0 {
+		t.Errorf("unexpected failure archive: %+v", failed)
+	}
+	msgs, err := queue.ListFailed(ctx, time.Now().Add(-time.Minute), time.Now().Add(time.Minute), 10)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(msgs) != 1 || msgs[0].ID != msg.ID {
+		t.Errorf("unexpected failure list: %d", len(msgs))
+	}
+	fixed = true
+	n, err := queue.Replay(ctx, msg.ID, "missing")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if n != 1 {
+		t.Errorf("expect 1 replayed, actual %d", n)
+	}
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(received) != 1 || received[0] != "hello:u1" {
+		t.Errorf("unexpected received: %v", received)
+	}
+	if _, err := queue.GetFailed(ctx, msg.ID); err != ErrMessageNotFound {
+		t.Errorf("replayed msg should be removed from archive, actual %v", err)
+	}
+}
+
+func TestDelayQueue_FailureArchiveGarbage(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	var delivered []string
+	var queue *DelayQueue
+	queue = NewDelayQueueWithHandler("test", redisCli, func(ctx context.Context, msg *Message) error {
+		delivered = append(delivered, msg.ID)
+		// 第一条消息处理超时，第二条消息通过 Nack 标记失败
+		if msg.Payload == "nack" {
+			if err := queue.Nack(context.Background(), msg.ID, errors.New("manual nack")); err != nil {
+				t.Error(err)
+			}
+		}
+		return ErrAckLater
+	}).WithFailureArchive(24*time.Hour, 0).WithHistory().WithDefaultRetryCount(0).WithMaxConsumeDuration(0)
+	for _, payload := range []string{"timeout", "nack"} {
+		if err := queue.SendDelayMsg(payload, 0, WithHeader("payload", payload)); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if err := queue.consume(); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(delivered) != 2 {
+		t.Errorf("expect 2 deliveries, actual %d", len(delivered))
+		return
+	}
+	for i := 0; i < 2; i++ {
+		if err := queue.consume(); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	expectErrors := []string{errConsumeTimeout, "manual nack"}
+	for i, id := range delivered {
+		archived, err := queue.GetFailed(ctx, id)
+		if err != nil {
+			t.Errorf("expect %s archived, actual %v", id, err)
+			continue
+		}
+		if archived.Outcome != OutcomeFailed || archived.LastError != expectErrors[i] || archived.Attempt != 1 ||
+			archived.Headers["payload"] != archived.Payload || archived.DeliveredAt.IsZero() || len(archived.History) == 0 {
+			t.Errorf("unexpected archive: %+v", archived)
+		}
+	}
+	if _, err := queue.GetMessage(ctx, delivered[0]); err != ErrMessageNotFound {
+		t.Errorf("expect garbage collected, actual %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package delayqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrResultNotFound 消息没有处理结果，或处理结果已过期
+var ErrResultNotFound = errors.New("result not found")
+
+// Reply 设置消息的处理结果，Handler 返回 nil 时处理结果会发送给通过 SendAndWait 发送该消息的生产者，
+// 同时保存在消息ID下，可以通过 GetResult 查询
+func (m *Message) Reply(result string) {
+	m.reply = &result
+}
+
+// genReplyKey list 存储等待 SendAndWait 读取的处理结果
+// 使用不含消费组的队列名称，消费组中的消费者与发送消息的生产者使用同一个 key
+func (q *DelayQueue) genReplyKey(idStr string) string {
+	return q.keyBase(q.baseName) + ":reply:" + idStr
+}
+
+// genResultKey string 存储消息的处理结果，供 GetResult 查询，与 genReplyKey 一样使用不含消费组的队列名称
+func (q *DelayQueue) genResultKey(idStr string) string {
+	return q.keyBase(q.baseName) + ":result:" + idStr
+}
+
+// WithResultTTL 自定义处理结果的保留时间，默认为 1 小时
+func (q *DelayQueue) WithResultTTL(d time.Duration) *DelayQueue {
+	if q.frozen("WithResultTTL") {
+		return q
+	}
+	if d > 0 {
+		q.resultTTL = d
+	}
+	return q
+}
+
+// GetResult 查询消息的处理结果，消息尚未处理成功或处理结果已过期时返回 ErrResultNotFound
+func (q *DelayQueue) GetResult(ctx context.Context, idStr string) (string, error) {
+	return q.broker.Result(ctx, idStr)
+}
+
+// SendAndWait 发送延时消息，并等待消费者通过 Message.Reply 返回处理结果，直到 ctx 取消或超时
+// 消费失败的消息会按重试策略重新投递，重试成功后仍可以收到处理结果
+func (q *DelayQueue) SendAndWait(ctx context.Context, payload string, duration time.Duration, opts ...SendOption) (string, error) {
+	msg, err := q.SendDelayMsgV2(payload, duration, opts...)
+	if err != nil {
+		return "", err
+	}
+	return q.broker.WaitReply(ctx, msg.ID)
+}
+
+// sendReply 发送处理结果，发送失败时只记录日志，不影响消息的确认
+func (q *DelayQueue) sendReply(ctx context.Context, msg *Message) {
+	if msg.reply == nil {
+		return
+	}
+	err := q.broker.Reply(ctx, msg.ID, *msg.reply, q.resultTTL)
+	if err != nil {
+		q.logger.Error("send reply failed", "queue", q.name, "id", msg.ID, "error", err)
+	}
+}
+
+func (b *redisBroker) Reply(ctx context.Context, idStr string, result string, ttl time.Duration) error {
+	q := b.q
+	pipe := q.redisCli.TxPipeline()
+	pipe.RPush(ctx, q.genReplyKey(idStr), result)
+	pipe.Expire(ctx, q.genReplyKey(idStr), ttl)
+	pipe.Set(ctx, q.genResultKey(idStr), result, ttl)
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("send reply failed: %v", err)
+	}
+	return nil
+}
+
+func (b *redisBroker) Result(ctx context.Context, idStr string) (string, error) {
+	q := b.q
+	result, err := q.redisCli.Get(ctx, q.genResultKey(idStr)).Result()
+	if err == redis.Nil {
+		return "", ErrResultNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("get result failed: %v", err)
+	}
+	return result, nil
+}
+
+// replyPollTimeout 单次 BLPop 的等待时间，超时后检查 ctx 是否已取消
+const replyPollTimeout = time.Second
+
+func (b *redisBroker) WaitReply(ctx context.Context, idStr string) (string, error) {
+	q := b.q
+	key := q.genReplyKey(idStr)
+	for {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		timeout := replyPollTimeout
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+			// BLPop 的超时时间精确到秒，不足一秒时使用非阻塞的 LPop
+			timeout = 0
+		}
+		if timeout == 0 {
+			result, err := q.redisCli.LPop(ctx, key).Result()
+			if err == nil {
+				return result, nil
+			}
+			if err != redis.Nil {
+				if ctx.Err() != nil {
+					return "", ctx.Err()
+				}
+				return "", fmt.Errorf("wait reply failed: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(10 * time.Millisecond):
+			}
+			continue
+		}
+		result, err := q.redisCli.BLPop(ctx, timeout, key).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			return "", fmt.Errorf("wait reply failed: %v", err)
+		}
+		return result[1], nil
+	}
+}
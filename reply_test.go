@@ -0,0 +1,74 @@
+package delayqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_SendAndWait(t *testing.T) {
+	redisCli := newTestRedis(t)
+	queue := NewDelayQueueWithHandler("test", redisCli, func(ctx context.Context, msg *Message) error {
+		if msg.Payload == "no reply" {
+			return nil
+		}
+		msg.Reply("re: " + msg.Payload)
+		return nil
+	}).WithFetchInterval(50 * time.Millisecond)
+	done := queue.StartConsume()
+	defer func() {
+		queue.StopConsume()
+		<-done
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err := queue.SendAndWait(ctx, "ping", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if result != "re: ping" {
+		t.Errorf("unexpected result: %s", result)
+	}
+
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel2()
+	_, err = queue.SendAndWait(ctx2, "no reply", 0)
+	if err != context.DeadlineExceeded {
+		t.Errorf("expect deadline exceeded, actual: %v", err)
+	}
+}
+
+func TestDelayQueue_GetResult(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	queue := NewDelayQueueWithHandler("test", redisCli, func(ctx context.Context, msg *Message) error {
+		msg.Reply("done: " + msg.Payload)
+		return nil
+	}).WithResultTTL(time.Minute)
+	msg, err := queue.SendDelayMsgV2("export", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = queue.GetResult(ctx, msg.ID); err != ErrResultNotFound {
+		t.Errorf("expect ErrResultNotFound before consume, actual: %v", err)
+	}
+	if _, err = queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	result, err := queue.GetResult(ctx, msg.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if result != "done: export" {
+		t.Errorf("unexpected result: %s", result)
+	}
+	ttl := redisCli.TTL(ctx, queue.genResultKey(msg.ID)).Val()
+	if ttl <= 0 || ttl > time.Minute {
+		t.Errorf("unexpected result ttl: %s", ttl)
+	}
+}
@@ -0,0 +1,88 @@
+package delayqueue
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// transientMarkers 表示 redis 暂时不可用的错误信息，消费流程中的错误大多以 %v 包装，无法使用 errors.As 判断
+var transientMarkers = []string{
+	"connection refused", "connection reset", "broken pipe", "i/o timeout", "EOF",
+	"no such host", "network is unreachable", "pool timeout",
+	"LOADING", "READONLY", "CLUSTERDOWN", "TRYAGAIN", "MASTERDOWN",
+}
+
+// IsTransientError 返回 err 是否为暂时性的错误，如 redis 连接失败、超时或主从切换，
+// 这类错误通常会自动恢复，其它错误（如脚本错误、数据类型错误）需要人工处理
+func IsTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, io.EOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	msg := err.Error()
+	for _, marker := range transientMarkers {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithMaxBackoff 配置 redis 暂时不可用时消费周期的最大退避时间，默认为 30 秒
+// 发生暂时性错误后，消费周期的间隔从 fetchInterval 开始按指数增长，直到 maxBackoff，恢复后立即回到正常间隔
+func (q *DelayQueue) WithMaxBackoff(d time.Duration) *DelayQueue {
+	if q.frozen("WithMaxBackoff") {
+		return q
+	}
+	q.maxBackoff = d
+	return q
+}
+
+// Degraded 返回队列是否因 redis 暂时不可用而处于降级状态
+func (q *DelayQueue) Degraded() bool {
+	return q.degraded.Load()
+}
+
+// consumeWithBackoff 执行一次消费周期，redis 暂时不可用时按指数退避跳过之后的消费周期
+// 进入降级状态时触发 QueueDegradedEvent 事件，恢复时触发 QueueRecoveredEvent 事件
+func (q *DelayQueue) consumeWithBackoff() error {
+	now := q.clock.Now()
+	if now.Before(q.backoffUntil) {
+		return nil
+	}
+	err := q.consume()
+	if err == nil || !IsTransientError(err) {
+		if q.backoffFailures > 0 {
+			q.backoffFailures = 0
+			q.backoffUntil = time.Time{}
+			q.degraded.Store(false)
+			q.logger.Info("queue recovered", "queue", q.name)
+			q.emit(QueueRecoveredEvent, 0)
+		}
+		return err
+	}
+	q.backoffFailures++
+	backoff := q.fetchInterval
+	for i := 1; i < q.backoffFailures && backoff < q.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > q.maxBackoff {
+		backoff = q.maxBackoff
+	}
+	q.backoffUntil = now.Add(backoff)
+	if q.backoffFailures == 1 {
+		q.degraded.Store(true)
+		q.logger.Warn("queue degraded", "queue", q.name, "error", err)
+		q.emit(QueueDegradedEvent, 0)
+	}
+	return err
+}
@@ -0,0 +1,59 @@
+package delayqueue
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestIsTransientError(t *testing.T) {
+	for err, expect := range map[error]bool{
+		nil: false,
+		errors.New("dial tcp 127.0.0.1:1: connect: connection refused"):                      true,
+		fmt.Errorf("pending2ReadyScript failed: %v", errors.New("LOADING Redis is loading")): true,
+		errors.New("WRONGTYPE Operation against a key holding the wrong kind of value"):      false,
+		redis.ErrClosed: false,
+	} {
+		if actual := IsTransientError(err); actual != expect {
+			t.Errorf("expect IsTransientError(%v) = %v, actual %v", err, expect, actual)
+		}
+	}
+}
+
+func TestDelayQueue_Backoff(t *testing.T) {
+	recorder := &eventRecorder{}
+	queue := NewDelayQueue("test", redis.NewClient(&redis.Options{
+		Addr:       "127.0.0.1:1",
+		MaxRetries: -1,
+	}), func(s string) bool {
+		return true
+	}).WithEventListener(recorder).WithFetchInterval(time.Minute).WithMaxBackoff(time.Hour)
+	if err := queue.consumeWithBackoff(); !IsTransientError(err) {
+		t.Errorf("expect transient error, actual: %v", err)
+	}
+	if !queue.Degraded() || len(recorder.events) != 1 || recorder.events[0].Code != QueueDegradedEvent {
+		t.Errorf("expect queue degraded, events: %d", len(recorder.events))
+	}
+	// 退避期间跳过消费周期
+	if err := queue.consumeWithBackoff(); err != nil {
+		t.Errorf("expect consume skipped during backoff, actual: %v", err)
+	}
+	queue.backoffUntil = time.Time{}
+	queue.consumeWithBackoff()
+	if backoff := queue.backoffUntil.Sub(time.Now()); backoff < time.Minute || backoff > 2*time.Minute {
+		t.Errorf("expect backoff doubled, actual: %s", backoff)
+	}
+	queue.redisCli = redis.NewClient(&redis.Options{
+		Addr: "127.0.0.1:6379",
+	})
+	queue.backoffUntil = time.Time{}
+	if err := queue.consumeWithBackoff(); err != nil {
+		t.Error(err)
+	}
+	if queue.Degraded() || len(recorder.events) != 2 || recorder.events[1].Code != QueueRecoveredEvent {
+		t.Errorf("expect queue recovered, events: %d", len(recorder.events))
+	}
+}
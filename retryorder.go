@@ -0,0 +1,81 @@
+package delayqueue
+
+// RetryOrder 消费周期中 ready 与 retry 中消息的投递顺序
+type RetryOrder int
+
+const (
+	// RetryLast 先投递 ready 中的消息，再投递 retry 中的消息，默认值
+	// 本周期内处理失败的消息会在同一周期内重试，但队列持续繁忙且设置了 fetchLimit 时重试的消息可能长时间得不到投递
+	RetryLast RetryOrder = iota
+	// RetryFirst 先投递 retry 中的消息，再投递 ready 中的消息，本周期内处理失败的消息在下一个周期重试
+	RetryFirst
+	// RetryInterleave ready 与 retry 中的消息按 WithRetryWeight 设置的比例（默认 1:1）交替投递，共用 fetchLimit，
+	// 一方没有消息时继续投递另一方，本周期内处理失败的消息在下一个周期重试
+	RetryInterleave
+)
+
+// WithRetryOrder 配置消费周期中 ready 与 retry 中消息的投递顺序，默认为 RetryLast
+// 分区模式下重试的消息放回所在分区的头部，不受该配置影响
+func (q *DelayQueue) WithRetryOrder(order RetryOrder) *DelayQueue {
+	if q.frozen("WithRetryOrder") {
+		return q
+	}
+	q.retryOrder = order
+	return q
+}
+
+// WithRetryWeight 按 fresh:retry 的比例交替投递 ready 与 retry 中的消息，例如 4:1 表示每投递 4 条新消息投递 1 条重试的消息，
+// 使大量处理失败的消息不会占满吞吐量，重试的消息也不会一直得不到投递；一方没有消息时继续投递另一方
+// 投递位置在消费周期之间保持，fetchLimit 较小时同样按比例投递，设置后投递顺序为 RetryInterleave
+func (q *DelayQueue) WithRetryWeight(fresh, retry uint) *DelayQueue {
+	if q.frozen("WithRetryWeight") {
+		return q
+	}
+	if fresh == 0 || retry == 0 {
+		q.invalidOption("WithRetryWeight", "retry weights must be positive")
+		return q
+	}
+	q.retryOrder = RetryInterleave
+	q.freshWeight, q.retryWeight = fresh, retry
+	return q
+}
+
+// retryWeights 返回交替投递的比例，默认为 1:1
+func (q *DelayQueue) retryWeights() (uint, uint) {
+	if q.freshWeight == 0 || q.retryWeight == 0 {
+		return 1, 1
+	}
+	return q.freshWeight, q.retryWeight
+}
+
+// interleave 返回按比例交替从 ready 和 retry 中取出消息的函数，并分别记录两者的流转数量
+func (q *DelayQueue) interleave() func() (string, error) {
+	fresh, retry := q.retryWeights()
+	readyEmpty, retryEmpty := false, false
+	return func() (string, error) {
+		for !readyEmpty || !retryEmpty {
+			useRetry := q.retryTurn%(fresh+retry) >= fresh
+			q.retryTurn++
+			if useRetry && retryEmpty {
+				useRetry = false
+			}
+			if !useRetry && readyEmpty {
+				useRetry = true
+			}
+			pop, counter, empty := q.ready2Unack, &q.flow.ready2Unack, &readyEmpty
+			if useRetry {
+				pop, counter, empty = q.retry2Unack, &q.flow.retry2Unack, &retryEmpty
+			}
+			idStr, err := pop()
+			if err == ErrNoMessage {
+				*empty = true
+				continue
+			}
+			if err == nil {
+				q.flow.add(counter, 1)
+			}
+			return idStr, err
+		}
+		return "", ErrNoMessage
+	}
+}
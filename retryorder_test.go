@@ -0,0 +1,100 @@
+package delayqueue
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestDelayQueue_RetryOrder(t *testing.T) {
+	redisCli := redis.NewClient(&redis.Options{
+		Addr: "127.0.0.1:6379",
+	})
+	ctx := context.Background()
+	cases := []struct {
+		order  RetryOrder
+		expect string
+	}{
+		{RetryLast, "fffrr"},
+		{RetryFirst, "rrfff"},
+		{RetryInterleave, "frfrf"},
+	}
+	for _, c := range cases {
+		redisCli.FlushDB(ctx)
+		// 处理失败的消息进入 retry，RetryFirst 使其留在 retry 中
+		failing := NewDelayQueue("test", redisCli, func(s string) bool {
+			return false
+		}).WithRetryOrder(RetryFirst)
+		for _, payload := range []string{"r1", "r2"} {
+			if err := failing.SendDelayMsg(payload, 0); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+		if _, err := failing.ProcessOnce(); err != nil {
+			t.Error(err)
+			return
+		}
+		var delivered []string
+		queue := NewDelayQueue("test", redisCli, func(s string) bool {
+			delivered = append(delivered, s[:1])
+			return true
+		}).WithRetryOrder(c.order)
+		now := time.Now()
+		for i, payload := range []string{"f1", "f2", "f3"} {
+			if err := queue.SendScheduleMsg(payload, now.Add(time.Duration(i-3)*time.Second)); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+		if _, err := queue.ProcessOnce(); err != nil {
+			t.Error(err)
+			return
+		}
+		if got := strings.Join(delivered, ""); got != c.expect {
+			t.Errorf("order %d: expected %s, got %s", c.order, c.expect, got)
+		}
+	}
+}
+
+func TestDelayQueue_RetryWeight(t *testing.T) {
+	redisCli := newTestRedis(t)
+	failing := NewDelayQueue("test", redisCli, func(s string) bool {
+		return false
+	}).WithRetryOrder(RetryFirst)
+	for _, payload := range []string{"r1", "r2", "r3"} {
+		if err := failing.SendDelayMsg(payload, 0); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if _, err := failing.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	var delivered []string
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		delivered = append(delivered, s[:1])
+		return true
+	}).WithRetryWeight(2, 1).WithFetchLimit(1)
+	now := time.Now()
+	for i := 0; i < 7; i++ {
+		if err := queue.SendScheduleMsg("f", now.Add(time.Duration(i-7)*time.Second)); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	// fetchLimit 为 1 时投递位置在消费周期之间保持，重试的消息按比例投递
+	for i := 0; i < 10; i++ {
+		if _, err := queue.ProcessOnce(); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if got := strings.Join(delivered, ""); got != "ffrffrffrf" {
+		t.Errorf("unexpected order: %s", got)
+	}
+}
@@ -0,0 +1,35 @@
+package delayqueue
+
+// Role 消费者实例在消费周期中执行的工作
+type Role int
+
+const (
+	// RoleAll 执行消费周期的所有阶段，默认值
+	RoleAll Role = iota
+	// RoleScheduler 只执行 pending2Ready、unack2Retry、垃圾回收及卡住消息的检测，不投递消息
+	RoleScheduler
+	// RoleWorker 只从 ready 和 retry 中取出消息并交给 Handler 处理，到期消息的移动、超时重试及垃圾回收由 scheduler 实例完成
+	RoleWorker
+)
+
+// WithRole 配置实例在消费周期中的角色，用于将调度和消息处理分别部署、扩容及授权
+// 使用 RoleWorker 时至少需要部署一个 RoleScheduler 或 RoleAll 的实例，否则消息不会从 pending 移入 ready；
+// RoleScheduler 实例不调用 Handler，NewDelayQueue 的 callback 可以直接返回 true
+// 分区模式下 worker 仍会将自己处理失败的消息放回所在分区，以保证同一分区的消息按顺序处理
+func (q *DelayQueue) WithRole(role Role) *DelayQueue {
+	if q.frozen("WithRole") {
+		return q
+	}
+	q.role = role
+	return q
+}
+
+// schedules 返回实例是否执行调度阶段
+func (q *DelayQueue) schedules() bool {
+	return q.role != RoleWorker
+}
+
+// works 返回实例是否投递消息
+func (q *DelayQueue) works() bool {
+	return q.role != RoleScheduler
+}
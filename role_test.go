@@ -0,0 +1,56 @@
+package delayqueue
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDelayQueue_Roles(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	scheduled, worked := 0, 0
+	scheduler := NewDelayQueue("test", redisCli, func(s string) bool {
+		scheduled++
+		return true
+	}).WithRole(RoleScheduler)
+	worker := NewDelayQueue("test", redisCli, func(s string) bool {
+		worked++
+		return worked > 1
+	}).WithRole(RoleWorker)
+	if err := worker.SendDelayMsg("foo", 0); err != nil {
+		t.Error(err)
+		return
+	}
+	assertStats := func(step string, pending, ready, unack, retry int64) {
+		t.Helper()
+		stats, err := scheduler.Stats(ctx)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if stats.Pending != pending || stats.Ready != ready || stats.Unack != unack || stats.Retry != retry {
+			t.Errorf("%s: unexpected stats %+v", step, stats)
+		}
+	}
+	steps := []struct {
+		name  string
+		queue *DelayQueue
+		check func()
+	}{
+		{"worker does not schedule", worker, func() { assertStats("worker", 1, 0, 0, 0) }},
+		{"scheduler moves to ready", scheduler, func() { assertStats("scheduler", 0, 1, 0, 0) }},
+		{"worker consumes and fails", worker, func() { assertStats("worker", 0, 0, 1, 0) }},
+		{"scheduler retries", scheduler, func() { assertStats("scheduler", 0, 0, 0, 1) }},
+		{"worker consumes retry", worker, func() { assertStats("worker", 0, 0, 0, 0) }},
+	}
+	for _, step := range steps {
+		if _, err := step.queue.ProcessOnce(); err != nil {
+			t.Errorf("%s: %v", step.name, err)
+			return
+		}
+		step.check()
+	}
+	if scheduled != 0 || worked != 2 {
+		t.Errorf("unexpected deliveries: scheduler %d, worker %d", scheduled, worked)
+	}
+}
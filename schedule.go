@@ -0,0 +1,104 @@
+package delayqueue
+
+import (
+	"errors"
+	"time"
+)
+
+// 启用 WithScheduleValidation 时发送方法返回的 *ScheduleError 包装的错误，可以使用 errors.Is 判断
+var (
+	ErrZeroScheduleTime = errors.New("zero schedule time")
+	ErrNegativeDelay    = errors.New("negative delay")
+	ErrScheduleTooFar   = errors.New("schedule exceeds max delay")
+	ErrScheduleInPast   = errors.New("schedule in the past")
+)
+
+// PastSchedulePolicy 投递时间早于当前时间的消息的处理方式
+type PastSchedulePolicy int
+
+const (
+	// PastDeliverNow 将投递时间修改为当前时间，在下一个消费周期投递，默认值
+	// 消息的过期时间从当前时间开始计算，多条早于当前时间的消息之间不再保留投递时间的先后顺序
+	PastDeliverNow PastSchedulePolicy = iota
+	// PastReject 拒绝发送，发送方法返回包装了 ErrScheduleInPast 的 *ScheduleError
+	PastReject
+	// PastClamp 将投递时间修改为当前时间加 minDelay
+	PastClamp
+)
+
+// ScheduleError 投递时间未通过校验时返回给发送方的错误，Err 为具体原因
+type ScheduleError struct {
+	At  time.Time // 请求的投递时间
+	Err error
+}
+
+func (e *ScheduleError) Error() string {
+	return "invalid schedule " + e.At.Format(time.RFC3339) + ": " + e.Err.Error()
+}
+
+func (e *ScheduleError) Unwrap() error {
+	return e.Err
+}
+
+// WithScheduleValidation 在发送消息时校验投递时间，拒绝零值时间、负数的延时以及晚于当前时间加 maxDelay 的投递时间，
+// 发送方法返回 *ScheduleError，避免因时间计算错误而保存在投递前就已过期或永远不会投递的消息
+// maxDelay 为 0 时不限制投递时间的上限；SendSpread 校验 start 和 start+window，经过抖动和工作日历调整后的投递时间同样会被校验
+func (q *DelayQueue) WithScheduleValidation(maxDelay time.Duration) *DelayQueue {
+	if q.frozen("WithScheduleValidation") {
+		return q
+	}
+	q.validateSchedule = true
+	q.maxDelay = maxDelay
+	return q
+}
+
+// WithPastSchedulePolicy 配置投递时间早于当前时间（超过一秒）的消息的处理方式，默认为 PastDeliverNow
+// minDelay 只在 PastClamp 时使用；SendSpread 按 start 处理，修改 start 时整批消息的投递时间一起后移
+func (q *DelayQueue) WithPastSchedulePolicy(policy PastSchedulePolicy, minDelay time.Duration) *DelayQueue {
+	if q.frozen("WithPastSchedulePolicy") {
+		return q
+	}
+	q.pastPolicy = policy
+	q.pastMinDelay = minDelay
+	return q
+}
+
+// adjustPast 按 PastSchedulePolicy 处理早于当前时间的投递时间 t，返回实际使用的投递时间
+// 投递时间精确到秒，早于当前时间不足一秒的视为当前时间，避免 SendDelayMsg(payload, 0) 被误判
+func (q *DelayQueue) adjustPast(t time.Time) (time.Time, error) {
+	now := q.clock.Now()
+	if t.IsZero() || now.Sub(t) < time.Second {
+		return t, nil
+	}
+	switch q.pastPolicy {
+	case PastReject:
+		return t, &ScheduleError{At: t, Err: ErrScheduleInPast}
+	case PastClamp:
+		q.debugLog("past schedule clamped", "deliverAt", t.Format(time.RFC3339))
+		return now.Add(q.pastMinDelay), nil
+	}
+	return now, nil
+}
+
+// checkSchedule 校验投递时间 t
+func (q *DelayQueue) checkSchedule(t time.Time) error {
+	if !q.validateSchedule {
+		return nil
+	}
+	if t.IsZero() {
+		return &ScheduleError{At: t, Err: ErrZeroScheduleTime}
+	}
+	if q.maxDelay > 0 && t.Sub(q.clock.Now()) > q.maxDelay {
+		return &ScheduleError{At: t, Err: ErrScheduleTooFar}
+	}
+	return nil
+}
+
+// checkDelay 校验延时 duration，不为负数时返回投递时间
+func (q *DelayQueue) checkDelay(duration time.Duration) (time.Time, error) {
+	t := q.clock.Now().Add(duration)
+	if q.validateSchedule && duration < 0 {
+		return t, &ScheduleError{At: t, Err: ErrNegativeDelay}
+	}
+	return t, nil
+}
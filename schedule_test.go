@@ -0,0 +1,118 @@
+package delayqueue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_ScheduleValidation(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	}).WithScheduleValidation(24 * time.Hour)
+	cases := []struct {
+		send   func() error
+		expect error
+	}{
+		{func() error { return queue.SendScheduleMsg("zero", time.Time{}) }, ErrZeroScheduleTime},
+		{func() error { return queue.SendDelayMsg("negative", -time.Second) }, ErrNegativeDelay},
+		{func() error { return queue.SendDelayMsg("far", 25*time.Hour) }, ErrScheduleTooFar},
+		{func() error {
+			_, err := queue.SendSpread(ctx, []string{"a", "b"}, time.Now(), 48*time.Hour)
+			return err
+		}, ErrScheduleTooFar},
+		{func() error { return queue.SendDelayMsg("ok", time.Hour) }, nil},
+	}
+	for i, c := range cases {
+		err := c.send()
+		if !errors.Is(err, c.expect) {
+			t.Errorf("case %d: expect %v, actual %v", i, c.expect, err)
+		}
+		var scheduleErr *ScheduleError
+		if c.expect != nil && !errors.As(err, &scheduleErr) {
+			t.Errorf("case %d: expect *ScheduleError, actual %T", i, err)
+		}
+	}
+	stats, err := queue.Stats(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if stats.Pending != 1 {
+		t.Errorf("only valid message should be saved, pending: %d", stats.Pending)
+	}
+}
+
+func TestDelayQueue_PastSchedulePolicy(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	past := time.Now().Add(-time.Hour)
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	})
+	msg, err := queue.SendScheduleMsgV2("default", past)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if d := time.Since(msg.Time); d < 0 || d > 2*time.Second {
+		t.Errorf("deliver time should be normalized to now, actual: %v", msg.Time)
+	}
+
+	queue.WithPastSchedulePolicy(PastReject, 0)
+	if _, err := queue.SendScheduleMsgV2("reject", past); !errors.Is(err, ErrScheduleInPast) {
+		t.Errorf("expect ErrScheduleInPast, actual: %v", err)
+	}
+	if _, err := queue.SendDelayMsgV2("now", 0); err != nil {
+		t.Errorf("message due now should not be rejected: %v", err)
+	}
+
+	queue.WithPastSchedulePolicy(PastClamp, time.Minute)
+	msg, err = queue.SendScheduleMsgV2("clamp", past)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if d := time.Until(msg.Time); d < 58*time.Second || d > time.Minute {
+		t.Errorf("deliver time should be clamped to now+minDelay, actual: %v", msg.Time)
+	}
+	ttl, err := redisCli.PTTL(ctx, queue.genMsgKey(msg.ID)).Result()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if ttl < time.Minute {
+		t.Errorf("msg ttl should be computed from clamped time, actual: %v", ttl)
+	}
+}
+
+func TestDelayQueue_PastScheduleTTL(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	})
+	// 投递时间早于当前时间超过 msgTTL
+	msg, err := queue.SendScheduleMsgV2("past", time.Now().Add(-3*time.Hour), WithMsgTTL(time.Hour), WithHeader("trace", "abc"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for _, key := range []string{queue.genMsgKey(msg.ID), queue.genHeadersKey(msg.ID)} {
+		ttl, err := redisCli.TTL(ctx, key).Result()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if ttl < 59*time.Minute || ttl > time.Hour {
+			t.Errorf("ttl of %s should be msgTTL from now, actual: %v", key, ttl)
+		}
+	}
+	info, err := queue.GetMessage(ctx, msg.ID)
+	if err != nil || info.Headers["trace"] != "abc" {
+		t.Errorf("headers should be kept: %+v, %v", info, err)
+	}
+}
@@ -0,0 +1,158 @@
+package delayqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrDuplicateMessage 使用 WithDedupKey 发送消息时，相同的去重 key 已经被其它消息使用
+var ErrDuplicateMessage = errors.New("duplicate message")
+
+// SendOption 发送消息的选项
+type SendOption func(*sendConfig)
+
+// sendConfig 发送消息的配置，由队列的默认配置和 SendOption 组成
+type sendConfig struct {
+	retryCount uint
+	msgTTL     time.Duration
+	jitter     time.Duration
+	tags       []string
+	headers    map[string]string
+	dedupKey   string
+	// partitionKey 分区 key，参见 WithPartitionKey
+	partitionKey string
+	// ctx 通过 WithContext 设置的 ctx
+	ctx context.Context
+	// calendar 调整投递时间的工作日历，参见 WithBusinessCalendar
+	calendar *Calendar
+}
+
+// WithRetryCount 给消息设置最大重试次数
+// example: queue.SendDelayMsg(payload, duration, delayqueue.WithRetryCount(3))
+func WithRetryCount(count int) SendOption {
+	return func(c *sendConfig) {
+		if count >= 0 {
+			c.retryCount = uint(count)
+		}
+	}
+}
+
+// WithMsgTTL 设置消息内容在投递时间之后的保留时间
+func WithMsgTTL(d time.Duration) SendOption {
+	return func(c *sendConfig) {
+		c.msgTTL = d
+	}
+}
+
+// WithJitter 将投递时间随机推迟 [0, maxJitter) 秒，避免大量相同延时的消息在同一秒到期
+// example: queue.SendDelayMsg(payload, time.Hour, delayqueue.WithJitter(5*time.Minute))
+func WithJitter(maxJitter time.Duration) SendOption {
+	return func(c *sendConfig) {
+		c.jitter = maxJitter
+	}
+}
+
+// WithHeader 给消息设置 header，Handler 可以通过 Message.Headers 读取
+// example: queue.SendDelayMsg(payload, duration, delayqueue.WithHeader("trace-id", traceID))
+func WithHeader(key, value string) SendOption {
+	return func(c *sendConfig) {
+		if c.headers == nil {
+			c.headers = make(map[string]string)
+		}
+		c.headers[key] = value
+	}
+}
+
+// WithHeaders 给消息设置多个 header
+func WithHeaders(headers map[string]string) SendOption {
+	return func(c *sendConfig) {
+		for k, v := range headers {
+			WithHeader(k, v)(c)
+		}
+	}
+}
+
+// WithDedupKey 使用业务 key 去重，消息内容过期之前使用相同 key 发送的消息会返回 ErrDuplicateMessage，
+// 同时返回已发送的消息ID
+// example: queue.SendDelayMsg(payload, duration, delayqueue.WithDedupKey("order:42:close"))
+func WithDedupKey(key string) SendOption {
+	return func(c *sendConfig) {
+		c.dedupKey = key
+	}
+}
+
+// genHeadersKey hash 存储消息的 header，过期时间与消息内容一致
+func (q *DelayQueue) genHeadersKey(idStr string) string {
+	return q.genMsgKey(idStr) + ":headers"
+}
+
+// genDedupKey string 存储去重 key 对应的消息ID，各消费组共用不含消费组的队列名称
+func (q *DelayQueue) genDedupKey(key string) string {
+	return q.keyBase(q.baseName) + ":dedup:" + key
+}
+
+// dedup 占用去重 key，key 已被占用时返回 ErrDuplicateMessage 及占用 key 的消息
+func (q *DelayQueue) dedup(ctx context.Context, pending *PendingMessage) (*MessageInfo, error) {
+	ttl := pending.TTL
+	if pending.dedupTTL > 0 {
+		ttl = pending.dedupTTL
+	}
+	existing, err := q.broker.Reserve(ctx, pending.DedupKey, pending.ID, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if existing != "" {
+		return &MessageInfo{ID: existing}, ErrDuplicateMessage
+	}
+	return nil, nil
+}
+
+func (b *redisBroker) Reserve(ctx context.Context, key string, idStr string, ttl time.Duration) (string, error) {
+	q := b.q
+	ok, err := q.redisCli.SetNX(ctx, q.genDedupKey(key), idStr, ttl).Result()
+	if err != nil {
+		return "", fmt.Errorf("reserve dedup key failed: %v", err)
+	}
+	if ok {
+		return "", nil
+	}
+	existing, err := q.redisCli.Get(ctx, q.genDedupKey(key)).Result()
+	if err == redis.Nil {
+		// key 恰好过期，重新占用
+		return b.Reserve(ctx, key, idStr, ttl)
+	}
+	if err != nil {
+		return "", fmt.Errorf("get dedup key failed: %v", err)
+	}
+	return existing, nil
+}
+
+func (b *redisBroker) Release(ctx context.Context, key string) error {
+	q := b.q
+	return q.redisCli.Del(ctx, q.genDedupKey(key)).Err()
+}
+
+// pushPipe 在 pipe 中保存消息内容、重试次数、header、标签索引，并将消息加入 pending
+func (q *DelayQueue) pushPipe(ctx context.Context, pipe redis.Pipeliner, msg *MessageInfo, ttl time.Duration) {
+	if q.hashStorage {
+		q.writeMsgHash(ctx, pipe, msg, ttl)
+	} else {
+		pipe.Set(ctx, q.genMsgKey(msg.ID), msg.Payload, ttl)
+		pipe.HSet(ctx, q.retryCountKey, msg.ID, msg.RetryCount)
+	}
+	if len(msg.Headers) > 0 && !q.hashStorage {
+		headers := make([]interface{}, 0, len(msg.Headers)*2)
+		for k, v := range msg.Headers {
+			headers = append(headers, k, v)
+		}
+		pipe.HSet(ctx, q.genHeadersKey(msg.ID), headers...)
+		pipe.Expire(ctx, q.genHeadersKey(msg.ID), ttl)
+	}
+	q.indexTags(ctx, pipe, msg, int64(ttl/time.Second))
+	pendingKey := q.shardKey(q.pendingKey, q.shardOf(msg.ID))
+	pipe.ZAdd(ctx, pendingKey, &redis.Z{Score: float64(msg.Time.Unix()), Member: msg.ID})
+}
@@ -0,0 +1,52 @@
+package delayqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_SendOptions(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	var received []*Message
+	queue := NewDelayQueueWithHandler("test", redisCli, func(ctx context.Context, msg *Message) error {
+		received = append(received, msg)
+		return nil
+	})
+	msg, err := queue.SendDelayMsgV2("hello", 0,
+		WithRetryCount(1),
+		WithHeader("trace-id", "abc"),
+		WithHeaders(map[string]string{"source": "test"}),
+		WithDedupKey("greeting"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	info, err := queue.GetMessage(ctx, msg.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if info.RetryCount != 1 || info.Headers["trace-id"] != "abc" || info.Headers["source"] != "test" {
+		t.Errorf("unexpected message: %+v", info)
+	}
+	dup, err := queue.SendDelayMsgV2("hello again", 0, WithDedupKey("greeting"))
+	if err != ErrDuplicateMessage || dup == nil || dup.ID != msg.ID {
+		t.Errorf("expect duplicate of %s, actual %+v %v", msg.ID, dup, err)
+	}
+	if _, err = queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(received) != 1 || received[0].Headers["trace-id"] != "abc" {
+		t.Errorf("unexpected received: %+v", received)
+		return
+	}
+	if n := redisCli.Exists(ctx, queue.genHeadersKey(msg.ID)).Val(); n != 0 {
+		t.Error("expect headers deleted after ack")
+	}
+	if _, err = queue.SendDelayMsgV2("other", time.Hour, WithDedupKey("other")); err != nil {
+		t.Error(err)
+	}
+}
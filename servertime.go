@@ -0,0 +1,116 @@
+package delayqueue
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// WithServerTime 以 redis 服务器的时间（TIME 命令）校正本地时钟，消息的投递时间、处理超时时间等均按校正后的时间计算，
+// 避免生产者、消费者所在机器之间的时钟偏差导致消息提前或延后投递、处理中的消息被提前判定为超时
+// 第一次读取时间时计算本地时钟与 redis 的偏差，之后读取时间时距上次计算超过 interval 则在后台重新计算，扣除往返耗时的一半；
+// 不会常驻后台协程，只负责发送消息的队列无需 StopConsume；计算失败或超时时沿用上次的偏差并记录日志
+// 需要在 WithClock 之后调用，校正的是当前使用的 Clock，仅支持 redis
+func (q *DelayQueue) WithServerTime(interval time.Duration) *DelayQueue {
+	if q.frozen("WithServerTime") {
+		return q
+	}
+	if q.redisCli == nil {
+		q.invalidOption("WithServerTime", "server time requires redis")
+		return q
+	}
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	return q.WithClock(&serverClock{
+		base:     q.clock,
+		cli:      q.redisCli,
+		interval: interval,
+		onError: func(err error) {
+			q.logger.Error("sync server time failed", "queue", q.name, "error", err)
+		},
+	})
+}
+
+// ClockOffset 返回启用 WithServerTime 时本地时钟与 redis 服务器时间的偏差（服务器时间减去本地时间），未启用时返回 0
+func (q *DelayQueue) ClockOffset() time.Duration {
+	c, ok := q.clock.(*serverClock)
+	if !ok {
+		return 0
+	}
+	return c.getOffset()
+}
+
+// serverTimeTimeout 每次读取服务器时间的超时时间
+const serverTimeTimeout = time.Second
+
+// serverClock 按 redis 服务器时间校正的 Clock
+// 第一次调用 Now 时同步计算偏差，之后 Now 读取缓存的偏差，距上次计算超过 interval 时启动一个协程刷新，刷新完成后协程退出
+type serverClock struct {
+	base     Clock
+	cli      redis.UniversalClient
+	interval time.Duration
+	onError  func(err error)
+
+	once sync.Once
+
+	mu      sync.Mutex
+	offset  time.Duration // 服务器时间减去本地时间
+	synced  time.Time     // 上次计算偏差的本地时间
+	syncing bool          // 是否正在后台刷新偏差
+}
+
+func (c *serverClock) Now() time.Time {
+	c.once.Do(c.sync)
+	now := c.base.Now()
+	c.mu.Lock()
+	offset := c.offset
+	// 本地时钟被回拨时同样刷新
+	refresh := !c.syncing && (now.Sub(c.synced) >= c.interval || now.Before(c.synced))
+	if refresh {
+		c.syncing = true
+	}
+	c.mu.Unlock()
+	if refresh {
+		go c.refresh()
+	}
+	return now.Add(offset)
+}
+
+func (c *serverClock) NewTicker(d time.Duration) Ticker {
+	return c.base.NewTicker(d)
+}
+
+func (c *serverClock) getOffset() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.offset
+}
+
+// refresh 在后台重新计算偏差，同一时刻只有一个
+func (c *serverClock) refresh() {
+	c.sync()
+	c.mu.Lock()
+	c.syncing = false
+	c.mu.Unlock()
+}
+
+// sync 计算本地时钟与服务器时间的偏差，失败时保留上次的偏差，在下一个 interval 后重试
+func (c *serverClock) sync() {
+	ctx, cancel := context.WithTimeout(context.Background(), serverTimeTimeout)
+	defer cancel()
+	before := c.base.Now()
+	serverTime, err := c.cli.Time(ctx).Result()
+	after := c.base.Now()
+	c.mu.Lock()
+	c.synced = after
+	if err == nil {
+		c.offset = serverTime.Sub(before.Add(after.Sub(before) / 2))
+	}
+	c.mu.Unlock()
+	if err != nil {
+		c.onError(err)
+	}
+}
@@ -0,0 +1,132 @@
+package delayqueue
+
+import (
+	"context"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// skewedClock 比系统时间慢 skew 的 Clock
+type skewedClock struct {
+	skew time.Duration
+}
+
+func (c skewedClock) Now() time.Time {
+	return time.Now().Add(-c.skew)
+}
+
+func (c skewedClock) NewTicker(d time.Duration) Ticker {
+	return realClock{}.NewTicker(d)
+}
+
+func TestDelayQueue_ServerTime(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	serverTime, err := redisCli.Time(ctx).Result()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// 生产者的时钟慢了一个小时
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	}).WithClock(skewedClock{skew: time.Hour}).WithServerTime(time.Minute)
+	msg, err := queue.SendDelayMsgV2("hello", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if d := msg.Time.Sub(serverTime); d < -2*time.Second || d > 2*time.Second {
+		t.Errorf("deliver time should follow server time, diff: %v", d)
+	}
+	if offset := queue.ClockOffset(); offset < 59*time.Minute || offset > 61*time.Minute {
+		t.Errorf("unexpected clock offset: %v", offset)
+	}
+	flow, err := queue.ProcessOnce()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if flow.Pending2Ready != 1 || flow.Unack2Ack != 1 {
+		t.Errorf("unexpected flow: %+v", flow)
+	}
+}
+
+// driftingClock 与系统时间的偏差可以在运行中修改的 Clock
+type driftingClock struct {
+	skew atomic.Int64
+}
+
+func (c *driftingClock) Now() time.Time {
+	return time.Now().Add(-time.Duration(c.skew.Load()))
+}
+
+func (c *driftingClock) NewTicker(d time.Duration) Ticker {
+	return realClock{}.NewTicker(d)
+}
+
+func TestDelayQueue_ServerTimeRefresh(t *testing.T) {
+	redisCli := newTestRedis(t)
+	clock := &driftingClock{}
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	}).WithClock(clock).WithServerTime(50 * time.Millisecond)
+	queue.clock.Now()
+	if offset := queue.ClockOffset(); offset < -time.Second || offset > time.Second {
+		t.Errorf("unexpected clock offset: %v", offset)
+	}
+	// 本地时钟变慢后，下一次读取时间时在后台刷新偏差
+	clock.skew.Store(int64(time.Hour))
+	queue.clock.Now()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if offset := queue.ClockOffset(); offset > 59*time.Minute && offset < 61*time.Minute {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("offset should be refreshed in background: %v", queue.ClockOffset())
+}
+
+func TestDelayQueue_ServerTimeNoLeak(t *testing.T) {
+	redisCli := newTestRedis(t)
+	before := runtime.NumGoroutine()
+	// 只发送消息的队列不调用 StopConsume
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	}).WithServerTime(10 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if err := queue.SendDelayMsg("foo", time.Hour); err != nil {
+			t.Error(err)
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("goroutine leaked: %d -> %d", before, after)
+	}
+}
+
+func TestDelayQueue_ServerTimeUnavailable(t *testing.T) {
+	redisCli := redis.NewClient(&redis.Options{
+		Addr: "127.0.0.1:6379",
+	})
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	}).WithServerTime(time.Minute)
+	defer queue.StopConsume()
+	redisCli.Close()
+	// 无法读取服务器时间时沿用本地时钟
+	now := time.Now()
+	if d := queue.clock.Now().Sub(now); d < -time.Second || d > time.Second {
+		t.Errorf("expect local time, diff: %v", d)
+	}
+}
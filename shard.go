@@ -0,0 +1,60 @@
+package delayqueue
+
+import (
+	"hash/crc32"
+	"strconv"
+)
+
+// WithShards 将 pending 和 ready 拆分为 n 个分片，消息按 ID 散列到各个分片，消费者轮询各个分片
+// 用于缓解高吞吐场景下单个 sortedset/list 成为 redis 热点 key 的问题
+// 同一队列的生产者和消费者必须使用相同的分片数
+func (q *DelayQueue) WithShards(n uint) *DelayQueue {
+	if q.frozen("WithShards") {
+		return q
+	}
+	if n > 1 && q.compat {
+		q.invalidOption("WithShards", "shards can not be used with upstream compat")
+		return q
+	}
+	if n > 0 {
+		q.shards = n
+	}
+	return q
+}
+
+// shardKey 返回分片对应的 key，第 0 个分片沿用未分片时的 key 以兼容已有数据
+func (q *DelayQueue) shardKey(key string, shard uint) string {
+	if shard == 0 {
+		return key
+	}
+	return key + ":" + strconv.FormatUint(uint64(shard), 10)
+}
+
+// shardKeys 返回 key 的所有分片
+func (q *DelayQueue) shardKeys(key string) []string {
+	keys := make([]string, 0, q.shards)
+	for shard := uint(0); shard < q.shards; shard++ {
+		keys = append(keys, q.shardKey(key, shard))
+	}
+	return keys
+}
+
+// shardOf 返回消息所属的分片，启用 WithPartitions 时只使用消息ID中的分区 key 计算
+func (q *DelayQueue) shardOf(idStr string) uint {
+	if q.shards <= 1 {
+		return 0
+	}
+	if q.partitions != nil {
+		if tag := hashTag(idStr); tag != "" {
+			idStr = tag
+		}
+	}
+	return uint(crc32.ChecksumIEEE([]byte(idStr))) % q.shards
+}
+
+// nextShard 返回下一个要消费的 ready 分片
+func (q *DelayQueue) nextShard() uint {
+	shard := q.shardCursor % q.shards
+	q.shardCursor++
+	return shard
+}
@@ -0,0 +1,43 @@
+package delayqueue
+
+import (
+	"context"
+	"strconv"
+	"testing"
+)
+
+func TestDelayQueue_Shards(t *testing.T) {
+	redisCli := newTestRedis(t)
+	size := 20
+	deliveryCount := make(map[string]int)
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		deliveryCount[s]++
+		return true
+	}).WithShards(4)
+	for i := 0; i < size; i++ {
+		err := queue.SendDelayMsg(strconv.Itoa(i), 0)
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	stats, err := queue.Stats(context.Background())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if stats.Pending != int64(size) {
+		t.Errorf("expect %d pending, actual %d", size, stats.Pending)
+	}
+	if err := queue.consume(); err != nil {
+		t.Errorf("consume error: %v", err)
+		return
+	}
+	if len(deliveryCount) != size {
+		t.Errorf("expect %d messages delivered, actual %d", size, len(deliveryCount))
+	}
+	for k, v := range deliveryCount {
+		if v != 1 {
+			t.Errorf("expect 1 delivery, actual %d. key: %s", v, k)
+		}
+	}
+}
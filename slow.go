@@ -0,0 +1,99 @@
+package delayqueue
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// slowWindowSize 计算处理耗时分位数时使用的最近样本数量
+const slowWindowSize = 1024
+
+// ConsumeDurationStats 最近若干次 Handler 处理耗时的分位数
+type ConsumeDurationStats struct {
+	Count int // 参与统计的样本数量，最多为最近 1024 次
+	P50   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+// slowConsumer 记录 Handler 的处理耗时并检测慢消息
+type slowConsumer struct {
+	threshold time.Duration
+	hook      func(msg *Message, cost time.Duration)
+	mu        sync.Mutex
+	samples   []time.Duration // 环形缓冲区
+	next      int
+}
+
+// WithSlowConsumer 记录 Handler 的处理耗时，可以通过 ConsumeDurationStats 查询最近的 p95/p99
+// 处理耗时超过 threshold 时调用 hook 并输出日志，用于找出导致队列延迟的消息，threshold 为 0 时只统计耗时
+// hook 在消费协程中同步调用，不应执行耗时操作
+func (q *DelayQueue) WithSlowConsumer(threshold time.Duration, hook func(msg *Message, cost time.Duration)) *DelayQueue {
+	if q.frozen("WithSlowConsumer") {
+		return q
+	}
+	q.slow = &slowConsumer{
+		threshold: threshold,
+		hook:      hook,
+		samples:   make([]time.Duration, 0, slowWindowSize),
+	}
+	return q
+}
+
+// ConsumeDurationStats 返回当前实例最近的处理耗时统计，未启用 WithSlowConsumer 时返回 nil
+func (q *DelayQueue) ConsumeDurationStats() *ConsumeDurationStats {
+	if q.slow == nil {
+		return nil
+	}
+	return q.slow.stats()
+}
+
+// observeConsume 记录一次处理耗时，超过阈值时通知 hook
+func (q *DelayQueue) observeConsume(msg *Message, cost time.Duration) {
+	s := q.slow
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if len(s.samples) < slowWindowSize {
+		s.samples = append(s.samples, cost)
+	} else {
+		s.samples[s.next] = cost
+		s.next = (s.next + 1) % slowWindowSize
+	}
+	s.mu.Unlock()
+	if s.threshold <= 0 || cost <= s.threshold {
+		return
+	}
+	q.logger.Warn("slow consume", "queue", q.name, "id", msg.ID, "cost", cost, "threshold", s.threshold)
+	if s.hook != nil {
+		s.hook(msg, cost)
+	}
+}
+
+func (s *slowConsumer) stats() *ConsumeDurationStats {
+	s.mu.Lock()
+	sorted := append([]time.Duration(nil), s.samples...)
+	s.mu.Unlock()
+	stats := &ConsumeDurationStats{Count: len(sorted)}
+	if len(sorted) == 0 {
+		return stats
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	percentile := func(p float64) time.Duration {
+		i := int(p*float64(len(sorted))+0.5) - 1
+		if i < 0 {
+			i = 0
+		}
+		return sorted[i]
+	}
+	stats.P50 = percentile(0.50)
+	stats.P95 = percentile(0.95)
+	stats.P99 = percentile(0.99)
+	stats.Max = sorted[len(sorted)-1]
+	return stats
+}
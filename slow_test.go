@@ -0,0 +1,42 @@
+package delayqueue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_SlowConsumer(t *testing.T) {
+	redisCli := newTestRedis(t)
+	var slow []string
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		if s == "slow" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		return true
+	}).WithSlowConsumer(30*time.Millisecond, func(msg *Message, cost time.Duration) {
+		if cost < 50*time.Millisecond {
+			t.Errorf("unexpected cost: %s", cost)
+		}
+		slow = append(slow, msg.Payload)
+	})
+	if stats := queue.ConsumeDurationStats(); stats.Count != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	for _, payload := range []string{"fast", "fast", "fast", "slow"} {
+		if err := queue.SendDelayMsg(payload, 0); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(slow) != 1 || slow[0] != "slow" {
+		t.Errorf("unexpected slow messages: %v", slow)
+	}
+	stats := queue.ConsumeDurationStats()
+	if stats.Count != 4 || stats.P50 >= 30*time.Millisecond || stats.P99 < 50*time.Millisecond || stats.Max != stats.P99 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
@@ -0,0 +1,142 @@
+package delayqueue
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// spreadBatchSize SendSpread 每个事务写入的消息数量
+const spreadBatchSize = 1000
+
+// SendSpread 将 payloads 均匀地分布在 [start, start+window) 内发送，用于平滑大批量的推送，
+// 第 i 条消息的投递时间为 start + window*i/len(payloads)（精确到秒），opts 与 SendScheduleMsg 相同，WithDedupKey 不生效
+// 消息按批写入 redis，返回错误时之前的批次已经发送成功，返回值为已发送的消息
+func (q *DelayQueue) SendSpread(ctx context.Context, payloads []string, start time.Time, window time.Duration, opts ...SendOption) ([]*MessageInfo, error) {
+	if q.deleted.Load() {
+		return nil, ErrQueueDeleted
+	}
+	if q.configErr != nil {
+		return nil, q.configErr
+	}
+	if q.validateSchedule && window < 0 {
+		return nil, &ScheduleError{At: start.Add(window), Err: ErrNegativeDelay}
+	}
+	if err := q.checkSchedule(start); err != nil {
+		return nil, err
+	}
+	if err := q.checkSchedule(start.Add(window)); err != nil {
+		return nil, err
+	}
+	start, err := q.adjustPast(start)
+	if err != nil {
+		return nil, err
+	}
+	sent := make([]*MessageInfo, 0, len(payloads))
+	for i := 0; i < len(payloads); i += spreadBatchSize {
+		end := i + spreadBatchSize
+		if end > len(payloads) {
+			end = len(payloads)
+		}
+		batch := make([]*PendingMessage, 0, end-i)
+		for j := i; j < end; j++ {
+			offset := time.Duration(int64(window) * int64(j) / int64(len(payloads)))
+			pending, err := q.newMessage(payloads[j], start.Add(offset), opts...)
+			if err != nil {
+				return sent, err
+			}
+			err = q.intercept(ctx, pending, 0, func(ctx context.Context, msg *PendingMessage) error {
+				batch = append(batch, msg)
+				return nil
+			})
+			if err != nil {
+				return sent, err
+			}
+		}
+		msgs, err := q.pushMany(ctx, batch)
+		if err != nil {
+			return sent, err
+		}
+		for _, msg := range msgs {
+			q.recordStatus(ctx, msg.ID, StatusScheduled, msg.Time)
+			q.recordHistory(ctx, msg.ID, &HistoryRecord{Time: q.clock.Now().Unix(), Event: HistoryEnqueued})
+		}
+		q.incCounter(MetricSent, int64(len(msgs)))
+		ids := make([]string, 0, len(msgs))
+		for _, msg := range msgs {
+			ids = append(ids, msg.ID)
+		}
+		q.audit(ctx, AuditSend, ids...)
+		if len(msgs) > 0 {
+			q.publishWakeup(ctx, msgs[0].Time)
+		}
+		sent = append(sent, msgs...)
+	}
+	q.debugLog("messages spread", "count", len(sent), "start", start.Format(time.RFC3339), "window", window)
+	return sent, nil
+}
+
+// pushMany 批量保存消息，消费组的处理与 push 相同
+func (q *DelayQueue) pushMany(ctx context.Context, msgs []*PendingMessage) ([]*MessageInfo, error) {
+	result := make([]*MessageInfo, 0, len(msgs))
+	for _, msg := range msgs {
+		result = append(result, msg.MessageInfo)
+	}
+	if q.redisCli == nil {
+		if err := q.makeRoom(ctx, q, len(msgs)); err != nil {
+			return nil, err
+		}
+		return result, q.pushManyStored(ctx, q, msgs)
+	}
+	groups, err := q.Groups(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		target := q.groupQueue("")
+		if err := q.makeRoom(ctx, target, len(msgs)); err != nil {
+			return nil, err
+		}
+		return result, q.pushManyStored(ctx, target, msgs)
+	}
+	for i, group := range groups {
+		copied := make([]*PendingMessage, 0, len(msgs))
+		for _, msg := range msgs {
+			info := *msg.MessageInfo
+			if i > 0 {
+				info.ID, err = q.copyID(msg.MessageInfo, group)
+				if err != nil {
+					return nil, err
+				}
+			}
+			copied = append(copied, &PendingMessage{MessageInfo: &info, TTL: msg.TTL})
+		}
+		target := q.groupQueue(group)
+		if err := q.makeRoom(ctx, target, len(copied)); err != nil {
+			return nil, err
+		}
+		err := q.pushManyStored(ctx, target, copied)
+		if err != nil {
+			return nil, fmt.Errorf("push to group %s failed: %v", group, err)
+		}
+		if i == 0 || group == q.group {
+			for j, msg := range copied {
+				result[j] = msg.MessageInfo
+			}
+		}
+	}
+	return result, nil
+}
+
+func (b *redisBroker) PushMany(ctx context.Context, msgs []*PendingMessage) error {
+	q := b.q
+	pipe := q.redisCli.TxPipeline()
+	for _, msg := range msgs {
+		q.pushPipe(ctx, pipe, msg.MessageInfo, msg.TTL)
+	}
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("store msgs failed: %v", err)
+	}
+	return nil
+}
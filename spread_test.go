@@ -0,0 +1,43 @@
+package delayqueue
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_SendSpread(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	queue := NewDelayQueue("test", redisCli, func(string) bool { return true })
+	payloads := make([]string, 2500)
+	for i := range payloads {
+		payloads[i] = strconv.Itoa(i)
+	}
+	start := time.Now().Add(time.Hour).Truncate(time.Second)
+	msgs, err := queue.SendSpread(ctx, payloads, start, 30*time.Minute)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(msgs) != len(payloads) {
+		t.Errorf("expect %d messages, actual %d", len(payloads), len(msgs))
+		return
+	}
+	for i, msg := range msgs {
+		expect := start.Add(time.Duration(i) * 30 * time.Minute / time.Duration(len(payloads))).Truncate(time.Second)
+		if !msg.Time.Equal(expect) || msg.Payload != payloads[i] {
+			t.Errorf("message %d: expect %s at %s, actual %s at %s", i, payloads[i], expect, msg.Payload, msg.Time)
+			return
+		}
+	}
+	stats, err := queue.Stats(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if stats.Pending != int64(len(payloads)) {
+		t.Errorf("expect %d pending, actual %d", len(payloads), stats.Pending)
+	}
+}
@@ -0,0 +1,60 @@
+package delayqueue
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// QueueStats 队列中各阶段的消息数量
+type QueueStats struct {
+	Pending int64 `json:"pending"` // 未到投递时间
+	Ready   int64 `json:"ready"`   // 已到投递时间，等待投递
+	Unack   int64 `json:"unack"`   // 已投递，等待确认
+	Retry   int64 `json:"retry"`   // 等待重试
+	Garbage int64 `json:"garbage"` // 已达重试上限，等待清理
+	Dead    int64 `json:"dead"`    // 死信队列中的消息
+}
+
+// Stats 获取队列中各阶段的消息数量
+func (q *DelayQueue) Stats(ctx context.Context) (*QueueStats, error) {
+	return q.broker.Stats(ctx)
+}
+
+func (b *redisBroker) Stats(ctx context.Context) (*QueueStats, error) {
+	q := b.q
+	pipe := q.redisCli.Pipeline()
+	pending := make([]*redis.IntCmd, 0, q.shards)
+	for _, key := range q.shardKeys(q.pendingKey) {
+		pending = append(pending, pipe.ZCard(ctx, key))
+	}
+	ready := make([]*redis.IntCmd, 0, q.shards)
+	for _, key := range q.shardKeys(q.readyKey) {
+		ready = append(ready, pipe.LLen(ctx, key))
+	}
+	if q.streams {
+		ready = append(ready, pipe.HLen(ctx, q.streamIndexKey()))
+	}
+	unack := pipe.ZCard(ctx, q.unAckKey)
+	retry := pipe.LLen(ctx, q.retryKey)
+	garbage := pipe.SCard(ctx, q.garbageKey)
+	dead := pipe.ZCard(ctx, q.deadKey)
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get queue stats failed: %v", err)
+	}
+	stats := &QueueStats{
+		Unack:   unack.Val(),
+		Retry:   retry.Val(),
+		Garbage: garbage.Val(),
+		Dead:    dead.Val(),
+	}
+	for _, cmd := range pending {
+		stats.Pending += cmd.Val()
+	}
+	for _, cmd := range ready {
+		stats.Ready += cmd.Val()
+	}
+	return stats, nil
+}
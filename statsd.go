@@ -0,0 +1,85 @@
+package delayqueue
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// StatsDMetrics 通过 UDP 将指标以 StatsD 协议发送，计数器使用 c 类型，耗时使用 ms 类型
+// 默认将标签值拼接到指标名称中，如 prefix.orders.sent，启用 WithDogStatsDTags 后改为 DogStatsD 的标签格式
+type StatsDMetrics struct {
+	conn      net.Conn
+	prefix    string
+	dogStatsD bool
+}
+
+// NewStatsDMetrics 创建发送到 addr 的 StatsD 上报器，prefix 为指标名称的前缀，可以为空
+func NewStatsDMetrics(addr string, prefix string) (*StatsDMetrics, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial statsd failed: %v", err)
+	}
+	return &StatsDMetrics{conn: conn, prefix: prefix}, nil
+}
+
+// WithDogStatsDTags 使用 DogStatsD 的标签格式发送标签，如 prefix.sent:1|c|#queue:orders
+func (m *StatsDMetrics) WithDogStatsDTags() *StatsDMetrics {
+	m.dogStatsD = true
+	return m
+}
+
+// IncCounter 发送计数器
+func (m *StatsDMetrics) IncCounter(name string, delta int64, tags ...string) {
+	m.send(name, fmt.Sprintf("%d|c", delta), tags)
+}
+
+// ObserveDuration 发送耗时，单位为毫秒
+func (m *StatsDMetrics) ObserveDuration(name string, d time.Duration, tags ...string) {
+	m.send(name, fmt.Sprintf("%d|ms", d.Milliseconds()), tags)
+}
+
+// Close 关闭连接
+func (m *StatsDMetrics) Close() error {
+	return m.conn.Close()
+}
+
+func (m *StatsDMetrics) send(name string, value string, tags []string) {
+	var b strings.Builder
+	if m.prefix != "" {
+		b.WriteString(m.prefix)
+		b.WriteByte('.')
+	}
+	if !m.dogStatsD {
+		for i := 1; i < len(tags); i += 2 {
+			b.WriteString(sanitizeStatsD(tags[i]))
+			b.WriteByte('.')
+		}
+	}
+	b.WriteString(name)
+	b.WriteByte(':')
+	b.WriteString(value)
+	if m.dogStatsD && len(tags) > 1 {
+		b.WriteString("|#")
+		for i := 0; i+1 < len(tags); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(sanitizeStatsD(tags[i]))
+			b.WriteByte(':')
+			b.WriteString(sanitizeStatsD(tags[i+1]))
+		}
+	}
+	// UDP 发送失败时丢弃指标，不影响队列
+	_, _ = m.conn.Write([]byte(b.String()))
+}
+
+// statsDReplacer 替换 StatsD 协议中有特殊含义的字符
+var statsDReplacer = strings.NewReplacer(":", "_", "|", "_", "@", "_", "#", "_", ",", "_", ".", "_", " ", "_")
+
+func sanitizeStatsD(s string) string {
+	return statsDReplacer.Replace(s)
+}
+
+var _ Metrics = (*StatsDMetrics)(nil)
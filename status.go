@@ -0,0 +1,116 @@
+package delayqueue
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// JobStatus 消息的业务状态，用于向用户展示任务的进度
+type JobStatus string
+
+const (
+	StatusScheduled JobStatus = "scheduled" // 等待投递
+	StatusReady     JobStatus = "ready"     // 已到投递时间，等待消费者处理
+	StatusRunning   JobStatus = "running"   // 消费者正在处理
+	StatusSucceeded JobStatus = "succeeded" // 处理成功
+	StatusFailed    JobStatus = "failed"    // 最近一次处理失败，有剩余重试次数时会重新投递
+	StatusDead      JobStatus = "dead"      // 达到重试上限，进入死信队列
+	StatusExpired   JobStatus = "expired"   // 超过最晚投递时间，未投递给消费者
+)
+
+// statusAtField 状态 hash 中保存投递时间的字段
+const statusAtField = "at"
+
+// StatusInfo 消息的当前状态及进入各状态的时间
+type StatusInfo struct {
+	ID     string
+	Status JobStatus
+	// Times 最近一次进入各状态的时间
+	Times map[JobStatus]time.Time
+}
+
+// genStatusKey hash 存储消息的状态，各消费组共用不含消费组的队列名称
+func (q *DelayQueue) genStatusKey(idStr string) string {
+	return q.keyBase(q.baseName) + ":status:" + idStr
+}
+
+// WithStatusTracking 启用消息状态跟踪，状态在最后一次更新后保留 ttl
+// 生产者和消费者需要同时启用，可以通过 GetStatus 查询消息的状态
+func (q *DelayQueue) WithStatusTracking(ttl time.Duration) *DelayQueue {
+	if q.frozen("WithStatusTracking") {
+		return q
+	}
+	q.statusTTL = ttl
+	return q
+}
+
+// recordStatus 更新消息的状态，at 为消息的投递时间，为零值时不更新
+func (q *DelayQueue) recordStatus(ctx context.Context, idStr string, status JobStatus, at time.Time) {
+	if q.statusTTL <= 0 {
+		return
+	}
+	err := q.broker.SetStatus(ctx, idStr, status, q.clock.Now(), at, q.statusTTL)
+	if err != nil {
+		q.logger.Error("record status failed", "queue", q.name, "id", idStr, "status", status, "error", err)
+	}
+}
+
+// GetStatus 查询消息的状态，未启用状态跟踪或状态已过期时返回 ErrMessageNotFound
+// 处于 scheduled 状态的消息到达投递时间后视为 ready，进入 ready 的时间为投递时间
+func (q *DelayQueue) GetStatus(ctx context.Context, idStr string) (*StatusInfo, error) {
+	info, at, err := q.broker.Status(ctx, idStr)
+	if err != nil {
+		return nil, err
+	}
+	if info.Status == StatusScheduled && !at.IsZero() && !at.After(q.clock.Now()) {
+		info.Status = StatusReady
+		info.Times[StatusReady] = at
+	}
+	return info, nil
+}
+
+func (b *redisBroker) SetStatus(ctx context.Context, idStr string, status JobStatus, now time.Time, at time.Time, ttl time.Duration) error {
+	q := b.q
+	key := q.genStatusKey(idStr)
+	values := []interface{}{"status", string(status), string(status), now.UnixMilli()}
+	if !at.IsZero() {
+		values = append(values, statusAtField, at.Unix())
+	}
+	pipe := q.redisCli.Pipeline()
+	pipe.HSet(ctx, key, values...)
+	pipe.Expire(ctx, key, ttl)
+	_, err := pipe.Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("set status failed: %v", err)
+	}
+	return nil
+}
+
+func (b *redisBroker) Status(ctx context.Context, idStr string) (*StatusInfo, time.Time, error) {
+	q := b.q
+	fields, err := q.redisCli.HGetAll(ctx, q.genStatusKey(idStr)).Result()
+	if err != nil && err != redis.Nil {
+		return nil, time.Time{}, fmt.Errorf("get status failed: %v", err)
+	}
+	if len(fields) == 0 {
+		return nil, time.Time{}, ErrMessageNotFound
+	}
+	info := &StatusInfo{ID: idStr, Status: JobStatus(fields["status"]), Times: make(map[JobStatus]time.Time)}
+	var at time.Time
+	for field, value := range fields {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		if field == statusAtField {
+			at = time.Unix(n, 0)
+		} else {
+			info.Times[JobStatus(field)] = time.UnixMilli(n)
+		}
+	}
+	return info, at, nil
+}
@@ -0,0 +1,65 @@
+package delayqueue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_GetStatus(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	queue := NewDelayQueueWithHandler("test", redisCli, func(ctx context.Context, msg *Message) error {
+		if msg.Payload == "fail" {
+			return errors.New("fail")
+		}
+		return nil
+	}).WithStatusTracking(time.Hour).WithDefaultRetryCount(0).WithDeadLetter(time.Hour)
+	ids := map[string]string{}
+	for _, payload := range []string{"ok", "fail"} {
+		msg, err := queue.SendDelayMsgV2(payload, 0)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		ids[payload] = msg.ID
+	}
+	later, err := queue.SendDelayMsgV2("later", time.Hour)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ids["later"] = later.ID
+
+	info, err := queue.GetStatus(ctx, ids["ok"])
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if info.Status != StatusReady || info.Times[StatusScheduled].IsZero() || info.Times[StatusReady].IsZero() {
+		t.Errorf("expect ok ready before consume, actual: %+v", info)
+	}
+	if _, err = queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	expect := map[string]JobStatus{"ok": StatusSucceeded, "fail": StatusDead, "later": StatusScheduled}
+	for payload, status := range expect {
+		info, err := queue.GetStatus(ctx, ids[payload])
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if info.Status != status {
+			t.Errorf("expect %s %s, actual %s", payload, status, info.Status)
+		}
+	}
+	info, _ = queue.GetStatus(ctx, ids["ok"])
+	if info.Times[StatusRunning].IsZero() || info.Times[StatusSucceeded].Before(info.Times[StatusRunning]) {
+		t.Errorf("unexpected status times: %+v", info.Times)
+	}
+	if _, err = queue.GetStatus(ctx, "unknown"); err != ErrMessageNotFound {
+		t.Errorf("expect ErrMessageNotFound, actual: %v", err)
+	}
+}
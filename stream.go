@@ -0,0 +1,215 @@
+package delayqueue
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// streamGroup ready stream 的消费者组，同一队列的所有消费者属于同一个消费者组
+const streamGroup = "delayqueue"
+
+// WithStreams 使用 redis stream 代替 list 存储 ready 阶段的消息，需要 redis 6.2 及以上版本
+// 到期的消息被追加到 {prefix}{name}:ready:stream 中，消费者以 WithConsumerID 设置的ID加入消费者组，
+// 通过 XREADGROUP 取出消息后再移入 unack，多个消费者之间由 redis 公平地分配消息；
+// 取出后未能移入 unack 的消息（例如消费者在此期间崩溃）保留在消费者组的 pending entries 中，
+// 空闲超过 maxConsumeDuration 后由其它消费者通过 XAUTOCLAIM 接管
+// 启用后 ready 不再分片，pending、unack、retry 等其它阶段不受影响；
+// Evict（WithMaxLength）和 Lag 不包含 stream 中的消息
+// 同一队列的生产者和消费者必须同时启用，切换前应确保 ready 中没有消息，仅支持 redis
+func (q *DelayQueue) WithStreams() *DelayQueue {
+	if q.frozen("WithStreams") {
+		return q
+	}
+	if q.partitions != nil {
+		q.invalidOption("WithStreams", "streams can not be used with partitions")
+		return q
+	}
+	if q.compat {
+		q.invalidOption("WithStreams", "streams can not be used with upstream compat")
+		return q
+	}
+	q.streams = true
+	return q
+}
+
+// streamKey stream 存储 ready 阶段的消息，每条 entry 的 id 字段为消息ID
+func (q *DelayQueue) streamKey() string {
+	return q.readyKey + ":stream"
+}
+
+// streamIndexKey hash 存储 ready stream 中的消息，消息ID -> entry ID，用于查询、统计和取消
+func (q *DelayQueue) streamIndexKey() string {
+	return q.readyKey + ":stream:index"
+}
+
+// readyKeys 返回存储 ready 阶段消息的 key，启用 WithStreams 时最后一个为 stream 的索引
+func (q *DelayQueue) readyKeys() []string {
+	keys := q.shardKeys(q.readyKey)
+	if q.streams {
+		keys = append(keys, q.streamIndexKey())
+	}
+	return keys
+}
+
+// streamIDLess 比较两个 stream entry ID（{毫秒}-{序号}）的先后
+func streamIDLess(a, b string) bool {
+	ams, aseq := parseStreamID(a)
+	bms, bseq := parseStreamID(b)
+	if ams != bms {
+		return ams < bms
+	}
+	return aseq < bseq
+}
+
+func parseStreamID(entry string) (ms, seq uint64) {
+	i := strings.IndexByte(entry, '-')
+	if i < 0 {
+		ms, _ = strconv.ParseUint(entry, 10, 64)
+		return ms, 0
+	}
+	ms, _ = strconv.ParseUint(entry[:i], 10, 64)
+	seq, _ = strconv.ParseUint(entry[i+1:], 10, 64)
+	return ms, seq
+}
+
+// pending2StreamScript 将到期的消息从 pending 追加到 ready stream 中
+// KEYS: pendingKey, streamKey, streamIndexKey
+// ARGV: currentTime
+const pending2StreamScript = `
+local msgs = redis.call('ZRangeByScore', KEYS[1], '0', ARGV[1])
+if (#msgs == 0) then return 0 end
+for _, id in ipairs(msgs) do
+	local entry = redis.call('XAdd', KEYS[2], '*', 'id', id)
+	redis.call('HSet', KEYS[3], id, entry)
+end
+redis.call('ZRemRangeByScore', KEYS[1], '0', ARGV[1])
+return #msgs
+`
+
+func (b *redisBroker) pending2Stream(ctx context.Context, now time.Time) (int64, error) {
+	q := b.q
+	var total int64
+	for _, pendingKey := range q.shardKeys(q.pendingKey) {
+		keys := []string{pendingKey, q.streamKey(), q.streamIndexKey()}
+		n, err := q.eval(ctx, pending2StreamScript, keys, now.Unix()).Int64()
+		if err != nil && err != redis.Nil {
+			return total, fmt.Errorf("pending2StreamScript failed: %v", err)
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// stream2UnackScript 确认从 stream 中取出的 entry，并将消息移入 unack
+// 消息已被取消（不在索引中）或已过期时只删除 entry
+// KEYS: streamKey, streamIndexKey, unackKey, attemptKey, msgKey
+// ARGV: group, entry ID, 消息ID, retryTime
+const stream2UnackScript = msgFieldScript + `
+redis.call('XAck', KEYS[1], ARGV[1], ARGV[2])
+redis.call('XDel', KEYS[1], ARGV[2])
+if redis.call('HGet', KEYS[2], ARGV[3]) ~= ARGV[2] then return end
+redis.call('HDel', KEYS[2], ARGV[3])
+if redis.call('Exists', KEYS[5]) == 0 then return end
+redis.call('ZAdd', KEYS[3], ARGV[4], ARGV[3])
+incrField(KEYS[4], ARGV[3], 'attempt', 1)
+return ARGV[3]
+`
+
+// stream2Unack 从 ready stream 中取出一条消息移入 unack，优先接管空闲超过 maxConsumeDuration 的 pending entry
+func (b *redisBroker) stream2Unack(ctx context.Context, deadline time.Time) (string, error) {
+	q := b.q
+	for {
+		entry, err := b.readStream(ctx)
+		if err != nil {
+			return "", err
+		}
+		idStr, _ := entry.Values["id"].(string)
+		keys := []string{q.streamKey(), q.streamIndexKey(), q.unAckKey, q.attemptKey, q.genMsgKey(idStr)}
+		ret, err := q.eval(ctx, stream2UnackScript, keys, streamGroup, entry.ID, idStr, deadline.Unix()).Result()
+		if err == redis.Nil {
+			// 消息已被取消，继续取下一条
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("stream2UnackScript failed: %v", err)
+		}
+		str, ok := ret.(string)
+		if !ok {
+			return "", fmt.Errorf("illegal result: %#v", ret)
+		}
+		return str, nil
+	}
+}
+
+// readStream 从 ready stream 中取出一条 entry，没有 entry 时返回 ErrNoMessage，消费者组不存在时自动创建
+func (b *redisBroker) readStream(ctx context.Context) (redis.XMessage, error) {
+	q := b.q
+	// go-redis 的 XAutoClaim 只能解析 redis 6.2 的返回值，redis 7 多返回了已删除的 entry ID
+	ret, err := q.redisCli.Do(ctx, "XAutoClaim", q.streamKey(), streamGroup, q.consumerID,
+		q.maxConsumeDuration.Milliseconds(), "0-0", "Count", 1).Result()
+	if isNoGroup(err) {
+		err = q.redisCli.XGroupCreateMkStream(ctx, q.streamKey(), streamGroup, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return redis.XMessage{}, fmt.Errorf("create consumer group failed: %v", err)
+		}
+		return b.readStream(ctx)
+	}
+	if err != nil && err != redis.Nil {
+		return redis.XMessage{}, fmt.Errorf("xautoclaim failed: %v", err)
+	}
+	if entry, ok := claimedEntry(ret); ok {
+		return entry, nil
+	}
+	streams, err := q.redisCli.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    streamGroup,
+		Consumer: q.consumerID,
+		Streams:  []string{q.streamKey(), ">"},
+		Count:    1,
+		Block:    -1,
+	}).Result()
+	if err == redis.Nil {
+		return redis.XMessage{}, ErrNoMessage
+	}
+	if err != nil {
+		return redis.XMessage{}, fmt.Errorf("xreadgroup failed: %v", err)
+	}
+	if len(streams) == 0 || len(streams[0].Messages) == 0 {
+		return redis.XMessage{}, ErrNoMessage
+	}
+	return streams[0].Messages[0], nil
+}
+
+// claimedEntry 解析 XAUTOCLAIM 返回的第一条 entry，entry 已被删除时只有 ID
+func claimedEntry(ret interface{}) (redis.XMessage, bool) {
+	reply, ok := ret.([]interface{})
+	if !ok || len(reply) < 2 {
+		return redis.XMessage{}, false
+	}
+	entries, ok := reply[1].([]interface{})
+	if !ok || len(entries) == 0 {
+		return redis.XMessage{}, false
+	}
+	entry, ok := entries[0].([]interface{})
+	if !ok || len(entry) == 0 {
+		return redis.XMessage{}, false
+	}
+	msg := redis.XMessage{Values: make(map[string]interface{})}
+	msg.ID, _ = entry[0].(string)
+	if len(entry) > 1 {
+		fields, _ := entry[1].([]interface{})
+		for i := 0; i+1 < len(fields); i += 2 {
+			key, _ := fields[i].(string)
+			msg.Values[key] = fields[i+1]
+		}
+	}
+	return msg, true
+}
+
+func isNoGroup(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "NOGROUP")
+}
@@ -0,0 +1,244 @@
+package delayqueue
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+func TestDelayQueue_Streams(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	received := make(map[string]int)
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		received[s]++
+		return true
+	}).WithStreams()
+	for _, payload := range []string{"a", "b", "c"} {
+		if err := queue.SendDelayMsg(payload, 0); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	cancelled, err := queue.SendDelayMsgV2("cancelled", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := queue.pending2Ready(); err != nil {
+		t.Error(err)
+		return
+	}
+	stats, err := queue.Stats(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if stats.Ready != 4 {
+		t.Errorf("expect 4 ready messages, actual %d", stats.Ready)
+	}
+	info, err := queue.GetMessage(ctx, cancelled.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if info.State != StageReady {
+		t.Errorf("expect state ready, actual %s", info.State)
+	}
+	if err := queue.Cancel(ctx, cancelled.ID); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(received) != 3 || received["a"] != 1 || received["b"] != 1 || received["c"] != 1 {
+		t.Errorf("unexpected deliveries: %v", received)
+	}
+	if n := redisCli.XLen(ctx, queue.streamKey()).Val(); n != 0 {
+		t.Errorf("expect empty stream, actual %d entries", n)
+	}
+	stats, _ = queue.Stats(ctx)
+	if stats.Ready != 0 || stats.Unack != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestDelayQueue_StreamsClaim(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	var received []string
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		received = append(received, s)
+		return true
+	}).WithStreams().WithConsumerID("alive").WithMaxConsumeDuration(time.Millisecond * 100)
+	if err := queue.SendDelayMsg("foo", 0); err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := queue.pending2Ready(); err != nil {
+		t.Error(err)
+		return
+	}
+	// 模拟取出 entry 后崩溃的消费者
+	redisCli.XGroupCreateMkStream(ctx, queue.streamKey(), streamGroup, "0")
+	err := redisCli.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    streamGroup,
+		Consumer: "crashed",
+		Streams:  []string{queue.streamKey(), ">"},
+		Count:    1,
+		Block:    -1,
+	}).Err()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(received) != 0 {
+		t.Errorf("expect no deliveries before idle timeout, actual %v", received)
+	}
+	time.Sleep(time.Millisecond * 200)
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(received) != 1 || received[0] != "foo" {
+		t.Errorf("expect claimed message delivered, actual %v", received)
+	}
+}
+
+func TestDelayQueue_StreamsExport(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	received := make(map[string]int)
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		received[s]++
+		return true
+	}).WithStreams()
+	for _, payload := range []string{"a", "b"} {
+		if err := queue.SendDelayMsg(payload, 0); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if _, err := queue.pending2Ready(); err != nil {
+		t.Error(err)
+		return
+	}
+	var ready []*MessageInfo
+	cursor := ""
+	for {
+		msgs, next, err := queue.List(ctx, StageReady, cursor, 10)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		ready = append(ready, msgs...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if len(ready) != 2 {
+		t.Errorf("expect 2 ready messages, actual %d", len(ready))
+	}
+	buf := &bytes.Buffer{}
+	n, err := queue.Export(ctx, buf)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if n != 2 {
+		t.Errorf("expect 2 exported messages, actual %d", n)
+	}
+	if err := queue.Purge(ctx); err != nil {
+		t.Error(err)
+		return
+	}
+	n, err = queue.Import(ctx, buf)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if n != 2 {
+		t.Errorf("expect 2 imported messages, actual %d", n)
+	}
+	report, err := queue.Verify(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if report.Checked != 2 || !report.OK() {
+		t.Errorf("unexpected verify report: %+v", report)
+	}
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(received) != 2 || received["a"] != 1 || received["b"] != 1 {
+		t.Errorf("unexpected deliveries: %v", received)
+	}
+}
+
+func TestDelayQueue_StreamsRequeueDead(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	fail := true
+	received := 0
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		received++
+		return !fail
+	}).WithStreams().WithDeadLetter(time.Hour).WithMaxConsumeDuration(0)
+	msg, err := queue.SendDelayMsgV2("dead", 0, WithRetryCount(0))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for i := 0; i < 3; i++ {
+		if err := queue.consume(); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	info, err := queue.GetMessage(ctx, msg.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if info.State != StageDead {
+		t.Errorf("expect state dead, actual %s", info.State)
+		return
+	}
+	fail = false
+	n, err := queue.RequeueDead(ctx, msg.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if n != 1 {
+		t.Errorf("expect 1 requeued message, actual %d", n)
+	}
+	info, err = queue.GetMessage(ctx, msg.ID)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if info.State != StageReady {
+		t.Errorf("expect state ready, actual %s", info.State)
+	}
+	received = 0
+	if _, err := queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	if received != 1 {
+		t.Errorf("expect requeued message to be delivered, actual %d", received)
+	}
+}
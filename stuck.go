@@ -0,0 +1,172 @@
+package delayqueue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 消息被判定为卡住的原因
+const (
+	StuckRedelivered = "redelivered" // 在检测窗口内被反复投递，可能是每次都处理失败或超时的毒消息
+	StuckOverdue     = "overdue"     // 超过处理超时时间很久仍留在 unack 中，可能所有消费者都已停止
+)
+
+// StuckMessage 被判定为卡住的消息
+type StuckMessage struct {
+	ID       string
+	Reason   string
+	Attempts int       // 检测窗口内当前实例投递的次数，Reason 为 StuckRedelivered 时有效
+	Deadline time.Time // 处理超时时间，Reason 为 StuckOverdue 时有效
+}
+
+// StuckDetection WithStuckDetection 的配置
+type StuckDetection struct {
+	// MaxAttempts 当前实例在 Window 内投递同一条消息的次数超过该值时告警，为 0 表示不检查
+	MaxAttempts int
+	// Window 统计投递次数的窗口，同一条消息在 Window 内只告警一次
+	Window time.Duration
+	// MaxOverdue unack 中的消息超过处理超时时间 MaxOverdue 后仍未被重试时告警，为 0 表示不检查
+	MaxOverdue time.Duration
+}
+
+// stuckDetector 记录当前实例的投递次数并检测卡住的消息
+type stuckDetector struct {
+	cfg        StuckDetection
+	hook       func([]*StuckMessage)
+	mu         sync.Mutex
+	deliveries map[string][]time.Time // 消息ID -> Window 内的投递时间
+	alerted    map[string]time.Time   // 消息ID -> 告警时间，Window 内不重复告警
+	found      []*StuckMessage        // 尚未通知 hook 的消息
+	lastCheck  time.Time              // 上次检查 unack 的时间
+}
+
+// WithStuckDetection 检测卡住的消息，在消费周期结束时通过 hook 通知其ID，用于发现反复失败的毒消息或无人处理的消息
+// hook 在消费协程中同步调用，不应执行耗时操作
+func (q *DelayQueue) WithStuckDetection(cfg StuckDetection, hook func([]*StuckMessage)) *DelayQueue {
+	if q.frozen("WithStuckDetection") {
+		return q
+	}
+	if hook == nil || (cfg.MaxAttempts <= 0 && cfg.MaxOverdue <= 0) {
+		q.stuck = nil
+		return q
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = time.Hour
+	}
+	q.stuck = &stuckDetector{
+		cfg:        cfg,
+		hook:       hook,
+		deliveries: make(map[string][]time.Time),
+		alerted:    make(map[string]time.Time),
+	}
+	return q
+}
+
+// recordDelivery 记录一次投递，投递次数超过上限时加入待通知的消息
+func (d *stuckDetector) recordDelivery(idStr string, now time.Time) {
+	if d.cfg.MaxAttempts <= 0 {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	times := append(d.recent(d.deliveries[idStr], now), now)
+	d.deliveries[idStr] = times
+	if len(times) > d.cfg.MaxAttempts && d.alert(idStr, now) {
+		d.found = append(d.found, &StuckMessage{ID: idStr, Reason: StuckRedelivered, Attempts: len(times)})
+	}
+}
+
+// recent 返回 Window 内的投递时间
+func (d *stuckDetector) recent(times []time.Time, now time.Time) []time.Time {
+	i := 0
+	for i < len(times) && now.Sub(times[i]) > d.cfg.Window {
+		i++
+	}
+	return times[i:]
+}
+
+// alert 返回 Window 内是否尚未告警过，调用时需要持有锁
+func (d *stuckDetector) alert(idStr string, now time.Time) bool {
+	if at, ok := d.alerted[idStr]; ok && now.Sub(at) <= d.cfg.Window {
+		return false
+	}
+	d.alerted[idStr] = now
+	return true
+}
+
+// prune 清理 Window 之前的记录，避免内存持续增长，调用时需要持有锁
+func (d *stuckDetector) prune(now time.Time) {
+	for idStr, times := range d.deliveries {
+		if times = d.recent(times, now); len(times) == 0 {
+			delete(d.deliveries, idStr)
+		} else {
+			d.deliveries[idStr] = times
+		}
+	}
+	for idStr, at := range d.alerted {
+		if now.Sub(at) > d.cfg.Window {
+			delete(d.alerted, idStr)
+		}
+	}
+}
+
+// detectStuck 检查 unack 中超时已久的消息，并将卡住的消息通知 hook
+// unack 每隔 MaxOverdue/2 检查一次
+func (q *DelayQueue) detectStuck() error {
+	d := q.stuck
+	if d == nil {
+		return nil
+	}
+	now := q.clock.Now()
+	var overdue map[string]time.Time
+	var err error
+	if d.cfg.MaxOverdue > 0 && now.Sub(d.lastCheck) >= d.cfg.MaxOverdue/2 {
+		d.lastCheck = now
+		overdue, err = q.broker.Overdue(context.Background(), now.Add(-d.cfg.MaxOverdue))
+	}
+	d.mu.Lock()
+	for idStr, deadline := range overdue {
+		if d.alert(idStr, now) {
+			d.found = append(d.found, &StuckMessage{ID: idStr, Reason: StuckOverdue, Deadline: deadline})
+		}
+	}
+	d.prune(now)
+	found := d.found
+	d.found = nil
+	d.mu.Unlock()
+	if len(found) > 0 {
+		q.logger.Warn("stuck messages detected", "queue", q.name, "count", len(found))
+		d.hook(found)
+	}
+	return err
+}
+
+func (b *redisBroker) Overdue(ctx context.Context, before time.Time) (map[string]time.Time, error) {
+	q := b.q
+	members, err := q.redisCli.ZRangeByScoreWithScores(ctx, q.unAckKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: fmt.Sprintf("%d", before.Unix()),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("get overdue msgs failed: %v", err)
+	}
+	overdue := make(map[string]time.Time, len(members))
+	for _, z := range members {
+		overdue[z.Member.(string)] = time.Unix(int64(z.Score), 0)
+	}
+	return overdue, nil
+}
+
+func (b *memoryBroker) Overdue(ctx context.Context, before time.Time) (map[string]time.Time, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	overdue := make(map[string]time.Time)
+	for _, idStr := range due(b.unack, before) {
+		overdue[idStr] = b.unack[idStr]
+	}
+	return overdue, nil
+}
@@ -0,0 +1,61 @@
+package delayqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_StuckDetection(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	var stuck []*StuckMessage
+	cfg := StuckDetection{MaxAttempts: 2, Window: time.Minute, MaxOverdue: time.Minute}
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return false
+	}).WithDefaultRetryCount(5).WithStuckDetection(cfg, func(msgs []*StuckMessage) {
+		stuck = append(stuck, msgs...)
+	})
+	poison, err := queue.SendDelayMsgV2("poison", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := queue.ProcessOnce(); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if len(stuck) != 1 || stuck[0].ID != poison.ID || stuck[0].Reason != StuckRedelivered || stuck[0].Attempts != 3 {
+		t.Errorf("unexpected stuck messages: %+v", stuck)
+		return
+	}
+
+	// 模拟所有消费者停止后留在 unack 中的消息
+	redisCli.FlushDB(ctx)
+	stuck = nil
+	orphan, err := queue.SendDelayMsgV2("orphan", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err := queue.broker.Pending2Ready(ctx, time.Now()); err != nil {
+		t.Error(err)
+		return
+	}
+	deadline := time.Now().Add(-2 * time.Minute)
+	if _, err := queue.broker.Ready2Unack(ctx, deadline); err != nil {
+		t.Error(err)
+		return
+	}
+	// 跳过 unack 检查的间隔
+	queue.stuck.lastCheck = time.Time{}
+	if err := queue.detectStuck(); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(stuck) != 1 || stuck[0].ID != orphan.ID || stuck[0].Reason != StuckOverdue || stuck[0].Deadline.Unix() != deadline.Unix() {
+		t.Errorf("unexpected stuck messages: %+v", stuck)
+	}
+}
@@ -0,0 +1,222 @@
+package delayqueue
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// WithTags 给消息设置标签，可以通过 CancelByTag 取消、通过 ListByTag 和 CountByTag 查询带有某个标签的消息
+// example: queue.SendDelayMsg(payload, duration, delayqueue.WithTags("account:42"))
+func WithTags(tags ...string) SendOption {
+	return func(c *sendConfig) {
+		c.tags = append(c.tags, tags...)
+	}
+}
+
+// genTagKey sortedset 存储带有标签的消息，member 为消息ID，score 为消息内容的过期时间
+// 已确认的消息不会立即从中移除，查询时根据消息内容是否存在过滤
+func (q *DelayQueue) genTagKey(tag string) string {
+	return q.keyBase(q.name) + ":tag:" + tag
+}
+
+// indexTags 在 pipe 中将消息加入标签索引，并移除已过期的消息
+func (q *DelayQueue) indexTags(ctx context.Context, pipe redis.Pipeliner, msg *MessageInfo, ttl int64) {
+	now := q.clock.Now().Unix()
+	for _, tag := range msg.Tags {
+		key := q.genTagKey(tag)
+		pipe.ZAdd(ctx, key, &redis.Z{Score: float64(now + ttl), Member: msg.ID})
+		pipe.ZRemRangeByScore(ctx, key, "-inf", "("+strconv.FormatInt(now, 10))
+	}
+}
+
+// CancelByTag 取消带有 tag 的所有消息，返回取消的数量，正在处理的消息的处理方式与 Cancel 相同
+func (q *DelayQueue) CancelByTag(ctx context.Context, tag string) (int, error) {
+	ids, err := q.broker.CancelByTag(ctx, tag)
+	for _, idStr := range ids {
+		q.publishCancel(ctx, idStr)
+	}
+	if err != nil {
+		return len(ids), err
+	}
+	q.logger.Info("messages cancelled by tag", "queue", q.name, "tag", tag, "count", len(ids))
+	return len(ids), nil
+}
+
+// cancelByTagBatch CancelByTag 每次从标签索引中取出的消息数量
+const cancelByTagBatch = 500
+
+func (b *redisBroker) CancelByTag(ctx context.Context, tag string) ([]string, error) {
+	q := b.q
+	key := q.genTagKey(tag)
+	var cancelled []string
+	for {
+		ids, err := q.redisCli.ZRange(ctx, key, 0, cancelByTagBatch-1).Result()
+		if err != nil {
+			return cancelled, fmt.Errorf("get tagged messages failed: %v", err)
+		}
+		if len(ids) == 0 {
+			return cancelled, nil
+		}
+		pipe := q.redisCli.Pipeline()
+		results := make([]*redis.Cmd, 0, len(ids))
+		for _, idStr := range ids {
+			results = append(results, q.pipeEval(ctx, pipe, cancelScript, q.cancelKeys(idStr), idStr))
+		}
+		members := make([]interface{}, 0, len(ids))
+		for _, idStr := range ids {
+			members = append(members, idStr)
+		}
+		pipe.ZRem(ctx, key, members...)
+		_, err = pipe.Exec(ctx)
+		if err != nil {
+			return cancelled, fmt.Errorf("cancel tagged messages failed: %v", err)
+		}
+		for i, result := range results {
+			if found, _ := result.Int(); found > 0 {
+				cancelled = append(cancelled, ids[i])
+			}
+		}
+	}
+}
+
+// ListByTag 分页遍历带有 tag 的消息，cursor 的用法与 List 相同，返回的消息包含所处的阶段
+// 基于 ZSCAN 遍历，count 仅作为参考；已确认、取消或过期的消息不会返回，并会从标签索引中移除
+// 返回的消息内容超过 256 字节时会被截断，完整内容可以通过 GetMessage 查询
+func (q *DelayQueue) ListByTag(ctx context.Context, tag string, cursor string, count int64) (msgs []*MessageInfo, next string, err error) {
+	if err := q.requireRedis("ListByTag"); err != nil {
+		return nil, "", err
+	}
+	if count <= 0 {
+		count = 10
+	}
+	var pos uint64
+	if cursor != "" {
+		pos, err = strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+	}
+	members, nextPos, err := q.redisCli.ZScan(ctx, q.genTagKey(tag), pos, "", count).Result()
+	if err != nil {
+		return nil, "", fmt.Errorf("zscan failed: %v", err)
+	}
+	ids := make([]string, 0, len(members)/2)
+	for i := 0; i < len(members); i += 2 {
+		ids = append(ids, members[i])
+	}
+	msgs, err = q.tagged(ctx, tag, ids)
+	if err != nil {
+		return nil, "", err
+	}
+	if nextPos != 0 {
+		next = strconv.FormatUint(nextPos, 10)
+	}
+	return msgs, next, q.fillPreview(ctx, msgs)
+}
+
+// CountByTag 统计带有 tag 的消息在各阶段的数量，如 stats.Pending 为尚未到投递时间的消息数量
+// 需要遍历整个标签索引，已确认、取消或过期的消息会从标签索引中移除
+func (q *DelayQueue) CountByTag(ctx context.Context, tag string) (*QueueStats, error) {
+	if err := q.requireRedis("CountByTag"); err != nil {
+		return nil, err
+	}
+	stats := &QueueStats{}
+	var pos uint64
+	for {
+		members, nextPos, err := q.redisCli.ZScan(ctx, q.genTagKey(tag), pos, "", cancelByTagBatch).Result()
+		if err != nil {
+			return nil, fmt.Errorf("zscan failed: %v", err)
+		}
+		ids := make([]string, 0, len(members)/2)
+		for i := 0; i < len(members); i += 2 {
+			ids = append(ids, members[i])
+		}
+		msgs, err := q.tagged(ctx, tag, ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range msgs {
+			switch msg.State {
+			case StagePending:
+				stats.Pending++
+			case StageReady:
+				stats.Ready++
+			case StageUnack:
+				stats.Unack++
+			case StageRetry:
+				stats.Retry++
+			case StageGarbage:
+				stats.Garbage++
+			case StageDead:
+				stats.Dead++
+			}
+		}
+		if nextPos == 0 {
+			return stats, nil
+		}
+		pos = nextPos
+	}
+}
+
+// tagged 查询 ids 所处的阶段，不存在的消息从 tag 的索引中移除
+func (q *DelayQueue) tagged(ctx context.Context, tag string, ids []string) ([]*MessageInfo, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	type stageCmds struct {
+		pending, unack, dead *redis.FloatCmd
+		ready, retry         *redis.IntCmd
+		garbage              *redis.BoolCmd
+	}
+	pipe := q.redisCli.Pipeline()
+	cmds := make([]*stageCmds, 0, len(ids))
+	for _, idStr := range ids {
+		shard := q.shardOf(idStr)
+		cmds = append(cmds, &stageCmds{
+			pending: pipe.ZScore(ctx, q.shardKey(q.pendingKey, shard), idStr),
+			ready:   pipe.LPos(ctx, q.shardKey(q.readyKey, shard), idStr, redis.LPosArgs{}),
+			unack:   pipe.ZScore(ctx, q.unAckKey, idStr),
+			retry:   pipe.LPos(ctx, q.retryKey, idStr, redis.LPosArgs{}),
+			garbage: pipe.SIsMember(ctx, q.garbageKey, idStr),
+			dead:    pipe.ZScore(ctx, q.deadKey, idStr),
+		})
+	}
+	_, err := pipe.Exec(ctx)
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("get tagged messages failed: %v", err)
+	}
+	var msgs []*MessageInfo
+	var missing []interface{}
+	for i, c := range cmds {
+		msg := &MessageInfo{ID: ids[i]}
+		switch {
+		case c.pending.Err() == nil:
+			msg.State, msg.Time = StagePending, time.Unix(int64(c.pending.Val()), 0)
+		case c.ready.Err() == nil:
+			msg.State = StageReady
+		case c.unack.Err() == nil:
+			msg.State, msg.Time = StageUnack, time.Unix(int64(c.unack.Val()), 0)
+		case c.retry.Err() == nil:
+			msg.State = StageRetry
+		case c.garbage.Val():
+			msg.State = StageGarbage
+		case c.dead.Err() == nil:
+			msg.State, msg.Time = StageDead, time.Unix(int64(c.dead.Val()), 0)
+		default:
+			missing = append(missing, ids[i])
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	if len(missing) > 0 {
+		err = q.redisCli.ZRem(ctx, q.genTagKey(tag), missing...).Err()
+		if err != nil {
+			return nil, fmt.Errorf("remove stale tagged messages failed: %v", err)
+		}
+	}
+	return msgs, nil
+}
@@ -0,0 +1,112 @@
+package delayqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_CancelByTag(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	var received []string
+	queue := NewDelayQueue("test", redisCli, func(payload string) bool {
+		received = append(received, payload)
+		return true
+	})
+	sends := []struct {
+		payload string
+		delay   time.Duration
+		tags    []string
+	}{
+		{"reminder 1", 0, []string{"account:1"}},
+		{"reminder 2", time.Hour, []string{"account:1", "campaign:42"}},
+		{"reminder 3", 0, []string{"account:2"}},
+	}
+	for _, s := range sends {
+		if err := queue.SendDelayMsg(s.payload, s.delay, WithTags(s.tags...)); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	n, err := queue.CancelByTag(ctx, "account:1")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if n != 2 {
+		t.Errorf("expect 2 messages cancelled, actual %d", n)
+	}
+	if _, err = queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	if len(received) != 1 || received[0] != "reminder 3" {
+		t.Errorf("unexpected received: %v", received)
+	}
+	stats, err := queue.Stats(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if stats.Pending != 0 {
+		t.Errorf("expect no pending message, actual %d", stats.Pending)
+	}
+	if n, _ = queue.CancelByTag(ctx, "account:1"); n != 0 {
+		t.Errorf("expect nothing to cancel, actual %d", n)
+	}
+}
+
+func TestDelayQueue_ListByTag(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	queue := NewDelayQueue("test", redisCli, func(string) bool { return true })
+	for i := 0; i < 3; i++ {
+		if err := queue.SendDelayMsg("later", time.Hour, WithTags("campaign-42")); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	now, err := queue.SendDelayMsgV2("now", 0, WithTags("campaign-42"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if _, err = queue.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	stats, err := queue.CountByTag(ctx, "campaign-42")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if stats.Pending != 3 || stats.Ready+stats.Unack+stats.Retry != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	var listed []*MessageInfo
+	cursor := ""
+	for {
+		msgs, next, err := queue.ListByTag(ctx, "campaign-42", cursor, 2)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		listed = append(listed, msgs...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if len(listed) != 3 {
+		t.Errorf("expect 3 tagged messages, actual %d", len(listed))
+	}
+	for _, msg := range listed {
+		if msg.ID == now.ID || msg.State != StagePending || msg.Payload != "later" {
+			t.Errorf("unexpected message: %+v", msg)
+		}
+	}
+	if n := redisCli.ZCard(ctx, queue.genTagKey("campaign-42")).Val(); n != 3 {
+		t.Errorf("expect acked message removed from tag index, actual %d members", n)
+	}
+}
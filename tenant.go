@@ -0,0 +1,167 @@
+package delayqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrTenantQuotaExceeded 租户所有队列中 pending 与 ready 的消息数量已达到 WithMaxPending 配置的上限
+var ErrTenantQuotaExceeded = errors.New("tenant quota exceeded")
+
+// Tenant 租户，同一租户的队列使用 dp:tenant:{id}: 作为 key 前缀，与其它租户的同名队列互相隔离
+// 用于向多个客户提供定时任务的平台，可以限制每个租户的消息数量并统计租户的所有队列
+type Tenant struct {
+	id         string
+	redisCli   *redis.Client
+	maxPending uint
+
+	mu     sync.Mutex
+	queues map[string]*DelayQueue // 当前进程中通过 Queue 创建的队列
+}
+
+// TenantStats 租户的消息数量统计
+type TenantStats struct {
+	Queues map[string]*QueueStats `json:"queues"` // 各队列中各阶段的消息数量
+	Total  QueueStats             `json:"total"`  // 所有队列的合计
+}
+
+// NewTenant 创建租户，id 不能为空
+func NewTenant(id string, redisCli *redis.Client) *Tenant {
+	if id == "" {
+		panic("tenant id is required")
+	}
+	if redisCli == nil {
+		panic("redis client is required")
+	}
+	return &Tenant{
+		id:       id,
+		redisCli: redisCli,
+		queues:   make(map[string]*DelayQueue),
+	}
+}
+
+// WithMaxPending 配置租户所有队列中 pending 与 ready 的消息数量之和的上限，为 0 表示不限制
+// 达到上限后发送返回 ErrTenantQuotaExceeded，多个生产者并发发送时上限是近似的
+// 每次发送都会统计租户的所有队列，队列数量较多时会增加发送的耗时
+func (t *Tenant) WithMaxPending(n uint) *Tenant {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.maxPending = n
+	return t
+}
+
+// ID 返回租户ID
+func (t *Tenant) ID() string {
+	return t.id
+}
+
+// Prefix 返回租户队列的 key 前缀
+func (t *Tenant) Prefix() string {
+	return DefaultKeyPrefix + "tenant:" + t.id + ":"
+}
+
+// registryKey set 存储租户的队列名称
+func (t *Tenant) registryKey() string {
+	return DefaultKeyPrefix + "tenants:" + t.id
+}
+
+// Queue 创建租户的队列，队列名称记录在 redis 中，用于统计和配额检查
+// 返回的队列不应再调用 WithKeyPrefix
+func (t *Tenant) Queue(name string, callback func(string) bool) *DelayQueue {
+	return t.register(NewDelayQueue(name, t.redisCli, callback))
+}
+
+// QueueWithHandler 使用 Handler 创建租户的队列
+func (t *Tenant) QueueWithHandler(name string, handler Handler) *DelayQueue {
+	return t.register(NewDelayQueueWithHandler(name, t.redisCli, handler))
+}
+
+func (t *Tenant) register(q *DelayQueue) *DelayQueue {
+	q.WithKeyPrefix(t.Prefix())
+	q.tenant = t
+	t.mu.Lock()
+	t.queues[q.name] = q
+	t.mu.Unlock()
+	err := t.redisCli.SAdd(context.Background(), t.registryKey(), q.name).Err()
+	if err != nil {
+		q.logger.Error("register tenant queue failed", "tenant", t.id, "queue", q.name, "error", err)
+	}
+	return q
+}
+
+// Queues 返回租户的所有队列名称，包括其它进程创建的队列
+func (t *Tenant) Queues(ctx context.Context) ([]string, error) {
+	names, err := t.redisCli.SMembers(ctx, t.registryKey()).Result()
+	if err != nil {
+		return nil, fmt.Errorf("get tenant queues failed: %v", err)
+	}
+	t.mu.Lock()
+	for name := range t.queues {
+		names = append(names, name)
+	}
+	t.mu.Unlock()
+	sort.Strings(names)
+	result := names[:0]
+	for i, name := range names {
+		if i == 0 || name != names[i-1] {
+			result = append(result, name)
+		}
+	}
+	return result, nil
+}
+
+// queue 返回统计用的队列，当前进程中未创建的队列使用默认配置（未分片）
+func (t *Tenant) queue(name string) *DelayQueue {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if q, ok := t.queues[name]; ok {
+		return q
+	}
+	return newDelayQueue(name, t.redisCli).WithKeyPrefix(t.Prefix())
+}
+
+// Stats 统计租户所有队列中各阶段的消息数量，使用消费组时只统计未使用消费组的队列
+func (t *Tenant) Stats(ctx context.Context) (*TenantStats, error) {
+	names, err := t.Queues(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stats := &TenantStats{Queues: make(map[string]*QueueStats, len(names))}
+	for _, name := range names {
+		s, err := t.queue(name).Stats(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("get stats of %s failed: %v", name, err)
+		}
+		stats.Queues[name] = s
+		stats.Total.Pending += s.Pending
+		stats.Total.Ready += s.Ready
+		stats.Total.Unack += s.Unack
+		stats.Total.Retry += s.Retry
+		stats.Total.Garbage += s.Garbage
+		stats.Total.Dead += s.Dead
+	}
+	return stats, nil
+}
+
+// admit 检查租户是否还能容纳 n 条消息
+func (t *Tenant) admit(ctx context.Context, n int) error {
+	t.mu.Lock()
+	maxPending := t.maxPending
+	t.mu.Unlock()
+	if maxPending == 0 {
+		return nil
+	}
+	stats, err := t.Stats(ctx)
+	if err != nil {
+		return err
+	}
+	if stats.Total.Pending+stats.Total.Ready+int64(n) > int64(maxPending) {
+		return ErrTenantQuotaExceeded
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package delayqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTenant(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	callback := func(s string) bool {
+		return true
+	}
+	acme := NewTenant("acme", redisCli).WithMaxPending(3)
+	orders := acme.Queue("orders", callback)
+	mails := acme.Queue("mails", callback)
+	// 其它租户的同名队列互不影响
+	other := NewTenant("other", redisCli).Queue("orders", callback)
+	if err := other.SendDelayMsg("other", time.Hour); err != nil {
+		t.Error(err)
+		return
+	}
+	for i := 0; i < 2; i++ {
+		if err := orders.SendDelayMsg("order", time.Hour); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	if err := mails.SendDelayMsg("mail", 0); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := mails.SendDelayMsg("mail", 0); err != ErrTenantQuotaExceeded {
+		t.Errorf("expect ErrTenantQuotaExceeded, actual %v", err)
+	}
+	stats, err := acme.Stats(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if stats.Total.Pending != 3 || stats.Queues["orders"].Pending != 2 || stats.Queues["mails"].Pending != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	// 消费后腾出配额
+	if _, err := mails.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	if err := mails.SendDelayMsg("mail", 0); err != nil {
+		t.Error(err)
+	}
+	// 其它进程创建的租户对象可以看到所有队列
+	names, err := NewTenant("acme", redisCli).Queues(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(names) != 2 || names[0] != "mails" || names[1] != "orders" {
+		t.Errorf("unexpected queues: %v", names)
+	}
+}
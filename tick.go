@@ -0,0 +1,195 @@
+package delayqueue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// WithSingleScriptTick 每个消费周期只执行一个 lua 脚本完成 pending2Ready、unack2Retry 和批量 ready/retry -> unack，
+// 脚本返回本周期需要投递的消息，减少与 redis 的往返次数，各阶段之间也不会被其它消费者插入操作
+// 每个周期至多取出 fetchLimit 条消息（ready 和 retry 合计），按 WithRetryOrder 决定 ready 和 retry 的先后，取出后一起交给 Handler 处理；
+// 启用 WithPartitions、WithStreams、RetryInterleave 或实例只负责调度或投递（WithRole）时仍按原有方式分阶段执行，仅支持 redis
+func (q *DelayQueue) WithSingleScriptTick() *DelayQueue {
+	if q.frozen("WithSingleScriptTick") {
+		return q
+	}
+	if q.redisCli == nil {
+		q.invalidOption("WithSingleScriptTick", "single script tick requires redis")
+		return q
+	}
+	q.singleTick = true
+	return q
+}
+
+// tickEnabled 返回本消费周期是否使用单个脚本
+func (q *DelayQueue) tickEnabled() bool {
+	return q.singleTick && q.schedules() && q.works() && q.partitions == nil && !q.streams &&
+		q.retryOrder != RetryInterleave
+}
+
+// tickScript 依次将到期的消息从 pending 移入 ready、将处理超时的消息从 unack 移入 retry 或 garbage，
+// 再从 ready 各分片（轮流）和 retry 中取出至多 limit 条消息移入 unack
+// KEYS: unackKey, retryCountKey, retryKey, garbageKey, attemptKey, 之后每个分片依次为 pendingKey, readyKey
+// ARGV: currentTime, retryTime, limit(为 0 时不取出消息，小于 0 时不限制), 是否优先取出 retry('1'/'0'), 投递历史 key 前缀
+// 返回 {进入ready的数量, 进入retry的数量, 进入garbage的数量, 从ready取出的消息, 从retry取出的消息}
+const tickScript = recordHistoryScript + msgFieldScript + pending2ReadyFuncScript + unack2RetryFuncScript + `
+local now, left = ARGV[1], tonumber(ARGV[3])
+local moved = 0
+for i = 6, #KEYS, 2 do
+	moved = moved + pending2Ready(KEYS[i], KEYS[i + 1], now)
+end
+local retried, dropped = unack2Retry(KEYS[1], KEYS[2], KEYS[3], KEYS[4], KEYS[5], now, ARGV[5])
+local function pop(key, ids)
+	local msg = redis.call('RPop', key)
+	if not msg then return false end
+	redis.call('ZAdd', KEYS[1], ARGV[2], msg)
+	incrField(KEYS[5], msg, 'attempt', 1)
+	table.insert(ids, msg)
+	left = left - 1
+	return true
+end
+local ready, retry = {}, {}
+local function popReady()
+	local popped = true
+	while popped and left ~= 0 do
+		popped = false
+		for i = 7, #KEYS, 2 do
+			if left == 0 then break end
+			if pop(KEYS[i], ready) then popped = true end
+		end
+	end
+end
+local function popRetry()
+	while left ~= 0 and pop(KEYS[3], retry) do end
+end
+if ARGV[4] == '1' then
+	popRetry()
+	popReady()
+else
+	popReady()
+	popRetry()
+end
+return {moved, retried, dropped, ready, retry}
+`
+
+// tickResult tickScript 的执行结果
+type tickResult struct {
+	pending2Ready int64
+	unack2Retry   int64
+	unack2Garbage int64
+	ready         []string // 从 ready 取出的消息
+	retry         []string // 从 retry 取出的消息
+}
+
+// consumeTick 以单个脚本完成本消费周期的消息流转，并投递取出的消息，各阶段的错误记录到 errs 中
+func (q *DelayQueue) consumeTick(errs *consumeErrors) {
+	deliver, err := q.canDeliver()
+	errs.add(err)
+	fetchLimit, concurrent := q.consumeLimits()
+	if q.BreakerState() == BreakerHalfOpen {
+		fetchLimit, concurrent = 1, 1
+	}
+	limit := int64(0)
+	if deliver {
+		n, ok, err := q.backpressureLimit(fetchLimit)
+		errs.add(err)
+		if ok {
+			limit = int64(n)
+			if n == 0 {
+				limit = -1
+			}
+		}
+	}
+	// 限流时预先获取令牌，未取出消息的令牌在脚本执行后归还
+	if limit != 0 && q.limiter != nil {
+		tokens := int64(0)
+		for (limit < 0 || tokens < limit) && q.limiter.allow(q.clock.Now()) {
+			tokens++
+		}
+		limit = tokens
+	}
+	now := q.clock.Now()
+	deadline := now.Add(q.maxConsumeDuration)
+	ret, err := q.runTick(context.Background(), now, deadline, limit)
+	if err != nil {
+		errs.add(err)
+		ret = &tickResult{}
+	}
+	q.flow.add(&q.flow.pending2Ready, ret.pending2Ready)
+	q.debugFlow(StagePending, StageReady, ret.pending2Ready)
+	q.flow.add(&q.flow.unack2Retry, ret.unack2Retry)
+	q.flow.add(&q.flow.unack2Garbage, ret.unack2Garbage)
+	q.incCounter(MetricRetried, ret.unack2Retry)
+	q.incCounter(MetricDead, ret.unack2Garbage)
+	q.debugFlow(StageUnack, StageRetry, ret.unack2Retry)
+	q.debugFlow(StageUnack, StageGarbage, ret.unack2Garbage)
+	q.flow.add(&q.flow.ready2Unack, int64(len(ret.ready)))
+	q.flow.add(&q.flow.retry2Unack, int64(len(ret.retry)))
+	for _, idStr := range ret.ready {
+		q.debugTransition(idStr, StageReady, StageUnack)
+	}
+	for _, idStr := range ret.retry {
+		q.debugTransition(idStr, StageRetry, StageUnack)
+	}
+	if q.limiter != nil && limit > 0 {
+		for i := int64(len(ret.ready) + len(ret.retry)); i < limit; i++ {
+			q.limiter.refund()
+		}
+	}
+	var ids []string
+	if q.retryOrder == RetryFirst {
+		ids = append(ret.retry, ret.ready...)
+	} else {
+		ids = append(ret.ready, ret.retry...)
+	}
+	if len(ids) > 0 {
+		q.batchCallback(ids, concurrent, deadline)
+	}
+	errs.add(q.garbageCollect())
+	errs.add(q.detectStuck())
+}
+
+// runTick 执行 tickScript，limit 为 0 时不取出消息，小于 0 时不限制
+func (q *DelayQueue) runTick(ctx context.Context, now, deadline time.Time, limit int64) (*tickResult, error) {
+	keys := []string{q.unAckKey, q.retryCountKey, q.retryKey, q.garbageKey, q.attemptKey}
+	// 每个周期从不同的分片开始轮流取出，避免消息总是先从第一个分片取出
+	start := q.nextShard()
+	for i := uint(0); i < q.shards; i++ {
+		shard := (start + i) % q.shards
+		keys = append(keys, q.shardKey(q.pendingKey, shard), q.shardKey(q.readyKey, shard))
+	}
+	retryFirst := "0"
+	if q.retryOrder == RetryFirst {
+		retryFirst = "1"
+	}
+	ret, err := q.eval(ctx, tickScript, keys, now.Unix(), deadline.Unix(), limit, retryFirst, q.historyPrefix()).Result()
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("tickScript failed: %v", err)
+	}
+	reply, ok := ret.([]interface{})
+	if !ok || len(reply) != 5 {
+		return nil, fmt.Errorf("illegal result: %#v", ret)
+	}
+	result := &tickResult{}
+	result.pending2Ready, _ = reply[0].(int64)
+	result.unack2Retry, _ = reply[1].(int64)
+	result.unack2Garbage, _ = reply[2].(int64)
+	result.ready = scriptIDs(reply[3])
+	result.retry = scriptIDs(reply[4])
+	return result, nil
+}
+
+// scriptIDs 将 lua 脚本返回的数组转换为消息ID
+func scriptIDs(v interface{}) []string {
+	values, _ := v.([]interface{})
+	ids := make([]string, 0, len(values))
+	for _, value := range values {
+		if idStr, ok := value.(string); ok {
+			ids = append(ids, idStr)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,130 @@
+package delayqueue
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// evalCounter 统计引用了指定 key 的脚本执行次数
+type evalCounter struct {
+	key string
+	mu  sync.Mutex
+	n   int
+}
+
+func (c *evalCounter) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	args := cmd.Args()
+	if name, _ := args[0].(string); name != "eval" && name != "evalsha" {
+		return ctx, nil
+	}
+	for _, arg := range args {
+		if arg == c.key {
+			c.mu.Lock()
+			c.n++
+			c.mu.Unlock()
+			break
+		}
+	}
+	return ctx, nil
+}
+
+func (c *evalCounter) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+func (c *evalCounter) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (c *evalCounter) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+func TestDelayQueue_SingleScriptTick(t *testing.T) {
+	redisCli := newTestRedis(t)
+	var mu sync.Mutex
+	received := make(map[string]bool)
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		received[s] = true
+		return true
+	}).WithShards(2).WithFetchLimit(2).WithConcurrent(2).WithSingleScriptTick()
+	for _, payload := range []string{"a", "b", "c"} {
+		if err := queue.SendDelayMsg(payload, 0); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	counter := &evalCounter{key: queue.unAckKey}
+	redisCli.AddHook(counter)
+	flow, err := queue.ProcessOnce()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if flow != (FlowStats{Pending2Ready: 3, Ready2Unack: 2, Unack2Ack: 2}) {
+		t.Errorf("unexpected flow: %+v", flow)
+	}
+	// 一个脚本完成全部流转，其余脚本为逐条确认消息
+	if counter.n != 1+2 {
+		t.Errorf("expected 3 scripts, got %d", counter.n)
+	}
+	flow, err = queue.ProcessOnce()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if flow != (FlowStats{Ready2Unack: 1, Unack2Ack: 1}) {
+		t.Errorf("unexpected flow of second cycle: %+v", flow)
+	}
+	if len(received) != 3 {
+		t.Errorf("unexpected received: %v", received)
+	}
+}
+
+func TestDelayQueue_SingleScriptTickRetry(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	var received []string
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		received = append(received, s)
+		return true
+	}).WithSingleScriptTick().WithDefaultRetryCount(1)
+	for _, payload := range []string{"timeout", "dead"} {
+		msg, err := queue.SendDelayMsgV2(payload, 0)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		// 模拟处理超时的消息
+		redisCli.ZRem(ctx, queue.pendingKey, msg.ID)
+		redisCli.ZAdd(ctx, queue.unAckKey, &redis.Z{Score: 1, Member: msg.ID})
+		if payload == "dead" {
+			redisCli.HSet(ctx, queue.retryCountKey, msg.ID, 0)
+		}
+	}
+	flow, err := queue.ProcessOnce()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	// 超时的消息在同一个脚本中移入 retry 并被取出投递
+	if flow != (FlowStats{Unack2Retry: 1, Unack2Garbage: 1, Retry2Unack: 1, Unack2Ack: 1}) {
+		t.Errorf("unexpected flow: %+v", flow)
+	}
+	if len(received) != 1 || received[0] != "timeout" {
+		t.Errorf("unexpected received: %v", received)
+	}
+	n, err := redisCli.SCard(ctx, queue.garbageKey).Result()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if n != 0 {
+		t.Errorf("garbage should be collected, %d left", n)
+	}
+}
@@ -0,0 +1,164 @@
+package delayqueue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Topic 将发布的消息按路由键分发到所有绑定的队列，绑定关系保存在 redis 中，所有发布者共享
+type Topic struct {
+	name        string
+	prefix      string
+	redisCli    *redis.Client
+	clock       Clock
+	bindingsKey string //hash 存储绑定关系 field为队列名称，value为 topicBinding
+}
+
+// topicBinding 队列与 Topic 的绑定关系
+type topicBinding struct {
+	Pattern string `json:"pattern"`
+	Shards  uint   `json:"shards"`
+}
+
+// NewTopic 创建 Topic
+func NewTopic(name string, redisCli *redis.Client) *Topic {
+	if name == "" {
+		panic("name is required")
+	}
+	if redisCli == nil {
+		panic("redis client is required")
+	}
+	t := &Topic{
+		name:     name,
+		redisCli: redisCli,
+		clock:    realClock{},
+	}
+	return t.WithKeyPrefix(DefaultKeyPrefix)
+}
+
+// WithKeyPrefix 自定义 key 前缀，需要与绑定的队列使用的前缀相同
+func (t *Topic) WithKeyPrefix(prefix string) *Topic {
+	t.prefix = prefix
+	t.bindingsKey = prefix + "topic:" + t.name + ":bindings"
+	return t
+}
+
+// WithClock 自定义时钟，用于计算 PublishDelay 的投递时间及发送到各队列时的过期时间
+func (t *Topic) WithClock(clock Clock) *Topic {
+	t.clock = clock
+	return t
+}
+
+// Bind 将队列绑定到 Topic，路由键与 pattern 匹配的消息会发送到该队列
+// pattern 由 "." 分隔的单词组成，"*" 匹配一个单词，"#" 匹配零个或多个单词，如 "order.*"、"order.#"
+// 同一个队列只能绑定一个 pattern，重复绑定会覆盖之前的 pattern
+func (t *Topic) Bind(ctx context.Context, queue *DelayQueue, pattern string) error {
+	value, err := json.Marshal(&topicBinding{Pattern: pattern, Shards: queue.shards})
+	if err != nil {
+		return err
+	}
+	err = t.redisCli.HSet(ctx, t.bindingsKey, queue.baseName, value).Err()
+	if err != nil {
+		return fmt.Errorf("bind queue failed: %v", err)
+	}
+	return nil
+}
+
+// Unbind 解除队列与 Topic 的绑定
+func (t *Topic) Unbind(ctx context.Context, queueName string) error {
+	err := t.redisCli.HDel(ctx, t.bindingsKey, queueName).Err()
+	if err != nil {
+		return fmt.Errorf("unbind queue failed: %v", err)
+	}
+	return nil
+}
+
+// Bindings 返回绑定到 Topic 的队列名称及其 pattern
+func (t *Topic) Bindings(ctx context.Context) (map[string]string, error) {
+	bindings, err := t.bindings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]string, len(bindings))
+	for name, binding := range bindings {
+		result[name] = binding.Pattern
+	}
+	return result, nil
+}
+
+func (t *Topic) bindings(ctx context.Context) (map[string]*topicBinding, error) {
+	values, err := t.redisCli.HGetAll(ctx, t.bindingsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("get bindings failed: %v", err)
+	}
+	bindings := make(map[string]*topicBinding, len(values))
+	for name, value := range values {
+		binding := &topicBinding{}
+		if err := json.Unmarshal([]byte(value), binding); err != nil {
+			continue
+		}
+		bindings[name] = binding
+	}
+	return bindings, nil
+}
+
+// Publish 将消息发送到路由键匹配的所有队列，在 t 时刻投递，返回每个队列收到的消息，按队列名称排序
+// opts 与 SendScheduleMsg 相同，发送到某个队列失败时返回已发送的消息及错误
+func (t *Topic) Publish(ctx context.Context, routingKey string, payload string, at time.Time, opts ...SendOption) ([]*MessageInfo, error) {
+	bindings, err := t.bindings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(bindings))
+	for name, binding := range bindings {
+		if matchRoutingKey(binding.Pattern, routingKey) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	msgs := make([]*MessageInfo, 0, len(names))
+	for _, name := range names {
+		q := newDelayQueue(name, t.redisCli).WithKeyPrefix(t.prefix).WithShards(bindings[name].Shards).WithClock(t.clock)
+		msg, err := q.SendScheduleMsgV2(payload, at, opts...)
+		if err != nil {
+			return msgs, fmt.Errorf("publish to queue %s failed: %v", name, err)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// PublishDelay 将消息发送到路由键匹配的所有队列，在 duration 之后投递
+func (t *Topic) PublishDelay(ctx context.Context, routingKey string, payload string, duration time.Duration, opts ...SendOption) ([]*MessageInfo, error) {
+	return t.Publish(ctx, routingKey, payload, t.clock.Now().Add(duration), opts...)
+}
+
+// matchRoutingKey 判断路由键是否与 pattern 匹配
+func matchRoutingKey(pattern, key string) bool {
+	return matchWords(strings.Split(pattern, "."), strings.Split(key, "."))
+}
+
+func matchWords(pattern, words []string) bool {
+	if len(pattern) == 0 {
+		return len(words) == 0
+	}
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(words); i++ {
+			if matchWords(pattern[1:], words[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(words) > 0 && matchWords(pattern[1:], words[1:])
+	default:
+		return len(words) > 0 && pattern[0] == words[0] && matchWords(pattern[1:], words[1:])
+	}
+}
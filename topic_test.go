@@ -0,0 +1,95 @@
+package delayqueue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMatchRoutingKey(t *testing.T) {
+	cases := []struct {
+		pattern string
+		key     string
+		expect  bool
+	}{
+		{"order.created", "order.created", true},
+		{"order.created", "order.paid", false},
+		{"order.*", "order.created", true},
+		{"order.*", "order.created.v2", false},
+		{"order.#", "order", true},
+		{"order.#", "order.created.v2", true},
+		{"#.created", "order.created", true},
+		{"#", "anything.at.all", true},
+	}
+	for _, c := range cases {
+		if actual := matchRoutingKey(c.pattern, c.key); actual != c.expect {
+			t.Errorf("expect match(%s, %s) = %v, actual %v", c.pattern, c.key, c.expect, actual)
+		}
+	}
+}
+
+func TestTopic_Publish(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	newQueue := func(name string) *DelayQueue {
+		return NewDelayQueue(name, redisCli, func(s string) bool {
+			return true
+		}).WithShards(2)
+	}
+	billing, audit, shipping := newQueue("billing"), newQueue("audit"), newQueue("shipping")
+	topic := NewTopic("events", redisCli)
+	for q, pattern := range map[*DelayQueue]string{billing: "order.created", audit: "#", shipping: "order.paid"} {
+		if err := topic.Bind(ctx, q, pattern); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	msgs, err := topic.PublishDelay(ctx, "order.created", "hello", 0)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(msgs) != 2 {
+		t.Errorf("expect published to 2 queues, actual %d", len(msgs))
+	}
+	for q, expect := range map[*DelayQueue]int64{billing: 1, audit: 1, shipping: 0} {
+		stats, err := q.Stats(ctx)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if stats.Pending != expect {
+			t.Errorf("expect %d messages in queue %s, actual %d", expect, q.name, stats.Pending)
+		}
+	}
+	if err := topic.Unbind(ctx, "audit"); err != nil {
+		t.Error(err)
+	}
+	bindings, _ := topic.Bindings(ctx)
+	if len(bindings) != 2 || bindings["billing"] != "order.created" {
+		t.Errorf("unexpected bindings: %v", bindings)
+	}
+}
+
+func TestTopic_PublishDelayClock(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	clock := &driftingClock{}
+	clock.skew.Store(int64(-24 * time.Hour))
+	queue := NewDelayQueue("billing", redisCli, func(s string) bool {
+		return true
+	}).WithClock(clock)
+	topic := NewTopic("events", redisCli).WithClock(clock)
+	if err := topic.Bind(ctx, queue, "#"); err != nil {
+		t.Error(err)
+		return
+	}
+	msgs, err := topic.PublishDelay(ctx, "order.created", "hello", time.Hour)
+	if err != nil || len(msgs) != 1 {
+		t.Errorf("expect published to 1 queue, actual %d, err: %v", len(msgs), err)
+		return
+	}
+	if diff := msgs[0].Time.Sub(clock.Now().Add(time.Hour)); diff < -time.Second || diff > time.Second {
+		t.Errorf("expect deliver at %s, actual %s", clock.Now().Add(time.Hour), msgs[0].Time)
+	}
+}
@@ -0,0 +1,60 @@
+package delayqueue
+
+import "errors"
+
+// ErrInvalidPayload 消息内容未通过 Validator 的校验，可以使用 errors.Is 判断
+var ErrInvalidPayload = errors.New("invalid payload")
+
+// Validator 在保存消息之前校验消息内容，返回 error 表示拒绝发送
+type Validator interface {
+	Validate(payload string) error
+}
+
+// ValidatorFunc 将函数转换为 Validator
+type ValidatorFunc func(payload string) error
+
+// Validate 调用 f(payload)
+func (f ValidatorFunc) Validate(payload string) error {
+	return f(payload)
+}
+
+// ValidationError Validator 拒绝消息时返回给发送方的错误，Err 为 Validator 返回的错误
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid payload: " + e.Err.Error()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Is 使 errors.Is(err, ErrInvalidPayload) 返回 true
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidPayload
+}
+
+// WithValidator 在发送消息时校验消息内容，未通过校验的消息不会保存，发送方法返回 *ValidationError，
+// 避免格式错误的消息在消费者处反复重试
+// 校验在所有 UseSend 注册的拦截器之后执行，即校验拦截器修改后的消息内容；SendSpread 中有消息未通过校验时该批次不会发送
+func (q *DelayQueue) WithValidator(v Validator) *DelayQueue {
+	if q.frozen("WithValidator") {
+		return q
+	}
+	q.validator = v
+	return q
+}
+
+// validate 使用 Validator 校验消息内容
+func (q *DelayQueue) validate(msg *PendingMessage) error {
+	if q.validator == nil {
+		return nil
+	}
+	if err := q.validator.Validate(msg.Payload); err != nil {
+		q.debugLog("message rejected by validator", "id", msg.ID, "error", err)
+		return &ValidationError{Err: err}
+	}
+	return nil
+}
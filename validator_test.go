@@ -0,0 +1,43 @@
+package delayqueue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestDelayQueue_WithValidator(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	errNotJSON := errors.New("not json")
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	}).WithValidator(ValidatorFunc(func(payload string) error {
+		if !json.Valid([]byte(payload)) {
+			return errNotJSON
+		}
+		return nil
+	}))
+	if err := queue.SendDelayMsg(`{"order":1}`, 0); err != nil {
+		t.Error(err)
+		return
+	}
+	err := queue.SendDelayMsg("{order", 0)
+	var validationErr *ValidationError
+	if !errors.Is(err, ErrInvalidPayload) || !errors.As(err, &validationErr) || validationErr.Err != errNotJSON {
+		t.Errorf("expected validation error, got %v", err)
+	}
+	sent, err := queue.SendSpread(ctx, []string{`{}`, "{order"}, queue.clock.Now(), 0)
+	if !errors.Is(err, errNotJSON) || len(sent) != 0 {
+		t.Errorf("expected spread rejected, got %v, %v", sent, err)
+	}
+	stats, err := queue.Stats(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if stats.Pending != 1 {
+		t.Errorf("only valid message should be stored, stats %+v", stats)
+	}
+}
@@ -0,0 +1,173 @@
+package delayqueue
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 违反的约束类型
+const (
+	// ViolationMissingPayload pending、ready、unack 或 retry 中的消息没有消息内容
+	ViolationMissingPayload = "missing_payload"
+	// ViolationMissingRetryCount pending、ready、unack 或 retry 中的消息没有重试次数
+	ViolationMissingRetryCount = "missing_retry_count"
+	// ViolationDuplicateState 同一条消息同时出现在多个阶段中
+	ViolationDuplicateState = "duplicate_state"
+)
+
+// Violation 一条违反约束的记录
+type Violation struct {
+	ID   string `json:"id"`
+	Kind string `json:"kind"`
+	// States 消息所处的阶段
+	States []string `json:"states"`
+}
+
+// VerifyReport Verify 的检查结果
+type VerifyReport struct {
+	// Checked 检查的消息数量
+	Checked    int         `json:"checked"`
+	Violations []Violation `json:"violations"`
+}
+
+// OK 是否没有违反任何约束
+func (r *VerifyReport) OK() bool {
+	return len(r.Violations) == 0
+}
+
+// needsPayload 处于该阶段的消息必须有消息内容和重试次数
+func needsPayload(stage string) bool {
+	switch stage {
+	case StagePending, StageReady, StageUnack, StageRetry:
+		return true
+	}
+	return false
+}
+
+// Verify 检查队列数据是否满足以下约束，不修改任何数据：
+//   - pending、ready、unack 和 retry 中的消息都有消息内容和重试次数
+//   - 同一条消息只出现在一个阶段中
+//
+// 可以通过 Repair 修复缺少消息内容的消息
+func (q *DelayQueue) Verify(ctx context.Context) (*VerifyReport, error) {
+	if err := q.requireRedis("Verify"); err != nil {
+		return nil, err
+	}
+	snapshot, err := q.snapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(snapshot.members))
+	for idStr := range snapshot.members {
+		ids = append(ids, idStr)
+	}
+	sort.Strings(ids)
+	hasRetryCount := make(map[string]bool, len(snapshot.retryCounts))
+	for _, idStr := range snapshot.retryCounts {
+		hasRetryCount[idStr] = true
+	}
+
+	report := &VerifyReport{Checked: len(ids)}
+	var candidates []string
+	for _, idStr := range ids {
+		keys := snapshot.members[idStr]
+		if len(keys) > 1 {
+			report.Violations = append(report.Violations, Violation{
+				ID:     idStr,
+				Kind:   ViolationDuplicateState,
+				States: snapshot.statesOf(idStr),
+			})
+			continue
+		}
+		if needsPayload(snapshot.stages[keys[0]]) {
+			candidates = append(candidates, idStr)
+		}
+	}
+
+	pipe := q.redisCli.Pipeline()
+	exists := make(map[string]*redis.IntCmd, len(candidates))
+	retryCounts := make(map[string]*redis.BoolCmd)
+	for _, idStr := range candidates {
+		exists[idStr] = pipe.Exists(ctx, q.genMsgKey(idStr))
+		if q.hashStorage {
+			retryCounts[idStr] = q.retryCountExists(ctx, pipe, idStr)
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("check payload failed: %v", err)
+	}
+	for _, idStr := range candidates {
+		missingPayload := exists[idStr].Val() == 0
+		missingRetryCount := !hasRetryCount[idStr]
+		if q.hashStorage {
+			// 消息的 HASH 不存在时只视为缺少消息内容
+			missingRetryCount = !missingPayload && !retryCounts[idStr].Val()
+		}
+		if !missingPayload && !missingRetryCount {
+			continue
+		}
+		// 快照之后消息可能已被确认或取消，再次确认以避免误报
+		key := snapshot.members[idStr][0]
+		missingPayload, missingRetryCount, err = q.recheck(ctx, idStr, key, snapshot.stages[key])
+		if err != nil {
+			return nil, err
+		}
+		if missingPayload {
+			report.Violations = append(report.Violations, Violation{
+				ID:     idStr,
+				Kind:   ViolationMissingPayload,
+				States: snapshot.statesOf(idStr),
+			})
+		}
+		if missingRetryCount {
+			report.Violations = append(report.Violations, Violation{
+				ID:     idStr,
+				Kind:   ViolationMissingRetryCount,
+				States: snapshot.statesOf(idStr),
+			})
+		}
+	}
+	return report, nil
+}
+
+// recheck 在同一个事务中检查消息是否仍在 key 中，以及是否缺少消息内容和重试次数
+// 消息已不在 key 中时不视为违反约束
+func (q *DelayQueue) recheck(ctx context.Context, idStr, key, stage string) (missingPayload, missingRetryCount bool, err error) {
+	pipe := q.redisCli.TxPipeline()
+	var member redis.Cmder
+	switch stage {
+	case StagePending, StageUnack:
+		member = pipe.ZScore(ctx, key, idStr)
+	case StageReady, StageRetry:
+		if q.streams && key == q.streamIndexKey() {
+			member = pipe.HGet(ctx, key, idStr)
+			break
+		}
+		member = pipe.LPos(ctx, key, idStr, redis.LPosArgs{})
+	}
+	payload := pipe.Exists(ctx, q.genMsgKey(idStr))
+	retryCount := q.retryCountExists(ctx, pipe, idStr)
+	_, err = pipe.Exec(ctx)
+	if err != nil && err != redis.Nil {
+		return false, false, fmt.Errorf("check message failed: %v", err)
+	}
+	if member.Err() != nil {
+		return false, false, nil
+	}
+	missingPayload = payload.Val() == 0
+	return missingPayload, !retryCount.Val() && !(q.hashStorage && missingPayload), nil
+}
+
+// statesOf 返回消息所处的阶段
+func (s *queueSnapshot) statesOf(idStr string) []string {
+	keys := s.members[idStr]
+	states := make([]string, len(keys))
+	for i, key := range keys {
+		states[i] = s.stages[key]
+	}
+	sort.Strings(states)
+	return states
+}
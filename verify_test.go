@@ -0,0 +1,57 @@
+package delayqueue
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_Verify(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	})
+	var ids []string
+	for i := 0; i < 4; i++ {
+		msg, err := queue.SendDelayMsgV2("payload", time.Hour)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		ids = append(ids, msg.ID)
+	}
+	report, err := queue.Verify(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !report.OK() || report.Checked != len(ids) {
+		t.Errorf("unexpected report: %+v", *report)
+		return
+	}
+
+	redisCli.Del(ctx, queue.genMsgKey(ids[0]))
+	redisCli.HDel(ctx, queue.retryCountKey, ids[1])
+	redisCli.RPush(ctx, queue.readyKey, ids[2])
+	report, err = queue.Verify(ctx)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expect := map[string]Violation{
+		ids[0]: {ID: ids[0], Kind: ViolationMissingPayload, States: []string{StagePending}},
+		ids[1]: {ID: ids[1], Kind: ViolationMissingRetryCount, States: []string{StagePending}},
+		ids[2]: {ID: ids[2], Kind: ViolationDuplicateState, States: []string{StagePending, StageReady}},
+	}
+	if len(report.Violations) != len(expect) {
+		t.Errorf("expect %d violations, actual %+v", len(expect), report.Violations)
+		return
+	}
+	for _, v := range report.Violations {
+		if !reflect.DeepEqual(v, expect[v.ID]) {
+			t.Errorf("unexpected violation: %+v", v)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package delayqueue
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// HeaderPayloadVersion 启用 WithPayloadVersion 时记录消息内容格式版本的 header，没有该 header 的消息视为版本 0
+const HeaderPayloadVersion = "delayqueue-payload-version"
+
+// PayloadUpgrade 将消息内容从某个版本升级到下一个版本
+type PayloadUpgrade func(payload string) (string, error)
+
+// WithPayloadVersion 设置当前代码使用的消息内容格式版本，发送的消息在 header 中记录该版本
+// 投递时，旧版本的消息内容通过 RegisterPayloadUpgrade 注册的函数逐级升级到当前版本后再交给 Handler，
+// 使部署之前写入的长延时消息在部署后仍然可以被消费；缺少升级函数、升级失败或版本高于当前版本（如回滚部署）的消息视为消费失败
+func (q *DelayQueue) WithPayloadVersion(version int) *DelayQueue {
+	if q.frozen("WithPayloadVersion") {
+		return q
+	}
+	q.payloadVersion = version
+	return q
+}
+
+// RegisterPayloadUpgrade 注册将 from 版本的消息内容升级为 from+1 版本的函数
+func (q *DelayQueue) RegisterPayloadUpgrade(from int, upgrade PayloadUpgrade) *DelayQueue {
+	if q.frozen("RegisterPayloadUpgrade") {
+		return q
+	}
+	if q.payloadUpgrades == nil {
+		q.payloadUpgrades = make(map[int]PayloadUpgrade)
+	}
+	q.payloadUpgrades[from] = upgrade
+	return q
+}
+
+// payloadVersionOf 返回消息内容的版本
+func payloadVersionOf(headers map[string]string) (int, error) {
+	v, ok := headers[HeaderPayloadVersion]
+	if !ok {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("illegal payload version %q", v)
+	}
+	return version, nil
+}
+
+// upgradePayload 将消息内容升级到当前版本，Headers 中的版本保持为发送时的版本
+func (q *DelayQueue) upgradePayload(msg *Message) error {
+	if q.payloadVersion == 0 && len(q.payloadUpgrades) == 0 {
+		return nil
+	}
+	version, err := payloadVersionOf(msg.Headers)
+	if err != nil {
+		return err
+	}
+	if version > q.payloadVersion {
+		return fmt.Errorf("payload version %d is newer than %d", version, q.payloadVersion)
+	}
+	for ; version < q.payloadVersion; version++ {
+		upgrade, ok := q.payloadUpgrades[version]
+		if !ok {
+			return fmt.Errorf("no upgrade registered for payload version %d", version)
+		}
+		msg.Payload, err = upgrade(msg.Payload)
+		if err != nil {
+			return fmt.Errorf("upgrade payload from version %d failed: %v", version, err)
+		}
+	}
+	return nil
+}
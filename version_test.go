@@ -0,0 +1,46 @@
+package delayqueue
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestDelayQueue_PayloadVersion(t *testing.T) {
+	redisCli := newTestRedis(t)
+	noop := func(s string) bool { return true }
+	legacy := NewDelayQueue("test", redisCli, noop)
+	v1 := NewDelayQueue("test", redisCli, noop).WithPayloadVersion(1)
+	v3 := NewDelayQueue("test", redisCli, noop).WithPayloadVersion(3)
+	for _, send := range []func() error{
+		func() error { return legacy.SendDelayMsg("bob", 0) },
+		func() error { return v1.SendDelayMsg("name:alice", 0) },
+		func() error { return v3.SendDelayMsg("from the future", 0, WithRetryCount(0)) },
+	} {
+		if err := send(); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+	var received []string
+	consumer := NewDelayQueueWithHandler("test", redisCli, func(ctx context.Context, msg *Message) error {
+		received = append(received, msg.Payload)
+		return nil
+	}).WithPayloadVersion(2).
+		RegisterPayloadUpgrade(0, func(payload string) (string, error) {
+			return "name:" + payload, nil
+		}).
+		RegisterPayloadUpgrade(1, func(payload string) (string, error) {
+			return strings.ToUpper(payload), nil
+		})
+	if _, err := consumer.ProcessOnce(); err != nil {
+		t.Error(err)
+		return
+	}
+	// 版本高于当前版本的消息视为消费失败，不会交给 Handler
+	sort.Strings(received)
+	if strings.Join(received, ",") != "NAME:ALICE,NAME:BOB" {
+		t.Errorf("unexpected received: %v", received)
+	}
+}
@@ -0,0 +1,79 @@
+package delayqueue
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// WithWakeup 发送在 window 内到期的消息后，通过 Pub/Sub 频道 {prefix}{name}:wakeup 发布消息的投递时间，
+// 订阅该频道的消费者在投递时间到达时立即执行一个消费周期，不必等待下一个拉取间隔，用于降低短延时消息的投递延迟
+// 投递时间晚于下一个拉取间隔的通知被忽略；通知可能丢失，此时消息仍在之后的消费周期中投递
+// 生产者和消费者都需要启用，消费组共用同一个频道，仅支持 redis
+func (q *DelayQueue) WithWakeup(window time.Duration) *DelayQueue {
+	if q.frozen("WithWakeup") {
+		return q
+	}
+	if q.redisCli == nil {
+		q.invalidOption("WithWakeup", "wakeup requires redis")
+		return q
+	}
+	q.wakeupWindow = window
+	q.wakeup = make(chan struct{}, 1)
+	return q
+}
+
+// genWakeupChannel 发布即将到期的消息的投递时间的频道，不区分消费组
+func (q *DelayQueue) genWakeupChannel() string {
+	return q.keyBase(q.baseName) + ":wakeup"
+}
+
+// publishWakeup 投递时间在 wakeupWindow 内时通知消费者，通知失败只记录日志
+func (q *DelayQueue) publishWakeup(ctx context.Context, at time.Time) {
+	if q.wakeup == nil || at.Sub(q.clock.Now()) > q.wakeupWindow {
+		return
+	}
+	err := q.redisCli.Publish(ctx, q.genWakeupChannel(), at.UnixMilli()).Err()
+	if err != nil {
+		q.logger.Error("publish wakeup failed", "queue", q.name, "error", err)
+	}
+}
+
+// watchWakeup 订阅唤醒频道直到 stop 关闭，在收到的投递时间到达时唤醒消费协程
+func (q *DelayQueue) watchWakeup(stop <-chan struct{}) {
+	if q.wakeup == nil {
+		return
+	}
+	ctx := context.Background()
+	pubsub := q.redisCli.Subscribe(ctx, q.genWakeupChannel())
+	defer pubsub.Close()
+	ch := pubsub.Channel()
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			ms, err := strconv.ParseInt(msg.Payload, 10, 64)
+			if err != nil {
+				continue
+			}
+			d := time.UnixMilli(ms).Sub(q.clock.Now())
+			if d <= 0 {
+				q.wakeUp()
+			} else if d < q.fetchInterval {
+				time.AfterFunc(d, q.wakeUp)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// wakeUp 唤醒消费协程，已有未处理的唤醒时忽略
+func (q *DelayQueue) wakeUp() {
+	select {
+	case q.wakeup <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,84 @@
+package delayqueue
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDelayQueue_Wakeup(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	received := make(chan string, 1)
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		received <- s
+		return true
+	}).WithFetchInterval(time.Hour).WithWakeup(time.Second)
+	done := queue.StartConsume()
+	defer func() {
+		queue.StopConsume()
+		<-done
+	}()
+	// 等待消费者订阅唤醒频道
+	for i := 0; ; i++ {
+		subs, err := redisCli.PubSubNumSub(ctx, queue.genWakeupChannel()).Result()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if subs[queue.genWakeupChannel()] > 0 {
+			break
+		}
+		if i >= 100 {
+			t.Error("consumer not subscribed")
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := queue.SendDelayMsg("hello", 0); err != nil {
+		t.Error(err)
+		return
+	}
+	// 拉取间隔为一小时，只有被唤醒时才能收到消息
+	select {
+	case s := <-received:
+		if s != "hello" {
+			t.Errorf("unexpected payload: %s", s)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("consumer not woken up")
+	}
+}
+
+func TestDelayQueue_WakeupWindow(t *testing.T) {
+	redisCli := newTestRedis(t)
+	ctx := context.Background()
+	queue := NewDelayQueue("test", redisCli, func(s string) bool {
+		return true
+	}).WithWakeup(time.Minute)
+	pubsub := redisCli.Subscribe(ctx, queue.genWakeupChannel())
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		t.Error(err)
+		return
+	}
+	// 超出 window 的消息不发布通知
+	if err := queue.SendDelayMsg("later", time.Hour); err != nil {
+		t.Error(err)
+		return
+	}
+	msg, err := queue.SendDelayMsgV2("soon", 10*time.Second)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	select {
+	case notify := <-pubsub.Channel():
+		if notify.Payload != strconv.FormatInt(msg.Time.UnixMilli(), 10) {
+			t.Errorf("unexpected wakeup: %s", notify.Payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("wakeup not published")
+	}
+}
@@ -0,0 +1,161 @@
+package delayqueue
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Webhook 将消息以 HTTP POST 推送给非 Go 服务处理，Webhook.Handle 可以作为 Handler 使用:
+//
+//	webhook := delayqueue.NewWebhook("https://example.com/hooks/order").WithSecret(secret)
+//	queue := delayqueue.NewDelayQueueWithHandler("order", redisCli, webhook.Handle)
+//
+// 响应状态码为 2xx 时确认消息；408、429 及 5xx 视为暂时性失败，消息按重试策略重新投递；
+// 其它状态码视为消息无法处理，记录日志后确认消息，不再重试
+type Webhook struct {
+	url     string
+	secret  []byte
+	client  *http.Client
+	timeout time.Duration
+	retry   func(statusCode int) bool
+	logger  Logger
+	clock   Clock
+}
+
+// WebhookBody 推送的请求体
+type WebhookBody struct {
+	ID      string `json:"id"`
+	Payload string `json:"payload"`
+	Attempt int    `json:"attempt"`
+}
+
+// 推送请求的 header
+const (
+	WebhookTimestampHeader = "X-Delayqueue-Timestamp" // unix 秒
+	WebhookSignatureHeader = "X-Delayqueue-Signature" // sha256=<hex(HMAC-SHA256(secret, timestamp + "." + body))>
+)
+
+// NewWebhook 创建推送到 url 的 Webhook，默认超时时间为 10 秒
+func NewWebhook(url string) *Webhook {
+	if url == "" {
+		panic("url is required")
+	}
+	return &Webhook{
+		url:     url,
+		client:  http.DefaultClient,
+		timeout: 10 * time.Second,
+		retry:   defaultWebhookRetry,
+		logger:  NewStdLogger(log.Default()),
+		clock:   realClock{},
+	}
+}
+
+// defaultWebhookRetry 408、429 及 5xx 视为暂时性失败
+func defaultWebhookRetry(statusCode int) bool {
+	return statusCode == http.StatusRequestTimeout || statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// WithSecret 设置签名密钥，设置后请求会携带时间戳及签名，接收方可以使用 VerifyWebhook 验证
+func (w *Webhook) WithSecret(secret string) *Webhook {
+	w.secret = []byte(secret)
+	return w
+}
+
+// WithHTTPClient 自定义 http.Client
+func (w *Webhook) WithHTTPClient(client *http.Client) *Webhook {
+	w.client = client
+	return w
+}
+
+// WithTimeout 自定义单次推送的超时时间，消息的处理超时时间更早时以处理超时时间为准
+func (w *Webhook) WithTimeout(d time.Duration) *Webhook {
+	w.timeout = d
+	return w
+}
+
+// WithRetryStatus 自定义需要重试的非 2xx 状态码
+func (w *Webhook) WithRetryStatus(retry func(statusCode int) bool) *Webhook {
+	w.retry = retry
+	return w
+}
+
+// WithClock 自定义时钟，用于生成签名的时间戳，通常与队列使用同一个 Clock
+func (w *Webhook) WithClock(clock Clock) *Webhook {
+	w.clock = clock
+	return w
+}
+
+// WithLogger 自定义日志，用于记录不再重试的推送
+func (w *Webhook) WithLogger(logger Logger) *Webhook {
+	w.logger = logger
+	return w
+}
+
+// Handle 推送消息，可以作为 Handler 使用
+func (w *Webhook) Handle(ctx context.Context, msg *Message) error {
+	body, _ := json.Marshal(&WebhookBody{ID: msg.ID, Payload: msg.Payload, Attempt: msg.Attempt})
+	if w.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create webhook request failed: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(w.secret) > 0 {
+		timestamp := strconv.FormatInt(w.clock.Now().Unix(), 10)
+		req.Header.Set(WebhookTimestampHeader, timestamp)
+		req.Header.Set(WebhookSignatureHeader, signWebhook(w.secret, timestamp, body))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post webhook failed: %v", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	if w.retry(resp.StatusCode) {
+		return fmt.Errorf("webhook responded %d", resp.StatusCode)
+	}
+	w.logger.Warn("webhook rejected message", "url", w.url, "id", msg.ID, "status", resp.StatusCode)
+	return nil
+}
+
+func signWebhook(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook 验证推送请求的签名，tolerance 为允许的时间戳误差，用于防止重放
+func VerifyWebhook(secret string, timestamp string, signature string, body []byte, tolerance time.Duration) bool {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	diff := time.Since(time.Unix(ts, 0))
+	if diff < 0 {
+		diff = -diff
+	}
+	if tolerance > 0 && diff > tolerance {
+		return false
+	}
+	expected := signWebhook([]byte(secret), timestamp, body)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
@@ -0,0 +1,52 @@
+package delayqueue
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhook(t *testing.T) {
+	var received []*WebhookBody
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !VerifyWebhook("secret", r.Header.Get(WebhookTimestampHeader), r.Header.Get(WebhookSignatureHeader), body, time.Minute) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		msg := &WebhookBody{}
+		_ = json.Unmarshal(body, msg)
+		received = append(received, msg)
+		switch msg.Payload {
+		case "unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "bad request":
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	webhook := NewWebhook(server.URL).WithSecret("secret").WithLogger(NewStdLogger(log.New(io.Discard, "", 0)))
+	ctx := context.Background()
+	cases := map[string]bool{"ok": false, "unavailable": true, "bad request": false}
+	for payload, retry := range cases {
+		err := webhook.Handle(ctx, &Message{ID: payload, Payload: payload, Attempt: 1})
+		if (err != nil) != retry {
+			t.Errorf("payload %s: expect retry %v, actual error: %v", payload, retry, err)
+		}
+	}
+	if len(received) != 3 {
+		t.Errorf("expect 3 verified requests, actual %d", len(received))
+	}
+	wrongSecret := NewWebhook(server.URL).WithSecret("wrong").WithLogger(NewStdLogger(log.New(io.Discard, "", 0)))
+	if err := wrongSecret.Handle(ctx, &Message{ID: "1", Payload: "ok"}); err != nil {
+		t.Errorf("expect 401 not retried, actual: %v", err)
+	}
+	if len(received) != 3 {
+		t.Error("expect request with wrong signature rejected")
+	}
+}